@@ -0,0 +1,344 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// altSvcOrigin 本地 HTTPS 服务，响应头声明 example.com 在 altPort 上提供 HTTP/3
+type altSvcOrigin struct {
+	url      string
+	requests atomic.Int32
+}
+
+// newAltSvcOrigin 启动只支持 HTTP/1.1 的 HTTPS 服务
+func newAltSvcOrigin(t *testing.T, altPort int) *altSvcOrigin {
+	t.Helper()
+	o := &altSvcOrigin{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o.requests.Add(1)
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Alt-Svc", `h3=":`+strconv.Itoa(altPort)+`"; ma=60, h3-29=":443"`)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	o.url = strings.Replace(server.URL, "127.0.0.1", "example.com", 1) + "/"
+	return o
+}
+
+// udpPort 返回 URL 中的端口
+func udpPort(t *testing.T, rawURL string) int {
+	t.Helper()
+	_, port, _ := net.SplitHostPort(strings.TrimSuffix(strings.TrimPrefix(rawURL, "https://"), "/"))
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatalf("无效的端口: %v", err)
+	}
+	return n
+}
+
+// altSvcOptions 返回使用 Chrome 指纹请求 example.com 的选项
+func altSvcOptions(cache *fastls.AltSvcCache, pool *fastls.HTTP3Pool) fastls.Options {
+	options := fastls.Options{
+		Resolver:  &fastls.StaticResolver{Hosts: map[string][]string{"example.com": {"127.0.0.1"}}},
+		AltSvc:    cache,
+		HTTP3Pool: pool,
+		Timeout:   5,
+	}
+	imitate.Chrome(&options)
+	return options
+}
+
+// altSvcRequest 发送请求，返回协议
+func altSvcRequest(t *testing.T, url string, options fastls.Options, method string) string {
+	t.Helper()
+	resp, err := fastls.NewClient().Do(url, options, method)
+	if err != nil {
+		t.Fatalf("%s 请求失败: %v", method, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Status != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("%s 请求应该返回 ok，实际是 %d %q", method, resp.Status, body)
+	}
+	return resp.Protocol
+}
+
+// TestAltSvcUpgrade 测试收到 Alt-Svc 后之后的请求改用 HTTP/3
+func TestAltSvcUpgrade(t *testing.T) {
+	h3 := newH3Server(t)
+	origin := newAltSvcOrigin(t, udpPort(t, h3.url))
+	pool := &fastls.HTTP3Pool{TLSConfig: &tls.Config{RootCAs: h3.roots}}
+	t.Cleanup(pool.Close)
+	options := altSvcOptions(&fastls.AltSvcCache{}, pool)
+
+	if protocol := altSvcRequest(t, origin.url, options, "GET"); protocol != "HTTP/1.1" {
+		t.Errorf("第一个请求应该通过 TCP 发送，实际是 %s", protocol)
+	}
+	for _, method := range []string{"GET", "POST"} {
+		options.Body = "data"
+		if protocol := altSvcRequest(t, origin.url, options, method); protocol != "HTTP/3.0" {
+			t.Errorf("%s 请求应该升级到 HTTP/3，实际是 %s", method, protocol)
+		}
+	}
+	if origin.requests.Load() != 1 || h3.conns.Load() != 1 {
+		t.Errorf("升级后的请求应该复用 QUIC 连接，实际 TCP 请求 %d 个，QUIC 连接 %d 个", origin.requests.Load(), h3.conns.Load())
+	}
+	if method, _, _ := h3.last(); method != "POST" {
+		t.Errorf("HTTP/3 服务应该收到 POST，实际是 %s", method)
+	}
+
+	// 没有 AltSvc 时不升级
+	options = altSvcOptions(nil, pool)
+	altSvcRequest(t, origin.url, options, "GET")
+	if protocol := altSvcRequest(t, origin.url, options, "GET"); protocol != "HTTP/1.1" {
+		t.Errorf("未设置 AltSvc 时应该一直使用 TCP，实际是 %s", protocol)
+	}
+}
+
+// TestAltSvcClientHello 测试升级 HTTP/3 的 ClientHello 由 crypto/tls 生成，QUICFingerprint 不改变握手
+func TestAltSvcClientHello(t *testing.T) {
+	var hellos []*tls.ClientHelloInfo
+	for _, fingerprint := range []string{"", "q13d0111h3_1301_000a,000d,002b,002d,0033,0039_0403"} {
+		h3 := newH3Server(t)
+		origin := newAltSvcOrigin(t, udpPort(t, h3.url))
+		pool := &fastls.HTTP3Pool{TLSConfig: &tls.Config{RootCAs: h3.roots}}
+		t.Cleanup(pool.Close)
+		options := altSvcOptions(&fastls.AltSvcCache{}, pool)
+		if fingerprint != "" {
+			options.QUICFingerprint = fastls.Ja4Fingerprint{FingerprintValue: fingerprint}
+		}
+		altSvcRequest(t, origin.url, options, "GET")
+		if protocol := altSvcRequest(t, origin.url, options, "GET"); protocol != "HTTP/3.0" {
+			t.Fatalf("请求应该升级到 HTTP/3，实际是 %s", protocol)
+		}
+		hello := h3.clientHello()
+		if hello == nil {
+			t.Fatal("HTTP/3 服务应该收到 ClientHello")
+		}
+		if hello.ServerName != "example.com" || !slices.Equal(hello.SupportedProtos, []string{"h3"}) || !slices.Equal(hello.SupportedVersions, []uint16{tls.VersionTLS13}) {
+			t.Errorf("ClientHello 应该只提供 TLS 1.3 和 h3，实际 SNI %q，ALPN %v，版本 %x", hello.ServerName, hello.SupportedProtos, hello.SupportedVersions)
+		}
+		hellos = append(hellos, hello)
+	}
+	if !slices.Equal(hellos[0].CipherSuites, hellos[1].CipherSuites) || len(hellos[1].CipherSuites) != 3 {
+		t.Errorf("QUICFingerprint 不应该改变 crypto/tls 的密码套件，实际是 %x 和 %x", hellos[0].CipherSuites, hellos[1].CipherSuites)
+	}
+}
+
+// TestAltSvcBroken 测试 QUIC 连接失败时改用 TCP，并在之后的请求中跳过该端点
+func TestAltSvcBroken(t *testing.T) {
+	h3 := newH3Server(t)
+	origin := newAltSvcOrigin(t, udpPort(t, h3.url))
+	// 没有信任服务端证书，QUIC 握手失败
+	pool := &fastls.HTTP3Pool{}
+	t.Cleanup(pool.Close)
+	logger, logs := newJSONLogger()
+	options := altSvcOptions(&fastls.AltSvcCache{RaceDelay: 5 * time.Second}, pool)
+	options.Logger = logger
+
+	for i := 0; i < 3; i++ {
+		if protocol := altSvcRequest(t, origin.url, options, "GET"); protocol != "HTTP/1.1" {
+			t.Errorf("第 %d 个请求应该通过 TCP 完成，实际是 %s", i+1, protocol)
+		}
+	}
+	if n := strings.Count(logs.String(), "quic broken"); n != 1 || origin.requests.Load() != 3 {
+		t.Errorf("QUIC 失败后应该只尝试一次，实际尝试 %d 次，TCP 请求 %d 个", n, origin.requests.Load())
+	}
+}
+
+// TestAltSvcRace 测试 QUIC 握手在 RaceDelay 内未完成时本次请求改用 TCP
+func TestAltSvcRace(t *testing.T) {
+	// 丢弃所有数据报的 UDP 端点
+	blackhole, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("监听 UDP 失败: %v", err)
+	}
+	t.Cleanup(func() { blackhole.Close() })
+	origin := newAltSvcOrigin(t, blackhole.LocalAddr().(*net.UDPAddr).Port)
+	pool := &fastls.HTTP3Pool{}
+	t.Cleanup(pool.Close)
+	logger, logs := newJSONLogger()
+	options := altSvcOptions(&fastls.AltSvcCache{RaceDelay: 100 * time.Millisecond}, pool)
+	options.Logger = logger
+
+	altSvcRequest(t, origin.url, options, "GET")
+	start := time.Now()
+	if protocol := altSvcRequest(t, origin.url, options, "GET"); protocol != "HTTP/1.1" {
+		t.Errorf("QUIC 握手未完成时应该改用 TCP，实际是 %s", protocol)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("应该在 RaceDelay 后改用 TCP，实际耗时 %v", elapsed)
+	}
+	if !strings.Contains(logs.String(), "quic slower than tcp") || strings.Contains(logs.String(), "quic broken") {
+		t.Errorf("握手慢不应该标记为失败，日志: %s", logs.String())
+	}
+}
+
+// TestAltSvcRaceStalled 测试 QUIC 连接已建立但没有响应时，幂等请求并行通过 TCP 发送，其他请求等待 HTTP/3
+func TestAltSvcRaceStalled(t *testing.T) {
+	h3 := newH3Server(t)
+	origin := newAltSvcOrigin(t, udpPort(t, h3.url))
+	pool := &fastls.HTTP3Pool{TLSConfig: &tls.Config{RootCAs: h3.roots}}
+	t.Cleanup(pool.Close)
+	options := altSvcOptions(&fastls.AltSvcCache{RaceDelay: 100 * time.Millisecond}, pool)
+
+	altSvcRequest(t, origin.url, options, "GET")
+	if protocol := altSvcRequest(t, origin.url, options, "GET"); protocol != "HTTP/3.0" {
+		t.Fatalf("请求应该升级到 HTTP/3，实际是 %s", protocol)
+	}
+	release := make(chan struct{})
+	h3.handle(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = w.Write([]byte("ok"))
+	})
+	closeRelease := sync.OnceFunc(func() { close(release) })
+	t.Cleanup(closeRelease)
+
+	start := time.Now()
+	if protocol := altSvcRequest(t, origin.url, options, "GET"); protocol != "HTTP/1.1" {
+		t.Errorf("HTTP/3 没有响应时 GET 应该使用 TCP 的响应，实际是 %s", protocol)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("应该在 RaceDelay 后并行通过 TCP 发送，实际耗时 %v", elapsed)
+	}
+
+	tcpRequests := origin.requests.Load()
+	time.AfterFunc(300*time.Millisecond, closeRelease)
+	options.Body = "data"
+	if protocol := altSvcRequest(t, origin.url, options, "POST"); protocol != "HTTP/3.0" {
+		t.Errorf("POST 可能已经通过 HTTP/3 发出，应该等待 HTTP/3 的响应，实际是 %s", protocol)
+	}
+	if origin.requests.Load() != tcpRequests {
+		t.Errorf("POST 不应该通过 TCP 重发")
+	}
+}
+
+// TestAltSvcRaceRedirect 测试 HTTP/3 赢得竞速后，落败的 TCP 请求与重定向后的请求并发选择传输层，需使用 -race 运行
+func TestAltSvcRaceRedirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(target.Close)
+	h3 := newH3Server(t)
+	// 第一个请求返回 Alt-Svc，之后的 TCP 请求没有响应，直到被取消
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Alt-Svc", `h3=":`+strconv.Itoa(udpPort(t, h3.url))+`"; ma=60`)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	originURL := strings.Replace(server.URL, "127.0.0.1", "example.com", 1) + "/"
+	pool := &fastls.HTTP3Pool{TLSConfig: &tls.Config{RootCAs: h3.roots}}
+	t.Cleanup(pool.Close)
+	options := altSvcOptions(&fastls.AltSvcCache{RaceDelay: 100 * time.Millisecond}, pool)
+
+	altSvcRequest(t, originURL, options, "GET")
+	if protocol := altSvcRequest(t, originURL, options, "GET"); protocol != "HTTP/3.0" {
+		t.Fatalf("请求应该升级到 HTTP/3，实际是 %s", protocol)
+	}
+	h3.handle(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		http.Redirect(w, r, target.URL+"/next", http.StatusFound)
+	})
+	if protocol := altSvcRequest(t, originURL, options, "GET"); protocol != "HTTP/1.1" {
+		t.Errorf("重定向后的请求应该通过 TCP 发送，实际是 %s", protocol)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("HTTP/3 没有及时响应时应该并行通过 TCP 发送，实际 TCP 请求 %d 个", requests.Load())
+	}
+}
+
+// staticHTTPSRecords 返回固定 HTTPS 记录的 HTTPSRecordResolver
+type staticHTTPSRecords struct {
+	records []fastls.HTTPSRecord
+	names   []string
+}
+
+func (r *staticHTTPSRecords) LookupHTTPS(ctx context.Context, name string) ([]fastls.HTTPSRecord, error) {
+	r.names = append(r.names, name)
+	return r.records, nil
+}
+
+// TestAltSvcHTTPSRecords 测试 DNS HTTPS 记录声明 h3 时第一个请求就使用 HTTP/3
+func TestAltSvcHTTPSRecords(t *testing.T) {
+	h3 := newH3Server(t)
+	pool := &fastls.HTTP3Pool{TLSConfig: &tls.Config{RootCAs: h3.roots}}
+	t.Cleanup(pool.Close)
+	records := &staticHTTPSRecords{records: []fastls.HTTPSRecord{
+		{Priority: 2, Target: "other.example.", ALPN: []string{"h2"}},
+		{Priority: 1, Target: ".", ALPN: []string{"h3", "h2"}, TTL: time.Hour},
+	}}
+	options := altSvcOptions(&fastls.AltSvcCache{HTTPSRecords: records}, pool)
+
+	for i := 0; i < 2; i++ {
+		if protocol := altSvcRequest(t, h3.url, options, "GET"); protocol != "HTTP/3.0" {
+			t.Errorf("第 %d 个请求应该使用 HTTP/3，实际是 %s", i+1, protocol)
+		}
+	}
+	want := "_" + strconv.Itoa(udpPort(t, h3.url)) + "._https.example.com"
+	if len(records.names) != 1 || records.names[0] != want {
+		t.Errorf("应该按 TTL 缓存并查询 %s，实际查询 %v", want, records.names)
+	}
+}
+
+// TestDoHLookupHTTPS 测试通过 DoH 查询和解析 HTTPS 记录
+func TestDoHLookupHTTPS(t *testing.T) {
+	// 优先级 1，目标为 .，alpn=h3,h2，port=8443
+	rdata := []byte{0, 1, 0, 0, 1, 0, 6, 2, 'h', '3', 2, 'h', '2', 0, 3, 0, 2, 0x20, 0xfb}
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		var msg dnsmessage.Message
+		if err != nil || msg.Unpack(query) != nil || len(msg.Questions) != 1 || msg.Questions[0].Type != 65 {
+			http.Error(w, "invalid query", http.StatusBadRequest)
+			return
+		}
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: msg.ID, Response: true},
+			Questions: msg.Questions,
+			Answers: []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: msg.Questions[0].Name, Type: 65, Class: dnsmessage.ClassINET, TTL: 300},
+				Body:   &dnsmessage.UnknownResource{Type: 65, Data: rdata},
+			}},
+		}
+		packed, _ := resp.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(packed)
+	}))
+	t.Cleanup(doh.Close)
+
+	dohOptions := fastls.Options{}
+	imitate.Chrome(&dohOptions)
+	resolver := &fastls.DoHResolver{URL: doh.URL + "/dns-query", Options: dohOptions}
+	records, err := resolver.LookupHTTPS(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("应该返回 1 条记录，实际是 %v", records)
+	}
+	r := records[0]
+	if r.Priority != 1 || r.Target != "." || strings.Join(r.ALPN, ",") != "h3,h2" || r.Port != 8443 || r.TTL != 300*time.Second {
+		t.Errorf("记录解析错误: %+v", r)
+	}
+}
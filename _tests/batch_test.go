@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// newDelayServer 启动一个本地服务，/<n> 等待 n 毫秒后返回 n
+func newDelayServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ms, _ := strconv.Atoi(r.URL.Path[1:])
+		select {
+		case <-time.After(time.Duration(ms) * time.Millisecond):
+		case <-r.Context().Done():
+		}
+		_, _ = w.Write([]byte(r.URL.Path[1:]))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func batchRequests(server *httptest.Server, delays ...int) []fastls.BatchRequest {
+	options := fastls.Options{}
+	imitate.Chrome142(&options)
+	var requests []fastls.BatchRequest
+	for _, ms := range delays {
+		requests = append(requests, fastls.BatchRequest{URL: server.URL + "/" + strconv.Itoa(ms), Method: "GET", Options: options})
+	}
+	return requests
+}
+
+func readResult(t *testing.T, result fastls.BatchResult) string {
+	t.Helper()
+	if result.Err != nil {
+		t.Fatalf("请求 %d 失败: %v", result.Index, result.Err)
+	}
+	defer result.Response.Body.Close()
+	body, _ := io.ReadAll(result.Response.Body)
+	return string(body)
+}
+
+// TestBatchOrdering 测试按提交顺序和按完成顺序返回结果
+func TestBatchOrdering(t *testing.T) {
+	server := newDelayServer(t)
+	delays := []int{150, 0, 80}
+
+	batch := fastls.NewClient().Batch(context.Background(), batchRequests(server, delays...), fastls.BatchOptions{Workers: 3, Ordered: true})
+	var got []string
+	for result := range batch.Results() {
+		got = append(got, readResult(t, result))
+	}
+	if len(got) != 3 || got[0] != "150" || got[1] != "0" || got[2] != "80" {
+		t.Errorf("Ordered 时应该按提交顺序返回，实际是 %v", got)
+	}
+	if p := batch.Progress(); p.Total != 3 || p.Started != 3 || p.Completed != 3 || p.Failed != 0 {
+		t.Errorf("进度错误: %+v", p)
+	}
+
+	batch = fastls.NewClient().Batch(context.Background(), batchRequests(server, delays...), fastls.BatchOptions{Workers: 3})
+	got = nil
+	for result := range batch.Results() {
+		got = append(got, readResult(t, result))
+	}
+	if len(got) != 3 || got[0] != "0" || got[2] != "150" {
+		t.Errorf("默认应该按完成顺序返回，实际是 %v", got)
+	}
+}
+
+// TestBatchWaitBodies 测试所有请求完成后，尚未读取的响应体仍然可以读取
+func TestBatchWaitBodies(t *testing.T) {
+	server := newDelayServer(t)
+	batch := fastls.NewClient().Batch(context.Background(), batchRequests(server, 0, 20, 40), fastls.BatchOptions{Workers: 3})
+	results := batch.Wait()
+	time.Sleep(50 * time.Millisecond)
+	for i, want := range []string{"0", "20", "40"} {
+		if got := readResult(t, results[i]); got != want {
+			t.Errorf("请求 %d 的响应体应该是 %q，实际是 %q", i, want, got)
+		}
+	}
+}
+
+// TestBatchCancel 测试取消后尚未开始的请求返回 context 错误
+func TestBatchCancel(t *testing.T) {
+	server := newDelayServer(t)
+
+	batch := fastls.NewClient().Batch(context.Background(), batchRequests(server, 500, 0, 0, 0), fastls.BatchOptions{Workers: 1})
+	time.AfterFunc(50*time.Millisecond, batch.Cancel)
+	results := batch.Wait()
+	if len(results) != 4 {
+		t.Fatalf("应该返回 4 个结果，实际是 %d", len(results))
+	}
+	for i, result := range results[1:] {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("请求 %d 应该被取消，实际是 %v", i+1, result.Err)
+		}
+	}
+	if p := batch.Progress(); p.Completed != 4 || p.Failed < 3 {
+		t.Errorf("进度错误: %+v", p)
+	}
+}
+
+// TestDoAsync 测试异步发送单个请求
+func TestDoAsync(t *testing.T) {
+	server := newDelayServer(t)
+	options := fastls.Options{}
+	imitate.Chrome142(&options)
+
+	result := <-fastls.NewClient().DoAsync(context.Background(), server.URL+"/10", options, "GET")
+	if got := readResult(t, result); got != "10" {
+		t.Errorf("响应应该是 10，实际是 %q", got)
+	}
+}
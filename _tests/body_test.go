@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// TestJSONAndFormBody 测试 JSON 和表单请求体的内容与 Content-Type
+func TestJSONAndFormBody(t *testing.T) {
+	server := newRedirectServer(t, nil)
+
+	options := fastls.Options{RequestBody: fastls.NewJSONBody(map[string]int{"a": 1})}
+	imitate.Chrome142(&options)
+	resp, err := fastls.NewClient().Do(server.URL+"/echo", options, "POST")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	echoed := decodeEchoedRequest(t, resp)
+	if echoed.Body != `{"a":1}` || echoed.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("JSON 请求体错误: %q %q", echoed.Body, echoed.Headers.Get("Content-Type"))
+	}
+
+	// 字段保持添加顺序，按浏览器规则编码 * 和 ~
+	form := fastls.NewFormBody().Add("z", "a b").Add("a", "*~&").Add("z", "中")
+	options = fastls.Options{RequestBody: form}
+	imitate.Chrome142(&options)
+	resp, err = fastls.NewClient().Do(server.URL+"/echo", options, "POST")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	echoed = decodeEchoedRequest(t, resp)
+	if want := "z=a+b&a=*%7E%26&z=%E4%B8%AD"; echoed.Body != want {
+		t.Errorf("表单应该是 %q，实际是 %q", want, echoed.Body)
+	}
+	if got := echoed.Headers.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+		t.Errorf("表单 Content-Type 错误: %q", got)
+	}
+}
+
+// TestMultipartBody 测试 multipart 请求体的分隔符格式、字段和从磁盘读取的文件
+func TestMultipartBody(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.txt")
+	content := strings.Repeat("line\n", 10000)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	type received struct {
+		ContentType   string
+		ContentLength int64
+		Field         string
+		FileName      string
+		FileType      string
+		File          string
+	}
+	server := newRedirectServer(t, map[string]func(http.ResponseWriter, *http.Request){
+		"/upload": func(w http.ResponseWriter, r *http.Request) {
+			var got received
+			got.ContentType = r.Header.Get("Content-Type")
+			got.ContentLength = r.ContentLength
+			if err := r.ParseMultipartForm(1 << 20); err == nil {
+				got.Field = r.FormValue("title")
+				if file, header, err := r.FormFile("file"); err == nil {
+					data, _ := io.ReadAll(file)
+					got.File = string(data)
+					got.FileName = header.Filename
+					got.FileType = header.Header.Get("Content-Type")
+				}
+			}
+			_ = json.NewEncoder(w).Encode(got)
+		},
+	})
+
+	testCases := map[string]struct {
+		imitate func(*fastls.Options)
+		prefix  string
+	}{
+		"Chrome":  {imitate.Chrome142, "multipart/form-data; boundary=----WebKitFormBoundary"},
+		"Firefox": {imitate.Firefox, "multipart/form-data; boundary=----geckoformboundary"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			body := fastls.NewMultipartBody().AddField("title", "周报").AddFile("file", path)
+			options := fastls.Options{RequestBody: body}
+			tc.imitate(&options)
+			resp, err := fastls.NewClient().Do(server.URL+"/upload", options, "POST")
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			defer resp.Body.Close()
+			var got received
+			if err := resp.DecodeJSON(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(got.ContentType, tc.prefix) {
+				t.Errorf("Content-Type 应该以 %q 开头，实际是 %q", tc.prefix, got.ContentType)
+			}
+			if got.ContentLength <= int64(len(content)) {
+				t.Errorf("应该发送 Content-Length，实际是 %d", got.ContentLength)
+			}
+			if got.Field != "周报" || got.File != content || got.FileName != "report.txt" || got.FileType != "text/plain" {
+				t.Errorf("multipart 内容错误: %q %q %q，文件长度 %d", got.Field, got.FileName, got.FileType, len(got.File))
+			}
+		})
+	}
+}
+
+// TestReaderBodyReplay 测试可 Seek 的 Reader 在 307 重定向时重新发送，只能读一次的 Reader 在 307 和 308 时返回错误
+func TestReaderBodyReplay(t *testing.T) {
+	var echoes atomic.Int32
+	server := newRedirectServer(t, map[string]func(http.ResponseWriter, *http.Request){
+		"/submit": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+			http.Redirect(w, r, "/echo", http.StatusTemporaryRedirect)
+		},
+		"/permanent": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+			http.Redirect(w, r, "/counted", http.StatusPermanentRedirect)
+		},
+		"/counted": func(w http.ResponseWriter, r *http.Request) {
+			echoes.Add(1)
+			_, _ = w.Write([]byte("ok"))
+		},
+	})
+
+	options := fastls.Options{RequestBody: fastls.NewReaderBody(strings.NewReader("binary"), "application/octet-stream")}
+	imitate.Chrome142(&options)
+	resp, err := fastls.NewClient().Do(server.URL+"/submit", options, "PUT")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	echoed := decodeEchoedRequest(t, resp)
+	if echoed.Method != "PUT" || echoed.Body != "binary" {
+		t.Errorf("307 后应该重新发送请求体，实际是 %s %q", echoed.Method, echoed.Body)
+	}
+	if got := echoed.Headers.Get("Content-Type"); got != "application/octet-stream" {
+		t.Errorf("Content-Type 错误: %q", got)
+	}
+
+	// 307 和 308 都不能发送没有请求体的请求
+	for _, path := range []string{"/submit", "/permanent"} {
+		echoes.Store(0)
+		options.RequestBody = fastls.NewReaderBody(io.MultiReader(strings.NewReader("once")), "")
+		_, err = fastls.NewClient().Do(server.URL+path, options, "PUT")
+		if !errors.Is(err, fastls.ErrBodyNotReplayable) {
+			t.Errorf("%s: 只能读一次的请求体重定向时应该返回 ErrBodyNotReplayable，实际是 %v", path, err)
+		}
+		if echoes.Load() != 0 {
+			t.Errorf("%s: 不能重发请求体时不应该跟随重定向", path)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// TestClientHintsBrands 测试 GREASE 品牌列表与真实浏览器一致
+func TestClientHintsBrands(t *testing.T) {
+	testCases := []struct {
+		name      string
+		userAgent string
+		brand     string
+		want      string
+	}{
+		{"Chrome116", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36", "", `"Chromium";v="116", "Not)A;Brand";v="24", "Google Chrome";v="116"`},
+		{"Chrome120", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", "", `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`},
+		{"Chrome142", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36", "", `"Chromium";v="142", "Google Chrome";v="142", "Not_A Brand";v="99"`},
+		{"Edge142", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36 Edg/142.0.0.0", "", `"Chromium";v="142", "Microsoft Edge";v="142", "Not_A Brand";v="99"`},
+		{"Opera101", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Safari/537.36 OPR/101.0.0.0", "", `"Not/A)Brand";v="99", "Opera";v="101", "Chromium";v="115"`},
+		{"Chromium115", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Safari/537.36", "Chromium", `"Chromium";v="115", "Not/A)Brand";v="99"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hints := fastls.NewClientHints(tc.userAgent)
+			if hints == nil {
+				t.Fatal("Chromium 内核的 User-Agent 应该生成 Client Hints")
+			}
+			if tc.brand != "" {
+				hints.Brand = tc.brand
+			}
+			if got := hints.SecChUa(); got != tc.want {
+				t.Errorf("Sec-CH-UA 应该是 %s，实际是 %s", tc.want, got)
+			}
+		})
+	}
+
+	firefox := "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:144.0) Gecko/20100101 Firefox/144.0"
+	if fastls.NewClientHints(firefox) != nil {
+		t.Error("Firefox 不应该生成 Client Hints")
+	}
+}
+
+// TestClientHintsFullVersionList 测试完整版本列表与 User-Agent 一致
+func TestClientHintsFullVersionList(t *testing.T) {
+	hints := fastls.NewClientHints("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36")
+	want := `"Chromium";v="142.0.7444.176", "Google Chrome";v="142.0.7444.176", "Not_A Brand";v="99.0.0.0"`
+	if got := hints.SecChUaFullVersionList(); got != want {
+		t.Errorf("Sec-CH-UA-Full-Version-List 应该是 %s，实际是 %s", want, got)
+	}
+}
+
+// newClientHintsServer 启动一个返回 Accept-CH 的 HTTPS 服务，以 JSON 返回收到的请求头
+func newClientHintsServer(t *testing.T, criticalCH string, requests *int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.Header().Set("Accept-CH", "Sec-CH-UA-Full-Version-List, Sec-CH-UA-Platform-Version, Sec-CH-UA-Arch")
+		if criticalCH != "" {
+			w.Header().Set("Critical-CH", criticalCH)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(r.Header)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestClientHintsAcceptCH 测试默认只发送低熵 hints，收到 Accept-CH 后按 origin 发送高熵 hints
+func TestClientHintsAcceptCH(t *testing.T) {
+	var requests int32
+	server := newClientHintsServer(t, "", &requests)
+
+	options := fastls.Options{}
+	imitate.Chrome142(&options)
+	options.ClientHints = fastls.NewClientHints(options.UserAgent)
+
+	headers := doEcho(t, server.URL, options, "GET")
+	if got := headers.Get("Sec-Ch-Ua"); got != options.ClientHints.SecChUa() {
+		t.Errorf("Sec-CH-UA 应该是 %s，实际是 %s", options.ClientHints.SecChUa(), got)
+	}
+	if got := headers.Get("Sec-Ch-Ua-Platform"); got != `"Windows"` {
+		t.Errorf(`Sec-CH-UA-Platform 应该是 "Windows"，实际是 %s`, got)
+	}
+	for _, key := range []string{"Sec-Ch-Ua-Full-Version-List", "Sec-Ch-Ua-Platform-Version", "Sec-Ch-Ua-Arch"} {
+		if got := headers.Get(key); got != "" {
+			t.Errorf("首次请求不应该发送高熵 hint %s，实际是 %s", key, got)
+		}
+	}
+
+	headers = doEcho(t, server.URL, options, "GET")
+	expected := map[string]string{
+		"Sec-Ch-Ua-Full-Version-List": options.ClientHints.SecChUaFullVersionList(),
+		"Sec-Ch-Ua-Platform-Version":  `"10.0.0"`,
+		"Sec-Ch-Ua-Arch":              `"x86"`,
+	}
+	for key, want := range expected {
+		if got := headers.Get(key); got != want {
+			t.Errorf("%s 应该是 %s，实际是 %s", key, want, got)
+		}
+	}
+	if got := headers.Get("Sec-Ch-Ua-Model"); got != "" {
+		t.Errorf("未请求的 Sec-CH-UA-Model 不应该发送，实际是 %s", got)
+	}
+
+	// 其他 origin 不受影响
+	other := newHeaderEchoServer(t)
+	headers = doEcho(t, other.URL, options, "GET")
+	if got := headers.Get("Sec-Ch-Ua-Full-Version-List"); got != "" {
+		t.Errorf("其他 origin 不应该发送高熵 hints，实际是 %s", got)
+	}
+}
+
+// TestClientHintsCriticalCH 测试 Critical-CH 要求的 hints 未发送时重试一次
+func TestClientHintsCriticalCH(t *testing.T) {
+	var requests int32
+	server := newClientHintsServer(t, "Sec-CH-UA-Platform-Version", &requests)
+
+	options := fastls.Options{}
+	imitate.Chrome142(&options)
+	options.ClientHints = fastls.NewClientHints(options.UserAgent)
+
+	headers := doEcho(t, server.URL, options, "GET")
+	if got := headers.Get("Sec-Ch-Ua-Platform-Version"); got != `"10.0.0"` {
+		t.Errorf(`重试后 Sec-CH-UA-Platform-Version 应该是 "10.0.0"，实际是 %s`, got)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("应该请求 2 次，实际是 %d 次", n)
+	}
+
+	// 已经发送过 Critical-CH 要求的 hints 时不再重试
+	atomic.StoreInt32(&requests, 0)
+	doEcho(t, server.URL, options, "GET")
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("应该请求 1 次，实际是 %d 次", n)
+	}
+}
@@ -0,0 +1,227 @@
+package tests
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encodeBody 按 encodings 的顺序依次压缩 data，与 Content-Encoding 的含义一致
+func encodeBody(t *testing.T, data []byte, encodings ...string) []byte {
+	t.Helper()
+	for _, encoding := range encodings {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch encoding {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "deflate":
+			// 部分服务器发送不带 zlib 头的原始 deflate 数据
+			w, _ = flate.NewWriter(&buf, flate.BestCompression)
+		case "br":
+			w = brotli.NewWriter(&buf)
+		case "zstd":
+			w, _ = zstd.NewWriter(&buf)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data = buf.Bytes()
+	}
+	return data
+}
+
+// newEncodedServer 启动一个本地服务，按 Content-Encoding 压缩后返回 body
+func newEncodedServer(t *testing.T, body []byte, encodings ...string) *httptest.Server {
+	t.Helper()
+	encoded := encodeBody(t, body, encodings...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", strings.Join(encodings, ", "))
+		_, _ = w.Write(encoded)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestDecompressStacked 测试自动解压单层和多层编码，并删除 Content-Encoding
+func TestDecompressStacked(t *testing.T) {
+	want := strings.Repeat("fastls ", 1000)
+	testCases := [][]string{
+		{"gzip"},
+		{"deflate"},
+		{"br"},
+		{"zstd"},
+		{"gzip", "br"},
+		{"zstd", "deflate", "gzip"},
+	}
+	for _, encodings := range testCases {
+		t.Run(strings.Join(encodings, "+"), func(t *testing.T) {
+			server := newEncodedServer(t, []byte(want), encodings...)
+
+			options := fastls.Options{}
+			imitate.Chrome142(&options)
+			resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("读取响应体失败: %v", err)
+			}
+			if string(body) != want {
+				t.Errorf("解压结果错误，长度 %d", len(body))
+			}
+			if !resp.Uncompressed || resp.Headers["Content-Encoding"] != "" || resp.Header.Get("Content-Length") != "" {
+				t.Errorf("解压后应该删除 Content-Encoding 和 Content-Length: %v", resp.Header)
+			}
+		})
+	}
+}
+
+// TestDecompressRawAndNotAdvertised 测试 RawBody 和请求未声明的编码不会被解压
+func TestDecompressRawAndNotAdvertised(t *testing.T) {
+	want := []byte("hello")
+	server := newEncodedServer(t, want, "gzip")
+	encoded := encodeBody(t, want, "gzip")
+
+	options := fastls.Options{RawBody: true}
+	imitate.Chrome142(&options)
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(body, encoded) || resp.Uncompressed || resp.Headers["Content-Encoding"] != "gzip" {
+		t.Errorf("RawBody 时应该返回原始响应体和 Content-Encoding")
+	}
+	if got := fastls.DecompressBody(body, []string{resp.Headers["Content-Encoding"]}, nil); got != string(want) {
+		t.Errorf("DecompressBody 结果错误: %q", got)
+	}
+
+	options = fastls.Options{}
+	imitate.Chrome142(&options)
+	options.Headers["Accept-Encoding"] = "br, gzip;q=0"
+	resp, err = fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(body, encoded) || resp.Uncompressed {
+		t.Errorf("请求未声明 gzip 时不应该解压")
+	}
+}
+
+// TestDecompressSizeLimit 测试解压后的大小超过限制时返回错误
+func TestDecompressSizeLimit(t *testing.T) {
+	server := newEncodedServer(t, make([]byte, 1<<20), "gzip")
+
+	options := fastls.Options{MaxDecompressedSize: 64 << 10}
+	imitate.Chrome142(&options)
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if !errors.Is(err, fastls.ErrDecompressedBodyTooLarge) {
+		t.Fatalf("应该返回 ErrDecompressedBodyTooLarge，实际是 %v", err)
+	}
+	if len(body) != 64<<10 {
+		t.Errorf("超限前应该输出 %d 字节，实际是 %d", 64<<10, len(body))
+	}
+}
+
+// TestDecompressHTTP3Streaming 测试 HTTP/3 响应体流式解压，不等服务端发送完整个响应体
+func TestDecompressHTTP3Streaming(t *testing.T) {
+	server := newH3Server(t)
+	release := make(chan struct{})
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	t.Cleanup(unblock)
+	server.handle(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		_, _ = zw.Write([]byte("first "))
+		_ = zw.Flush()
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = zw.Write([]byte("second"))
+		_ = zw.Close()
+	})
+
+	options := server.options(nil)
+	options.Headers = map[string]string{"Accept-Encoding": "gzip"}
+	resp, err := fastls.NewClient().Do(server.url, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Protocol != "HTTP/3.0" {
+		t.Fatalf("应该通过 HTTP/3 请求，实际是 %s", resp.Protocol)
+	}
+	first := make([]byte, len("first "))
+	if _, err := io.ReadFull(resp.Body, first); err != nil || string(first) != "first " {
+		t.Fatalf("服务端发送完之前应该能读到已解压的部分，实际是 %q %v", first, err)
+	}
+	unblock()
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil || string(rest) != "second" {
+		t.Errorf("剩余的响应体应该是 second，实际是 %q %v", rest, err)
+	}
+	if !resp.Uncompressed {
+		t.Error("响应应该标记为已解压")
+	}
+}
+
+// TestDecompressStdlibStreaming 测试未设置指纹时标准库传输层的响应体同样流式传递
+func TestDecompressStdlibStreaming(t *testing.T) {
+	release := make(chan struct{})
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	t.Cleanup(unblock)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		_, _ = zw.Write([]byte("first "))
+		_ = zw.Flush()
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = zw.Write([]byte("second"))
+		_ = zw.Close()
+	}))
+	t.Cleanup(server.Close)
+
+	options := fastls.Options{Headers: map[string]string{"Accept-Encoding": "gzip"}, Timeout: 5}
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	first := make([]byte, len("first "))
+	if _, err := io.ReadFull(resp.Body, first); err != nil || string(first) != "first " {
+		t.Fatalf("服务端发送完之前应该能读到已解压的部分，实际是 %q %v", first, err)
+	}
+	unblock()
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil || string(rest) != "second" {
+		t.Errorf("剩余的响应体应该是 second，实际是 %q %v", rest, err)
+	}
+}
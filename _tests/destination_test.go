@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// newHeaderEchoServer 启动一个本地服务，以 JSON 返回收到的请求头
+func newHeaderEchoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(r.Header)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// doEcho 发送请求并返回服务端收到的请求头
+func doEcho(t *testing.T, url string, options fastls.Options, method string) http.Header {
+	t.Helper()
+	resp, err := fastls.NewClient().Do(url, options, method)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	var headers http.Header
+	if err := json.NewDecoder(resp.Body).Decode(&headers); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return headers
+}
+
+// TestDestinationFetch 测试 fetch/XHR 请求头
+func TestDestinationFetch(t *testing.T) {
+	server := newHeaderEchoServer(t)
+
+	options := fastls.Options{
+		Headers:     map[string]string{"Referer": "https://www.example.com/page"},
+		Destination: fastls.DestinationEmpty,
+		FetchSite:   fastls.FetchSiteCrossSite,
+	}
+	imitate.Chrome142(&options)
+
+	headers := doEcho(t, server.URL, options, "GET")
+	expected := map[string]string{
+		"Accept":         "*/*",
+		"Sec-Fetch-Dest": "empty",
+		"Sec-Fetch-Mode": "cors",
+		"Sec-Fetch-Site": "cross-site",
+		"Priority":       "u=1, i",
+		"Origin":         "https://www.example.com",
+	}
+	for key, want := range expected {
+		if got := headers.Get(key); got != want {
+			t.Errorf("%s 应该是 %q，实际是 %q", key, want, got)
+		}
+	}
+	for _, key := range []string{"Sec-Fetch-User", "Upgrade-Insecure-Requests"} {
+		if got := headers.Get(key); got != "" {
+			t.Errorf("fetch 请求不应该发送 %s，实际是 %q", key, got)
+		}
+	}
+
+	// 调用方复用的 Headers 不应被修改
+	if options.Headers["Sec-Fetch-Dest"] != "document" {
+		t.Errorf("调用方的 Headers 被修改: Sec-Fetch-Dest=%s", options.Headers["Sec-Fetch-Dest"])
+	}
+}
+
+// TestDestinationKeepsCustomAccept 测试调用方设置的 Accept 不会被覆盖
+func TestDestinationKeepsCustomAccept(t *testing.T) {
+	server := newHeaderEchoServer(t)
+
+	options := fastls.Options{
+		Headers:     map[string]string{"Accept": "application/json"},
+		Destination: fastls.DestinationEmpty,
+	}
+	imitate.Chrome142(&options)
+
+	headers := doEcho(t, server.URL, options, "GET")
+	if got := headers.Get("Accept"); got != "application/json" {
+		t.Errorf("Accept 应该是 application/json，实际是 %q", got)
+	}
+	if got := headers.Get("Sec-Fetch-Site"); got != "same-origin" {
+		t.Errorf("Sec-Fetch-Site 默认应该是 same-origin，实际是 %q", got)
+	}
+	if got := headers.Get("Origin"); got != "" {
+		t.Errorf("同源 GET 请求不应该发送 Origin，实际是 %q", got)
+	}
+}
+
+// TestDestinationPerBrowser 测试各浏览器子资源请求头
+func TestDestinationPerBrowser(t *testing.T) {
+	server := newHeaderEchoServer(t)
+
+	testCases := []struct {
+		name        string
+		imitate     func(*fastls.Options)
+		destination fastls.RequestDestination
+		accept      string
+		mode        string
+		priority    string
+	}{
+		{"Chrome142Image", imitate.Chrome142, fastls.DestinationImage, "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8", "no-cors", "i"},
+		{"Chrome142Style", imitate.Chrome142, fastls.DestinationStyle, "text/css,*/*;q=0.1", "no-cors", "u=0"},
+		{"ChromeScript", imitate.Chrome, fastls.DestinationScript, "*/*", "no-cors", ""},
+		{"FirefoxFetch", imitate.Firefox, fastls.DestinationEmpty, "*/*", "cors", "u=4"},
+		{"FirefoxFont", imitate.Firefox, fastls.DestinationFont, "application/font-woff2;q=1.0,application/font-woff;q=0.9,*/*;q=0.8", "cors", "u=2"},
+		{"SafariImage", imitate.Safari, fastls.DestinationImage, "image/webp,image/avif,image/jxl,image/heic,image/heic-sequence,video/*;q=0.8,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5", "no-cors", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			options := fastls.Options{Destination: tc.destination}
+			tc.imitate(&options)
+
+			headers := doEcho(t, server.URL, options, "GET")
+			if got := headers.Get("Accept"); got != tc.accept {
+				t.Errorf("Accept 应该是 %q，实际是 %q", tc.accept, got)
+			}
+			if got := headers.Get("Sec-Fetch-Dest"); got != string(tc.destination) {
+				t.Errorf("Sec-Fetch-Dest 应该是 %q，实际是 %q", tc.destination, got)
+			}
+			if got := headers.Get("Sec-Fetch-Mode"); got != tc.mode {
+				t.Errorf("Sec-Fetch-Mode 应该是 %q，实际是 %q", tc.mode, got)
+			}
+			if got := headers.Get("Priority"); got != tc.priority {
+				t.Errorf("Priority 应该是 %q，实际是 %q", tc.priority, got)
+			}
+		})
+	}
+}
+
+// TestDestinationIframe 测试 iframe 导航不发送 Sec-Fetch-User
+func TestDestinationIframe(t *testing.T) {
+	server := newHeaderEchoServer(t)
+
+	options := fastls.Options{Destination: fastls.DestinationIframe, FetchSite: fastls.FetchSiteSameSite}
+	imitate.Chrome142(&options)
+
+	headers := doEcho(t, server.URL, options, "GET")
+	if got := headers.Get("Sec-Fetch-Mode"); got != "navigate" {
+		t.Errorf("Sec-Fetch-Mode 应该是 navigate，实际是 %q", got)
+	}
+	if got := headers.Get("Sec-Fetch-User"); got != "" {
+		t.Errorf("iframe 不应该发送 Sec-Fetch-User，实际是 %q", got)
+	}
+	if got := headers.Get("Upgrade-Insecure-Requests"); got != "1" {
+		t.Errorf("Upgrade-Insecure-Requests 应该是 1，实际是 %q", got)
+	}
+}
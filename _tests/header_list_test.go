@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// TestHeaderListJSON 测试有序请求头列表的三种 JSON 形式
+func TestHeaderListJSON(t *testing.T) {
+	want := fastls.HeaderList{
+		{Name: "x-b", Value: "1"},
+		{Name: "X-A", Value: "2"},
+		{Name: "x-b", Value: "3"},
+	}
+	testCases := map[string]string{
+		"对象数组": `{"headerList": [{"name": "x-b", "value": "1"}, {"name": "X-A", "value": "2"}, {"name": "x-b", "value": "3"}]}`,
+		"键值对":  `{"headerList": [["x-b", "1"], ["X-A", "2"], ["x-b", "3"]]}`,
+	}
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var options fastls.Options
+			if err := json.Unmarshal([]byte(data), &options); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(options.HeaderList, want) {
+				t.Errorf("HeaderList 应该是 %v，实际是 %v", want, options.HeaderList)
+			}
+		})
+	}
+
+	// 对象形式按键在 JSON 中出现的顺序解析
+	var options fastls.Options
+	if err := json.Unmarshal([]byte(`{"headerList": {"x-z": "1", "x-a": "2", "x-m": "3"}}`), &options); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range options.HeaderList {
+		names = append(names, f.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"x-z", "x-a", "x-m"}) {
+		t.Errorf("对象形式应该保留键的顺序，实际是 %v", names)
+	}
+	if got := options.HeaderList.Values("X-Z"); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("Values 应该不区分大小写，实际是 %v", got)
+	}
+}
+
+// TestHeaderListRepeated 测试重复请求头、位置和 HTTP/1.1 下 Cookie 的合并
+func TestHeaderListRepeated(t *testing.T) {
+	url, received := newRawRequestServer(t)
+
+	options := fastls.Options{}
+	imitate.Firefox(&options)
+	options.HeaderList.Add("X-Forwarded-For", "10.0.0.1")
+	options.HeaderList.Add("X-Forwarded-For", "10.0.0.2")
+	options.HeaderList.Add("Accept", "application/json")
+	options.HeaderList.Add("Cookie", "a=1")
+	options.HeaderList.Add("Cookie", "b=2")
+
+	resp, err := fastls.NewClient().Do(url, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	lines := <-received
+
+	var forwarded, cookies, accepts []string
+	for _, line := range lines {
+		name, value, _ := strings.Cut(line, ": ")
+		switch strings.ToLower(name) {
+		case "x-forwarded-for":
+			forwarded = append(forwarded, value)
+		case "cookie":
+			cookies = append(cookies, value)
+		case "accept":
+			accepts = append(accepts, value)
+		}
+	}
+	if !reflect.DeepEqual(forwarded, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("X-Forwarded-For 应该按顺序发送两次，实际是 %v", forwarded)
+	}
+	if !reflect.DeepEqual(cookies, []string{"a=1; b=2"}) {
+		t.Errorf("HTTP/1.1 下 Cookie 应该合并为一行，实际是 %v", cookies)
+	}
+	if !reflect.DeepEqual(accepts, []string{"application/json"}) {
+		t.Errorf("HeaderList 应该替换 imitate 设置的 Accept，实际是 %v", accepts)
+	}
+
+	// 列表中的请求头按列表顺序连续排列，放在画像顺序中 Accept 的位置
+	xff := headerIndex(lines, "X-Forwarded-For")
+	accept := headerIndex(lines, "Accept")
+	language := headerIndex(lines, "Accept-Language")
+	if !(xff < accept && accept < language) {
+		t.Errorf("请求头顺序错误: %v", lines)
+	}
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// newRawRequestServer 启动一个本地 TCP 服务，记录收到的原始请求头行（保留顺序和大小写）
+func newRawRequestServer(t *testing.T) (string, <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	lines := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var headers []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				break
+			}
+			headers = append(headers, line)
+		}
+		lines <- headers[1:]
+		_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok"))
+	}()
+	return "http://" + ln.Addr().String(), lines
+}
+
+// headerIndex 返回请求头在原始请求中的位置，key 区分大小写
+func headerIndex(lines []string, key string) int {
+	for i, line := range lines {
+		if strings.HasPrefix(line, key+": ") {
+			return i
+		}
+	}
+	return -1
+}
+
+// TestHeaderOrderFromJSON 测试 JSON 设置的 headerOrder 生效，并保留请求头大小写
+func TestHeaderOrderFromJSON(t *testing.T) {
+	url, received := newRawRequestServer(t)
+
+	var options fastls.Options
+	data := `{
+		"headers": {"x-first": "1", "X-Second": "2", "x-Third": "3"},
+		"headerOrder": ["host", "X-Third", "x-second", "user-agent", "x-first"]
+	}`
+	if err := json.Unmarshal([]byte(data), &options); err != nil {
+		t.Fatal(err)
+	}
+	imitate.Firefox(&options)
+
+	resp, err := fastls.NewClient().Do(url, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	lines := <-received
+
+	order := []string{"x-Third", "X-Second", "User-Agent", "x-first"}
+	last := -1
+	for _, key := range order {
+		i := headerIndex(lines, key)
+		if i < 0 {
+			t.Fatalf("没有找到请求头 %s: %v", key, lines)
+		}
+		if i < last {
+			t.Errorf("请求头 %s 的顺序错误: %v", key, lines)
+		}
+		last = i
+	}
+}
+
+// TestHeaderCasingHTTP1 测试 HTTP/1.1 请求按调用方设置的大小写写出请求头
+func TestHeaderCasingHTTP1(t *testing.T) {
+	url, received := newRawRequestServer(t)
+
+	options := fastls.Options{
+		Headers: map[string]string{"x-lower-case": "1", "user-agent": "ignored"},
+	}
+	imitate.Firefox(&options)
+
+	resp, err := fastls.NewClient().Do(url, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	lines := <-received
+
+	for _, key := range []string{"x-lower-case", "Sec-Fetch-Dest", "Upgrade-Insecure-Requests", "user-agent"} {
+		if headerIndex(lines, key) < 0 {
+			t.Errorf("请求头 %s 的大小写没有保留: %v", key, lines)
+		}
+	}
+	// User-Agent 只发送一次，且值来自 options.UserAgent
+	count := 0
+	for _, line := range lines {
+		if strings.HasPrefix(strings.ToLower(line), "user-agent: ") {
+			count++
+			if line != "user-agent: "+options.UserAgent {
+				t.Errorf("User-Agent 应该是 %s，实际是 %s", options.UserAgent, line)
+			}
+		}
+	}
+	if count != 1 {
+		t.Errorf("User-Agent 应该只发送 1 次，实际是 %d 次: %v", count, lines)
+	}
+}
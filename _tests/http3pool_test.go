@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// h3ConnKey 请求 context 中的 QUIC 连接
+type h3ConnKey struct{}
+
+// h3Server 本地 HTTP/3 服务，统计 QUIC 连接数和最近一次请求的连接状态，记录最近一次握手的 ClientHello
+type h3Server struct {
+	url   string
+	roots *x509.CertPool
+	conns atomic.Int32
+
+	mu       sync.Mutex
+	method   string
+	resumed  bool
+	used0RTT bool
+	hello    *tls.ClientHelloInfo
+	handler  http.HandlerFunc // 不为空时代替默认的 ok 响应
+}
+
+// newH3Server 启动允许 0-RTT 的 HTTP/3 服务，证书对 example.com 有效
+func newH3Server(t *testing.T) *h3Server {
+	t.Helper()
+	certServer := httptest.NewUnstartedServer(nil)
+	certServer.StartTLS()
+	t.Cleanup(certServer.Close)
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("监听 UDP 失败: %v", err)
+	}
+	s := &h3Server{roots: x509.NewCertPool()}
+	s.roots.AddCert(certServer.Certificate())
+	server := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{
+			Certificates: certServer.TLS.Certificates,
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				s.mu.Lock()
+				s.hello = hello
+				s.mu.Unlock()
+				return nil, nil
+			},
+		}),
+		QUICConfig: &quic.Config{Allow0RTT: true},
+		ConnContext: func(ctx context.Context, c *quic.Conn) context.Context {
+			s.conns.Add(1)
+			return context.WithValue(ctx, h3ConnKey{}, c)
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+			state := r.Context().Value(h3ConnKey{}).(*quic.Conn).ConnectionState()
+			s.mu.Lock()
+			s.method, s.resumed, s.used0RTT = r.Method, state.TLS.DidResume, state.Used0RTT
+			handler := s.handler
+			s.mu.Unlock()
+			if handler != nil {
+				handler(w, r)
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		}),
+	}
+	go func() { _ = server.Serve(udpConn) }()
+	t.Cleanup(func() { server.Close() })
+	s.url = "https://example.com:" + strconv.Itoa(udpConn.LocalAddr().(*net.UDPAddr).Port) + "/"
+	return s
+}
+
+// last 返回最近一次请求的方法、连接是否恢复会话和是否使用 0-RTT
+func (s *h3Server) last() (string, bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.method, s.resumed, s.used0RTT
+}
+
+// clientHello 返回最近一次握手的 ClientHello
+func (s *h3Server) clientHello() *tls.ClientHelloInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hello
+}
+
+// handle 设置之后请求的处理函数
+func (s *h3Server) handle(handler http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = handler
+}
+
+// options 返回请求本地服务的选项
+func (s *h3Server) options(pool *fastls.HTTP3Pool) fastls.Options {
+	return fastls.Options{
+		Fingerprint: quicFingerprint,
+		Resolver:    &fastls.StaticResolver{Hosts: map[string][]string{"example.com": {"127.0.0.1"}}},
+		HTTP3Pool:   pool,
+		Timeout:     5,
+	}
+}
+
+// h3Request 发送请求并读完响应体
+func h3Request(t *testing.T, url string, options fastls.Options, method string) fastls.Response {
+	t.Helper()
+	resp, err := fastls.NewClient().Do(url, options, method)
+	if err != nil {
+		t.Fatalf("%s 请求失败: %v", method, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Status != http.StatusOK || string(body) != "ok" || resp.Protocol != "HTTP/3.0" {
+		t.Fatalf("%s 请求应该通过 HTTP/3 返回 ok，实际是 %d %s %q", method, resp.Status, resp.Protocol, body)
+	}
+	return resp
+}
+
+// TestHTTP3Pool 测试 HTTP/3 连接跨请求复用、并发请求多路复用和恢复会话后的 0-RTT
+func TestHTTP3Pool(t *testing.T) {
+	server := newH3Server(t)
+	pool := &fastls.HTTP3Pool{TLSConfig: &tls.Config{RootCAs: server.roots}}
+	t.Cleanup(pool.Close)
+	options := server.options(pool)
+
+	first := h3Request(t, server.url, options, "GET")
+	second := h3Request(t, server.url, options, "GET")
+	if server.conns.Load() != 1 || !second.Timing.ConnReused || second.RemoteAddr != first.RemoteAddr {
+		t.Errorf("第二个请求应该复用连接，实际连接 %d 个，复用 %v", server.conns.Load(), second.Timing.ConnReused)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := fastls.NewClient().Do(server.url, options, "GET"); err == nil {
+				resp.Body.Close()
+			} else {
+				t.Errorf("并发请求失败: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if server.conns.Load() != 1 {
+		t.Errorf("并发请求应该在一个连接上多路复用，实际连接 %d 个", server.conns.Load())
+	}
+
+	pool.CloseIdleConnections()
+	h3Request(t, server.url, options, "GET")
+	if method, resumed, used0RTT := server.last(); server.conns.Load() != 2 || method != "GET" || !resumed || !used0RTT {
+		t.Errorf("新连接应该恢复会话并通过 0-RTT 发送 GET，实际连接 %d 个，恢复 %v，0-RTT %v", server.conns.Load(), resumed, used0RTT)
+	}
+	pool.CloseIdleConnections()
+	options.Body = "data"
+	h3Request(t, server.url, options, "POST")
+	if method, resumed, _ := server.last(); method != "POST" || !resumed {
+		t.Errorf("POST 应该在恢复会话的连接上发送，实际是 %s，恢复 %v", method, resumed)
+	}
+
+	// 指纹或 User-Agent 不同的请求不共享连接和会话票据
+	options = server.options(pool)
+	options.UserAgent = "Mozilla/5.0 other"
+	h3Request(t, server.url, options, "GET")
+	if _, resumed, _ := server.last(); server.conns.Load() != 4 || resumed {
+		t.Errorf("User-Agent 不同时应该建立新连接且不恢复会话，实际连接 %d 个，恢复 %v", server.conns.Load(), resumed)
+	}
+
+	// 每个请求轮换源地址时不跨请求复用连接
+	options = server.options(pool)
+	options.SourcePool = &fastls.SourcePool{Addrs: []string{"127.0.0.1"}}
+	h3Request(t, server.url, options, "GET")
+	h3Request(t, server.url, options, "GET")
+	if server.conns.Load() != 6 {
+		t.Errorf("每个请求轮换源地址时应该新建连接，实际连接 %d 个", server.conns.Load())
+	}
+	options.SourceSession = "session"
+	h3Request(t, server.url, options, "GET")
+	h3Request(t, server.url, options, "GET")
+	if server.conns.Load() != 7 {
+		t.Errorf("同一源地址会话的请求应该复用连接，实际连接 %d 个", server.conns.Load())
+	}
+}
+
+// TestHTTP3PoolDisable0RTT 测试关闭 0-RTT 后仍然恢复会话
+func TestHTTP3PoolDisable0RTT(t *testing.T) {
+	server := newH3Server(t)
+	pool := &fastls.HTTP3Pool{TLSConfig: &tls.Config{RootCAs: server.roots}, Disable0RTT: true}
+	t.Cleanup(pool.Close)
+	options := server.options(pool)
+
+	h3Request(t, server.url, options, "GET")
+	pool.CloseIdleConnections()
+	h3Request(t, server.url, options, "GET")
+	if _, resumed, used0RTT := server.last(); !resumed || used0RTT {
+		t.Errorf("关闭 0-RTT 时新连接应该恢复会话但不使用 0-RTT，实际恢复 %v，0-RTT %v", resumed, used0RTT)
+	}
+}
+
+// TestHTTP3PoolIdleTimeout 测试空闲超时关闭的连接不会导致请求失败
+func TestHTTP3PoolIdleTimeout(t *testing.T) {
+	server := newH3Server(t)
+	pool := &fastls.HTTP3Pool{TLSConfig: &tls.Config{RootCAs: server.roots}, IdleTimeout: 200 * time.Millisecond}
+	t.Cleanup(pool.Close)
+	options := server.options(pool)
+
+	h3Request(t, server.url, options, "GET")
+	time.Sleep(600 * time.Millisecond)
+	resp := h3Request(t, server.url, options, "GET")
+	if server.conns.Load() != 2 || resp.Timing.ConnReused {
+		t.Errorf("空闲超时后应该建立新连接，实际连接 %d 个，复用 %v", server.conns.Load(), resp.Timing.ConnReused)
+	}
+}
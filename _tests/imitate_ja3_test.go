@@ -22,10 +22,9 @@ func TestChromeJa3Fingerprint(t *testing.T) {
 		t.Fatal("Fingerprint 应该是 Ja3Fingerprint 类型")
 	}
 
-	// Chrome 使用 shuffleExtension，所以指纹值会变化
-	// 但应该包含固定的前缀和后缀
+	// Chrome 指向最新的 Chrome 画像，应该包含固定的前缀和后缀
 	expectedPrefix := "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,"
-	expectedSuffix := ",29-23-24,0"
+	expectedSuffix := ",4588-29-23-24,0"
 
 	if !strings.HasPrefix(ja3.FingerprintValue, expectedPrefix) {
 		t.Errorf("JA3 指纹应该以 %s 开头，实际是 %s", expectedPrefix, ja3.FingerprintValue)
@@ -266,10 +265,10 @@ func TestOperaJa3Fingerprint(t *testing.T) {
 		t.Fatal("Fingerprint 应该是 Ja3Fingerprint 类型")
 	}
 
-	// Opera 使用 Chrome 的指纹格式（使用 shuffleExtension，所以值会变化）
-	// 但应该包含固定的前缀和后缀
+	// Opera 使用 Chrome 的指纹格式（最新的 Chrome 画像）
+	// 应该包含固定的前缀和后缀
 	expectedPrefix := "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,"
-	expectedSuffix := ",29-23-24,0"
+	expectedSuffix := ",4588-29-23-24,0"
 
 	if !strings.HasPrefix(ja3.FingerprintValue, expectedPrefix) {
 		t.Errorf("JA3 指纹应该以 %s 开头，实际是 %s", expectedPrefix, ja3.FingerprintValue)
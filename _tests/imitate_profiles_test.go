@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+)
+
+// profileGolden 对应 testdata/profiles 下由 profilegen 生成的 golden 文件
+type profileGolden struct {
+	Function            string            `json:"function"`
+	FingerprintType     string            `json:"fingerprintType"`
+	Fingerprint         string            `json:"fingerprint"`
+	Shuffled            bool              `json:"shuffled"`
+	QUICFingerprint     string            `json:"quicFingerprint"`
+	HTTP2SettingsString string            `json:"http2SettingsString"`
+	UserAgent           string            `json:"userAgent"`
+	Headers             map[string]string `json:"headers"`
+	HeaderOrderKeys     []string          `json:"headerOrderKeys"`
+}
+
+// TestGeneratedProfilesMatchGolden 测试生成的 imitate 函数与 golden 数据一致
+func TestGeneratedProfilesMatchGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "profiles", "*.golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(generatedProfiles) {
+		t.Fatalf("golden 文件数量 %d 与生成的函数数量 %d 不一致，请运行 go generate ./imitate", len(files), len(generatedProfiles))
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".golden.json")
+		t.Run(name, func(t *testing.T) {
+			imitateFunc, ok := generatedProfiles[name]
+			if !ok {
+				t.Fatalf("%s 没有对应的生成函数", name)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want profileGolden
+			if err := json.Unmarshal(data, &want); err != nil {
+				t.Fatalf("解析 golden 文件失败: %v", err)
+			}
+
+			checkProfileGolden(t, imitateFunc, want)
+			// latest 画像的别名应该与所指的画像一致
+			if alias := latestProfiles[name]; alias != nil {
+				checkProfileGolden(t, alias, want)
+			}
+		})
+	}
+}
+
+// checkProfileGolden 检查 imitateFunc 应用后的 Options 与 golden 数据一致
+func checkProfileGolden(t *testing.T, imitateFunc func(*fastls.Options), want profileGolden) {
+	t.Helper()
+	// 不预先初始化 Headers，生成的函数应当自行创建
+	options := &fastls.Options{}
+	imitateFunc(options)
+
+	if got := options.GetFingerprintType(); got != want.FingerprintType {
+		t.Errorf("%s 指纹类型应该是 %s，实际是 %s", want.Function, want.FingerprintType, got)
+	}
+	if want.Shuffled {
+		assertShuffledJA3(t, want.Fingerprint, options.GetFingerprintValue())
+	} else if got := options.GetFingerprintValue(); got != want.Fingerprint {
+		t.Errorf("%s 指纹应该是 %s，实际是 %s", want.Function, want.Fingerprint, got)
+	}
+	quic := ""
+	if options.QUICFingerprint != nil {
+		quic = options.QUICFingerprint.Value()
+	}
+	if quic != want.QUICFingerprint {
+		t.Errorf("%s QUIC 指纹应该是 %s，实际是 %s", want.Function, want.QUICFingerprint, quic)
+	}
+	if options.HTTP2SettingsString != want.HTTP2SettingsString {
+		t.Errorf("HTTP2SettingsString 应该是 %s，实际是 %s", want.HTTP2SettingsString, options.HTTP2SettingsString)
+	}
+	if options.UserAgent != want.UserAgent {
+		t.Errorf("UserAgent 应该是 %s，实际是 %s", want.UserAgent, options.UserAgent)
+	}
+	if !reflect.DeepEqual(options.Headers, want.Headers) {
+		t.Errorf("Headers 不一致\n期望: %v\n实际: %v", want.Headers, options.Headers)
+	}
+	if !reflect.DeepEqual(options.HeaderOrderKeys, want.HeaderOrderKeys) {
+		t.Errorf("HeaderOrderKeys 不一致\n期望: %v\n实际: %v", want.HeaderOrderKeys, options.HeaderOrderKeys)
+	}
+}
+
+// TestGeneratedProfilesKeepCallerHeaders 测试默认请求头不会覆盖调用方设置的值
+func TestGeneratedProfilesKeepCallerHeaders(t *testing.T) {
+	for name, imitateFunc := range generatedProfiles {
+		options := &fastls.Options{
+			Headers: map[string]string{"Accept": "application/json", "Accept-Encoding": "identity"},
+		}
+		imitateFunc(options)
+		if options.Headers["Accept"] != "application/json" {
+			t.Errorf("%s 覆盖了调用方设置的 Accept: %s", name, options.Headers["Accept"])
+		}
+		if options.Headers["Accept-Encoding"] != "identity" {
+			t.Errorf("%s 覆盖了调用方设置的 Accept-Encoding: %s", name, options.Headers["Accept-Encoding"])
+		}
+	}
+}
+
+// assertShuffledJA3 校验随机打乱扩展顺序后的 JA3：除扩展外的部分相同，
+// 扩展集合相同（21 可能被移除），末尾的 PSK 扩展 41 保持在最后
+func assertShuffledJA3(t *testing.T, want, got string) {
+	t.Helper()
+	wantParts := strings.Split(want, ",")
+	gotParts := strings.Split(got, ",")
+	if len(gotParts) != 5 {
+		t.Fatalf("JA3 指纹应该有 5 个部分，实际是 %s", got)
+	}
+	for _, i := range []int{0, 1, 3, 4} {
+		if wantParts[i] != gotParts[i] {
+			t.Errorf("JA3 第 %d 部分应该是 %s，实际是 %s", i, wantParts[i], gotParts[i])
+		}
+	}
+
+	wantExts := strings.Split(wantParts[2], "-")
+	gotExts := strings.Split(gotParts[2], "-")
+	if wantExts[len(wantExts)-1] == "41" && gotExts[len(gotExts)-1] != "41" {
+		t.Errorf("PSK 扩展 41 应该在最后: %s", gotParts[2])
+	}
+	remaining := make(map[string]int)
+	for _, e := range wantExts {
+		remaining[e]++
+	}
+	for _, e := range gotExts {
+		if remaining[e] == 0 {
+			t.Errorf("出现了多余的扩展 %s: %s", e, gotParts[2])
+			continue
+		}
+		remaining[e]--
+	}
+	for e, n := range remaining {
+		if n > 0 && e != "21" {
+			t.Errorf("缺少扩展 %s: %s", e, gotParts[2])
+		}
+	}
+}
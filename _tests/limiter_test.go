@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// concurrencyCounter 记录服务端同时处理的请求数和打开的连接数的最大值
+type concurrencyCounter struct {
+	current, max    atomic.Int32
+	conns, maxConns atomic.Int32
+	hold            time.Duration
+}
+
+func updateMax(max *atomic.Int32, v int32) {
+	for {
+		old := max.Load()
+		if v <= old || max.CompareAndSwap(old, v) {
+			return
+		}
+	}
+}
+
+func newConcurrencyServer(t *testing.T, hold time.Duration) (*httptest.Server, *concurrencyCounter) {
+	t.Helper()
+	counter := &concurrencyCounter{hold: hold}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		updateMax(&counter.max, counter.current.Add(1))
+		time.Sleep(counter.hold)
+		counter.current.Add(-1)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			updateMax(&counter.maxConns, counter.conns.Add(1))
+		case http.StateClosed, http.StateHijacked:
+			counter.conns.Add(-1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, counter
+}
+
+// doConcurrently 同时发送 n 个请求
+func doConcurrently(t *testing.T, n int, url string, options fastls.Options) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := fastls.NewClient().Do(url, options, "GET")
+			if err != nil {
+				t.Errorf("请求失败: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+// TestLimiterConnsPerHost 测试零值 Limiter 每个 origin 最多 6 个 HTTP/1.1 连接
+func TestLimiterConnsPerHost(t *testing.T) {
+	server, counter := newConcurrencyServer(t, 50*time.Millisecond)
+
+	options := fastls.Options{Limiter: &fastls.Limiter{}}
+	imitate.Chrome142(&options)
+	doConcurrently(t, 12, server.URL, options)
+	if got := counter.maxConns.Load(); got > 6 || got < 2 {
+		t.Errorf("同时打开的连接数应该在 2 到 6 之间，实际是 %d", got)
+	}
+}
+
+// TestLimiterInFlightPerHost 测试每个 host 同时进行的请求数
+func TestLimiterInFlightPerHost(t *testing.T) {
+	server, counter := newConcurrencyServer(t, 30*time.Millisecond)
+
+	options := fastls.Options{Limiter: &fastls.Limiter{MaxInFlightPerHost: 2}}
+	imitate.Chrome142(&options)
+	doConcurrently(t, 8, server.URL, options)
+	if got := counter.max.Load(); got != 2 {
+		t.Errorf("同时进行的请求数应该是 2，实际是 %d", got)
+	}
+}
+
+// TestLimiterRate 测试令牌桶限速
+func TestLimiterRate(t *testing.T) {
+	server, _ := newConcurrencyServer(t, 0)
+
+	options := fastls.Options{Limiter: &fastls.Limiter{RequestsPerSecond: 20, Burst: 2}}
+	imitate.Chrome142(&options)
+	start := time.Now()
+	doConcurrently(t, 6, server.URL, options)
+	// 前 2 个请求使用突发容量，其余 4 个每 50ms 一个
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("6 个请求应该至少耗时 200ms，实际是 %v", elapsed)
+	}
+}
+
+// TestLimiterQueueContext 测试排队的请求在 context 取消时返回
+func TestLimiterQueueContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	limiter := &fastls.Limiter{MaxInFlight: 1}
+	options := fastls.Options{Limiter: limiter}
+	imitate.Chrome142(&options)
+	go func(options fastls.Options) {
+		resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}(options)
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	options.Context = ctx
+	start := time.Now()
+	_, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("排队的请求应该在 context 超时时返回，实际是 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("排队的请求应该及时返回，实际耗时 %v", elapsed)
+	}
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// syncBuffer 可以被多个 goroutine 同时写入的 bytes.Buffer
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newJSONLogger 返回输出 debug 及以上级别 JSON 日志的 logger
+func newJSONLogger() (*slog.Logger, *syncBuffer) {
+	buf := &syncBuffer{}
+	return slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})), buf
+}
+
+// logRecords 解析每一行 JSON 日志，解析失败时测试失败
+func logRecords(t *testing.T, output string) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("日志不是 JSON: %q", line)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// findRecord 返回消息为 msg 的第一条日志
+func findRecord(records []map[string]any, msg string) map[string]any {
+	for _, record := range records {
+		if record["msg"] == msg {
+			return record
+		}
+	}
+	return nil
+}
+
+// TestLoggerRedaction 测试结构化字段，以及代理密码和 Cookie 不写入日志
+func TestLoggerRedaction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	proxyURL, _ := newConnectProxy(t)
+	logger, buf := newJSONLogger()
+
+	options := fastls.Options{
+		Logger:  logger,
+		Proxy:   strings.Replace(proxyURL, "http://", "http://user:proxy-secret@", 1),
+		Headers: map[string]string{"Cookie": "session=cookie-secret", "X-Visible": "visible"},
+	}
+	imitate.Chrome(&options)
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+
+	output := buf.String()
+	for _, secret := range []string{"proxy-secret", "cookie-secret"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("日志不应该包含 %s: %s", secret, output)
+		}
+	}
+	if !strings.Contains(output, "visible") {
+		t.Error("日志应该包含普通请求头")
+	}
+
+	records := logRecords(t, output)
+	for _, msg := range []string{"sending request", "proxy connected", "request completed"} {
+		record := findRecord(records, msg)
+		if record == nil {
+			t.Errorf("缺少日志 %q: %s", msg, output)
+			continue
+		}
+		if record["level"] != "DEBUG" || record["host"] != strings.TrimPrefix(server.URL, "http://") || record["profile"] != "chrome/ja3" || record["phase"] == nil {
+			t.Errorf("日志 %q 的字段错误: %v", msg, record)
+		}
+	}
+	if record := findRecord(records, "request completed"); record != nil && record["protocol"] != "HTTP/1.1" {
+		t.Errorf("protocol 应该是 HTTP/1.1，实际是 %v", record["protocol"])
+	}
+}
+
+// TestLoggerFailure 测试请求失败和重试的日志级别
+func TestLoggerFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+	logger, buf := newJSONLogger()
+
+	options := fastls.Options{Logger: logger, Retry: fastls.RetryPolicy{MaxAttempts: 2, MinBackoff: 1, MaxBackoff: 1}}
+	imitate.Chrome(&options)
+	if _, err := fastls.NewClient().Do(url, options, "GET"); err == nil {
+		t.Fatal("连接已关闭的服务时请求应该失败")
+	}
+
+	records := logRecords(t, buf.String())
+	failed := findRecord(records, "request failed")
+	if failed == nil || failed["level"] != "WARN" || failed["phase"] != "request" || failed["error"] == nil {
+		t.Errorf("请求失败应该记录 WARN 日志: %v", failed)
+	}
+	retry := findRecord(records, "retrying request")
+	if retry == nil || retry["level"] != "INFO" || retry["attempt"] != float64(1) {
+		t.Errorf("重试应该记录 INFO 日志: %v", retry)
+	}
+}
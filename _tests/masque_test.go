@@ -0,0 +1,441 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/quicvarint"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// quicFingerprint 选择 HTTP/3 的 JA4 指纹
+var quicFingerprint = fastls.Ja4Fingerprint{FingerprintValue: "q13d0310h3_1301,1302,1303_000a,000d,0010,002b,002d,0033_0403,0804,0401"}
+
+// masqueProxy 进程内的 MASQUE CONNECT-UDP 代理，支持 HTTP/3 datagram 和 HTTP/2、HTTP/1.1 的 DATAGRAM capsule
+type masqueProxy struct {
+	hosts map[string]string // 代理端解析的域名
+
+	mu      sync.Mutex
+	targets []string
+	header  http.Header
+	proto   string
+}
+
+// newH3Target 启动本地 HTTP/3 服务，返回端口和收到的数据报数
+func newH3Target(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	certServer := httptest.NewUnstartedServer(nil)
+	certServer.StartTLS()
+	t.Cleanup(certServer.Close)
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("监听 UDP 失败: %v", err)
+	}
+	counted := &countingPacketConn{PacketConn: udpConn}
+	h3Server := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: certServer.TLS.Certificates}),
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	}
+	go func() { _ = h3Server.Serve(counted) }()
+	t.Cleanup(func() { h3Server.Close() })
+	return strconv.Itoa(udpConn.LocalAddr().(*net.UDPAddr).Port), &counted.packets
+}
+
+// countingPacketConn 统计收到的数据报
+type countingPacketConn struct {
+	net.PacketConn
+	packets atomic.Int32
+}
+
+func (c *countingPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err == nil {
+		c.packets.Add(1)
+	}
+	return n, addr, err
+}
+
+// dialTarget 解析 RFC 9298 默认模板中的目标，建立发往目标的 UDP 连接
+func (p *masqueProxy) dialTarget(r *http.Request) (*net.UDPConn, bool) {
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	if len(parts) != 5 || parts[0] != ".well-known" || parts[1] != "masque" || parts[2] != "udp" {
+		return nil, false
+	}
+	host, _ := url.PathUnescape(parts[3])
+	p.mu.Lock()
+	p.targets = append(p.targets, net.JoinHostPort(host, parts[4]))
+	p.header = r.Header.Clone()
+	p.mu.Unlock()
+	if ip, ok := p.hosts[host]; ok {
+		host = ip
+	}
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, parts[4]))
+	if err != nil {
+		return nil, false
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	return conn, err == nil
+}
+
+// lastRequest 返回最近一次 CONNECT-UDP 的目标、请求头和协议
+func (p *masqueProxy) lastRequest() (string, http.Header, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.targets) == 0 {
+		return "", nil, ""
+	}
+	return p.targets[len(p.targets)-1], p.header, p.proto
+}
+
+// serveHTTP3 处理 HTTP/3 扩展 CONNECT，在 datagram 和 UDP 之间转发
+func (p *masqueProxy) serveHTTP3(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect || r.Proto != "connect-udp" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	udp, ok := p.dialTarget(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer udp.Close()
+	p.mu.Lock()
+	p.proto = "h3"
+	p.mu.Unlock()
+	w.Header().Set("Capsule-Protocol", "?1")
+	w.WriteHeader(http.StatusOK)
+	str := w.(http3.HTTPStreamer).HTTPStream()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, err := udp.Read(buf)
+			if err != nil {
+				return
+			}
+			if err := str.SendDatagram(append([]byte{0}, buf[:n]...)); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		data, err := str.ReceiveDatagram(r.Context())
+		if err != nil {
+			return
+		}
+		if len(data) > 0 && data[0] == 0 {
+			_, _ = udp.Write(data[1:])
+		}
+	}
+}
+
+// serveHTTP1 处理 HTTP/1.1 Upgrade: connect-udp，在 DATAGRAM capsule 和 UDP 之间转发
+func (p *masqueProxy) serveHTTP1(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upgrade") != "connect-udp" {
+		http.Error(w, "only CONNECT-UDP", http.StatusMethodNotAllowed)
+		return
+	}
+	udp, ok := p.dialTarget(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer udp.Close()
+	p.mu.Lock()
+	p.proto = "HTTP/1.1"
+	p.mu.Unlock()
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: connect-udp\r\nCapsule-Protocol: ?1\r\n\r\n"))
+	relayCapsules(udp, buf.Reader, conn)
+}
+
+// serveHTTP2 处理 HTTP/2 扩展 CONNECT
+//
+// 标准库和 x/net 的 HTTP/2 服务端默认不启用 SETTINGS_ENABLE_CONNECT_PROTOCOL，这里直接读写帧
+func (p *masqueProxy) serveHTTP2(conn net.Conn) {
+	defer conn.Close()
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil || string(preface) != http2.ClientPreface {
+		return
+	}
+	fr := http2.NewFramer(conn, conn)
+	fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	var wmu sync.Mutex
+	write := func(f func() error) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+		return f()
+	}
+	_ = fr.WriteSettings(http2.Setting{ID: http2.SettingEnableConnectProtocol, Val: 1})
+
+	var streamID uint32
+	r := &http.Request{Header: http.Header{}}
+	for streamID == 0 {
+		frame, err := fr.ReadFrame()
+		if err != nil {
+			return
+		}
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				_ = fr.WriteSettingsAck()
+			}
+		case *http2.MetaHeadersFrame:
+			streamID = f.StreamID
+			for _, field := range f.Fields {
+				r.Header.Add(field.Name, field.Value)
+			}
+		}
+	}
+	status := "200"
+	r.URL, _ = url.Parse(r.Header.Get(":path"))
+	udp, ok := p.dialTarget(r)
+	if r.Header.Get(":method") != http.MethodConnect || r.Header.Get(":protocol") != "connect-udp" || !ok {
+		status = "400"
+	}
+	var block bytes.Buffer
+	encoder := hpack.NewEncoder(&block)
+	_ = encoder.WriteField(hpack.HeaderField{Name: ":status", Value: status})
+	_ = encoder.WriteField(hpack.HeaderField{Name: "capsule-protocol", Value: "?1"})
+	_ = fr.WriteHeaders(http2.HeadersFrameParam{StreamID: streamID, BlockFragment: block.Bytes(), EndHeaders: true, EndStream: status != "200"})
+	if status != "200" {
+		return
+	}
+	defer udp.Close()
+	p.mu.Lock()
+	p.proto = "HTTP/2.0"
+	p.mu.Unlock()
+
+	// 请求体的 DATA 帧写入管道，按 capsule 解析
+	pr, pw := io.Pipe()
+	go func() {
+		defer pw.Close()
+		for {
+			frame, err := fr.ReadFrame()
+			if err != nil {
+				return
+			}
+			switch f := frame.(type) {
+			case *http2.DataFrame:
+				if n := uint32(len(f.Data())); n > 0 {
+					_, _ = pw.Write(f.Data())
+					_ = write(func() error { return fr.WriteWindowUpdate(0, n) })
+					_ = write(func() error { return fr.WriteWindowUpdate(streamID, n) })
+				}
+				if f.StreamEnded() {
+					return
+				}
+			case *http2.PingFrame:
+				if !f.IsAck() {
+					_ = write(func() error { return fr.WritePing(true, f.Data) })
+				}
+			case *http2.RSTStreamFrame, *http2.GoAwayFrame:
+				return
+			}
+		}
+	}()
+	relayCapsules(udp, bufio.NewReader(pr), writerFunc(func(b []byte) (int, error) {
+		return len(b), write(func() error { return fr.WriteData(streamID, false, b) })
+	}))
+}
+
+// writerFunc 把函数转换为 io.Writer
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// relayCapsules 在 DATAGRAM capsule 流和 UDP 连接之间转发数据报
+func relayCapsules(udp *net.UDPConn, reader *bufio.Reader, writer io.Writer) {
+	var mu sync.Mutex
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, err := udp.Read(buf)
+			if err != nil {
+				return
+			}
+			capsule := quicvarint.Append(nil, 0)
+			capsule = quicvarint.Append(capsule, uint64(n+1))
+			capsule = append(append(capsule, 0), buf[:n]...)
+			mu.Lock()
+			_, err = writer.Write(capsule)
+			mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		capsuleType, err := quicvarint.Read(reader)
+		if err != nil {
+			return
+		}
+		length, err := quicvarint.Read(reader)
+		if err != nil {
+			return
+		}
+		value := make([]byte, length)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return
+		}
+		if capsuleType == 0 && len(value) > 0 && value[0] == 0 {
+			_, _ = udp.Write(value[1:])
+		}
+	}
+}
+
+// newMasqueH3Proxy 启动 HTTP/3 MASQUE 代理，返回 masque:// 代理地址
+func newMasqueH3Proxy(t *testing.T, p *masqueProxy) string {
+	t.Helper()
+	certServer := httptest.NewUnstartedServer(nil)
+	certServer.StartTLS()
+	t.Cleanup(certServer.Close)
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("监听 UDP 失败: %v", err)
+	}
+	server := &http3.Server{
+		TLSConfig:       http3.ConfigureTLSConfig(&tls.Config{Certificates: certServer.TLS.Certificates}),
+		EnableDatagrams: true,
+		// 与客户端一样，外层的包要装下目标发来的 1280 字节的内层包
+		QUICConfig: &quic.Config{EnableDatagrams: true, InitialPacketSize: 1350},
+		Handler:    http.HandlerFunc(p.serveHTTP3),
+	}
+	go func() { _ = server.Serve(udpConn) }()
+	t.Cleanup(func() { server.Close() })
+	return "masque://user:secret@" + udpConn.LocalAddr().String()
+}
+
+// newMasqueHTTP1Proxy 启动通过 HTTP/1.1 Upgrade 转发 UDP 的 HTTPS 代理
+func newMasqueHTTP1Proxy(t *testing.T, p *masqueProxy) string {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(p.serveHTTP1))
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return strings.Replace(server.URL, "https://", "https://user:secret@", 1)
+}
+
+// newMasqueHTTP2Proxy 启动通过 HTTP/2 扩展 CONNECT 转发 UDP 的 HTTPS 代理
+func newMasqueHTTP2Proxy(t *testing.T, p *masqueProxy) string {
+	t.Helper()
+	certServer := httptest.NewUnstartedServer(nil)
+	certServer.StartTLS()
+	t.Cleanup(certServer.Close)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certServer.TLS.Certificates, NextProtos: []string{"h2"}})
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go p.serveHTTP2(conn)
+		}
+	}()
+	return "https://user:secret@" + listener.Addr().String()
+}
+
+// TestMasqueHTTP3 测试 HTTP/3 通过 MASQUE CONNECT-UDP 经 HTTP/3、HTTP/2 和 HTTP/1.1 代理发送
+//
+// 与 TestSocksHTTP3 一样，测试证书不受信任，握手以证书错误结束；收到服务端证书说明 QUIC 数据报经代理往返
+func TestMasqueHTTP3(t *testing.T) {
+	port, _ := newH3Target(t)
+	tests := []struct {
+		name  string
+		proxy func(*masqueProxy) string
+		proto string
+	}{
+		{"HTTP/3", func(p *masqueProxy) string { return newMasqueH3Proxy(t, p) }, "h3"},
+		{"HTTP/2", func(p *masqueProxy) string { return newMasqueHTTP2Proxy(t, p) }, "HTTP/2.0"},
+		{"HTTP/1.1", func(p *masqueProxy) string { return newMasqueHTTP1Proxy(t, p) }, "HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		proxy := &masqueProxy{hosts: map[string]string{"h3.fastls.test": "127.0.0.1"}}
+		options := fastls.Options{
+			Proxy:        tt.proxy(proxy),
+			ProxyHeaders: map[string]string{"X-Proxy-Token": "token"},
+			Fingerprint:  quicFingerprint,
+			Timeout:      5,
+		}
+		_, err := fastls.NewClient().Do("https://h3.fastls.test:"+port+"/", options, "GET")
+		if err == nil || !strings.Contains(err.Error(), "x509") {
+			t.Errorf("%s: 应该收到服务端证书并校验失败，实际是 %v", tt.name, err)
+			continue
+		}
+		target, header, proto := proxy.lastRequest()
+		if target != "h3.fastls.test:"+port || proto != tt.proto {
+			t.Errorf("%s: 代理应该通过 %s 收到目标 h3.fastls.test:%s，实际是 %s %s", tt.name, tt.proto, port, proto, target)
+		}
+		if header.Get("Proxy-Authorization") == "" || header.Get("X-Proxy-Token") != "token" || header.Get("Capsule-Protocol") != "?1" {
+			t.Errorf("%s: CONNECT-UDP 请求应该带有代理认证和 ProxyHeaders: %v", tt.name, header)
+		}
+	}
+}
+
+// TestHTTP3FailClosed 测试代理无法转发 UDP 时 HTTP/3 请求失败，不绕过代理直连
+func TestHTTP3FailClosed(t *testing.T) {
+	port, packets := newH3Target(t)
+	connectProxy, _ := newConnectProxy(t)
+	socks := newSocksServer(t, "", "", nil)
+	// MASQUE 不能使用显式设置的代理指纹和 HTTP/2 设置
+	masque := &masqueProxy{hosts: map[string]string{}}
+	proxySettings := fastls.ToHTTP2Settings(&fastls.H2Settings{
+		Settings:      map[string]int{"INITIAL_WINDOW_SIZE": 6291456},
+		SettingsOrder: []string{"INITIAL_WINDOW_SIZE"},
+	})
+	tests := []struct {
+		name    string
+		options fastls.Options
+	}{
+		{"代理不支持 CONNECT-UDP", fastls.Options{Proxy: connectProxy}},
+		{"SOCKS4 代理", fastls.Options{Proxy: "socks4a://" + socks.addr}},
+		{"只有代理链", fastls.Options{ProxyChain: []string{connectProxy}}},
+		{"代理链后的 SOCKS5 代理", fastls.Options{ProxyChain: []string{connectProxy}, Proxy: "socks5://" + socks.addr}},
+		{"PAC 选择的 HTTP 代理", fastls.Options{ProxyFunc: func(*url.URL) ([]string, error) { return []string{connectProxy}, nil }}},
+		{"masque 代理设置了 ProxyFingerprint", fastls.Options{Proxy: newMasqueH3Proxy(t, masque), ProxyFingerprint: quicFingerprint}},
+		{"HTTP/2 代理设置了 ProxyHTTP2Settings", fastls.Options{Proxy: newMasqueHTTP2Proxy(t, masque), ProxyHTTP2Settings: proxySettings}},
+	}
+	for _, tt := range tests {
+		tt.options.Fingerprint = quicFingerprint
+		tt.options.Timeout = 5
+		start := time.Now()
+		if _, err := fastls.NewClient().Do("https://127.0.0.1:"+port+"/", tt.options, "GET"); err == nil || strings.Contains(err.Error(), "x509") {
+			t.Errorf("%s: 请求应该在建立 UDP 通道时失败，实际是 %v", tt.name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("%s: 应该立即失败，实际耗时 %v", tt.name, elapsed)
+		}
+	}
+	if packets.Load() != 0 {
+		t.Errorf("目标不应该直接收到数据报，实际收到 %d 个", packets.Load())
+	}
+	options := fastls.Options{Fingerprint: quicFingerprint, Timeout: 5}
+	if _, err := fastls.NewClient().Do("https://127.0.0.1:"+port+"/", options, "GET"); err == nil || !strings.Contains(err.Error(), "x509") {
+		t.Errorf("未设置代理时应该直连并收到服务端证书，实际是 %v", err)
+	}
+	if packets.Load() == 0 {
+		t.Error("未设置代理时目标应该直接收到数据报")
+	}
+}
@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// tlsProxy 本地 HTTPS CONNECT 代理，记录收到的 ClientHello 和 CONNECT 请求
+type tlsProxy struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	hello  *tls.ClientHelloInfo
+	header http.Header
+	proto  int
+}
+
+// newTLSProxy 启动 HTTPS CONNECT 代理，enableHTTP2 为 true 时通过 ALPN 协商 HTTP/2
+func newTLSProxy(t *testing.T, enableHTTP2 bool) *tlsProxy {
+	t.Helper()
+	p := &tlsProxy{}
+	p.Server = httptest.NewUnstartedServer(http.HandlerFunc(p.serveConnect))
+	p.EnableHTTP2 = enableHTTP2
+	p.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		p.mu.Lock()
+		p.hello = hello
+		p.mu.Unlock()
+		return nil, nil
+	}}
+	p.StartTLS()
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *tlsProxy) serveConnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "only CONNECT", http.StatusMethodNotAllowed)
+		return
+	}
+	p.mu.Lock()
+	p.header, p.proto = r.Header.Clone(), r.ProtoMajor
+	p.mu.Unlock()
+	upstream, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	if r.ProtoMajor == 2 {
+		// HTTP/2 CONNECT 的隧道是请求体和响应体
+		w.WriteHeader(http.StatusOK)
+		rc := http.NewResponseController(w)
+		_ = rc.Flush()
+		go func() {
+			_, _ = io.Copy(upstream, r.Body)
+			upstream.Close()
+		}()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := upstream.Read(buf)
+			if n > 0 {
+				if _, err := w.Write(buf[:n]); err != nil {
+					return
+				}
+				_ = rc.Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	pipe(conn, buf, upstream)
+	conn.Close()
+}
+
+// connect 返回代理最后收到的 ClientHello、CONNECT 请求头和 HTTP 主版本
+func (p *tlsProxy) connect() (*tls.ClientHelloInfo, http.Header, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.hello, p.header, p.proto
+}
+
+// hasGREASE 判断密码套件中是否有 GREASE 值，Go 标准库不发送 GREASE
+func hasGREASE(hello *tls.ClientHelloInfo) bool {
+	return slices.ContainsFunc(hello.CipherSuites, func(suite uint16) bool {
+		return suite&0x0f0f == 0x0a0a && suite>>8 == suite&0xff
+	})
+}
+
+// TestProxyTLS 测试与 HTTPS 代理握手时使用配置的指纹，以及设置 CONNECT 请求头
+func TestProxyTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+
+	proxy := newTLSProxy(t, false)
+	options := fastls.Options{
+		Proxy:        proxy.URL,
+		ProxyHeaders: map[string]string{"X-Proxy-Token": "token"},
+	}
+	imitate.Chrome(&options)
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("通过 HTTPS 代理请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Status != http.StatusOK {
+		t.Errorf("状态码应该是 200，实际是 %d", resp.Status)
+	}
+
+	hello, header, _ := proxy.connect()
+	if !hasGREASE(hello) {
+		t.Errorf("与代理握手应该使用 Chrome 指纹，密码套件是 %v", hello.CipherSuites)
+	}
+	if !slices.Contains(hello.SupportedProtos, "h2") {
+		t.Errorf("ALPN 应该来自指纹，实际是 %v", hello.SupportedProtos)
+	}
+	if got := header.Get("X-Proxy-Token"); got != "token" {
+		t.Errorf("CONNECT 请求头 X-Proxy-Token 应该是 token，实际是 %q", got)
+	}
+	if got := header.Get("User-Agent"); got != options.UserAgent {
+		t.Errorf("CONNECT 请求头 User-Agent 应该是 %q，实际是 %q", options.UserAgent, got)
+	}
+
+	// 空指纹使用 Go 标准库 TLS 与代理握手
+	proxy = newTLSProxy(t, false)
+	options = fastls.Options{Proxy: proxy.URL, ProxyFingerprint: fastls.Ja3Fingerprint{}}
+	imitate.Chrome(&options)
+	resp, err = fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("通过 HTTPS 代理请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if hello, _, _ := proxy.connect(); hasGREASE(hello) {
+		t.Error("ProxyFingerprint 为空指纹时不应该使用 Chrome 指纹")
+	}
+}
+
+// TestProxyDialTLS 测试自定义与 HTTPS 代理的 TLS 连接
+func TestProxyDialTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	proxy := newTLSProxy(t, true)
+
+	var dials atomic.Int32
+	options := fastls.Options{
+		Proxy: proxy.URL,
+		ProxyDialTLS: func(ctx context.Context, network, addr string) (net.Conn, string, error) {
+			dials.Add(1)
+			dialer := &tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}}}
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, "", err
+			}
+			return conn, conn.(*tls.Conn).ConnectionState().NegotiatedProtocol, nil
+		},
+	}
+	imitate.Chrome(&options)
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("通过 HTTPS 代理请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if dials.Load() == 0 {
+		t.Error("应该调用 ProxyDialTLS 连接代理")
+	}
+	if _, _, proto := proxy.connect(); proto != 1 {
+		t.Errorf("ProxyDialTLS 协商 http/1.1 时 CONNECT 应该使用 HTTP/1，实际是 HTTP/%d", proto)
+	}
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// chainRequest 通过代理链发送请求并关闭响应体
+func chainRequest(target string, options fastls.Options) error {
+	imitate.Chrome(&options)
+	resp, err := fastls.NewClient().Do(target, options, "GET")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// TestProxyChain 测试 SOCKS5、HTTPS 和 HTTP 代理组成的代理链
+func TestProxyChain(t *testing.T) {
+	server := newOKServer(t)
+	socks := newSocksServer(t, "user", "secret", nil)
+	tlsProxy := newTLSProxy(t, false)
+	connectProxy, tunnels := newConnectProxy(t)
+	tlsProxyHost := strings.TrimPrefix(tlsProxy.URL, "https://")
+
+	options := fastls.Options{
+		ProxyChain: []string{"socks5h://user:secret@" + socks.addr, tlsProxy.URL},
+		Proxy:      connectProxy,
+	}
+	if err := chainRequest(server.URL, options); err != nil {
+		t.Fatalf("通过代理链请求失败: %v", err)
+	}
+	if target := socks.lastTarget(); target != tlsProxyHost {
+		t.Errorf("第一跳应该连接第二跳 %s，实际连接 %s", tlsProxyHost, target)
+	}
+	if hello, _, _ := tlsProxy.connect(); hello == nil {
+		t.Error("第二跳应该通过 TLS 连接")
+	}
+	if tunnels.Load() != 1 {
+		t.Errorf("最后一跳应该连接 Proxy，实际隧道 %d 个", tunnels.Load())
+	}
+
+	options = fastls.Options{ProxyChain: []string{"socks5://user:secret@" + socks.addr, connectProxy}}
+	if err := chainRequest(server.URL, options); err != nil {
+		t.Fatalf("通过代理链请求失败: %v", err)
+	}
+	if tunnels.Load() != 2 {
+		t.Errorf("未设置 Proxy 时最后一跳应该连接目标，实际隧道 %d 个", tunnels.Load())
+	}
+}
+
+// TestProxyChainError 测试代理链的错误指明失败的一跳
+func TestProxyChainError(t *testing.T) {
+	server := newOKServer(t)
+	socks := newSocksServer(t, "user", "secret", nil)
+	connectProxy, _ := newConnectProxy(t)
+	dead := deadProxyURL(t)
+
+	tests := []struct {
+		name   string
+		chain  []string
+		hop    int
+		target string
+	}{
+		{"下一跳拒绝连接", []string{connectProxy, dead}, 1, strings.TrimPrefix(dead, "http://")},
+		{"认证失败", []string{connectProxy, "socks5://user:wrong@" + socks.addr}, 2, strings.TrimPrefix(server.URL, "http://")},
+		{"第一跳拒绝连接", []string{dead, connectProxy}, 1, strings.TrimPrefix(connectProxy, "http://")},
+	}
+	for _, tt := range tests {
+		err := chainRequest(server.URL, fastls.Options{ProxyChain: tt.chain})
+		var hopErr *fastls.ProxyHopError
+		if !errors.As(err, &hopErr) {
+			t.Errorf("%s: 应该返回 ProxyHopError，实际是 %v", tt.name, err)
+			continue
+		}
+		if hopErr.Hop != tt.hop || hopErr.Target != tt.target || strings.Contains(hopErr.Error(), "wrong") {
+			t.Errorf("%s: 应该是第 %d 跳连接 %s 失败，实际是 %v", tt.name, tt.hop, tt.target, hopErr)
+		}
+	}
+
+	if err := chainRequest(server.URL, fastls.Options{ProxyChain: []string{connectProxy, "ftp://example.com"}}); err == nil ||
+		!strings.Contains(err.Error(), "第 2 跳") {
+		t.Errorf("不支持的代理应该指明第 2 跳，实际是 %v", err)
+	}
+}
+
+// TestProxyChainTimeout 测试每一跳的超时
+func TestProxyChainTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// 接受连接但从不应答
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	server := newOKServer(t)
+	connectProxy, _ := newConnectProxy(t)
+
+	options := fastls.Options{
+		ProxyChain:      []string{connectProxy, "http://" + listener.Addr().String()},
+		ProxyHopTimeout: 200,
+		Timeout:         10,
+	}
+	start := time.Now()
+	err = chainRequest(server.URL, options)
+	var hopErr *fastls.ProxyHopError
+	if !errors.As(err, &hopErr) || hopErr.Hop != 2 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("不响应的第二跳应该超时，实际是 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("超时后应该立即返回，实际耗时 %v", elapsed)
+	}
+
+	options.ProxyChain = []string{connectProxy}
+	if err := chainRequest(server.URL, options); err != nil {
+		t.Errorf("每一跳在超时内完成时请求应该成功: %v", err)
+	}
+}
+
+// TestProxyChainHTTP2HopTimeout 测试设置了每一跳的超时时经 HTTP/2 的 HTTPS 代理建立的隧道在握手后仍然可用
+func TestProxyChainHTTP2HopTimeout(t *testing.T) {
+	server := newOKServer(t)
+	connectProxy, _ := newConnectProxy(t)
+	tlsProxy := newTLSProxy(t, true)
+
+	options := fastls.Options{
+		ProxyChain:      []string{connectProxy, tlsProxy.URL},
+		ProxyHopTimeout: 2000,
+	}
+	if err := chainRequest(server.URL, options); err != nil {
+		t.Fatalf("通过 HTTP/2 代理的代理链请求失败: %v", err)
+	}
+	if _, _, proto := tlsProxy.connect(); proto != 2 {
+		t.Errorf("第二跳应该通过 HTTP/2 CONNECT 建立隧道，实际是 HTTP/%d", proto)
+	}
+}
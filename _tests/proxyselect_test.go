@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+	"github.com/gorilla/websocket"
+)
+
+// selectProxies 调用 ProxyFunc 并把结果连接成字符串，直连为 DIRECT
+func selectProxies(t *testing.T, fn fastls.ProxyFunc, rawURL string) string {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxies, err := fn(u)
+	if err != nil {
+		t.Fatalf("选择 %s 的代理失败: %v", rawURL, err)
+	}
+	if len(proxies) == 0 {
+		return "DIRECT"
+	}
+	for i, p := range proxies {
+		if p == "" {
+			proxies[i] = "DIRECT"
+		}
+	}
+	return strings.Join(proxies, ",")
+}
+
+// TestProxyFromEnvironment 测试按环境变量和 NO_PROXY 规则选择代理
+func TestProxyFromEnvironment(t *testing.T) {
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "NO_PROXY", "REQUEST_METHOD"} {
+		t.Setenv(name, "")
+		t.Setenv(strings.ToLower(name), "")
+	}
+	t.Setenv("HTTP_PROXY", "http://http-proxy:3128")
+	t.Setenv("ALL_PROXY", "socks5h://all-proxy:1080")
+	t.Setenv("NO_PROXY", "internal.example,.corp.example,10.0.0.0/8,api.example:8443")
+	fn := fastls.ProxyFromEnvironment()
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://example.com/", "http://http-proxy:3128"},
+		{"https://example.com/", "socks5h://all-proxy:1080"},
+		{"https://internal.example/", "DIRECT"},
+		{"https://a.internal.example/", "DIRECT"},
+		{"https://x.corp.example/", "DIRECT"},
+		{"http://10.1.2.3/", "DIRECT"},
+		{"http://11.1.2.3/", "http://http-proxy:3128"},
+		{"https://api.example:8443/", "DIRECT"},
+		{"https://api.example/", "socks5h://all-proxy:1080"},
+	}
+	for _, tt := range tests {
+		if got := selectProxies(t, fn, tt.url); got != tt.want {
+			t.Errorf("%s 的代理应该是 %s，实际是 %s", tt.url, tt.want, got)
+		}
+	}
+}
+
+// testPAC 覆盖常用语法和辅助函数的 PAC 脚本
+const testPAC = `
+// 公司内部的域名直连
+var internal = ["intranet.example", ".corp.example"];
+
+function isInternal(host) {
+	for (var i = 0; i < internal.length; i++) {
+		if (dnsDomainIs(host, internal[i]) || host == internal[i]) return true;
+	}
+	return false;
+}
+
+function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	if (isPlainHostName(host) || isInternal(host))
+		return "DIRECT";
+	if (isInNet(host, "10.0.0.0", "255.0.0.0"))
+		return "DIRECT";
+	if (/^ftp\./i.test(host) || url.substring(0, 4) == "ftp:")
+		return "SOCKS proxy.example:1080";
+	if (shExpMatch(url, "https://*.video.example/*") && weekdayRange("SUN", "SAT"))
+		return "HTTPS secure.example:443; SOCKS5 socks.example:1080";
+	var port = url.indexOf("http:") === 0 ? 3128 : 8080;
+	return "PROXY proxy.example:" + port + "; DIRECT";
+}
+`
+
+// TestProxyFromPAC 测试执行 PAC 脚本选择代理
+func TestProxyFromPAC(t *testing.T) {
+	fn, err := fastls.ProxyFromPAC(testPAC, nil)
+	if err != nil {
+		t.Fatalf("解析 PAC 脚本失败: %v", err)
+	}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://printer/", "DIRECT"},
+		{"https://intranet.example/", "DIRECT"},
+		{"https://wiki.corp.example/page", "DIRECT"},
+		{"http://10.20.30.40/", "DIRECT"},
+		{"https://FTP.example/", "socks4://proxy.example:1080"},
+		{"https://cdn.video.example/v.mp4", "https://secure.example:443,socks5h://socks.example:1080"},
+		{"http://example.com/", "http://proxy.example:3128,DIRECT"},
+		{"https://example.com/", "http://proxy.example:8080,DIRECT"},
+	}
+	for _, tt := range tests {
+		if got := selectProxies(t, fn, tt.url); got != tt.want {
+			t.Errorf("%s 的代理应该是 %s，实际是 %s", tt.url, tt.want, got)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "proxy.pac")
+	if err := os.WriteFile(path, []byte(testPAC), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if fn, err = fastls.LoadPAC(path, nil); err != nil {
+		t.Fatalf("加载 PAC 文件失败: %v", err)
+	}
+	if got := selectProxies(t, fn, "http://printer/"); got != "DIRECT" {
+		t.Errorf("从文件加载的 PAC 脚本应该返回 DIRECT，实际是 %s", got)
+	}
+
+	for _, script := range []string{
+		"function FindProxyForURL(url, host) { return \"DIRECT\";",
+		"var x = 1;",
+		"function FindProxyForURL(url, host) { return \"BOGUS a:1\"; }",
+		"function f() { return f(); } function FindProxyForURL(url, host) { return f(); }",
+	} {
+		fn, err := fastls.ProxyFromPAC(script, nil)
+		if err == nil {
+			_, err = fn(&url.URL{Scheme: "https", Host: "example.com"})
+		}
+		if err == nil {
+			t.Errorf("无效的 PAC 脚本应该返回错误: %s", script)
+		}
+	}
+}
+
+// TestProxyFuncRequest 测试按 ProxyFunc 选择代理，连接失败时尝试下一个
+func TestProxyFuncRequest(t *testing.T) {
+	server := newOKServer(t)
+	tlsServer := newSourceServer(t)
+	liveProxy, tunnels := newConnectProxy(t)
+	live, _ := url.Parse(liveProxy)
+	dead, _ := url.Parse(deadProxyURL(t))
+
+	fn, err := fastls.ProxyFromPAC(`function FindProxyForURL(url, host) {
+		if (url.substring(0, 6) == "https:") return "DIRECT";
+		return "PROXY `+dead.Host+`; PROXY `+live.Host+`";
+	}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := fastls.Options{ProxyFunc: fn}
+	imitate.Chrome(&options)
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if tunnels.Load() != 1 {
+		t.Errorf("第一个代理连接失败时应该使用第二个代理，实际隧道 %d 个", tunnels.Load())
+	}
+	resp, err = fastls.NewClient().Do(tlsServer.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if tunnels.Load() != 1 {
+		t.Errorf("PAC 返回 DIRECT 时应该直连，实际隧道 %d 个", tunnels.Load())
+	}
+
+	selectErr := errors.New("no proxy")
+	options.ProxyFunc = func(*url.URL) ([]string, error) { return nil, selectErr }
+	if _, err := fastls.NewClient().Do(server.URL, options, "GET"); !errors.Is(err, selectErr) {
+		t.Errorf("ProxyFunc 返回错误时请求应该失败，实际是 %v", err)
+	}
+}
+
+// TestWebSocketProxyFunc 测试 WebSocket 使用与 HTTP 请求相同的代理选择
+func TestWebSocketProxyFunc(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		messageType, data, err := conn.ReadMessage()
+		if err == nil {
+			_ = conn.WriteMessage(messageType, data)
+		}
+	}))
+	t.Cleanup(server.Close)
+	proxyURL, tunnels := newConnectProxy(t)
+
+	var selected []string
+	options := fastls.Options{ProxyFunc: func(u *url.URL) ([]string, error) {
+		selected = append(selected, u.Scheme)
+		return []string{proxyURL}, nil
+	}}
+	imitate.Chrome(&options)
+	wsc := fastls.NewWebSocketClientWithOptions(options)
+	conn, _, err := wsc.Connect(strings.Replace(server.URL, "https://", "wss://", 1))
+	if err != nil {
+		t.Fatalf("WebSocket 连接失败: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "ping" {
+		t.Errorf("应该收到回显的消息，实际是 %q: %v", data, err)
+	}
+	if tunnels.Load() != 1 || strings.Join(selected, ",") != "https" {
+		t.Errorf("WebSocket 应该通过 ProxyFunc 选择的代理连接，wss 按 https 传入，实际隧道 %d 个，协议 %v", tunnels.Load(), selected)
+	}
+}
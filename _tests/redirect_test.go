@@ -0,0 +1,345 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// echoedRequest 重定向测试服务返回的请求信息
+type echoedRequest struct {
+	Method  string
+	Body    string
+	Headers http.Header
+}
+
+// newRedirectServer 启动一个本地服务：/echo 返回收到的请求，其余路径按 routes 重定向
+func newRedirectServer(t *testing.T, routes map[string]func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := routes[r.URL.Path]; ok {
+			route(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(echoedRequest{Method: r.Method, Body: string(body), Headers: r.Header})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func decodeEchoedRequest(t *testing.T, resp fastls.Response) echoedRequest {
+	t.Helper()
+	defer resp.Body.Close()
+	var echoed echoedRequest
+	if err := json.NewDecoder(resp.Body).Decode(&echoed); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return echoed
+}
+
+// TestRedirectSeeOtherAfterPost 测试 303 将 POST 改为 GET、丢弃请求体并携带重定向中设置的 Cookie
+func TestRedirectSeeOtherAfterPost(t *testing.T) {
+	server := newRedirectServer(t, map[string]func(http.ResponseWriter, *http.Request){
+		"/login": func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "abc", Path: "/"})
+			http.Redirect(w, r, "/echo", http.StatusSeeOther)
+		},
+	})
+
+	options := fastls.Options{
+		Headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+		Body:    "user=a&pass=b",
+	}
+	imitate.Chrome142(&options)
+
+	resp, err := fastls.NewClient().Do(server.URL+"/login", options, "POST")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	echoed := decodeEchoedRequest(t, resp)
+	if echoed.Method != "GET" || echoed.Body != "" {
+		t.Errorf("303 后应该是不带请求体的 GET，实际是 %s %q", echoed.Method, echoed.Body)
+	}
+	if got := echoed.Headers.Get("Content-Type"); got != "" {
+		t.Errorf("丢弃请求体后不应该发送 Content-Type，实际是 %q", got)
+	}
+	if got := echoed.Headers.Get("Cookie"); got != "sid=abc" {
+		t.Errorf("重定向中设置的 Cookie 应该被携带，实际是 %q", got)
+	}
+
+	if resp.URL != server.URL+"/echo" {
+		t.Errorf("最终 URL 应该是 %s/echo，实际是 %s", server.URL, resp.URL)
+	}
+	if len(resp.Redirects) != 1 {
+		t.Fatalf("应该有 1 次重定向，实际是 %d 次", len(resp.Redirects))
+	}
+	hop := resp.Redirects[0]
+	if hop.Status != http.StatusSeeOther || hop.Method != "POST" || hop.URL != server.URL+"/login" || hop.Location != server.URL+"/echo" {
+		t.Errorf("重定向记录错误: %+v", hop)
+	}
+	if got := hop.Headers.Get("Set-Cookie"); !strings.HasPrefix(got, "sid=abc") {
+		t.Errorf("重定向记录应该包含响应头 Set-Cookie，实际是 %q", got)
+	}
+}
+
+// TestRedirectCookiesAcrossHops 测试同 origin 的多跳重定向每跳只发送一份 Cookie，中间跳设置的 Cookie 覆盖同名 Cookie
+func TestRedirectCookiesAcrossHops(t *testing.T) {
+	var hopCookies []string
+	server := newRedirectServer(t, map[string]func(http.ResponseWriter, *http.Request){
+		"/a": func(w http.ResponseWriter, r *http.Request) {
+			hopCookies = append(hopCookies, strings.Join(r.Header.Values("Cookie"), "|"))
+			http.Redirect(w, r, "/b", http.StatusFound)
+		},
+		"/b": func(w http.ResponseWriter, r *http.Request) {
+			hopCookies = append(hopCookies, strings.Join(r.Header.Values("Cookie"), "|"))
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "new", Path: "/"})
+			http.Redirect(w, r, "/c", http.StatusFound)
+		},
+		"/c": func(w http.ResponseWriter, r *http.Request) {
+			hopCookies = append(hopCookies, strings.Join(r.Header.Values("Cookie"), "|"))
+			http.Redirect(w, r, "/echo", http.StatusFound)
+		},
+	})
+
+	options := fastls.Options{
+		Headers: map[string]string{"Cookie": "theme=dark; sid=old"},
+		Cookies: []fastls.Cookie{{Name: "lang", Value: "en"}},
+	}
+	imitate.Chrome142(&options)
+
+	resp, err := fastls.NewClient().Do(server.URL+"/a", options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	echoed := decodeEchoedRequest(t, resp)
+	hopCookies = append(hopCookies, strings.Join(echoed.Headers.Values("Cookie"), "|"))
+
+	want := []string{
+		"theme=dark; sid=old; lang=en",
+		"theme=dark; sid=old; lang=en",
+		"theme=dark; sid=new; lang=en",
+		"theme=dark; sid=new; lang=en",
+	}
+	if len(hopCookies) != len(want) {
+		t.Fatalf("应该经过 %d 跳，实际是 %d 跳: %q", len(want), len(hopCookies), hopCookies)
+	}
+	for i := range want {
+		if hopCookies[i] != want[i] {
+			t.Errorf("第 %d 跳的 Cookie 应该是 %q，实际是 %q", i+1, want[i], hopCookies[i])
+		}
+	}
+}
+
+// newRawH2RedirectServer 启动直接读写帧的 HTTP/2 服务，记录每个请求中的各个 Cookie 字段：/start 设置 Cookie 并重定向到 /next，
+// 其余路径返回 ok。标准库的 HTTP/2 服务端会合并 Cookie 字段，这里直接解码请求头
+func newRawH2RedirectServer(t *testing.T) (string, <-chan []string) {
+	t.Helper()
+	certServer := httptest.NewUnstartedServer(nil)
+	certServer.StartTLS()
+	t.Cleanup(certServer.Close)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certServer.TLS.Certificates, NextProtos: []string{"h2"}})
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	cookies := make(chan []string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveRawH2Redirect(conn, cookies)
+		}
+	}()
+	return "https://" + ln.Addr().String(), cookies
+}
+
+func serveRawH2Redirect(conn net.Conn, cookies chan<- []string) {
+	defer conn.Close()
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil || string(preface) != http2.ClientPreface {
+		return
+	}
+	fr := http2.NewFramer(conn, conn)
+	fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	_ = fr.WriteSettings()
+	for {
+		frame, err := fr.ReadFrame()
+		if err != nil {
+			return
+		}
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				_ = fr.WriteSettingsAck()
+			}
+		case *http2.MetaHeadersFrame:
+			var path string
+			var values []string
+			for _, field := range f.Fields {
+				switch field.Name {
+				case ":path":
+					path = field.Value
+				case "cookie":
+					values = append(values, field.Value)
+				}
+			}
+			cookies <- values
+			var block bytes.Buffer
+			encoder := hpack.NewEncoder(&block)
+			if path == "/start" {
+				_ = encoder.WriteField(hpack.HeaderField{Name: ":status", Value: "302"})
+				_ = encoder.WriteField(hpack.HeaderField{Name: "location", Value: "/next"})
+				_ = encoder.WriteField(hpack.HeaderField{Name: "set-cookie", Value: "sid=new; Path=/"})
+				_ = fr.WriteHeaders(http2.HeadersFrameParam{StreamID: f.StreamID, BlockFragment: block.Bytes(), EndHeaders: true, EndStream: true})
+				continue
+			}
+			_ = encoder.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+			_ = encoder.WriteField(hpack.HeaderField{Name: "content-length", Value: "2"})
+			_ = fr.WriteHeaders(http2.HeadersFrameParam{StreamID: f.StreamID, BlockFragment: block.Bytes(), EndHeaders: true})
+			_ = fr.WriteData(f.StreamID, true, []byte("ok"))
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				_ = fr.WritePing(true, f.Data)
+			}
+		}
+	}
+}
+
+// TestRedirectCookiesHTTP2 测试 HTTP/2 下重定向后的请求与第一个请求一样分别发送各个 Cookie 值
+func TestRedirectCookiesHTTP2(t *testing.T) {
+	url, cookies := newRawH2RedirectServer(t)
+	options := fastls.Options{Cookies: []fastls.Cookie{{Name: "lang", Value: "en"}}}
+	imitate.Chrome142(&options)
+	options.HeaderList.Add("Cookie", "theme=dark")
+	options.HeaderList.Add("Cookie", "sid=old; a=1")
+
+	resp, err := fastls.NewClient().Do(url+"/start", options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Protocol != "HTTP/2.0" {
+		t.Fatalf("应该使用 HTTP/2，实际是 %s", resp.Protocol)
+	}
+	want := [][]string{
+		{"theme=dark", "sid=old; a=1", "lang=en"},
+		{"theme=dark", "a=1", "sid=new", "lang=en"},
+	}
+	for i := range want {
+		if got := <-cookies; !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("第 %d 跳的 Cookie 字段应该是 %q，实际是 %q", i+1, want[i], got)
+		}
+	}
+}
+
+// TestRedirectTemporaryKeepsBody 测试 307 保留方法和请求体
+func TestRedirectTemporaryKeepsBody(t *testing.T) {
+	server := newRedirectServer(t, map[string]func(http.ResponseWriter, *http.Request){
+		"/submit": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/echo", http.StatusTemporaryRedirect)
+		},
+	})
+
+	options := fastls.Options{Body: `{"a":1}`}
+	imitate.Chrome142(&options)
+
+	resp, err := fastls.NewClient().Do(server.URL+"/submit", options, "POST")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	echoed := decodeEchoedRequest(t, resp)
+	if echoed.Method != "POST" || echoed.Body != `{"a":1}` {
+		t.Errorf("307 后应该保留 POST 和请求体，实际是 %s %q", echoed.Method, echoed.Body)
+	}
+}
+
+// TestRedirectCrossSite 测试跨站重定向时更新 Referer、Sec-Fetch-Site 并删除敏感请求头
+func TestRedirectCrossSite(t *testing.T) {
+	target := newRedirectServer(t, nil)
+	// localhost 与 127.0.0.1 不同站
+	targetURL := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+	source := newRedirectServer(t, map[string]func(http.ResponseWriter, *http.Request){
+		"/go": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, targetURL+"/echo", http.StatusFound)
+		},
+	})
+
+	options := fastls.Options{
+		Headers: map[string]string{
+			"Authorization": "Bearer secret",
+			"Referer":       source.URL + "/page?q=1",
+		},
+		Destination: fastls.DestinationEmpty,
+	}
+	imitate.Chrome142(&options)
+
+	resp, err := fastls.NewClient().Do(source.URL+"/go", options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	echoed := decodeEchoedRequest(t, resp)
+	if got := echoed.Headers.Get("Authorization"); got != "" {
+		t.Errorf("跨 origin 重定向不应该发送 Authorization，实际是 %q", got)
+	}
+	if got := echoed.Headers.Get("Referer"); got != source.URL+"/" {
+		t.Errorf("跨 origin 时 Referer 应该只保留 origin，实际是 %q", got)
+	}
+	if got := echoed.Headers.Get("Sec-Fetch-Site"); got != "cross-site" {
+		t.Errorf("Sec-Fetch-Site 应该是 cross-site，实际是 %q", got)
+	}
+	if got := echoed.Headers.Get("Host"); got != "" && !strings.HasPrefix(got, "localhost:") {
+		t.Errorf("Host 应该更新为重定向目标，实际是 %q", got)
+	}
+}
+
+// TestRedirectPolicy 测试最大重定向次数和 manual、error 模式
+func TestRedirectPolicy(t *testing.T) {
+	server := newRedirectServer(t, map[string]func(http.ResponseWriter, *http.Request){
+		"/loop": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		},
+	})
+
+	options := fastls.Options{Redirect: fastls.RedirectPolicy{MaxRedirects: 3}}
+	imitate.Chrome142(&options)
+	resp, err := fastls.NewClient().Do(server.URL+"/loop", options, "GET")
+	if !errors.Is(err, fastls.ErrTooManyRedirects) {
+		t.Fatalf("应该返回 ErrTooManyRedirects，实际是 %v", err)
+	}
+	if len(resp.Redirects) != 4 {
+		t.Errorf("应该记录 4 次重定向，实际是 %d 次", len(resp.Redirects))
+	}
+
+	options.Redirect = fastls.RedirectPolicy{Mode: fastls.RedirectManual}
+	resp, err = fastls.NewClient().Do(server.URL+"/loop", options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Status != http.StatusFound || len(resp.Redirects) != 0 {
+		t.Errorf("manual 模式应该直接返回 302，实际是 %d，重定向 %d 次", resp.Status, len(resp.Redirects))
+	}
+
+	options.Redirect = fastls.RedirectPolicy{Mode: fastls.RedirectError}
+	_, err = fastls.NewClient().Do(server.URL+"/loop", options, "GET")
+	if !errors.Is(err, fastls.ErrRedirectNotAllowed) {
+		t.Errorf("error 模式应该返回 ErrRedirectNotAllowed，实际是 %v", err)
+	}
+}
@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsAnswer 按 records（域名 -> IPv4 地址）回答 A 查询，未知域名返回 NXDOMAIN
+func dnsAnswer(t *testing.T, query []byte, records map[string]string) []byte {
+	t.Helper()
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil || len(msg.Questions) != 1 {
+		t.Errorf("无效的 DNS 查询: %v", err)
+		return nil
+	}
+	q := msg.Questions[0]
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: msg.ID, Response: true, RecursionAvailable: true},
+		Questions: msg.Questions,
+	}
+	ip, ok := records[strings.TrimSuffix(q.Name.String(), ".")]
+	if !ok {
+		resp.RCode = dnsmessage.RCodeNameError
+	} else if q.Type == dnsmessage.TypeA {
+		resp.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+			Body:   &dnsmessage.AResource{A: [4]byte(net.ParseIP(ip).To4())},
+		}}
+	}
+	packed, err := resp.Pack()
+	if err != nil {
+		t.Errorf("打包 DNS 响应失败: %v", err)
+	}
+	return packed
+}
+
+// countingResolver 记录查询次数的 StaticResolver
+type countingResolver struct {
+	fastls.StaticResolver
+	lookups atomic.Int32
+}
+
+func (r *countingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.lookups.Add(1)
+	return r.StaticResolver.LookupIPAddr(ctx, host)
+}
+
+// TestStaticResolver 测试按固定映射访问和未知域名不回退到系统 DNS
+func TestStaticResolver(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "https://"))
+
+	var dnsHosts []string
+	options := fastls.Options{
+		Resolver: &fastls.StaticResolver{Hosts: map[string][]string{"edge.fastls.test": {"127.0.0.1"}}},
+		Trace:    &fastls.ClientTrace{DNSStart: func(host string) { dnsHosts = append(dnsHosts, host) }},
+	}
+	imitate.Chrome(&options)
+	resp, err := fastls.NewClient().Do("https://edge.fastls.test:"+port+"/", options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "edge.fastls.test:"+port {
+		t.Errorf("Host 应该是 edge.fastls.test:%s，实际是 %s", port, body)
+	}
+	if resp.RemoteAddr != "127.0.0.1:"+port {
+		t.Errorf("应该连接 127.0.0.1:%s，实际是 %s", port, resp.RemoteAddr)
+	}
+	if len(dnsHosts) != 1 || dnsHosts[0] != "edge.fastls.test" {
+		t.Errorf("DNSStart 应该触发一次，实际是 %v", dnsHosts)
+	}
+
+	_, err = fastls.NewClient().Do("https://unknown.fastls.test:"+port+"/", options, "GET")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("未配置的域名应该返回 not found，实际是 %v", err)
+	}
+}
+
+// TestHappyEyeballs 测试 IPv6 地址不可用时回退到 IPv4
+func TestHappyEyeballs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+
+	// ::1 上没有监听，100::1 是丢弃前缀，连接会失败或超时
+	options := fastls.Options{Resolver: &fastls.StaticResolver{Hosts: map[string][]string{
+		"refused.fastls.test":   {"::1", "127.0.0.1"},
+		"blackhole.fastls.test": {"100::1", "127.0.0.1"},
+	}}}
+	imitate.Chrome(&options)
+	for _, host := range []string{"refused.fastls.test", "blackhole.fastls.test"} {
+		start := time.Now()
+		resp, err := fastls.NewClient().Do("http://"+host+":"+port+"/", options, "GET")
+		if err != nil {
+			t.Errorf("%s 请求失败: %v", host, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.RemoteAddr != "127.0.0.1:"+port {
+			t.Errorf("%s 应该回退到 IPv4，实际连接 %s", host, resp.RemoteAddr)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s 回退耗时 %v", host, elapsed)
+		}
+	}
+}
+
+// TestCachingResolver 测试缓存命中和过期
+func TestCachingResolver(t *testing.T) {
+	inner := &countingResolver{StaticResolver: fastls.StaticResolver{Hosts: map[string][]string{"cache.fastls.test": {"127.0.0.1"}}}}
+	resolver := &fastls.CachingResolver{Resolver: inner, TTL: 100 * time.Millisecond}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := resolver.LookupIPAddr(context.Background(), "cache.fastls.test"); err != nil {
+				t.Errorf("解析失败: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := resolver.LookupIPAddr(context.Background(), "CACHE.fastls.test"); err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if n := inner.lookups.Load(); n != 1 {
+		t.Errorf("缓存有效时应该只查询 1 次，实际 %d 次", n)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if _, err := resolver.LookupIPAddr(context.Background(), "cache.fastls.test"); err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if n := inner.lookups.Load(); n != 2 {
+		t.Errorf("缓存过期后应该重新查询，实际共 %d 次", n)
+	}
+}
+
+// TestDoHResolver 测试通过带指纹的 DoH 查询解析目标
+func TestDoHResolver(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(target.Close)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(target.URL, "http://"))
+
+	var mu sync.Mutex
+	var userAgents, accepts []string
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents = append(userAgents, r.UserAgent())
+		accepts = append(accepts, r.Header.Get("Accept"))
+		mu.Unlock()
+		query, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(dnsAnswer(t, query, map[string]string{"doh.fastls.test": "127.0.0.1"}))
+	}))
+	t.Cleanup(doh.Close)
+
+	dohOptions := fastls.Options{}
+	imitate.Chrome(&dohOptions)
+	options := fastls.Options{Resolver: &fastls.DoHResolver{URL: doh.URL + "/dns-query", Options: dohOptions}}
+	imitate.Chrome(&options)
+	resp, err := fastls.NewClient().Do("http://doh.fastls.test:"+port+"/", options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(userAgents) != 2 {
+		t.Fatalf("应该发送 A 和 AAAA 两个查询，实际 %d 个", len(userAgents))
+	}
+	for i := range userAgents {
+		if userAgents[i] != dohOptions.UserAgent || accepts[i] != "application/dns-message" {
+			t.Errorf("DoH 查询应该使用 imitate 的 User-Agent 和 DNS Accept，实际是 %q %q", userAgents[i], accepts[i])
+		}
+	}
+}
+
+// TestDoTResolver 测试 DNS-over-TLS 查询和 NXDOMAIN
+func TestDoTResolver(t *testing.T) {
+	// 借用 httptest 的证书，它对 example.com 和 127.0.0.1 有效
+	certServer := httptest.NewUnstartedServer(nil)
+	certServer.StartTLS()
+	t.Cleanup(certServer.Close)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", certServer.TLS)
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				resp := dnsAnswer(t, query, map[string]string{"dot.fastls.test": "127.0.0.1"})
+				_, _ = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+			}()
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certServer.Certificate())
+	resolver := &fastls.DoTResolver{
+		Addr:      listener.Addr().String(),
+		TLSConfig: &tls.Config{RootCAs: roots, ServerName: "example.com"},
+	}
+	addrs, err := resolver.LookupIPAddr(context.Background(), "dot.fastls.test")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if len(addrs) != 1 || !addrs[0].IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("应该解析为 127.0.0.1，实际是 %v", addrs)
+	}
+
+	_, err = resolver.LookupIPAddr(context.Background(), "missing.fastls.test")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("不存在的域名应该返回 not found，实际是 %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// TestResponseDetails 测试响应中的多值响应头、trailer、协议、远端地址和 TLS 信息
+func TestResponseDetails(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Multi", "a")
+		w.Header().Add("X-Multi", "b")
+		w.Header().Set("Trailer", "X-Checksum")
+		_, _ = w.Write([]byte("hello"))
+		w.Header().Set("X-Checksum", "123")
+	}))
+	t.Cleanup(server.Close)
+
+	options := fastls.Options{}
+	imitate.Chrome(&options)
+
+	// 使用域名访问，IP 地址不会发送 SNI 扩展
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	resp, err := fastls.NewClient().Do(url, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "hello" {
+		t.Fatalf("读取响应体失败: %q %v", body, err)
+	}
+
+	if got := resp.Header["X-Multi"]; !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("X-Multi 应该是 [a b]，实际是 %v", got)
+	}
+	if got := resp.Trailer.Get("X-Checksum"); got != "123" {
+		t.Errorf("trailer X-Checksum 应该是 123，实际是 %q", got)
+	}
+	if resp.Protocol != "HTTP/1.1" {
+		t.Errorf("协议应该是 HTTP/1.1，实际是 %s", resp.Protocol)
+	}
+	if resp.RemoteAddr != server.Listener.Addr().String() {
+		t.Errorf("远端地址应该是 %s，实际是 %s", server.Listener.Addr(), resp.RemoteAddr)
+	}
+
+	if resp.TLS == nil {
+		t.Fatal("https 响应应该包含 TLS 信息")
+	}
+	if resp.TLS.Version != tls.VersionTLS13 || resp.TLS.VersionName != "TLS 1.3" {
+		t.Errorf("TLS 版本应该是 TLS 1.3，实际是 %s", resp.TLS.VersionName)
+	}
+	if resp.TLS.CipherSuiteName == "" || resp.TLS.ALPN != "http/1.1" {
+		t.Errorf("密码套件或 ALPN 错误: %s %s", resp.TLS.CipherSuiteName, resp.TLS.ALPN)
+	}
+	if len(resp.TLS.PeerCertificates) == 0 || !resp.TLS.PeerCertificates[0].Equal(server.Certificate()) {
+		t.Error("证书链应该以服务器证书开头")
+	}
+	assertShuffledJA3(t, options.GetFingerprintValue(), resp.TLS.JA3)
+	// JA4 对扩展排序，不受扩展顺序随机化影响；ClientHello 较短，不发送 padding 扩展
+	if want := "t13d1515h2_8daaf6152771_f37e75b10bcc"; resp.TLS.JA4 != want {
+		t.Errorf("JA4 应该是 %s，实际是 %s", want, resp.TLS.JA4)
+	}
+}
+
+// TestResponsePlainHTTP 测试 http 响应没有 TLS 信息
+func TestResponsePlainHTTP(t *testing.T) {
+	server := newHeaderEchoServer(t)
+
+	options := fastls.Options{}
+	imitate.Chrome(&options)
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.TLS != nil {
+		t.Error("http 响应不应该包含 TLS 信息")
+	}
+	if resp.RemoteAddr != server.Listener.Addr().String() {
+		t.Errorf("远端地址应该是 %s，实际是 %s", server.Listener.Addr(), resp.RemoteAddr)
+	}
+	if resp.URL != server.URL {
+		t.Errorf("URL 应该是 %s，实际是 %s", server.URL, resp.URL)
+	}
+}
+
+// TestResponseDecodeJSON 测试将响应体解析到调用方提供的类型
+func TestResponseDecodeJSON(t *testing.T) {
+	server := newHeaderEchoServer(t)
+
+	options := fastls.Options{Headers: map[string]string{"X-Test": "1"}}
+	imitate.Chrome(&options)
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var headers http.Header
+	if err := resp.DecodeJSON(&headers); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if got := headers.Get("X-Test"); got != "1" {
+		t.Errorf("X-Test 应该是 1，实际是 %q", got)
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// newConnectProxy 启动一个本地 HTTP CONNECT 代理，返回代理地址和经过它的隧道数
+func newConnectProxy(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	var tunnels atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		tunnels.Add(1)
+		w.WriteHeader(http.StatusOK)
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		go func() {
+			_, _ = io.Copy(upstream, buf)
+			upstream.Close()
+		}()
+		_, _ = io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &tunnels
+}
+
+// TestRetryStatus 测试按状态码重试、Retry-After 和尝试次数
+func TestRetryStatus(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+
+	options := fastls.Options{Retry: fastls.RetryPolicy{MaxAttempts: 3, MinBackoff: 1}}
+	imitate.Chrome142(&options)
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Status != http.StatusOK || resp.Attempts != 3 || hits.Load() != 3 {
+		t.Errorf("应该在第 3 次成功，实际状态 %d，尝试 %d 次，服务端收到 %d 次", resp.Status, resp.Attempts, hits.Load())
+	}
+
+	// Retry-After 超过上限时直接返回
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(limited.Close)
+	resp, err = fastls.NewClient().Do(limited.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Status != http.StatusTooManyRequests || resp.Attempts != 1 {
+		t.Errorf("Retry-After 超过上限时不应该重试，实际状态 %d，尝试 %d 次", resp.Status, resp.Attempts)
+	}
+}
+
+// TestRetryIdempotency 测试默认不重试 POST，RetryNonIdempotent 时重新发送请求体
+func TestRetryIdempotency(t *testing.T) {
+	var hits atomic.Int32
+	var lastBody atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lastBody.Store(string(body))
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	options := fastls.Options{
+		RequestBody: fastls.NewJSONBody(map[string]string{"k": "v"}),
+		Retry:       fastls.RetryPolicy{MaxAttempts: 2, MinBackoff: 1},
+	}
+	imitate.Chrome142(&options)
+	resp, err := fastls.NewClient().Do(server.URL, options, "POST")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Status != http.StatusBadGateway || resp.Attempts != 1 {
+		t.Errorf("默认不应该重试 POST，实际状态 %d，尝试 %d 次", resp.Status, resp.Attempts)
+	}
+
+	hits.Store(0)
+	options.Retry.RetryNonIdempotent = true
+	resp, err = fastls.NewClient().Do(server.URL, options, "POST")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Status != http.StatusOK || resp.Attempts != 2 || lastBody.Load() != `{"k":"v"}` {
+		t.Errorf("应该重试并重新发送请求体，实际状态 %d，尝试 %d 次，请求体 %v", resp.Status, resp.Attempts, lastBody.Load())
+	}
+}
+
+// TestRetryRotatesProxy 测试连接失败后重新建立连接并轮换代理
+func TestRetryRotatesProxy(t *testing.T) {
+	server := newHeaderEchoServer(t)
+	proxyURL, tunnels := newConnectProxy(t)
+
+	// 先占用一个端口再关闭，得到一个拒绝连接的代理地址
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadProxy := "http://" + listener.Addr().String()
+	listener.Close()
+
+	options := fastls.Options{
+		Proxy: deadProxy,
+		Retry: fastls.RetryPolicy{MaxAttempts: 3, MinBackoff: 1, Proxies: []string{proxyURL}},
+	}
+	imitate.Chrome142(&options)
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Status != http.StatusOK || resp.Attempts != 2 || tunnels.Load() != 1 {
+		t.Errorf("应该通过轮换的代理在第 2 次成功，实际状态 %d，尝试 %d 次，隧道 %d 个", resp.Status, resp.Attempts, tunnels.Load())
+	}
+}
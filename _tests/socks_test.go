@@ -0,0 +1,389 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// socksServer 进程内的 SOCKS4/4a/5 代理，记录客户端请求的目标地址
+type socksServer struct {
+	t        *testing.T
+	addr     string
+	username string            // SOCKS5 用户名，为空时不要求认证
+	password string            // SOCKS5 密码
+	hosts    map[string]string // 代理端解析的域名
+
+	mu        sync.Mutex
+	targets   []string
+	udpClient string // 最近一次 UDP 中继收到的客户端地址
+}
+
+// newSocksServer 启动 SOCKS 代理，测试结束时关闭
+func newSocksServer(t *testing.T, username, password string, hosts map[string]string) *socksServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	s := &socksServer{t: t, addr: listener.Addr().String(), username: username, password: password, hosts: hosts}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// lastTarget 返回最近一次请求的目标地址
+func (s *socksServer) lastTarget() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.targets) == 0 {
+		return ""
+	}
+	return s.targets[len(s.targets)-1]
+}
+
+// resolve 记录目标地址，并把代理端配置的域名换成 IP
+func (s *socksServer) resolve(host string, port int) string {
+	s.mu.Lock()
+	s.targets = append(s.targets, net.JoinHostPort(host, strconv.Itoa(port)))
+	s.mu.Unlock()
+	if ip, ok := s.hosts[host]; ok {
+		host = ip
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+func (s *socksServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	version, err := r.ReadByte()
+	if err != nil {
+		return
+	}
+	switch version {
+	case 4:
+		s.serveSocks4(conn, r)
+	case 5:
+		s.serveSocks5(conn, r)
+	}
+}
+
+// readString 读取以 0 结尾的字符串
+func readString(r *bufio.Reader) string {
+	b, _ := r.ReadBytes(0)
+	return strings.TrimSuffix(string(b), "\x00")
+}
+
+func (s *socksServer) serveSocks4(conn net.Conn, r *bufio.Reader) {
+	var head [7]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil || head[0] != 1 {
+		return
+	}
+	port := int(binary.BigEndian.Uint16(head[1:3]))
+	host := net.IP(head[3:7]).String()
+	readString(r) // userid
+	if head[3] == 0 && head[4] == 0 && head[5] == 0 && head[6] != 0 {
+		host = readString(r)
+	}
+	upstream, err := net.Dial("tcp", s.resolve(host, port))
+	if err != nil {
+		_, _ = conn.Write([]byte{0, 0x5b, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	_, _ = conn.Write([]byte{0, 0x5a, 0, 0, 0, 0, 0, 0})
+	pipe(conn, r, upstream)
+}
+
+func (s *socksServer) serveSocks5(conn net.Conn, r *bufio.Reader) {
+	n, _ := r.ReadByte()
+	methods := make([]byte, n)
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return
+	}
+	if s.username != "" {
+		if !strings.ContainsRune(string(methods), 2) {
+			_, _ = conn.Write([]byte{5, 0xff})
+			return
+		}
+		_, _ = conn.Write([]byte{5, 2})
+		_, _ = r.ReadByte()
+		ulen, _ := r.ReadByte()
+		user := make([]byte, ulen)
+		_, _ = io.ReadFull(r, user)
+		plen, _ := r.ReadByte()
+		pass := make([]byte, plen)
+		_, _ = io.ReadFull(r, pass)
+		if string(user) != s.username || string(pass) != s.password {
+			_, _ = conn.Write([]byte{1, 1})
+			return
+		}
+		_, _ = conn.Write([]byte{1, 0})
+	} else {
+		_, _ = conn.Write([]byte{5, 0})
+	}
+
+	var head [3]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return
+	}
+	host, port, err := readSocksAddr(r)
+	if err != nil {
+		return
+	}
+	switch head[1] {
+	case 1:
+		upstream, err := net.Dial("tcp", s.resolve(host, port))
+		if err != nil {
+			_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		defer upstream.Close()
+		_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		pipe(conn, r, upstream)
+	case 3:
+		relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			return
+		}
+		defer relay.Close()
+		reply := []byte{5, 0, 0, 1, 127, 0, 0, 1}
+		reply = binary.BigEndian.AppendUint16(reply, uint16(relay.LocalAddr().(*net.UDPAddr).Port))
+		_, _ = conn.Write(reply)
+		go s.relayUDP(relay)
+		// 控制连接关闭时结束关联
+		_, _ = io.Copy(io.Discard, r)
+	default:
+		_, _ = conn.Write([]byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0})
+	}
+}
+
+// relayUDP 转发 SOCKS5 UDP 数据报
+func (s *socksServer) relayUDP(relay *net.UDPConn) {
+	var client *net.UDPAddr
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := relay.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if client == nil || from.String() == client.String() {
+			client = from
+			s.mu.Lock()
+			s.udpClient = from.IP.String()
+			s.mu.Unlock()
+			r := bufio.NewReader(strings.NewReader(string(buf[3:n])))
+			host, port, err := readSocksAddr(r)
+			if err != nil {
+				continue
+			}
+			dst, err := net.ResolveUDPAddr("udp", s.resolve(host, port))
+			if err != nil {
+				continue
+			}
+			payload, _ := io.ReadAll(r)
+			_, _ = relay.WriteToUDP(payload, dst)
+			continue
+		}
+		packet := []byte{0, 0, 0, 1}
+		packet = append(packet, from.IP.To4()...)
+		packet = binary.BigEndian.AppendUint16(packet, uint16(from.Port))
+		_, _ = relay.WriteToUDP(append(packet, buf[:n]...), client)
+	}
+}
+
+// readSocksAddr 读取 SOCKS5 格式的地址
+func readSocksAddr(r *bufio.Reader) (string, int, error) {
+	atyp, err := r.ReadByte()
+	if err != nil {
+		return "", 0, err
+	}
+	var host string
+	switch atyp {
+	case 1, 4:
+		ip := make(net.IP, map[byte]int{1: 4, 4: 16}[atyp])
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", 0, err
+		}
+		host = ip.String()
+	case 3:
+		n, _ := r.ReadByte()
+		name := make([]byte, n)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return "", 0, err
+		}
+		host = string(name)
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return "", 0, err
+	}
+	return host, int(binary.BigEndian.Uint16(port[:])), nil
+}
+
+// pipe 在客户端和上游之间双向复制数据
+func pipe(conn net.Conn, r io.Reader, upstream net.Conn) {
+	go func() {
+		_, _ = io.Copy(upstream, r)
+		upstream.Close()
+	}()
+	_, _ = io.Copy(conn, upstream)
+}
+
+// TestSocksProxy 测试 socks4、socks4a、socks5 和 socks5h 在本地或代理端解析域名
+func TestSocksProxy(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "https://"))
+	target := "https://socks.fastls.test:" + port + "/"
+
+	local := &fastls.StaticResolver{Hosts: map[string][]string{"socks.fastls.test": {"127.0.0.1"}}}
+	// 代理端解析时本地解析会失败
+	remote := &fastls.StaticResolver{}
+	proxy := newSocksServer(t, "", "", map[string]string{"socks.fastls.test": "127.0.0.1"})
+
+	tests := []struct {
+		scheme   string
+		resolver fastls.Resolver
+		target   string
+	}{
+		{"socks4", local, "127.0.0.1:" + port},
+		{"socks4a", remote, "socks.fastls.test:" + port},
+		{"socks5", local, "127.0.0.1:" + port},
+		{"socks5h", remote, "socks.fastls.test:" + port},
+	}
+	for _, tt := range tests {
+		options := fastls.Options{Proxy: tt.scheme + "://" + proxy.addr, Resolver: tt.resolver}
+		imitate.Chrome(&options)
+		resp, err := fastls.NewClient().Do(target, options, "GET")
+		if err != nil {
+			t.Errorf("%s 请求失败: %v", tt.scheme, err)
+			continue
+		}
+		resp.Body.Close()
+		if got := proxy.lastTarget(); got != tt.target {
+			t.Errorf("%s 的目标地址应该是 %s，实际是 %s", tt.scheme, tt.target, got)
+		}
+	}
+}
+
+// TestSocksAuth 测试 SOCKS5 用户名密码认证
+func TestSocksAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+	proxy := newSocksServer(t, "user", "secret", nil)
+
+	options := fastls.Options{Proxy: "socks5h://user:secret@" + proxy.addr}
+	imitate.Chrome(&options)
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("认证成功时请求失败: %v", err)
+	}
+	resp.Body.Close()
+
+	options.Proxy = "socks5h://user:wrong@" + proxy.addr
+	if _, err := fastls.NewClient().Do(server.URL, options, "GET"); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("密码错误时应该返回认证失败，实际是 %v", err)
+	}
+	options.Proxy = "socks5h://" + proxy.addr
+	if _, err := fastls.NewClient().Do(server.URL, options, "GET"); err == nil {
+		t.Error("未提供密码时请求应该失败")
+	}
+}
+
+// TestSocksContext 测试代理不响应时 context 超时中止握手
+func TestSocksContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// 接受连接但从不应答
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	options := fastls.Options{Proxy: "socks5h://" + listener.Addr().String(), Context: ctx}
+	imitate.Chrome(&options)
+	start := time.Now()
+	if _, err := fastls.NewClient().Do("http://example.com/", options, "GET"); err == nil {
+		t.Fatal("代理不响应时请求应该失败")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("context 超时后应该立即返回，实际耗时 %v", elapsed)
+	}
+}
+
+// TestSocksHTTP3 测试 HTTP/3 通过 SOCKS5 UDP ASSOCIATE 发送，UDP 中继使用绑定的源地址
+//
+// HTTP/3 校验服务端证书，测试证书不受信任，握手以证书错误结束；
+// 收到服务端证书说明 QUIC 数据报经 UDP 中继往返
+func TestSocksHTTP3(t *testing.T) {
+	certServer := httptest.NewUnstartedServer(nil)
+	certServer.StartTLS()
+	t.Cleanup(certServer.Close)
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("监听 UDP 失败: %v", err)
+	}
+	h3Server := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: certServer.TLS.Certificates}),
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	}
+	go func() { _ = h3Server.Serve(udpConn) }()
+	t.Cleanup(func() { h3Server.Close() })
+	port := strconv.Itoa(udpConn.LocalAddr().(*net.UDPAddr).Port)
+
+	proxy := newSocksServer(t, "", "", map[string]string{"h3.fastls.test": "127.0.0.1"})
+	options := fastls.Options{
+		Proxy:       "socks5h://" + proxy.addr,
+		Resolver:    &fastls.StaticResolver{},
+		Fingerprint: fastls.Ja4Fingerprint{FingerprintValue: "q13d0310h3_1301,1302,1303_000a,000d,0010,002b,002d,0033_0403,0804,0401"},
+		LocalAddr:   "127.0.0.2",
+	}
+	_, err = fastls.NewClient().Do("https://h3.fastls.test:"+port+"/", options, "GET")
+	if err == nil || !strings.Contains(err.Error(), "x509") {
+		t.Fatalf("应该收到服务端证书并校验失败，实际是 %v", err)
+	}
+	if got := proxy.lastTarget(); got != "h3.fastls.test:"+port {
+		t.Errorf("UDP 目标应该由代理解析，实际是 %s", got)
+	}
+	proxy.mu.Lock()
+	udpClient := proxy.udpClient
+	proxy.mu.Unlock()
+	if udpClient != "127.0.0.2" {
+		t.Errorf("UDP 中继的源地址应该是 127.0.0.2，实际是 %s", udpClient)
+	}
+}
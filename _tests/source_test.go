@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// newSourceServer 返回把客户端地址作为响应体的服务
+func newSourceServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		_, _ = w.Write([]byte(host))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// sourceOf 发送请求并返回服务看到的客户端地址
+func sourceOf(t *testing.T, url string, options fastls.Options) string {
+	t.Helper()
+	resp, err := fastls.NewClient().Do(url, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+// TestLocalAddr 测试绑定本地地址和网卡
+func TestLocalAddr(t *testing.T) {
+	server := newSourceServer(t)
+
+	options := fastls.Options{LocalAddr: "127.0.0.2"}
+	imitate.Chrome(&options)
+	if source := sourceOf(t, server.URL, options); source != "127.0.0.2" {
+		t.Errorf("源地址应该是 127.0.0.2，实际是 %s", source)
+	}
+
+	// 只有 IPv6 源地址时无法连接 IPv4 目标
+	options.LocalAddr = "::1"
+	if _, err := fastls.NewClient().Do(server.URL, options, "GET"); err == nil {
+		t.Error("没有 IPv4 源地址时请求应该失败")
+	}
+
+	options.LocalAddr = "not-an-ip"
+	if _, err := fastls.NewClient().Do(server.URL, options, "GET"); err == nil {
+		t.Error("无效的本地地址应该返回错误")
+	}
+
+	loopback := ""
+	interfaces, _ := net.Interfaces()
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			loopback = iface.Name
+		}
+	}
+	if loopback == "" {
+		t.Skip("没有回环网卡")
+	}
+	options = fastls.Options{Interface: loopback}
+	imitate.Chrome(&options)
+	if source := sourceOf(t, server.URL, options); source != "127.0.0.1" {
+		t.Errorf("绑定 %s 时源地址应该是 127.0.0.1，实际是 %s", loopback, source)
+	}
+}
+
+// TestSourcePool 测试源地址按请求轮换、按会话固定以及从前缀中生成
+func TestSourcePool(t *testing.T) {
+	server := newSourceServer(t)
+	pool := &fastls.SourcePool{Addrs: []string{"127.0.0.2", "127.0.0.3", "::1"}}
+
+	options := fastls.Options{SourcePool: pool}
+	imitate.Chrome(&options)
+	var sources []string
+	for range 4 {
+		sources = append(sources, sourceOf(t, server.URL, options))
+	}
+	if strings.Join(sources, ",") != "127.0.0.2,127.0.0.3,127.0.0.2,127.0.0.3" {
+		t.Errorf("每个请求应该轮换 IPv4 源地址，实际是 %v", sources)
+	}
+
+	options.SourceSession = "session-a"
+	first := sourceOf(t, server.URL, options)
+	for range 3 {
+		if source := sourceOf(t, server.URL, options); source != first {
+			t.Errorf("同一会话应该使用相同的源地址 %s，实际是 %s", first, source)
+		}
+	}
+	options.SourceSession = "session-b"
+	if source := sourceOf(t, server.URL, options); source == first {
+		t.Errorf("不同会话应该轮换到其他源地址，实际都是 %s", source)
+	}
+
+	options = fastls.Options{SourcePool: &fastls.SourcePool{Addrs: []string{"127.0.0.2", "127.0.0.3", "127.0.0.4"}, SessionTTL: 50 * time.Millisecond}}
+	imitate.Chrome(&options)
+	options.SourceSession = "session-a"
+	_ = sourceOf(t, server.URL, options)
+	time.Sleep(60 * time.Millisecond)
+	options.SourceSession = "session-b"
+	_ = sourceOf(t, server.URL, options)
+	options.SourceSession = "session-a"
+	if source := sourceOf(t, server.URL, options); source != "127.0.0.4" {
+		t.Errorf("空闲超过 SessionTTL 的会话应该重新选择源地址 127.0.0.4，实际是 %s", source)
+	}
+
+	options = fastls.Options{SourcePool: &fastls.SourcePool{Addrs: []string{"127.0.1.0/24"}}}
+	imitate.Chrome(&options)
+	seen := map[string]bool{}
+	for range 5 {
+		source := sourceOf(t, server.URL, options)
+		ip := net.ParseIP(source)
+		if ip == nil || !strings.HasPrefix(source, "127.0.1.") || source == "127.0.1.0" || source == "127.0.1.255" {
+			t.Fatalf("源地址应该在 127.0.1.0/24 中且不是网络或广播地址，实际是 %s", source)
+		}
+		seen[source] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("前缀中的源地址应该随机生成，实际是 %v", seen)
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// traceEvents 按顺序记录触发的回调
+type traceEvents struct {
+	mu     sync.Mutex
+	events []string
+	hello  []byte
+	proxy  string
+}
+
+func (e *traceEvents) add(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+// index 返回 event 第一次出现的位置，未出现时返回 -1
+func (e *traceEvents) index(event string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, v := range e.events {
+		if v == event {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *traceEvents) trace() *fastls.ClientTrace {
+	return &fastls.ClientTrace{
+		DNSStart:     func(string) { e.add("DNSStart") },
+		DNSDone:      func([]net.IPAddr, error) { e.add("DNSDone") },
+		ConnectStart: func(string, string) { e.add("ConnectStart") },
+		ConnectDone:  func(string, string, error) { e.add("ConnectDone") },
+		ProxyConnectStart: func(proxyURL, _ string) {
+			e.mu.Lock()
+			e.proxy = proxyURL
+			e.mu.Unlock()
+			e.add("ProxyConnectStart")
+		},
+		ProxyConnectDone:  func(string, string, error) { e.add("ProxyConnectDone") },
+		TLSHandshakeStart: func(string) { e.add("TLSHandshakeStart") },
+		TLSHandshakeDone: func(info *fastls.TLSInfo, err error) {
+			if err == nil && info != nil {
+				e.mu.Lock()
+				e.hello = info.ClientHello
+				e.mu.Unlock()
+			}
+			e.add("TLSHandshakeDone")
+		},
+		GotConn:              func(string, bool) { e.add("GotConn") },
+		WroteRequest:         func(error) { e.add("WroteRequest") },
+		GotFirstResponseByte: func() { e.add("GotFirstResponseByte") },
+	}
+}
+
+// TestTraceTLS 测试直连 HTTPS 时回调的顺序、ClientHello 和耗时
+func TestTraceTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+
+	events := &traceEvents{}
+	options := fastls.Options{Trace: events.trace()}
+	imitate.Chrome(&options)
+
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	resp, err := fastls.NewClient().Do(url, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+
+	order := []string{"DNSStart", "DNSDone", "ConnectStart", "ConnectDone", "TLSHandshakeStart", "TLSHandshakeDone", "GotConn", "WroteRequest", "GotFirstResponseByte"}
+	last := -1
+	for _, event := range order {
+		i := events.index(event)
+		if i <= last {
+			t.Fatalf("回调 %s 缺失或顺序错误: %v", event, events.events)
+		}
+		last = i
+	}
+	if events.index("ProxyConnectStart") != -1 {
+		t.Error("未使用代理时不应该触发 ProxyConnectStart")
+	}
+	if len(events.hello) == 0 || events.hello[0] != 1 {
+		t.Error("TLSHandshakeDone 应该带有实际发送的 ClientHello")
+	}
+
+	timing := resp.Timing
+	if timing == nil {
+		t.Fatal("Response.Timing 不应该为空")
+	}
+	if timing.TLSHandshake <= 0 || timing.Total <= 0 || timing.Total < timing.TLSHandshake {
+		t.Errorf("耗时错误: %+v", timing)
+	}
+	if timing.ConnReused {
+		t.Error("新连接的 ConnReused 应该为 false")
+	}
+}
+
+// TestTraceProxy 测试通过代理时触发代理回调，且代理 URL 不包含密码
+func TestTraceProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	proxyURL, tunnels := newConnectProxy(t)
+
+	events := &traceEvents{}
+	options := fastls.Options{Trace: events.trace(), Proxy: strings.Replace(proxyURL, "http://", "http://user:secret@", 1)}
+	imitate.Chrome(&options)
+
+	resp, err := fastls.NewClient().Do(server.URL, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+
+	if tunnels.Load() != 1 {
+		t.Fatalf("应该通过代理建立 1 个隧道，实际是 %d", tunnels.Load())
+	}
+	start, done := events.index("ProxyConnectStart"), events.index("ProxyConnectDone")
+	if start == -1 || done <= start {
+		t.Fatalf("代理回调缺失或顺序错误: %v", events.events)
+	}
+	if strings.Contains(events.proxy, "secret") {
+		t.Errorf("代理 URL 不应该包含密码: %s", events.proxy)
+	}
+	if resp.Timing == nil || resp.Timing.ProxyConnect <= 0 {
+		t.Errorf("代理耗时错误: %+v", resp.Timing)
+	}
+}
@@ -0,0 +1,435 @@
+package fastls
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	http "github.com/FastTLS/fhttp"
+)
+
+const (
+	// defaultAltSvcMaxAge Alt-Svc 未指定 ma 时的有效期（RFC 7838）
+	defaultAltSvcMaxAge = 24 * time.Hour
+	// defaultAltSvcRaceDelay HTTP/3 请求多久未完成时放弃 QUIC 握手或并行通过 TCP 发送
+	defaultAltSvcRaceDelay = 300 * time.Millisecond
+	// 与 Chrome 相同，QUIC 失败后 5 分钟内不再尝试，连续失败时加倍，最长 48 小时
+	altSvcBrokenDelay    = 5 * time.Minute
+	altSvcBrokenMaxDelay = 48 * time.Hour
+	// defaultHTTPSRecordTTL 没有 HTTPS 记录或查询失败时，多久后重新查询
+	defaultHTTPSRecordTTL = 5 * time.Minute
+)
+
+// defaultQUICFingerprint 没有设置 QUICFingerprint 时升级 HTTP/3 记录的 Chrome QUIC 指纹
+var defaultQUICFingerprint = Ja4Fingerprint{FingerprintValue: "q13d0311h3_1301,1302,1303_000a,000d,001b,002b,002d,0033,0039,44cd,fe0d_0403,0804,0401,0503,0805,0501,0806,0601"}
+
+// AltSvcCache 记录 origin 通过 Alt-Svc 响应头或 DNS HTTPS 记录声明的 HTTP/3 端点，需在请求间复用，每个会话使用各自的实例
+//
+// 与浏览器相同，第一个请求通过 TCP 发送，之后对同一 origin 的请求改用 HTTP/3，QUIC 握手由 crypto/tls 完成。
+// QUIC 握手在 RaceDelay 内未完成时本次请求改用 TCP；握手完成但 RaceDelay 内没有响应时，幂等请求同时通过 TCP 发送，
+// 使用先成功的响应；QUIC 连接失败时请求改用 TCP 发送，
+// 该端点 5 分钟内不再尝试，连续失败时时间加倍。配合 HTTP3Pool 使用时放弃的握手继续完成，连接供之后的请求使用。
+// 请求体不能重放（没有 GetBody）的请求不升级。零值可用，字段在第一次使用后不能再修改
+type AltSvcCache struct {
+	RaceDelay time.Duration // HTTP/3 请求多久未完成时放弃 QUIC 握手或并行通过 TCP 发送，为 0 时为 300ms
+	// HTTPSRecords 不为空时在 origin 没有 Alt-Svc 记录时查询 DNS HTTPS 记录，ALPN 包含 h3 时第一个请求就使用 HTTP/3
+	HTTPSRecords HTTPSRecordResolver
+
+	mu      sync.Mutex
+	entries map[string]altSvcEntry   // origin 地址 -> HTTP/3 端点
+	queried map[string]time.Time     // origin 地址 -> 下次查询 HTTPS 记录的时间
+	broken  map[string]*brokenAltSvc // 端点地址 -> 失败记录
+}
+
+// altSvcEntry origin 的 HTTP/3 端点
+type altSvcEntry struct {
+	addr    string // 连接的地址，主机名为空时已替换为 origin 的主机名
+	expires time.Time
+}
+
+// brokenAltSvc 端点连续失败的次数和恢复尝试的时间
+type brokenAltSvc struct {
+	failures int
+	until    time.Time
+}
+
+// lookup 返回 origin 未过期且没有被标记为失败的 HTTP/3 端点
+func (c *AltSvcCache) lookup(origin string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[origin]
+	if !ok {
+		return "", false
+	}
+	now := time.Now()
+	if now.After(entry.expires) {
+		delete(c.entries, origin)
+		return "", false
+	}
+	if b := c.broken[entry.addr]; b != nil && now.Before(b.until) {
+		return "", false
+	}
+	return entry.addr, true
+}
+
+// record 按响应的 Alt-Svc 响应头更新 origin 的端点，新的响应头替换之前的记录
+func (c *AltSvcCache) record(origin string, header http.Header) {
+	values := header.Values("Alt-Svc")
+	if len(values) == 0 {
+		return
+	}
+	addr, maxAge, ok := parseAltSvc(strings.Join(values, ","), origin)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !ok {
+		delete(c.entries, origin)
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]altSvcEntry)
+	}
+	c.entries[origin] = altSvcEntry{addr: addr, expires: time.Now().Add(maxAge)}
+}
+
+// discover origin 没有记录时查询 DNS HTTPS 记录，结果按记录的 TTL 缓存
+func (c *AltSvcCache) discover(ctx context.Context, origin string) {
+	if c.HTTPSRecords == nil {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	_, known := c.entries[origin]
+	next, queried := c.queried[origin]
+	if known || (queried && now.Before(next)) {
+		c.mu.Unlock()
+		return
+	}
+	if c.queried == nil {
+		c.queried = make(map[string]time.Time)
+	}
+	c.queried[origin] = now.Add(defaultHTTPSRecordTTL)
+	c.mu.Unlock()
+
+	host, port, _ := net.SplitHostPort(origin)
+	name := host
+	if port != "443" {
+		// 非默认端口的 origin 查询 _port._https 前缀的名称（RFC 9460）
+		name = "_" + port + "._https." + host
+	}
+	records, err := c.HTTPSRecords.LookupHTTPS(ctx, name)
+	if err != nil {
+		return
+	}
+	addr, ttl, ok := httpsRecordEndpoint(records, host, port)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !ok {
+		return
+	}
+	c.queried[origin] = now.Add(ttl)
+	if _, known := c.entries[origin]; known {
+		// 查询期间收到的 Alt-Svc 优先
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]altSvcEntry)
+	}
+	c.entries[origin] = altSvcEntry{addr: addr, expires: now.Add(ttl)}
+}
+
+// markBroken 标记端点的 QUIC 连接失败，返回之后多久内不再尝试
+func (c *AltSvcCache) markBroken(addr string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.broken == nil {
+		c.broken = make(map[string]*brokenAltSvc)
+	}
+	b := c.broken[addr]
+	if b == nil {
+		b = &brokenAltSvc{}
+		c.broken[addr] = b
+	}
+	delay := altSvcBrokenDelay << b.failures
+	if delay > altSvcBrokenMaxDelay || delay <= 0 {
+		delay = altSvcBrokenMaxDelay
+	} else {
+		b.failures++
+	}
+	b.until = time.Now().Add(delay)
+	return delay
+}
+
+// confirm 端点的 HTTP/3 请求成功，清除失败记录
+func (c *AltSvcCache) confirm(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.broken, addr)
+}
+
+// raceDelay 返回 QUIC 握手的等待时间
+func (c *AltSvcCache) raceDelay() time.Duration {
+	if c.RaceDelay > 0 {
+		return c.RaceDelay
+	}
+	return defaultAltSvcRaceDelay
+}
+
+// parseAltSvc 返回 Alt-Svc 中第一个 h3 端点和有效期，为 clear 或没有 h3 端点时 ok 为 false
+func parseAltSvc(value, origin string) (addr string, maxAge time.Duration, ok bool) {
+	originHost, _, _ := net.SplitHostPort(origin)
+	for _, alt := range strings.Split(value, ",") {
+		params := strings.Split(alt, ";")
+		protocol, authority, found := strings.Cut(strings.TrimSpace(params[0]), "=")
+		if !found || protocol != "h3" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(strings.Trim(authority, `"`))
+		if err != nil {
+			continue
+		}
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			continue
+		}
+		if host == "" {
+			host = originHost
+		}
+		maxAge = defaultAltSvcMaxAge
+		for _, param := range params[1:] {
+			key, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "ma") {
+				if seconds, err := strconv.ParseInt(strings.Trim(v, `"`), 10, 64); err == nil && seconds >= 0 {
+					maxAge = time.Duration(seconds) * time.Second
+				}
+			}
+		}
+		if maxAge == 0 {
+			continue
+		}
+		return net.JoinHostPort(host, port), maxAge, true
+	}
+	return "", 0, false
+}
+
+// httpsRecordEndpoint 返回 HTTPS 记录中优先级最高且支持 h3 的端点
+func httpsRecordEndpoint(records []HTTPSRecord, host, port string) (addr string, ttl time.Duration, ok bool) {
+	var best *HTTPSRecord
+	for i := range records {
+		r := &records[i]
+		// 优先级为 0 的别名记录不跟随
+		if r.Priority == 0 || !slices.Contains(r.ALPN, "h3") {
+			continue
+		}
+		if best == nil || r.Priority < best.Priority {
+			best = r
+		}
+	}
+	if best == nil {
+		return "", 0, false
+	}
+	target := strings.TrimSuffix(best.Target, ".")
+	if target == "" {
+		target = host
+	}
+	if best.Port != 0 {
+		port = strconv.Itoa(int(best.Port))
+	}
+	ttl = best.TTL
+	if ttl < defaultCacheTTL {
+		ttl = defaultCacheTTL
+	}
+	return net.JoinHostPort(target, port), ttl, true
+}
+
+// quicFingerprintFor 返回升级 HTTP/3 记录的指纹：fingerprint 不为空时使用它，Fingerprint 本身是 QUIC 指纹时使用它，
+// 否则使用抓取的 Chrome QUIC 指纹。QUIC 的 ClientHello 由 crypto/tls 生成，该指纹不改变握手
+func quicFingerprintFor(fingerprint, tcp Fingerprint) Fingerprint {
+	if fingerprint != nil && !fingerprint.IsEmpty() {
+		return fingerprint
+	}
+	if tcp != nil && strings.HasPrefix(tcp.Value(), "q") {
+		return tcp
+	}
+	return defaultQUICFingerprint
+}
+
+// altSvcEndpoint 返回请求应该升级到的 HTTP/3 端点
+func (rt *roundTripper) altSvcEndpoint(req *http.Request, origin string) (string, bool) {
+	if rt.altSvc == nil || !strings.EqualFold(req.URL.Scheme, "https") || strings.HasPrefix(rt.Fingerprint.Value(), "q") {
+		return "", false
+	}
+	// 改用 TCP 时需要重新发送请求体
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return "", false
+	}
+	rt.altSvc.discover(req.Context(), origin)
+	return rt.altSvc.lookup(origin)
+}
+
+// altSvcResult HTTP/3 或 TCP 请求的结果
+type altSvcResult struct {
+	resp *http.Response
+	err  error
+}
+
+// discardAltSvcResult 在后台等待竞速失败的一方返回并关闭它的响应体
+func discardAltSvcResult(results <-chan altSvcResult) {
+	if results == nil {
+		return
+	}
+	go func() {
+		if r := <-results; r.err == nil {
+			_ = r.resp.Body.Close()
+		}
+	}()
+}
+
+// roundTripAltSvc 通过 HTTP/3 端点发送请求，与 Chrome 相同，RaceDelay 内没有完成时改用或并行使用 TCP
+//
+// QUIC 连接在 RaceDelay 内未建立时放弃 QUIC，本次请求改用 TCP。连接已建立时请求可能已经发出：
+// 幂等请求并行通过 TCP 重发，使用先成功的响应，其他请求继续等待 HTTP/3 的响应。
+// QUIC 连接失败时请求改用 TCP，并标记该端点失败
+func (rt *roundTripper) roundTripAltSvc(req *http.Request, origin, alt string) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+
+	// connected 获得 QUIC 连接后请求可能已经发出；abandoned 竞速超时放弃 QUIC
+	var mu sync.Mutex
+	var connected, abandoned bool
+	h3 := rt.newHTTP3Transport(rt.quicFingerprint)
+	h3.altAddr = alt
+	h3.detachDial = true
+	h3.onConn = func() {
+		mu.Lock()
+		connected = true
+		mu.Unlock()
+	}
+	rt.logger.Debug("protocol selected", slog.String("phase", phaseProtocol), slog.String("protocol", "h3"), slog.String("alt-svc", alt))
+
+	quic := make(chan altSvcResult, 1)
+	go func() {
+		resp, err := h3.RoundTrip(req.WithContext(ctx))
+		quic <- altSvcResult{resp, err}
+	}()
+	timer := time.NewTimer(rt.altSvc.raceDelay())
+	defer timer.Stop()
+	idempotent := idempotentMethods[strings.ToUpper(req.Method)]
+	var r altSvcResult
+	select {
+	case r = <-quic:
+	case <-timer.C:
+		mu.Lock()
+		abandoned = !connected
+		mu.Unlock()
+		switch {
+		case abandoned && idempotent:
+			cancel()
+			discardAltSvcResult(quic)
+			rt.logger.Debug("quic slower than tcp, falling back", slog.String("phase", phaseQUIC), slog.String("alt-svc", alt))
+			return rt.fallbackTCP(req, origin)
+		case abandoned:
+			cancel()
+		case idempotent:
+			return rt.raceTCP(req, origin, alt, quic, cancel)
+		}
+		r = <-quic
+	}
+	if r.err == nil {
+		rt.altSvc.confirm(alt)
+		rt.altSvc.record(origin, r.resp.Header)
+		// 响应体是流式读取的，读完或关闭后才取消请求的 context
+		r.resp.Body = &releaseBody{ReadCloser: r.resp.Body, release: cancel}
+		return r.resp, nil
+	}
+	cancel()
+
+	mu.Lock()
+	sent := connected
+	mu.Unlock()
+	switch {
+	case req.Context().Err() != nil:
+		return nil, r.err
+	case sent:
+		// 请求可能已经发出，包括放弃后连接才建立的情况
+		return nil, r.err
+	case abandoned:
+		rt.logger.Debug("quic slower than tcp, falling back", slog.String("phase", phaseQUIC), slog.String("alt-svc", alt))
+	default:
+		delay := rt.altSvc.markBroken(alt)
+		rt.logger.Warn("quic broken, falling back to tcp", slog.String("phase", phaseQUIC), slog.String("alt-svc", alt),
+			slog.Duration("retry_after", delay), slog.Any("error", r.err))
+	}
+	return rt.fallbackTCP(req, origin)
+}
+
+// raceTCP QUIC 连接已建立但 RaceDelay 内没有响应时，幂等请求同时通过 TCP 发送，返回先成功的响应，
+// 取消另一方。两边都失败时返回 TCP 的错误
+func (rt *roundTripper) raceTCP(req *http.Request, origin, alt string, quic <-chan altSvcResult, cancelQUIC context.CancelFunc) (*http.Response, error) {
+	tcpReq, err := rewindRequest(req)
+	if err != nil {
+		cancelQUIC()
+		discardAltSvcResult(quic)
+		return nil, err
+	}
+	rt.logger.Debug("quic stalled, racing tcp", slog.String("phase", phaseQUIC), slog.String("alt-svc", alt))
+	ctx, cancelTCP := context.WithCancel(req.Context())
+	tcp := make(chan altSvcResult, 1)
+	go func() {
+		resp, err := rt.roundTripTCP(tcpReq.Clone(ctx), origin)
+		tcp <- altSvcResult{resp, err}
+	}()
+
+	var tcpErr error
+	for quic != nil || tcp != nil {
+		select {
+		case r := <-quic:
+			quic = nil
+			if r.err == nil {
+				cancelTCP()
+				discardAltSvcResult(tcp)
+				rt.altSvc.confirm(alt)
+				rt.altSvc.record(origin, r.resp.Header)
+				r.resp.Body = &releaseBody{ReadCloser: r.resp.Body, release: cancelQUIC}
+				return r.resp, nil
+			}
+			cancelQUIC()
+		case r := <-tcp:
+			tcp = nil
+			if r.err == nil {
+				cancelQUIC()
+				discardAltSvcResult(quic)
+				r.resp.Body = &releaseBody{ReadCloser: r.resp.Body, release: cancelTCP}
+				return r.resp, nil
+			}
+			cancelTCP()
+			tcpErr = r.err
+		}
+	}
+	return nil, tcpErr
+}
+
+// fallbackTCP 放弃 HTTP/3 后通过 TCP 重新发送请求
+func (rt *roundTripper) fallbackTCP(req *http.Request, origin string) (*http.Response, error) {
+	req, err := rewindRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return rt.roundTripTCP(req, origin)
+}
+
+// rewindRequest 返回请求体可以重新读取的请求副本，没有请求体时返回 req
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.GetBody == nil {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = body
+	return req, nil
+}
@@ -0,0 +1,205 @@
+package fastls
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultBatchWorkers 未设置 BatchOptions.Workers 时的并发数
+const defaultBatchWorkers = 10
+
+// BatchRequest 批量请求中的一个请求
+type BatchRequest struct {
+	URL     string
+	Method  string
+	Options Options
+}
+
+// BatchResult 一个请求的结果，Err 不为空时请求失败；Response.Body 需由调用方关闭
+type BatchResult struct {
+	Index    int // 请求在提交列表中的位置
+	Request  BatchRequest
+	Response Response
+	Err      error
+}
+
+// BatchOptions 批量请求的选项
+type BatchOptions struct {
+	Workers int  // 同时执行的请求数，为 0 时为 10
+	Ordered bool // 按提交顺序返回结果，否则按完成顺序返回
+	// 以下字段在请求本身未设置时共享给所有请求，使它们属于同一个会话
+	ClientHints *ClientHints
+	Limiter     *Limiter
+}
+
+// BatchProgress 批量请求的进度
+type BatchProgress struct {
+	Total     int // 请求总数
+	Started   int // 已开始的请求数
+	Completed int // 已完成的请求数，包括失败和取消
+	Failed    int // 失败或被取消的请求数
+}
+
+// Batch 正在执行的批量请求
+type Batch struct {
+	results chan BatchResult
+	cancel  context.CancelFunc
+	total   int
+
+	started   atomic.Int64
+	completed atomic.Int64
+	failed    atomic.Int64
+	// bodies 统计尚未读完或关闭的响应体，响应体依赖请求的 context，全部结束后才取消它
+	bodies sync.WaitGroup
+}
+
+// Batch 在有界的 goroutine 池中执行 requests，通过 Results 返回每个请求的结果
+//
+// ctx 取消或调用 Cancel 后，尚未开始的请求以 ctx 的错误返回；请求设置了 Options.Context 时使用请求自己的 context
+func (client Fastls) Batch(ctx context.Context, requests []BatchRequest, opts BatchOptions) *Batch {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	b := &Batch{
+		results: make(chan BatchResult, len(requests)),
+		cancel:  cancel,
+		total:   len(requests),
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+	if workers > len(requests) {
+		workers = len(requests)
+	}
+
+	jobs := make(chan int)
+	done := make(chan BatchResult)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				done <- b.run(ctx, client, index, requests[index], opts)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for index := range requests {
+			select {
+			case jobs <- index:
+			case <-ctx.Done():
+				// 取消后不再分发，剩余请求直接返回 ctx 的错误
+				for ; index < len(requests); index++ {
+					b.completed.Add(1)
+					b.failed.Add(1)
+					done <- BatchResult{Index: index, Request: requests[index], Err: ctx.Err()}
+				}
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(done)
+		// 所有请求完成且响应体都已读完或关闭后释放 context
+		b.bodies.Wait()
+		cancel()
+	}()
+	go b.deliver(done, opts.Ordered)
+	return b
+}
+
+// run 执行一个请求
+func (b *Batch) run(ctx context.Context, client Fastls, index int, request BatchRequest, opts BatchOptions) BatchResult {
+	result := BatchResult{Index: index, Request: request}
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+	} else {
+		b.started.Add(1)
+		options := request.Options
+		if options.Context == nil {
+			options.Context = ctx
+		}
+		if options.ClientHints == nil {
+			options.ClientHints = opts.ClientHints
+		}
+		if options.Limiter == nil {
+			options.Limiter = opts.Limiter
+		}
+		result.Response, result.Err = client.Do(request.URL, options, request.Method)
+		if result.Err == nil && result.Response.Body != nil {
+			b.bodies.Add(1)
+			result.Response.Body = &releaseBody{ReadCloser: result.Response.Body, release: sync.OnceFunc(b.bodies.Done)}
+		}
+	}
+	if result.Err != nil {
+		b.failed.Add(1)
+	}
+	b.completed.Add(1)
+	return result
+}
+
+// deliver 将结果发送到 Results，ordered 时缓存提前完成的结果
+func (b *Batch) deliver(done <-chan BatchResult, ordered bool) {
+	defer close(b.results)
+	if !ordered {
+		for result := range done {
+			b.results <- result
+		}
+		return
+	}
+	pending := make(map[int]BatchResult)
+	next := 0
+	for result := range done {
+		pending[result.Index] = result
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			b.results <- r
+			next++
+		}
+	}
+}
+
+// Results 返回结果 channel，所有请求完成后关闭
+func (b *Batch) Results() <-chan BatchResult {
+	return b.results
+}
+
+// Wait 等待所有请求完成并按提交顺序返回结果
+func (b *Batch) Wait() []BatchResult {
+	results := make([]BatchResult, b.total)
+	for result := range b.results {
+		results[result.Index] = result
+	}
+	return results
+}
+
+// Cancel 取消尚未完成的请求
+func (b *Batch) Cancel() {
+	b.cancel()
+}
+
+// Progress 返回当前进度
+func (b *Batch) Progress() BatchProgress {
+	return BatchProgress{
+		Total:     b.total,
+		Started:   int(b.started.Load()),
+		Completed: int(b.completed.Load()),
+		Failed:    int(b.failed.Load()),
+	}
+}
+
+// DoAsync 在新的 goroutine 中执行 Do，结果通过返回的 channel 发送一次
+func (client Fastls) DoAsync(ctx context.Context, URL string, options Options, Method string) <-chan BatchResult {
+	return client.Batch(ctx, []BatchRequest{{URL: URL, Method: Method, Options: options}}, BatchOptions{}).Results()
+}
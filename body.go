@@ -0,0 +1,461 @@
+package fastls
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	http "github.com/FastTLS/fhttp"
+)
+
+// ErrBodyNotReplayable 请求体只能读取一次，无法在重试或重定向时重新发送
+var ErrBodyNotReplayable = errors.New("请求体只能读取一次")
+
+// RequestBody 请求体构造器，设置 Options.RequestBody 后代替 Options.Body
+type RequestBody interface {
+	// ContentType 返回浏览器为该请求体设置的 Content-Type，为空时不设置
+	ContentType() string
+	// Open 返回新的请求体和长度，长度未知时为 -1；重试和重定向时会再次调用
+	Open() (io.ReadCloser, int64, error)
+}
+
+// browserBody 需要根据 User-Agent 生成浏览器特有内容（如 multipart 分隔符）的请求体
+type browserBody interface {
+	forUserAgent(userAgent string) RequestBody
+}
+
+// bytesBody 内存中的请求体
+type bytesBody struct {
+	data        []byte
+	contentType string
+	err         error
+}
+
+func (b *bytesBody) ContentType() string {
+	return b.contentType
+}
+
+func (b *bytesBody) Open() (io.ReadCloser, int64, error) {
+	if b.err != nil {
+		return nil, 0, b.err
+	}
+	return io.NopCloser(bytes.NewReader(b.data)), int64(len(b.data)), nil
+}
+
+// NewJSONBody 将 v 编码为 JSON 请求体，Content-Type 为 application/json
+func NewJSONBody(v interface{}) RequestBody {
+	data, err := json.Marshal(v)
+	if err != nil {
+		err = fmt.Errorf("JSON编码失败: %w", err)
+	}
+	return &bytesBody{data: data, contentType: "application/json", err: err}
+}
+
+// NewBytesBody 使用 data 作为请求体
+func NewBytesBody(data []byte, contentType string) RequestBody {
+	return &bytesBody{data: data, contentType: contentType}
+}
+
+// FormBody application/x-www-form-urlencoded 请求体，字段按添加顺序编码，与浏览器提交表单一致
+type FormBody struct {
+	fields [][2]string
+}
+
+// NewFormBody 创建空的表单请求体
+func NewFormBody() *FormBody {
+	return &FormBody{}
+}
+
+// Add 追加一个字段，同名字段可以重复
+func (f *FormBody) Add(name, value string) *FormBody {
+	f.fields = append(f.fields, [2]string{name, value})
+	return f
+}
+
+// Encode 按 URL 标准的 application/x-www-form-urlencoded 序列化规则编码表单
+func (f *FormBody) Encode() string {
+	var sb strings.Builder
+	for i, field := range f.fields {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(formEncode(field[0]))
+		sb.WriteByte('=')
+		sb.WriteString(formEncode(field[1]))
+	}
+	return sb.String()
+}
+
+func (f *FormBody) ContentType() string {
+	return "application/x-www-form-urlencoded"
+}
+
+func (f *FormBody) Open() (io.ReadCloser, int64, error) {
+	data := f.Encode()
+	return io.NopCloser(strings.NewReader(data)), int64(len(data)), nil
+}
+
+// formEncode 浏览器保留 *-._ 和字母数字，空格编码为 +，与 url.QueryEscape 对 * 和 ~ 的处理不同
+func formEncode(s string) string {
+	const upperhex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '*', c == '-', c == '.', c == '_':
+			sb.WriteByte(c)
+		case c == ' ':
+			sb.WriteByte('+')
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(upperhex[c>>4])
+			sb.WriteByte(upperhex[c&15])
+		}
+	}
+	return sb.String()
+}
+
+// readerBody 任意 io.Reader 请求体，可 Seek 的 Reader 在重试和重定向时回到起始位置
+type readerBody struct {
+	mu          sync.Mutex
+	r           io.Reader
+	start       int64
+	length      int64
+	seekable    bool
+	used        bool
+	contentType string
+}
+
+// NewReaderBody 使用 r 作为请求体。r 实现 io.Seeker 时可以重复发送，否则只能发送一次
+func NewReaderBody(r io.Reader, contentType string) RequestBody {
+	// bytes.Buffer 读取后无法回退，保存剩余内容
+	if buf, ok := r.(*bytes.Buffer); ok {
+		return NewBytesBody(buf.Bytes(), contentType)
+	}
+	b := &readerBody{r: r, length: -1, contentType: contentType}
+	if seeker, ok := r.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			if end, err := seeker.Seek(0, io.SeekEnd); err == nil {
+				b.start, b.length, b.seekable = start, end-start, true
+			}
+			_, _ = seeker.Seek(start, io.SeekStart)
+		}
+	}
+	return b
+}
+
+func (b *readerBody) ContentType() string {
+	return b.contentType
+}
+
+func (b *readerBody) Open() (io.ReadCloser, int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.seekable {
+		if _, err := b.r.(io.Seeker).Seek(b.start, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+		return io.NopCloser(b.r), b.length, nil
+	}
+	if b.used {
+		return nil, 0, ErrBodyNotReplayable
+	}
+	b.used = true
+	return io.NopCloser(b.r), b.length, nil
+}
+
+// streamBody 由调用方的 GetBody 提供的请求体
+type streamBody struct {
+	getBody     func() (io.ReadCloser, error)
+	length      int64
+	contentType string
+}
+
+// NewStreamBody 每次发送时调用 getBody 获取请求体，length 未知时传 -1
+func NewStreamBody(getBody func() (io.ReadCloser, error), length int64, contentType string) RequestBody {
+	return &streamBody{getBody: getBody, length: length, contentType: contentType}
+}
+
+func (b *streamBody) ContentType() string {
+	return b.contentType
+}
+
+func (b *streamBody) Open() (io.ReadCloser, int64, error) {
+	rc, err := b.getBody()
+	if err != nil {
+		return nil, 0, err
+	}
+	return rc, b.length, nil
+}
+
+// fileBody 磁盘文件请求体，每次发送时重新打开，长度取自打开时的文件大小
+type fileBody struct {
+	path        string
+	contentType string
+}
+
+// NewFileBody 从磁盘流式上传文件，contentType 为空时与浏览器一样按扩展名推断
+func NewFileBody(path, contentType string) RequestBody {
+	if contentType == "" {
+		contentType = fileContentType(path)
+	}
+	return &fileBody{path: path, contentType: contentType}
+}
+
+func (b *fileBody) ContentType() string {
+	return b.contentType
+}
+
+func (b *fileBody) Open() (io.ReadCloser, int64, error) {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取上传文件失败: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// fileContentType 按扩展名推断文件类型，未知时为 application/octet-stream，不带参数
+func fileContentType(path string) string {
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+	contentType, _, _ = strings.Cut(contentType, ";")
+	return contentType
+}
+
+// multipartPart multipart 请求体中的一个字段
+type multipartPart struct {
+	name        string
+	value       string
+	fileName    string
+	path        string
+	contentType string
+	isFile      bool
+}
+
+// MultipartBody multipart/form-data 请求体，文件在发送时才从磁盘流式读取
+type MultipartBody struct {
+	parts    []multipartPart
+	boundary string
+}
+
+// NewMultipartBody 创建空的 multipart 请求体，分隔符在发送时按 User-Agent 生成
+func NewMultipartBody() *MultipartBody {
+	return &MultipartBody{}
+}
+
+// AddField 追加一个普通字段
+func (m *MultipartBody) AddField(name, value string) *MultipartBody {
+	m.parts = append(m.parts, multipartPart{name: name, value: value})
+	return m
+}
+
+// AddFile 追加一个文件字段，文件名取 path 的文件名，Content-Type 按扩展名推断
+func (m *MultipartBody) AddFile(name, path string) *MultipartBody {
+	m.parts = append(m.parts, multipartPart{
+		name:        name,
+		fileName:    filepath.Base(path),
+		path:        path,
+		contentType: fileContentType(path),
+		isFile:      true,
+	})
+	return m
+}
+
+// Boundary 返回分隔符。通过 Options.RequestBody 发送时每次请求按 User-Agent 生成新的分隔符，
+// 直接调用 Open 时使用 Chromium 格式的分隔符
+func (m *MultipartBody) Boundary() string {
+	if m.boundary == "" {
+		m.boundary = multipartBoundary("")
+	}
+	return m.boundary
+}
+
+func (m *MultipartBody) ContentType() string {
+	return "multipart/form-data; boundary=" + m.Boundary()
+}
+
+// forUserAgent 返回使用该浏览器分隔符格式的副本，每次请求生成新的分隔符
+func (m *MultipartBody) forUserAgent(userAgent string) RequestBody {
+	boundary := m.boundary
+	if boundary == "" {
+		boundary = multipartBoundary(userAgent)
+	}
+	return &MultipartBody{parts: m.parts, boundary: boundary}
+}
+
+func (m *MultipartBody) Open() (io.ReadCloser, int64, error) {
+	boundary := m.Boundary()
+	var readers []io.Reader
+	var files []*lazyFile
+	var length int64
+	add := func(s string) {
+		readers = append(readers, strings.NewReader(s))
+		length += int64(len(s))
+	}
+	for _, part := range m.parts {
+		header := "--" + boundary + "\r\nContent-Disposition: form-data; name=\"" + multipartEscape(part.name) + "\""
+		if !part.isFile {
+			add(header + "\r\n\r\n" + part.value + "\r\n")
+			continue
+		}
+		info, err := os.Stat(part.path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取上传文件失败: %w", err)
+		}
+		add(header + "; filename=\"" + multipartEscape(part.fileName) + "\"\r\nContent-Type: " + part.contentType + "\r\n\r\n")
+		file := &lazyFile{path: part.path}
+		files = append(files, file)
+		readers = append(readers, file)
+		length += info.Size()
+		add("\r\n")
+	}
+	add("--" + boundary + "--\r\n")
+	return &multipartReader{Reader: io.MultiReader(readers...), files: files}, length, nil
+}
+
+// multipartEscape 按 HTML 标准转义字段名和文件名中的换行和双引号
+func multipartEscape(s string) string {
+	return strings.NewReplacer("\n", "%0A", "\r", "%0D", "\"", "%22").Replace(s)
+}
+
+// boundaryChars Chrome 生成分隔符使用的字符表
+const boundaryChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789AB"
+
+// multipartBoundary 生成与浏览器格式一致的分隔符：
+// Chromium 和 Safari 为 ----WebKitFormBoundary 加 16 个字母数字，Firefox 为 ----geckoformboundary 加 32 个十六进制字符
+func multipartBoundary(userAgent string) string {
+	random := make([]byte, 16)
+	_, _ = rand.Read(random)
+	if destinationFamily(userAgent) == firefox {
+		return "----geckoformboundary" + hex.EncodeToString(random)
+	}
+	for i, b := range random {
+		random[i] = boundaryChars[b&0x3f]
+	}
+	return "----WebKitFormBoundary" + string(random)
+}
+
+// lazyFile 第一次读取时才打开的文件，读完后关闭
+type lazyFile struct {
+	path string
+	f    *os.File
+	done bool
+}
+
+func (l *lazyFile) Read(p []byte) (int, error) {
+	if l.done {
+		return 0, io.EOF
+	}
+	if l.f == nil {
+		f, err := os.Open(l.path)
+		if err != nil {
+			return 0, fmt.Errorf("读取上传文件失败: %w", err)
+		}
+		l.f = f
+	}
+	n, err := l.f.Read(p)
+	if err == io.EOF {
+		l.Close()
+	}
+	return n, err
+}
+
+func (l *lazyFile) Close() error {
+	l.done = true
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// multipartReader multipart 请求体，关闭时关闭尚未读完的文件
+type multipartReader struct {
+	io.Reader
+	files []*lazyFile
+}
+
+func (r *multipartReader) Close() error {
+	for _, f := range r.files {
+		_ = f.Close()
+	}
+	return nil
+}
+
+// setRequestBody 打开请求体并设置 GetBody，重试和重定向时重新打开
+func setRequestBody(req *http.Request, body RequestBody) error {
+	rc, length, err := body.Open()
+	if err != nil {
+		return err
+	}
+	req.ContentLength = length
+	req.Body = rc
+	if length == 0 {
+		rc.Close()
+		req.Body = http.NoBody
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		rc, _, err := body.Open()
+		return rc, err
+	}
+	return nil
+}
+
+// addBodyHeaderOrder 在导航请求的顺序中补充带请求体时浏览器发送的请求头，已存在时保持不变
+func addBodyHeaderOrder(order []string, userAgent string) []string {
+	if len(order) == 0 {
+		return order
+	}
+	if destinationFamily(userAgent) == firefox {
+		return insertOrderKeys(order, "accept-encoding", true, "content-type", "content-length", "origin")
+	}
+	order = insertOrderKeys(order, "connection", true, "content-length")
+	return insertOrderKeys(order, "upgrade-insecure-requests", false, "origin", "content-type")
+}
+
+// insertOrderKeys 将 order 中缺少的 keys 插入到 anchor 之前或之后，anchor 不存在时追加到末尾，返回新的切片
+func insertOrderKeys(order []string, anchor string, after bool, keys ...string) []string {
+	var missing []string
+	for _, key := range keys {
+		if !slices.Contains(order, key) {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return order
+	}
+	pos := len(order)
+	for i, key := range order {
+		if key == anchor {
+			pos = i
+			if after {
+				pos++
+			}
+			break
+		}
+	}
+	result := make([]string, 0, len(order)+len(missing))
+	result = append(result, order[:pos]...)
+	result = append(result, missing...)
+	return append(result, order[pos:]...)
+}
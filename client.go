@@ -1,6 +1,11 @@
 package fastls
 
 import (
+	"context"
+	"log/slog"
+	"net"
+	"net/url"
+
 	http "github.com/FastTLS/fhttp"
 	"github.com/FastTLS/fhttp/http2"
 
@@ -15,6 +20,33 @@ type browser struct {
 	UserAgent     string
 	Cookies       []Cookie
 	HTTP2Settings *http2.HTTP2Settings
+	Limiter       *Limiter
+	Trace         *ClientTrace
+	Logger        *slog.Logger
+	Resolver      Resolver
+	Source        *sourceAddr
+	// 与代理之间的 TLS、HTTP/2 和 CONNECT 请求头
+	ProxyFingerprint   Fingerprint
+	ProxyHTTP2Settings *http2.HTTP2Settings
+	ProxyDialTLS       func(ctx context.Context, network, addr string) (net.Conn, string, error)
+	ProxyHeaders       map[string]string
+	// proxyFingerprintSet 和 proxyHTTP2SettingsSet 表示调用方显式设置了 ProxyFingerprint 和 ProxyHTTP2Settings，
+	// MASQUE 不能使用它们时拒绝建立 UDP 通道
+	proxyFingerprintSet   bool
+	proxyHTTP2SettingsSet bool
+	// ProxyFunc 未设置固定代理时按请求 URL 选择代理
+	ProxyFunc ProxyFunc
+	// ProxyChain 连接代理或目标前依次经过的代理，ProxyHopTimeout 为每一跳的超时
+	ProxyChain      []string
+	ProxyHopTimeout time.Duration
+	// packetDialer 为 HTTP/3 建立 UDP 通道的代理，由 newClient 设置
+	packetDialer packetDialer
+	// HTTP3Pool 跨请求复用 HTTP/3 连接；http3Route 返回请求在连接池中的路由键，由 newClient 设置
+	HTTP3Pool  *HTTP3Pool
+	http3Route func(u *url.URL) (string, bool)
+	// AltSvc 记录 origin 的 HTTP/3 端点，QUICFingerprint 为升级 HTTP/3 记录的指纹，不改变 QUIC 握手
+	AltSvc          *AltSvcCache
+	QUICFingerprint Fingerprint
 }
 
 var disabledRedirect = func(req *http.Request, via []*http.Request) error {
@@ -40,18 +72,41 @@ func clientBuilder(browser browser, dialer proxy.ContextDialer, timeout int, dis
 // newClient creates a new http client
 func newClient(browser browser, timeout int, disableRedirect bool, UserAgent string, proxyURL ...string) (http.Client, error) {
 	var dialer proxy.ContextDialer
+	forward, err := proxyForward(browser, UserAgent, directDialer(browser.Resolver, browser.Source))
+	if err != nil {
+		return http.Client{
+			Timeout:       time.Duration(timeout) * time.Second,
+			CheckRedirect: disabledRedirect,
+		}, err
+	}
+	if chain, ok := forward.(*chainDialer); ok {
+		// 经过代理链时 HTTP/3 不能绕过代理链直连
+		browser.packetDialer = chain
+	}
 	// Check if a valid proxyURL is provided.
 	if len(proxyURL) > 0 && len(proxyURL[0]) > 0 {
-		var err error
-		dialer, err = newConnectDialer(proxyURL[0], UserAgent)
+		dialer, err = newConnectDialer(proxyURL[0], UserAgent, browser, forward)
 		if err != nil {
 			return http.Client{
 				Timeout:       time.Duration(timeout) * time.Second,
 				CheckRedirect: disabledRedirect,
 			}, err
 		}
+		browser.packetDialer = dialer.(*connectDialer).packetDialer()
+		dialer = withTrace(browser.Trace, dialer, proxyURL[0])
+	} else if browser.ProxyFunc != nil {
+		selector := newSelectDialer(browser.ProxyFunc, UserAgent, browser, forward)
+		browser.packetDialer = selector
+		dialer = selector
 	} else {
-		dialer = proxy.Direct
+		dialer = withTrace(browser.Trace, forward, "")
+	}
+	if browser.HTTP3Pool != nil {
+		route := ""
+		if len(proxyURL) > 0 {
+			route = proxyURL[0]
+		}
+		browser.http3Route = http3Route(browser, route)
 	}
 
 	return clientBuilder(browser, dialer, timeout, disableRedirect), nil
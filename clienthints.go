@@ -0,0 +1,399 @@
+package fastls
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	http "github.com/FastTLS/fhttp"
+)
+
+// 低熵 Client Hints，Chromium 默认发送
+var lowEntropyHints = []string{
+	"sec-ch-ua",
+	"sec-ch-ua-mobile",
+	"sec-ch-ua-platform",
+}
+
+// 高熵 Client Hints，仅在服务端通过 Accept-CH 请求后发送
+var highEntropyHints = []string{
+	"sec-ch-ua-arch",
+	"sec-ch-ua-bitness",
+	"sec-ch-ua-full-version",
+	"sec-ch-ua-full-version-list",
+	"sec-ch-ua-model",
+	"sec-ch-ua-platform-version",
+	"sec-ch-ua-wow64",
+	"sec-ch-ua-form-factors",
+}
+
+// Chromium GREASE 品牌使用的字符和版本，见 components/embedder_support/user_agent_utils.cc
+var (
+	greaseyChars    = []string{" ", "(", ":", "-", ".", "/", ")", ";", "=", "?", "_"}
+	greasedVersions = []string{"8", "99", "24"}
+)
+
+// 已知 Chrome 版本的完整版本号，User-Agent 精简后只保留主版本号
+var chromeFullVersions = map[int]string{
+	115: "115.0.5790.171",
+	116: "116.0.5845.188",
+	120: "120.0.6099.225",
+	142: "142.0.7444.176",
+}
+
+// ClientHints 根据 User-Agent 生成 User-Agent Client Hints，并像 Chrome 一样按 origin 记住服务端的 Accept-CH。
+// 同一个 ClientHints 应在同一会话的多个请求间复用。
+type ClientHints struct {
+	// Brand 品牌，如 "Google Chrome"、"Microsoft Edge"；为空或 "Chromium" 时只包含 Chromium 品牌
+	Brand string
+	// BrandVersion 品牌完整版本，为空时与 FullVersion 相同（Opera 等品牌版本与 Chromium 不同）
+	BrandVersion string
+	// FullVersion Chromium 完整版本，如 "142.0.7444.176"
+	FullVersion     string
+	Platform        string
+	PlatformVersion string
+	Arch            string
+	Bitness         string
+	Model           string
+	Mobile          bool
+	WoW64           bool
+	FormFactors     []string
+
+	mu       sync.Mutex
+	accepted map[string]map[string]bool // origin -> 服务端请求的高熵 hints
+}
+
+// NewClientHints 从 User-Agent 推导 Client Hints；非 Chromium 内核的浏览器不发送 Client Hints，返回 nil
+func NewClientHints(userAgent string) *ClientHints {
+	major := chromeMajorVersion(userAgent)
+	if parseUserAgent(userAgent) != chrome || major == 0 {
+		return nil
+	}
+
+	c := &ClientHints{
+		Brand:       "Google Chrome",
+		FullVersion: chromeFullVersions[major],
+		Mobile:      strings.Contains(userAgent, "Mobile"),
+		Bitness:     "64",
+		Arch:        "x86",
+		FormFactors: []string{"Desktop"},
+	}
+	if c.FullVersion == "" {
+		c.FullVersion = strconv.Itoa(major) + ".0.0.0"
+	}
+	if version := uaProductVersion(userAgent, "Edg/"); version != "" {
+		c.Brand = "Microsoft Edge"
+		c.BrandVersion = version
+	} else if version := uaProductVersion(userAgent, "OPR/"); version != "" {
+		c.Brand = "Opera"
+		c.BrandVersion = version
+	}
+
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		c.Platform = "Android"
+		c.PlatformVersion = "14.0.0"
+		c.Arch = ""
+		c.Bitness = ""
+		c.FormFactors = []string{"Mobile"}
+	case strings.Contains(userAgent, "Windows"):
+		c.Platform = "Windows"
+		c.PlatformVersion = "10.0.0"
+		if !strings.Contains(userAgent, "Win64") && !strings.Contains(userAgent, "WOW64") {
+			c.Bitness = "32"
+		}
+		c.WoW64 = strings.Contains(userAgent, "WOW64")
+	case strings.Contains(userAgent, "Macintosh"):
+		c.Platform = "macOS"
+		c.PlatformVersion = "15.0.0"
+		c.Arch = "arm"
+	case strings.Contains(userAgent, "CrOS"):
+		c.Platform = "Chrome OS"
+		c.PlatformVersion = "16181.61.0"
+	case strings.Contains(userAgent, "Linux"):
+		c.Platform = "Linux"
+		c.PlatformVersion = ""
+	default:
+		c.Platform = "Unknown"
+	}
+	return c
+}
+
+// uaProductVersion 返回 User-Agent 中 product 之后的版本号
+func uaProductVersion(userAgent, product string) string {
+	_, rest, ok := strings.Cut(userAgent, product)
+	if !ok {
+		return ""
+	}
+	version, _, _ := strings.Cut(rest, " ")
+	return version
+}
+
+// majorOf 返回版本号的主版本
+func majorOf(version string) string {
+	major, _, _ := strings.Cut(version, ".")
+	return major
+}
+
+// brandVersion 表示 Sec-CH-UA 中的一个品牌
+type brandVersion struct {
+	Brand   string
+	Version string
+}
+
+// brandList 按 Chromium 的 GREASE 算法生成品牌列表，full 为 true 时使用完整版本号
+func (c *ClientHints) brandList(full bool) []brandVersion {
+	seed, _ := strconv.Atoi(majorOf(c.FullVersion))
+
+	grease := brandVersion{
+		Brand:   "Not" + greaseyChars[seed%len(greaseyChars)] + "A" + greaseyChars[(seed+1)%len(greaseyChars)] + "Brand",
+		Version: greasedVersions[seed%len(greasedVersions)],
+	}
+	chromium := brandVersion{Brand: "Chromium", Version: majorOf(c.FullVersion)}
+	brandFull := c.BrandVersion
+	if brandFull == "" {
+		brandFull = c.FullVersion
+	}
+	brand := brandVersion{Brand: c.Brand, Version: majorOf(brandFull)}
+	if full {
+		grease.Version += ".0.0.0"
+		chromium.Version = c.FullVersion
+		brand.Version = brandFull
+	}
+
+	if c.Brand == "" || c.Brand == "Chromium" {
+		orders := [][]int{{0, 1}, {1, 0}}
+		return shuffleBrands([]brandVersion{grease, chromium}, orders[seed%len(orders)])
+	}
+	orders := [][]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}}
+	return shuffleBrands([]brandVersion{grease, chromium, brand}, orders[seed%len(orders)])
+}
+
+func shuffleBrands(brands []brandVersion, order []int) []brandVersion {
+	shuffled := make([]brandVersion, len(brands))
+	for i, pos := range order {
+		shuffled[pos] = brands[i]
+	}
+	return shuffled
+}
+
+func formatBrandList(brands []brandVersion) string {
+	parts := make([]string, 0, len(brands))
+	for _, b := range brands {
+		parts = append(parts, fmt.Sprintf("%q;v=%q", b.Brand, b.Version))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SecChUa 返回 Sec-CH-UA 请求头的值
+func (c *ClientHints) SecChUa() string {
+	return formatBrandList(c.brandList(false))
+}
+
+// SecChUaFullVersionList 返回 Sec-CH-UA-Full-Version-List 请求头的值
+func (c *ClientHints) SecChUaFullVersionList() string {
+	return formatBrandList(c.brandList(true))
+}
+
+// hintValue 返回单个 hint 的值
+func (c *ClientHints) hintValue(hint string) string {
+	switch hint {
+	case "sec-ch-ua":
+		return c.SecChUa()
+	case "sec-ch-ua-mobile":
+		return structuredBool(c.Mobile)
+	case "sec-ch-ua-platform":
+		return strconv.Quote(c.Platform)
+	case "sec-ch-ua-arch":
+		return strconv.Quote(c.Arch)
+	case "sec-ch-ua-bitness":
+		return strconv.Quote(c.Bitness)
+	case "sec-ch-ua-full-version":
+		return strconv.Quote(c.FullVersion)
+	case "sec-ch-ua-full-version-list":
+		return c.SecChUaFullVersionList()
+	case "sec-ch-ua-model":
+		return strconv.Quote(c.Model)
+	case "sec-ch-ua-platform-version":
+		return strconv.Quote(c.PlatformVersion)
+	case "sec-ch-ua-wow64":
+		return structuredBool(c.WoW64)
+	case "sec-ch-ua-form-factors":
+		quoted := make([]string, 0, len(c.FormFactors))
+		for _, f := range c.FormFactors {
+			quoted = append(quoted, strconv.Quote(f))
+		}
+		return strings.Join(quoted, ", ")
+	}
+	return ""
+}
+
+func structuredBool(b bool) string {
+	if b {
+		return "?1"
+	}
+	return "?0"
+}
+
+// Headers 返回发往 origin 的 Client Hints：低熵 hints 总是发送，高熵 hints 仅在该 origin 通过 Accept-CH 请求后发送
+func (c *ClientHints) Headers(origin string) map[string]string {
+	headers := make(map[string]string)
+	for _, hint := range lowEntropyHints {
+		headers[hint] = c.hintValue(hint)
+	}
+
+	c.mu.Lock()
+	accepted := c.accepted[origin]
+	c.mu.Unlock()
+	for _, hint := range highEntropyHints {
+		if accepted[hint] {
+			headers[hint] = c.hintValue(hint)
+		}
+	}
+	return headers
+}
+
+// Remember 记录 origin 返回的 Accept-CH，之后发往该 origin 的请求会带上对应的高熵 hints。
+// 与 Chrome 一样，新的 Accept-CH 会替换该 origin 之前记住的值，且只对 https origin 生效。
+func (c *ClientHints) Remember(origin, acceptCH string) {
+	if !strings.HasPrefix(origin, "https://") {
+		return
+	}
+	hints := make(map[string]bool)
+	for _, hint := range parseHintList(acceptCH) {
+		hints[hint] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.accepted == nil {
+		c.accepted = make(map[string]map[string]bool)
+	}
+	c.accepted[origin] = hints
+}
+
+// Forget 清除所有 origin 记住的 Accept-CH
+func (c *ClientHints) Forget() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accepted = nil
+}
+
+// missingCritical 返回 Critical-CH 中本次请求未发送、但现在已被 origin 接受的 hints
+func (c *ClientHints) missingCritical(origin, criticalCH string, sent map[string]string) []string {
+	c.mu.Lock()
+	accepted := c.accepted[origin]
+	c.mu.Unlock()
+
+	var missing []string
+	for _, hint := range parseHintList(criticalCH) {
+		if _, ok := sent[hint]; !ok && accepted[hint] {
+			missing = append(missing, hint)
+		}
+	}
+	return missing
+}
+
+// parseHintList 解析 Accept-CH / Critical-CH 中逗号分隔的 hint 列表
+func parseHintList(value string) []string {
+	var hints []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			hints = append(hints, item)
+		}
+	}
+	return hints
+}
+
+// urlOrigin 返回 URL 的 origin，用作 Accept-CH 的记忆键
+func urlOrigin(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host)
+}
+
+// applyClientHints 用 ClientHints 生成的值替换请求头中的 Client Hints，返回本次发送的 hints
+func applyClientHints(options *Options) map[string]string {
+	if options.ClientHints == nil {
+		return nil
+	}
+	u, err := url.Parse(options.URL)
+	if err != nil {
+		return nil
+	}
+	hints := options.ClientHints.Headers(urlOrigin(u))
+
+	headers := make(map[string]string, len(options.Headers)+len(hints))
+	for k, v := range options.Headers {
+		if !strings.HasPrefix(strings.ToLower(k), "sec-ch-ua") {
+			headers[k] = v
+		}
+	}
+	for hint, value := range hints {
+		headers[hint] = value
+	}
+	options.Headers = headers
+
+	if len(options.HeaderOrderKeys) > 0 {
+		options.HeaderOrderKeys = insertHintOrder(options.HeaderOrderKeys, hints)
+	}
+	return hints
+}
+
+// insertHintOrder 将顺序中缺少的 hints 插入到最后一个 Client Hint 之后，没有 Client Hint 时追加到末尾
+func insertHintOrder(order []string, hints map[string]string) []string {
+	present := make(map[string]bool, len(order))
+	last := -1
+	for i, k := range order {
+		k = strings.ToLower(k)
+		present[k] = true
+		if strings.HasPrefix(k, "sec-ch-ua") {
+			last = i
+		}
+	}
+	var missing []string
+	for _, hint := range append(lowEntropyHints, highEntropyHints...) {
+		if _, ok := hints[hint]; ok && !present[hint] {
+			missing = append(missing, hint)
+		}
+	}
+	if len(missing) == 0 {
+		return order
+	}
+	if last < 0 {
+		last = len(order) - 1
+	}
+
+	result := make([]string, 0, len(order)+len(missing))
+	result = append(result, order[:last+1]...)
+	result = append(result, missing...)
+	return append(result, order[last+1:]...)
+}
+
+// needsClientHintsRetry 判断响应的 Critical-CH 是否要求重试，仅对 GET/HEAD 请求重试
+func (res *requestContext) needsClientHintsRetry(response Response) bool {
+	hints := res.options.ClientHints
+	if hints == nil || (res.req.Method != "GET" && res.req.Method != "HEAD") {
+		return false
+	}
+	criticalCH := response.Headers["Critical-Ch"]
+	if criticalCH == "" {
+		return false
+	}
+	return len(hints.missingCritical(urlOrigin(res.req.URL), criticalCH, res.clientHints)) > 0
+}
+
+// rememberClientHints 记录响应中的 Accept-CH
+func (res *requestContext) rememberClientHints(resp *http.Response) {
+	hints := res.options.ClientHints
+	if hints == nil || resp.Request == nil {
+		return
+	}
+	if acceptCH, ok := resp.Header["Accept-Ch"]; ok {
+		hints.Remember(urlOrigin(resp.Request.URL), strings.Join(acceptCH, ","))
+	}
+}
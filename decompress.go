@@ -0,0 +1,185 @@
+package fastls
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	http "github.com/FastTLS/fhttp"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultMaxDecompressedSize 未设置 Options.MaxDecompressedSize 时解压后响应体的最大字节数
+const defaultMaxDecompressedSize = 256 << 20
+
+// ErrDecompressedBodyTooLarge 解压后的响应体超过 Options.MaxDecompressedSize
+var ErrDecompressedBodyTooLarge = errors.New("解压后的响应体超过大小限制")
+
+// contentEncodings 按出现顺序返回 Content-Encoding 中的编码，忽略 identity
+func contentEncodings(h http.Header) []string {
+	var encodings []string
+	for _, value := range h.Values("Content-Encoding") {
+		for _, token := range strings.Split(value, ",") {
+			token = strings.ToLower(strings.TrimSpace(token))
+			if token == "x-gzip" {
+				token = "gzip"
+			}
+			if token != "" && token != "identity" {
+				encodings = append(encodings, token)
+			}
+		}
+	}
+	return encodings
+}
+
+// acceptedEncodings 解析 Accept-Encoding，返回 q 值不为 0 的编码
+func acceptedEncodings(value string) map[string]bool {
+	accepted := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		name, params, _ := strings.Cut(item, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		if q == "q=0" || strings.HasPrefix(q, "q=0.") && strings.Trim(q[4:], "0") == "" {
+			continue
+		}
+		accepted[name] = true
+	}
+	return accepted
+}
+
+// canDecode 判断是否支持并在请求中声明了所有编码
+func canDecode(encodings []string, acceptEncoding string) bool {
+	accepted := acceptedEncodings(acceptEncoding)
+	for _, encoding := range encodings {
+		switch encoding {
+		case "gzip", "deflate", "br", "zstd":
+		default:
+			return false
+		}
+		if !accepted[encoding] && !accepted["*"] {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeResponse 按请求的 Accept-Encoding 透明解压响应体，并删除 Content-Encoding 和 Content-Length
+func decodeResponse(resp *http.Response, limit int64) bool {
+	encodings := contentEncodings(resp.Header)
+	if len(encodings) == 0 || resp.Request == nil || !canDecode(encodings, headerValue(resp.Request.Header, "Accept-Encoding")) {
+		return false
+	}
+	if limit == 0 {
+		limit = defaultMaxDecompressedSize
+	}
+	resp.Body = &decodedBody{raw: resp.Body, encodings: encodings, remaining: limit}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return true
+}
+
+// decodedBody 流式解压的响应体，第一次读取时才创建解码器，因此没有响应体的响应不会出错
+type decodedBody struct {
+	raw       io.ReadCloser
+	encodings []string
+	remaining int64 // 还允许输出的字节数，小于 0 时不限制
+	reader    io.Reader
+	closers   []io.Closer
+	err       error
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.reader == nil {
+		if b.err = b.init(); b.err != nil {
+			return 0, b.err
+		}
+	}
+	if b.remaining >= 0 && int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.reader.Read(p)
+	if b.remaining >= 0 {
+		if int64(n) > b.remaining {
+			n = int(b.remaining)
+			err = ErrDecompressedBodyTooLarge
+		}
+		b.remaining -= int64(n)
+	}
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// init 按 Content-Encoding 的相反顺序叠加解码器
+func (b *decodedBody) init() error {
+	var r io.Reader = b.raw
+	for i := len(b.encodings) - 1; i >= 0; i-- {
+		encoding := b.encodings[i]
+		switch encoding {
+		case "gzip":
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return fmt.Errorf("gzip 解压失败: %w", err)
+			}
+			b.closers = append(b.closers, zr)
+			r = zr
+		case "deflate":
+			zr, err := newDeflateReader(r)
+			if err != nil {
+				return fmt.Errorf("deflate 解压失败: %w", err)
+			}
+			b.closers = append(b.closers, zr)
+			r = zr
+		case "br":
+			r = brotli.NewReader(r)
+		case "zstd":
+			zr, err := zstd.NewReader(r)
+			if err != nil {
+				return fmt.Errorf("zstd 解压失败: %w", err)
+			}
+			rc := zr.IOReadCloser()
+			b.closers = append(b.closers, rc)
+			r = rc
+		}
+	}
+	b.reader = r
+	return nil
+}
+
+func (b *decodedBody) Close() error {
+	for _, c := range b.closers {
+		_ = c.Close()
+	}
+	return b.raw.Close()
+}
+
+// newDeflateReader HTTP 的 deflate 应为 zlib 格式，但部分服务器发送原始 deflate 数据，根据头部判断
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil && len(header) < 2 {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
@@ -0,0 +1,296 @@
+package fastls
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RequestDestination 请求目标，对应浏览器的 Sec-Fetch-Dest
+type RequestDestination string
+
+const (
+	DestinationDocument RequestDestination = "document" // 顶层导航
+	DestinationIframe   RequestDestination = "iframe"   // iframe 导航
+	DestinationEmpty    RequestDestination = "empty"    // fetch / XHR
+	DestinationScript   RequestDestination = "script"   // <script>
+	DestinationImage    RequestDestination = "image"    // <img>
+	DestinationStyle    RequestDestination = "style"    // <link rel=stylesheet>
+	DestinationFont     RequestDestination = "font"     // @font-face
+)
+
+// Sec-Fetch-Site 取值
+const (
+	FetchSiteNone       = "none"
+	FetchSiteSameOrigin = "same-origin"
+	FetchSiteSameSite   = "same-site"
+	FetchSiteCrossSite  = "cross-site"
+)
+
+const safari = "safari" // Safari 浏览器类型，仅用于请求头选择
+
+// destinationHeaders 某个请求目标下浏览器发送的请求头
+type destinationHeaders struct {
+	Accept   string
+	Mode     string
+	Priority string
+}
+
+// navigationHeaderKeys 仅在导航请求中出现的请求头
+var navigationHeaderKeys = []string{"Sec-Fetch-User", "Upgrade-Insecure-Requests"}
+
+var chromeDestinations = map[RequestDestination]destinationHeaders{
+	DestinationDocument: {Accept: "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7", Mode: "navigate", Priority: "u=0, i"},
+	DestinationIframe:   {Accept: "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7", Mode: "navigate", Priority: "u=0, i"},
+	DestinationEmpty:    {Accept: "*/*", Mode: "cors", Priority: "u=1, i"},
+	DestinationScript:   {Accept: "*/*", Mode: "no-cors", Priority: "u=1"},
+	DestinationImage:    {Accept: "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8", Mode: "no-cors", Priority: "i"},
+	DestinationStyle:    {Accept: "text/css,*/*;q=0.1", Mode: "no-cors", Priority: "u=0"},
+	DestinationFont:     {Accept: "*/*", Mode: "cors", Priority: "u=0"},
+}
+
+var firefoxDestinations = map[RequestDestination]destinationHeaders{
+	DestinationDocument: {Accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", Mode: "navigate", Priority: "u=0, i"},
+	DestinationIframe:   {Accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", Mode: "navigate", Priority: "u=4, i"},
+	DestinationEmpty:    {Accept: "*/*", Mode: "cors", Priority: "u=4"},
+	DestinationScript:   {Accept: "*/*", Mode: "no-cors", Priority: "u=2"},
+	DestinationImage:    {Accept: "image/avif,image/webp,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5", Mode: "no-cors", Priority: "u=5, i"},
+	DestinationStyle:    {Accept: "text/css,*/*;q=0.1", Mode: "no-cors", Priority: "u=2"},
+	DestinationFont:     {Accept: "application/font-woff2;q=1.0,application/font-woff;q=0.9,*/*;q=0.8", Mode: "cors", Priority: "u=2"},
+}
+
+// Safari 不发送 Priority 请求头
+var safariDestinations = map[RequestDestination]destinationHeaders{
+	DestinationDocument: {Accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", Mode: "navigate"},
+	DestinationIframe:   {Accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", Mode: "navigate"},
+	DestinationEmpty:    {Accept: "*/*", Mode: "cors"},
+	DestinationScript:   {Accept: "*/*", Mode: "no-cors"},
+	DestinationImage:    {Accept: "image/webp,image/avif,image/jxl,image/heic,image/heic-sequence,video/*;q=0.8,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5", Mode: "no-cors"},
+	DestinationStyle:    {Accept: "text/css,*/*;q=0.1", Mode: "no-cors"},
+	DestinationFont:     {Accept: "*/*", Mode: "cors"},
+}
+
+// chromeSubresourceOrder Chrome 子资源请求（非导航）的请求头顺序
+var chromeSubresourceOrder = []string{
+	"host",
+	"connection",
+	"content-length",
+	"pragma",
+	"cache-control",
+	"sec-ch-ua-platform",
+	"user-agent",
+	"sec-ch-ua",
+	"content-type",
+	"sec-ch-ua-mobile",
+	"accept",
+	"origin",
+	"sec-fetch-site",
+	"sec-fetch-mode",
+	"sec-fetch-dest",
+	"referer",
+	"accept-encoding",
+	"accept-language",
+	"cookie",
+	"priority",
+}
+
+// firefoxSubresourceOrder Firefox 子资源请求（非导航）的请求头顺序
+var firefoxSubresourceOrder = []string{
+	"host",
+	"user-agent",
+	"accept",
+	"accept-language",
+	"accept-encoding",
+	"referer",
+	"content-type",
+	"content-length",
+	"origin",
+	"connection",
+	"cookie",
+	"sec-fetch-dest",
+	"sec-fetch-mode",
+	"sec-fetch-site",
+	"priority",
+	"pragma",
+	"cache-control",
+	"te",
+}
+
+// safariSubresourceOrder Safari 子资源请求（非导航）的请求头顺序
+var safariSubresourceOrder = []string{
+	"host",
+	"content-type",
+	"origin",
+	"sec-fetch-dest",
+	"user-agent",
+	"accept",
+	"referer",
+	"sec-fetch-site",
+	"sec-fetch-mode",
+	"accept-language",
+	"priority",
+	"accept-encoding",
+	"connection",
+	"cookie",
+	"content-length",
+}
+
+// destinationFamily 根据 User-Agent 选择请求头表使用的浏览器类型
+func destinationFamily(userAgent string) string {
+	browserType := parseUserAgent(userAgent)
+	if browserType == other && strings.Contains(strings.ToLower(userAgent), "safari/") {
+		return safari
+	}
+	return browserType
+}
+
+func destinationTable(family string) (map[RequestDestination]destinationHeaders, []string) {
+	switch family {
+	case firefox:
+		return firefoxDestinations, firefoxSubresourceOrder
+	case safari:
+		return safariDestinations, safariSubresourceOrder
+	default:
+		return chromeDestinations, chromeSubresourceOrder
+	}
+}
+
+// isNavigationAccept 判断 Accept 是否为某个浏览器的导航默认值（即由 imitate 设置）
+func isNavigationAccept(accept string) bool {
+	for _, table := range []map[RequestDestination]destinationHeaders{chromeDestinations, firefoxDestinations, safariDestinations} {
+		if table[DestinationDocument].Accept == accept {
+			return true
+		}
+	}
+	// Edge 等基于 Chromium 的浏览器使用不带 avif 的导航 Accept
+	return accept == "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"
+}
+
+// applyDestination 根据 Options.Destination 和 Options.FetchSite 调整请求头，
+// 使请求看起来像浏览器对该目标发出的请求，而不是地址栏导航
+func applyDestination(options *Options) {
+	if options.Destination == "" && options.FetchSite == "" {
+		return
+	}
+	dest := options.Destination
+	if dest == "" {
+		dest = DestinationDocument
+	}
+	family := destinationFamily(options.UserAgent)
+	table, subresourceOrder := destinationTable(family)
+	values, ok := table[dest]
+	if !ok {
+		return
+	}
+
+	// 复制请求头，避免修改调用方复用的 map
+	headers := make(map[string]string, len(options.Headers)+4)
+	for k, v := range options.Headers {
+		headers[k] = v
+	}
+	options.Headers = headers
+
+	site := options.FetchSite
+	if site == "" {
+		site = FetchSiteSameOrigin
+		if dest == DestinationDocument {
+			site = FetchSiteNone
+		}
+	}
+
+	if accept := getHeader(headers, "Accept"); accept == "" || isNavigationAccept(accept) {
+		setHeader(headers, "Accept", values.Accept)
+	}
+	setHeader(headers, "Sec-Fetch-Dest", string(dest))
+	setHeader(headers, "Sec-Fetch-Mode", values.Mode)
+	setHeader(headers, "Sec-Fetch-Site", site)
+	// Chrome 124 之前不发送 Priority 请求头
+	if values.Priority != "" && (family != chrome || chromeMajorVersion(options.UserAgent) >= 124) {
+		setHeader(headers, "Priority", values.Priority)
+	} else {
+		deleteHeader(headers, "Priority")
+	}
+
+	if values.Mode == "navigate" {
+		setHeader(headers, "Upgrade-Insecure-Requests", "1")
+		// 只有顶层导航且由用户触发时才发送 Sec-Fetch-User
+		if dest == DestinationDocument {
+			setHeader(headers, "Sec-Fetch-User", "?1")
+		} else {
+			deleteHeader(headers, "Sec-Fetch-User")
+		}
+		return
+	}
+
+	for _, key := range navigationHeaderKeys {
+		deleteHeader(headers, key)
+	}
+	// 跨站或非简单方法的 CORS 请求携带发起页面的 Origin，这里从 Referer 推导
+	if values.Mode == "cors" && getHeader(headers, "Origin") == "" {
+		method := strings.ToUpper(options.Method)
+		if site != FetchSiteSameOrigin || (method != "" && method != "GET" && method != "HEAD") {
+			if origin := originOf(getHeader(headers, "Referer")); origin != "" {
+				setHeader(headers, "Origin", origin)
+			}
+		}
+	}
+	if len(options.HeaderOrderKeys) > 0 {
+		options.HeaderOrderKeys = subresourceOrder
+	}
+}
+
+// chromeMajorVersion 从 User-Agent 中解析 Chrome 主版本号，解析失败时返回 0
+func chromeMajorVersion(userAgent string) int {
+	_, rest, ok := strings.Cut(userAgent, "Chrome/")
+	if !ok {
+		return 0
+	}
+	major, _, _ := strings.Cut(rest, ".")
+	version, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+	return version
+}
+
+// originOf 返回 URL 的 origin（scheme://host），无法解析时返回空字符串
+func originOf(rawURL string) string {
+	if rawURL == "" {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// getHeader 不区分大小写地读取请求头
+func getHeader(headers map[string]string, key string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// setHeader 不区分大小写地设置请求头，保留已有键的大小写
+func setHeader(headers map[string]string, key, value string) {
+	for k := range headers {
+		if strings.EqualFold(k, key) {
+			headers[k] = value
+			return
+		}
+	}
+	headers[key] = value
+}
+
+// deleteHeader 不区分大小写地删除请求头
+func deleteHeader(headers map[string]string, key string) {
+	for k := range headers {
+		if strings.EqualFold(k, key) {
+			delete(headers, k)
+		}
+	}
+}
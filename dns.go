@@ -0,0 +1,388 @@
+package fastls
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxDNSMessageSize DNS 消息的最大字节数
+const maxDNSMessageSize = 65535
+
+// DoHResolver 通过 DNS-over-HTTPS（RFC 8484）解析域名，查询由 fastls 发送，使用 Options 中的指纹、请求头和代理
+//
+// Options.Resolver 用于解析 DoH 服务器自身的域名，为空时使用系统 DNS；
+// URL 使用 IP 地址或配合 StaticResolver 时不会发出任何系统 DNS 查询
+type DoHResolver struct {
+	URL     string  // DoH 服务地址，如 https://cloudflare-dns.com/dns-query
+	Options Options // 发送查询的选项，通常由 imitate 设置
+}
+
+func (r *DoHResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, _, err := r.lookupIPAddrTTL(ctx, host)
+	return addrs, err
+}
+
+func (r *DoHResolver) lookupIPAddrTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error) {
+	// RFC 8484 建议 ID 为 0 以便 HTTP 缓存
+	return lookupDNS(ctx, host, func() uint16 { return 0 }, r.exchange)
+}
+
+// exchange 使用 GET 请求发送一个查询
+func (r *DoHResolver) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	sep := "?"
+	if strings.Contains(r.URL, "?") {
+		sep = "&"
+	}
+	options := r.Options
+	options.Context = ctx
+	options.Headers = make(map[string]string, len(r.Options.Headers)+1)
+	for k, v := range r.Options.Headers {
+		options.Headers[k] = v
+	}
+	options.Headers["Accept"] = "application/dns-message"
+
+	resp, err := NewClient().Do(r.URL+sep+"dns="+base64.RawURLEncoding.EncodeToString(query), options, "GET")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.Status != 200 {
+		return nil, fmt.Errorf("DoH 服务返回状态码 %d", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDNSMessageSize))
+}
+
+// defaultDoTPort DNS-over-TLS 的默认端口
+const defaultDoTPort = "853"
+
+// DoTResolver 通过 DNS-over-TLS（RFC 7858）解析域名
+//
+// Addr 为域名时使用系统 DNS 解析，通常应使用 IP 地址并在 TLSConfig.ServerName 中指定证书的域名
+type DoTResolver struct {
+	Addr      string      // 服务器地址，如 1.1.1.1:853，未指定端口时为 853
+	TLSConfig *tls.Config // 为空时按 Addr 的主机名验证证书
+}
+
+func (r *DoTResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, _, err := r.lookupIPAddrTTL(ctx, host)
+	return addrs, err
+}
+
+func (r *DoTResolver) lookupIPAddrTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error) {
+	return lookupDNS(ctx, host, func() uint16 { return uint16(rand.Uint32()) }, r.exchange)
+}
+
+// exchange 建立 TLS 连接，发送带 2 字节长度前缀的查询并读取响应
+func (r *DoTResolver) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	addr := r.Addr
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+		addr = net.JoinHostPort(addr, defaultDoTPort)
+	}
+	var cfg *tls.Config
+	if r.TLSConfig != nil {
+		cfg = r.TLSConfig.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+
+	dialer := tls.Dialer{Config: cfg}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	msg := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	copy(msg[2:], query)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// lookupDNS 并发查询 A 和 AAAA 记录，返回所有地址和其中最小的 TTL
+func lookupDNS(ctx context.Context, host string, newID func() uint16, exchange func(ctx context.Context, query []byte) ([]byte, error)) ([]net.IPAddr, time.Duration, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host}
+	}
+
+	type result struct {
+		addrs []net.IPAddr
+		ttl   time.Duration
+		err   error
+	}
+	types := []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	results := make([]result, len(types))
+	done := make(chan struct{})
+	for i, typ := range types {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			id := newID()
+			query, err := (&dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+				Questions: []dnsmessage.Question{{Name: name, Type: typ, Class: dnsmessage.ClassINET}},
+			}).Pack()
+			if err != nil {
+				results[i].err = err
+				return
+			}
+			resp, err := exchange(ctx, query)
+			if err != nil {
+				results[i].err = &net.DNSError{Err: err.Error(), Name: host, IsTemporary: true}
+				return
+			}
+			results[i].addrs, results[i].ttl, results[i].err = parseDNSResponse(resp, id, host)
+		}()
+	}
+	for range types {
+		<-done
+	}
+
+	var addrs []net.IPAddr
+	var ttl time.Duration
+	for _, r := range results {
+		if r.err != nil || len(r.addrs) == 0 {
+			continue
+		}
+		addrs = append(addrs, r.addrs...)
+		if ttl == 0 || r.ttl < ttl {
+			ttl = r.ttl
+		}
+	}
+	if len(addrs) > 0 {
+		return addrs, ttl, nil
+	}
+	for _, r := range results {
+		if r.err != nil {
+			return nil, 0, r.err
+		}
+	}
+	return nil, 0, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// parseDNSResponse 解析响应中的 A 和 AAAA 记录
+func parseDNSResponse(resp []byte, id uint16, host string) ([]net.IPAddr, time.Duration, error) {
+	var p dnsmessage.Parser
+	if err := startDNSResponse(&p, resp, id, host); err != nil {
+		return nil, 0, err
+	}
+
+	var addrs []net.IPAddr
+	var ttl uint32
+	for {
+		h, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, 0, &net.DNSError{Err: "cannot unmarshal DNS message", Name: host}
+		}
+		switch h.Type {
+		case dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return nil, 0, &net.DNSError{Err: "cannot unmarshal DNS message", Name: host}
+			}
+			addrs = append(addrs, net.IPAddr{IP: net.IP(r.A[:])})
+		case dnsmessage.TypeAAAA:
+			r, err := p.AAAAResource()
+			if err != nil {
+				return nil, 0, &net.DNSError{Err: "cannot unmarshal DNS message", Name: host}
+			}
+			addrs = append(addrs, net.IPAddr{IP: net.IP(r.AAAA[:])})
+		default:
+			if err := p.SkipAnswer(); err != nil {
+				return nil, 0, &net.DNSError{Err: "cannot unmarshal DNS message", Name: host}
+			}
+			continue
+		}
+		if len(addrs) == 1 || h.TTL < ttl {
+			ttl = h.TTL
+		}
+	}
+	return addrs, time.Duration(ttl) * time.Second, nil
+}
+
+// startDNSResponse 检查响应的 ID 和状态码，并跳过问题部分
+func startDNSResponse(p *dnsmessage.Parser, resp []byte, id uint16, host string) error {
+	header, err := p.Start(resp)
+	if err != nil {
+		return &net.DNSError{Err: "cannot unmarshal DNS message", Name: host}
+	}
+	if header.ID != id || !header.Response {
+		return &net.DNSError{Err: "invalid DNS response", Name: host}
+	}
+	switch header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	default:
+		return &net.DNSError{Err: "server misbehaving: " + header.RCode.String(), Name: host, IsTemporary: true}
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return &net.DNSError{Err: "cannot unmarshal DNS message", Name: host}
+	}
+	return nil
+}
+
+// typeHTTPS HTTPS 记录的类型（RFC 9460）
+const typeHTTPS dnsmessage.Type = 65
+
+// HTTPS 记录中的 SvcParamKey
+const (
+	svcParamALPN = 1
+	svcParamPort = 3
+)
+
+// HTTPSRecordResolver 查询 DNS HTTPS 记录（RFC 9460），DoHResolver 和 DoTResolver 实现了该接口
+type HTTPSRecordResolver interface {
+	LookupHTTPS(ctx context.Context, name string) ([]HTTPSRecord, error)
+}
+
+// HTTPSRecord HTTPS 记录中与建立连接有关的字段
+type HTTPSRecord struct {
+	Priority uint16        // 为 0 时是别名记录
+	Target   string        // 目标域名，"." 表示记录所在的域名
+	ALPN     []string      // 支持的协议，如 h3、h2
+	Port     uint16        // 为 0 时使用 origin 的端口
+	TTL      time.Duration // 记录的 TTL
+}
+
+func (r *DoHResolver) LookupHTTPS(ctx context.Context, name string) ([]HTTPSRecord, error) {
+	return lookupHTTPS(ctx, name, 0, r.exchange)
+}
+
+func (r *DoTResolver) LookupHTTPS(ctx context.Context, name string) ([]HTTPSRecord, error) {
+	return lookupHTTPS(ctx, name, uint16(rand.Uint32()), r.exchange)
+}
+
+// lookupHTTPS 查询 name 的 HTTPS 记录
+func lookupHTTPS(ctx context.Context, name string, id uint16, exchange func(ctx context.Context, query []byte) ([]byte, error)) ([]HTTPSRecord, error) {
+	qname, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name}
+	}
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: typeHTTPS, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := exchange(ctx, query)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name, IsTemporary: true}
+	}
+
+	var p dnsmessage.Parser
+	if err := startDNSResponse(&p, resp, id, name); err != nil {
+		return nil, err
+	}
+	var records []HTTPSRecord
+	for {
+		h, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, &net.DNSError{Err: "cannot unmarshal DNS message", Name: name}
+		}
+		if h.Type != typeHTTPS {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, &net.DNSError{Err: "cannot unmarshal DNS message", Name: name}
+			}
+			continue
+		}
+		r, err := p.UnknownResource()
+		if err != nil {
+			return nil, &net.DNSError{Err: "cannot unmarshal DNS message", Name: name}
+		}
+		record, ok := parseHTTPSRecord(r.Data)
+		if !ok {
+			return nil, &net.DNSError{Err: "invalid HTTPS record", Name: name}
+		}
+		record.TTL = time.Duration(h.TTL) * time.Second
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// parseHTTPSRecord 解析 HTTPS 记录的 RDATA：优先级、不压缩的目标域名和 SvcParams
+func parseHTTPSRecord(data []byte) (HTTPSRecord, bool) {
+	if len(data) < 3 {
+		return HTTPSRecord{}, false
+	}
+	record := HTTPSRecord{Priority: binary.BigEndian.Uint16(data)}
+	data = data[2:]
+	var labels []string
+	for {
+		if len(data) == 0 || int(data[0]) >= len(data) {
+			return HTTPSRecord{}, false
+		}
+		n := int(data[0])
+		if n == 0 {
+			data = data[1:]
+			break
+		}
+		labels = append(labels, string(data[1:1+n]))
+		data = data[1+n:]
+	}
+	record.Target = strings.Join(labels, ".") + "."
+
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return HTTPSRecord{}, false
+		}
+		key, n := binary.BigEndian.Uint16(data), int(binary.BigEndian.Uint16(data[2:]))
+		if len(data) < 4+n {
+			return HTTPSRecord{}, false
+		}
+		value := data[4 : 4+n]
+		data = data[4+n:]
+		switch key {
+		case svcParamALPN:
+			for len(value) > 0 {
+				l := int(value[0])
+				if l == 0 || l > len(value)-1 {
+					return HTTPSRecord{}, false
+				}
+				record.ALPN = append(record.ALPN, string(value[1:1+l]))
+				value = value[1+l:]
+			}
+		case svcParamPort:
+			if n != 2 {
+				return HTTPSRecord{}, false
+			}
+			record.Port = binary.BigEndian.Uint16(value)
+		}
+	}
+	return record, true
+}
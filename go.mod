@@ -12,7 +12,6 @@ require (
 	github.com/quic-go/quic-go v0.57.1
 	github.com/refraction-networking/utls v1.8.1
 	golang.org/x/net v0.43.0
-	h12.io/socks v1.0.3
 )
 
 require (
@@ -0,0 +1,151 @@
+package fastls
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// HeaderField 有序请求头列表中的一项
+type HeaderField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HeaderList 有序、允许重复的请求头列表，保留名称的大小写。
+// JSON 支持三种形式：[{"name":..,"value":..}]、[[name, value]] 和按键顺序解析的对象 {"name": "value"}。
+type HeaderList []HeaderField
+
+// Add 追加一个请求头，不影响已有的同名请求头
+func (l *HeaderList) Add(name, value string) {
+	*l = append(*l, HeaderField{Name: name, Value: value})
+}
+
+// Get 返回第一个同名请求头的值，名称不区分大小写
+func (l HeaderList) Get(name string) string {
+	for _, f := range l {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Values 按顺序返回所有同名请求头的值，名称不区分大小写
+func (l HeaderList) Values(name string) []string {
+	var values []string
+	for _, f := range l {
+		if strings.EqualFold(f.Name, name) {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// UnmarshalJSON 解析请求头列表，对象形式按键在 JSON 中出现的顺序解析
+func (l *HeaderList) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		*l = nil
+		return nil
+	}
+
+	if data[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		var list HeaderList
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			var value string
+			if err := dec.Decode(&value); err != nil {
+				return fmt.Errorf("请求头 %v 的值必须是字符串: %w", key, err)
+			}
+			list.Add(key.(string), value)
+		}
+		*l = list
+		return nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	list := make(HeaderList, 0, len(raw))
+	for _, item := range raw {
+		var pair []string
+		if err := json.Unmarshal(item, &pair); err == nil {
+			if len(pair) != 2 {
+				return fmt.Errorf("请求头数组必须是 [name, value]，实际是 %s", item)
+			}
+			list.Add(pair[0], pair[1])
+			continue
+		}
+		var field HeaderField
+		if err := json.Unmarshal(item, &field); err != nil {
+			return fmt.Errorf("无效的请求头 %s: %w", item, err)
+		}
+		list = append(list, field)
+	}
+	*l = list
+	return nil
+}
+
+// applyHeaderList 将有序请求头列表写入请求头：同名请求头替换 Headers 中的值，重复项按顺序追加
+func applyHeaderList(h map[string][]string, list HeaderList) {
+	keys := make(map[string]string) // 小写名称 -> 第一次出现时的大小写
+	for _, f := range list {
+		lower := strings.ToLower(f.Name)
+		if key, ok := keys[lower]; ok {
+			h[key] = append(h[key], f.Value)
+			continue
+		}
+		keys[lower] = f.Name
+		setRawHeader(h, f.Name, f.Value)
+	}
+}
+
+// mergeHeaderOrder 将列表中的请求头按列表顺序连续排列，放在它们在 order 中最早出现的位置，
+// order 中都没有时追加到末尾
+func mergeHeaderOrder(order []string, list HeaderList) []string {
+	listed := make(map[string]bool)
+	var block []string
+	for _, f := range list {
+		lower := strings.ToLower(f.Name)
+		if !listed[lower] {
+			listed[lower] = true
+			block = append(block, lower)
+		}
+	}
+
+	result := make([]string, 0, len(order)+len(block))
+	inserted := false
+	for _, k := range order {
+		if !listed[strings.ToLower(k)] {
+			result = append(result, k)
+			continue
+		}
+		if !inserted {
+			result = append(result, block...)
+			inserted = true
+		}
+	}
+	if !inserted {
+		result = append(result, block...)
+	}
+	return result
+}
+
+// joinCookieHeader HTTP/1.1 只允许一行 Cookie，将多个 Cookie 值用 "; " 合并
+func joinCookieHeader(h map[string][]string) {
+	for k, v := range h {
+		if len(v) > 1 && strings.EqualFold(k, "Cookie") {
+			h[k] = []string{strings.Join(v, "; ")}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package fastls
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// defaultHTTP3IdleTimeout 与 Chrome 相同，QUIC 连接 30 秒没有收发数据后关闭
+const defaultHTTP3IdleTimeout = 30 * time.Second
+
+// HTTP3Pool 按 origin 复用 HTTP/3 连接并缓存 TLS 会话票据，需在请求间复用同一个实例
+//
+// 同一 origin 的并发请求在一个 QUIC 连接上多路复用，连接空闲超过 IdleTimeout 后关闭。
+// 新连接恢复缓存的会话时，GET 和 HEAD 请求通过 0-RTT 随握手发送，其他方法等待握手完成。
+// 指纹、User-Agent、代理或源地址不同的请求使用各自的连接和会话缓存，不会通过会话票据被关联；
+// 每个请求轮换源地址（SourcePool 未设置 SourceSession）时不跨请求复用。零值可用，字段在第一次使用后不能再修改
+type HTTP3Pool struct {
+	IdleTimeout time.Duration // 连接空闲多久后关闭，为 0 时为 30 秒
+	Disable0RTT bool          // 不发送 0-RTT 请求，恢复会话时仍然省去证书交换
+	// TLSConfig QUIC 握手的 TLS 设置，如 RootCAs；ServerName、NextProtos 和 ClientSessionCache 由连接池设置
+	TLSConfig *tls.Config
+
+	mu     sync.Mutex
+	routes map[string]*http3.Transport
+	// ctx 在 Close 时取消，中止不随请求取消的握手
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// transport 返回 route 对应的 HTTP/3 Transport，第一次使用时创建
+func (p *HTTP3Pool) transport(route string) *http3.Transport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.routes == nil {
+		p.routes = make(map[string]*http3.Transport)
+	}
+	t := p.routes[route]
+	if t == nil {
+		t = newStdHTTP3Transport(p.TLSConfig, p.IdleTimeout)
+		p.routes[route] = t
+	}
+	return t
+}
+
+// closing 返回 Close 时取消的 context
+func (p *HTTP3Pool) closing() context.Context {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx == nil {
+		p.ctx, p.cancel = context.WithCancel(context.Background())
+	}
+	return p.ctx
+}
+
+// CloseIdleConnections 关闭没有进行中请求的连接，会话票据保留，之后的新连接仍然可以使用 0-RTT
+func (p *HTTP3Pool) CloseIdleConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.routes {
+		t.CloseIdleConnections()
+	}
+}
+
+// Close 关闭所有连接并丢弃会话票据
+func (p *HTTP3Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		p.cancel()
+		p.ctx, p.cancel = nil, nil
+	}
+	for route, t := range p.routes {
+		_ = t.Close()
+		delete(p.routes, route)
+	}
+}
+
+// newStdHTTP3Transport 创建 quic-go 的 HTTP/3 Transport，连接通过 context 中发起请求的 http3Transport 建立
+func newStdHTTP3Transport(tlsConfig *tls.Config, idleTimeout time.Duration) *http3.Transport {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	if idleTimeout <= 0 {
+		idleTimeout = defaultHTTP3IdleTimeout
+	}
+	return &http3.Transport{
+		TLSClientConfig: tlsConfig,
+		QUICConfig:      &quic.Config{MaxIdleTimeout: idleTimeout},
+		Dial:            dialHTTP3FromContext,
+	}
+}
+
+// http3Route 返回计算 HTTP/3 连接池中路由键的函数，按请求 URL 选择代理时代理列表也是键的一部分。
+// 每个请求轮换源地址时返回 nil，函数返回 false 时本次请求的连接不跨请求复用
+func http3Route(browser browser, proxyURL string) func(u *url.URL) (string, bool) {
+	source, ok := browser.Source.reuseKey()
+	if !ok {
+		return nil
+	}
+	fingerprint := ""
+	if browser.Fingerprint != nil {
+		fingerprint = browser.Fingerprint.Value()
+	}
+	headers := make([]string, 0, len(browser.ProxyHeaders))
+	for k, v := range browser.ProxyHeaders {
+		headers = append(headers, k+": "+v)
+	}
+	sort.Strings(headers)
+	route := strings.Join([]string{
+		fingerprint,
+		browser.UserAgent,
+		proxyURL,
+		strings.Join(browser.ProxyChain, ","),
+		strings.Join(headers, "\n"),
+		source,
+	}, "|")
+	if proxyURL != "" || browser.ProxyFunc == nil {
+		return func(*url.URL) (string, bool) { return route, true }
+	}
+	return func(u *url.URL) (string, bool) {
+		proxies, err := browser.ProxyFunc(u)
+		if err != nil {
+			// 让请求在建立连接时返回 ProxyFunc 的错误
+			return "", false
+		}
+		return fmt.Sprintf("%s|%q", route, proxies), true
+	}
+}
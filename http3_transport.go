@@ -1,40 +1,91 @@
 package fastls
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"net"
-	"strings"
+	"net/url"
 	"sync"
 
 	stdhttp "net/http"
+	stdhttptrace "net/http/httptrace"
 
 	http "github.com/FastTLS/fhttp"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
-	"golang.org/x/net/proxy"
 )
 
 // http3Transport 实现 HTTP/3 传输层
 type http3Transport struct {
-	sync.Mutex
 	Fingerprint Fingerprint
 	UserAgent   string
 	Cookies     []Cookie
-	dialer      proxy.ContextDialer
 
-	// QUIC 连接缓存
-	cachedQuicConnections map[string]*quic.Conn
+	// pool 跨请求复用连接的连接池，route 返回请求在连接池中的路由键，由 roundTripper 设置
+	pool  *HTTP3Pool
+	route func(u *url.URL) (string, bool)
+
+	// recordConn 记录连接的远端地址和 TLS 信息，由 roundTripper 设置
+	recordConn func(addr string, info connInfo)
+	// trace 请求的回调，由 roundTripper 设置
+	trace *ClientTrace
+	// logger 由 roundTripper 设置
+	logger *slog.Logger
+	// resolver 解析 QUIC 连接的域名，为空时使用系统 DNS，由 roundTripper 设置
+	resolver Resolver
+	// source 绑定的本地源地址，为空时由系统选择，由 roundTripper 设置
+	source *sourceAddr
+	// packetDialer 不为空时通过代理收发 UDP 数据报，由 roundTripper 设置
+	packetDialer packetDialer
+	// altAddr Alt-Svc 声明的端点，不为空时连接该地址，证书仍按 URL 的域名验证
+	altAddr string
+	// detachDial 请求取消后连接池中的握手继续完成，onConn 在获得连接时调用，由 Alt-Svc 竞速设置
+	detachDial bool
+	onConn     func()
 }
 
+// http3DialKey context 中发起请求的 http3Transport，连接池中的连接按请求的代理、解析器、源地址和回调建立
+type http3DialKey struct{}
+
+// http3DetachDialKey context 中的值为 true 时，建立连接不随请求取消
+type http3DetachDialKey struct{}
+
 // RoundTrip 实现 http.RoundTripper 接口
 func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport, pooled := t.transport(req.URL)
+	closeTransport := func() {}
+	if !pooled {
+		// 不在连接池中的传输层只用于这个请求，响应体读完或关闭后才关闭
+		closeTransport = sync.OnceFunc(func() { _ = transport.Close() })
+	}
+
+	// 请求的 context 带上建立连接使用的 http3Transport 和获得连接的回调
+	var remoteAddr string
+	ctx := context.WithValue(req.Context(), http3DialKey{}, t)
+	if pooled && t.detachDial {
+		ctx = context.WithValue(ctx, http3DetachDialKey{}, true)
+	}
+	ctx = stdhttptrace.WithClientTrace(ctx, &stdhttptrace.ClientTrace{
+		GotConn: func(info stdhttptrace.GotConnInfo) {
+			remoteAddr = info.Conn.RemoteAddr().String()
+			t.trace.gotConn(remoteAddr, info.Reused)
+			if t.onConn != nil {
+				t.onConn()
+			}
+		},
+	})
+
 	// 将 fhttp.Request 转换为标准库的 http.Request
-	stdReq, err := stdhttp.NewRequest(req.Method, req.URL.String(), req.Body)
+	body := req.Body
+	if body == http.NoBody {
+		body = nil
+	}
+	stdReq, err := stdhttp.NewRequestWithContext(ctx, req.Method, req.URL.String(), body)
 	if err != nil {
+		closeTransport()
 		return nil, fmt.Errorf("创建标准库请求失败: %w", err)
 	}
 
@@ -71,39 +122,45 @@ func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 		})
 	}
 
-	// 创建 HTTP/3 Transport
-	// Transport 会通过 Dial 函数自动建立连接
-	transport := &http3.Transport{
-		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
-			// 建立 QUIC 连接（使用 DialEarly 支持 0-RTT）
-			return t.dialQUICEarly(ctx, addr, tlsCfg, cfg)
-		},
+	// 恢复会话的新连接上，GET 和 HEAD 请求随握手通过 0-RTT 发送
+	method := stdReq.Method
+	if pooled && !t.pool.Disable0RTT && body == nil {
+		switch method {
+		case stdhttp.MethodGet:
+			stdReq.Method = http3.MethodGet0RTT
+		case stdhttp.MethodHead:
+			stdReq.Method = http3.MethodHead0RTT
+		}
 	}
-	defer transport.Close()
 
 	// 发送请求
 	stdResp, err := transport.RoundTrip(stdReq)
+	if err != nil && stdReq.Method != method && errors.Is(err, quic.Err0RTTRejected) {
+		// 服务端拒绝 0-RTT 时等待握手完成后重新发送
+		t.logger.Debug("0-rtt rejected", slog.String("phase", phaseQUIC), slog.String("host", req.URL.Host))
+		stdReq.Method = method
+		stdResp, err = transport.RoundTrip(stdReq)
+	}
 	if err != nil {
+		closeTransport()
 		return nil, fmt.Errorf("HTTP/3 请求失败: %w", err)
 	}
-
-	// 将标准库的 Response 转换为 fhttp.Response
-	bodyBytes, err := io.ReadAll(stdResp.Body)
-	stdResp.Body.Close()
-	if err != nil {
-		return nil, fmt.Errorf("读取响应体失败: %w", err)
+	t.trace.gotFirstResponseByte()
+	if t.recordConn != nil {
+		t.recordConn(connKey(req.URL), connInfo{remoteAddr: remoteAddr, tls: tlsInfoFromStd(stdResp.TLS)})
 	}
 
-	// 创建 fhttp.Response
+	// 将标准库的 Response 转换为 fhttp.Response，响应体直接流式传递，由上层按需解压
 	fhttpResp := &http.Response{
-		Status:     stdResp.Status,
-		StatusCode: stdResp.StatusCode,
-		Proto:      stdResp.Proto,
-		ProtoMajor: stdResp.ProtoMajor,
-		ProtoMinor: stdResp.ProtoMinor,
-		Header:     http.Header{},
-		Body:       io.NopCloser(bytes.NewReader(bodyBytes)),
-		Request:    req,
+		Status:        stdResp.Status,
+		StatusCode:    stdResp.StatusCode,
+		Proto:         stdResp.Proto,
+		ProtoMajor:    stdResp.ProtoMajor,
+		ProtoMinor:    stdResp.ProtoMinor,
+		Header:        http.Header{},
+		Body:          &releaseBody{ReadCloser: stdResp.Body, release: closeTransport},
+		ContentLength: stdResp.ContentLength,
+		Request:       req,
 	}
 
 	// 复制响应头
@@ -116,108 +173,88 @@ func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return fhttpResp, nil
 }
 
-// dialQUIC 建立 QUIC 连接
-func (t *http3Transport) dialQUIC(ctx context.Context, addr string) (*quic.Conn, error) {
-	t.Lock()
-	defer t.Unlock()
-
-	// 检查缓存
-	if conn := t.cachedQuicConnections[addr]; conn != nil {
-		// 检查连接是否仍然有效（简单检查，实际应该检查连接状态）
-		return conn, nil
+// dialUDP 建立 QUIC 使用的 UDP 通道，使用 SOCKS5 代理时通过 UDP ASSOCIATE 转发
+func (t *http3Transport) dialUDP(ctx context.Context, host, port string) (net.PacketConn, net.Addr, error) {
+	if t.packetDialer != nil {
+		conn, addr, err := t.packetDialer.dialPacket(ctx, net.JoinHostPort(host, port))
+		if err != nil {
+			return nil, nil, fmt.Errorf("建立代理 UDP 通道失败: %w", err)
+		}
+		return conn, addr, nil
 	}
 
-	host, port, err := net.SplitHostPort(addr)
+	return dialDirectUDP(ctx, t.resolver, t.source, host, port)
+}
+
+// dialDirectUDP 不经过代理建立 UDP 连接，按 resolver 解析地址并绑定 source 中的源地址
+func dialDirectUDP(ctx context.Context, resolver Resolver, source *sourceAddr, host, port string) (net.PacketConn, net.Addr, error) {
+	udpAddr, err := resolveUDPAddr(ctx, resolver, source, host, port)
 	if err != nil {
-		host = addr
-		port = "443"
+		return nil, nil, fmt.Errorf("解析 UDP 地址失败: %w", err)
 	}
-
-	// 建立 UDP 连接（QUIC 基于 UDP）
-	udpAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, port))
+	localAddr, err := source.udpAddr(udpAddr.IP)
 	if err != nil {
-		return nil, fmt.Errorf("解析 UDP 地址失败: %w", err)
+		return nil, nil, err
 	}
-
-	udpConn, err := net.DialUDP("udp", nil, udpAddr)
+	// quic-go 通过 WriteTo 发送数据报，不能使用已连接的 UDP 连接
+	udpConn, err := net.ListenUDP("udp", localAddr)
 	if err != nil {
-		return nil, fmt.Errorf("建立 UDP 连接失败: %w", err)
+		return nil, nil, fmt.Errorf("建立 UDP 连接失败: %w", err)
 	}
+	return udpConn, udpAddr, nil
+}
 
-	// 配置 TLS
-	var tlsConfig *tls.Config
-	if t.Fingerprint != nil && !t.Fingerprint.IsEmpty() {
-		// 解析指纹并转换为标准 TLS 配置
-		// 注意：quic-go 使用标准库的 tls.Config，不支持 uTLS
-		// 我们只能尽量匹配 TLS 配置
-		fpValue := t.Fingerprint.Value()
-
-		// 如果是 JA4R 格式且是 QUIC 协议，解析它
-		if strings.HasPrefix(fpValue, "q") {
-			// 解析 JA4R 获取 TLS 配置信息
-			spec, err := ParseJA4R(fpValue, t.UserAgent)
-			if err != nil {
-				udpConn.Close()
-				return nil, fmt.Errorf("解析 JA4R 指纹失败: %w", err)
-			}
-
-			// 从 spec 中提取 TLS 配置
-			tlsConfig = &tls.Config{
-				ServerName:         host,
-				InsecureSkipVerify: true,
-				NextProtos:         []string{"h3"}, // HTTP/3 ALPN
-				MinVersion:         tls.VersionTLS13,
-				MaxVersion:         tls.VersionTLS13,
-			}
-
-			// 设置密码套件
-			if len(spec.CipherSuites) > 0 {
-				tlsConfig.CipherSuites = spec.CipherSuites
-			}
-		} else {
-			// 尝试解析 JA3 或其他格式
-			spec, err := StringToSpec(fpValue, t.UserAgent)
-			if err != nil {
-				udpConn.Close()
-				return nil, fmt.Errorf("解析指纹失败: %w", err)
-			}
-
-			tlsConfig = &tls.Config{
-				ServerName:         host,
-				InsecureSkipVerify: true,
-				NextProtos:         []string{"h3"},
-				MinVersion:         tls.VersionTLS13,
-				MaxVersion:         tls.VersionTLS13,
-			}
-
-			if len(spec.CipherSuites) > 0 {
-				tlsConfig.CipherSuites = spec.CipherSuites
-			}
-		}
-	} else {
-		tlsConfig = &tls.Config{
-			ServerName:         host,
-			InsecureSkipVerify: true,
-			NextProtos:         []string{"h3"},
-			MinVersion:         tls.VersionTLS13,
-			MaxVersion:         tls.VersionTLS13,
+// transport 返回发送请求的 HTTP/3 Transport，pooled 为 false 时是本次请求新建的，用完后关闭
+func (t *http3Transport) transport(u *url.URL) (transport *http3.Transport, pooled bool) {
+	if t.pool == nil {
+		return newStdHTTP3Transport(nil, 0), false
+	}
+	if t.route != nil {
+		if route, ok := t.route(u); ok {
+			return t.pool.transport(route), true
 		}
 	}
+	return newStdHTTP3Transport(t.pool.TLSConfig, t.pool.IdleTimeout), false
+}
 
-	// 建立 QUIC 连接
-	quicConn, err := quic.Dial(ctx, udpConn, udpAddr, tlsConfig, &quic.Config{})
-	if err != nil {
-		udpConn.Close()
-		return nil, fmt.Errorf("建立 QUIC 连接失败: %w", err)
+// dialHTTP3FromContext 通过 context 中发起请求的 http3Transport 建立 QUIC 连接
+func dialHTTP3FromContext(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	t, ok := ctx.Value(http3DialKey{}).(*http3Transport)
+	if !ok {
+		return nil, errors.New("缺少发起 HTTP/3 请求的传输层")
 	}
-
-	// 缓存连接
-	if t.cachedQuicConnections == nil {
-		t.cachedQuicConnections = make(map[string]*quic.Conn)
+	serverName, _, _ := net.SplitHostPort(addr)
+	if tlsCfg != nil && tlsCfg.ServerName != "" {
+		serverName = tlsCfg.ServerName
 	}
-	t.cachedQuicConnections[addr] = quicConn
-
-	return quicConn, nil
+	if t.altAddr != "" {
+		addr = t.altAddr
+	}
+	if detach, _ := ctx.Value(http3DetachDialKey{}).(bool); detach {
+		// 竞速放弃 QUIC 后握手继续完成，连接留在连接池中，仍受请求的超时和连接池的 Close 限制
+		deadline, ok := ctx.Deadline()
+		dialCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		defer cancel()
+		if ok {
+			dialCtx, cancel = context.WithDeadline(dialCtx, deadline)
+			defer cancel()
+		}
+		stop := context.AfterFunc(t.pool.closing(), cancel)
+		defer stop()
+		ctx = dialCtx
+	}
+	t.trace.tlsHandshakeStart(serverName)
+	conn, err := t.dialQUICEarly(ctx, addr, tlsCfg, cfg)
+	if err != nil {
+		t.trace.tlsHandshakeDone(nil, err)
+		t.logger.Warn("quic dial failed", slog.String("phase", phaseQUIC), slog.String("addr", addr), slog.Any("error", err))
+		return nil, err
+	}
+	state := conn.ConnectionState()
+	t.logger.Debug("quic connected", slog.String("phase", phaseQUIC), slog.String("addr", addr), slog.String("remote", conn.RemoteAddr().String()),
+		slog.Bool("resumed", state.TLS.DidResume), slog.Bool("0rtt", state.Used0RTT))
+	t.trace.tlsHandshakeDone(tlsInfoFromStd(&state.TLS), nil)
+	return conn, nil
 }
 
 // dialQUICEarly 建立 QUIC 连接（用于 HTTP/3）
@@ -229,17 +266,13 @@ func (t *http3Transport) dialQUICEarly(ctx context.Context, addr string, tlsCfg
 	}
 
 	// 建立 UDP 连接（QUIC 基于 UDP）
-	udpAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, port))
+	udpConn, udpAddr, err := t.dialUDP(ctx, host, port)
 	if err != nil {
-		return nil, fmt.Errorf("解析 UDP 地址失败: %w", err)
+		return nil, err
 	}
 
-	udpConn, err := net.DialUDP("udp", nil, udpAddr)
-	if err != nil {
-		return nil, fmt.Errorf("建立 UDP 连接失败: %w", err)
-	}
-
-	// 如果没有提供 tlsCfg，使用默认配置
+	// 如果没有提供 tlsCfg，使用默认配置；http3.Transport 总会传入 TLSClientConfig 的副本。
+	// QUIC 的 ClientHello 由 crypto/tls 生成，TLS 1.3 的密码套件和扩展不能设置，Fingerprint 不改变握手
 	if tlsCfg == nil {
 		tlsCfg = &tls.Config{
 			ServerName:         host,
@@ -248,41 +281,41 @@ func (t *http3Transport) dialQUICEarly(ctx context.Context, addr string, tlsCfg
 			MinVersion:         tls.VersionTLS13,
 			MaxVersion:         tls.VersionTLS13,
 		}
-
-		// 如果有指纹，尝试应用
-		if t.Fingerprint != nil && !t.Fingerprint.IsEmpty() {
-			fpValue := t.Fingerprint.Value()
-			if strings.HasPrefix(fpValue, "q") {
-				spec, err := ParseJA4R(fpValue, t.UserAgent)
-				if err == nil && len(spec.CipherSuites) > 0 {
-					tlsCfg.CipherSuites = spec.CipherSuites
-				}
-			}
-		}
 	}
 
 	// 如果没有提供 cfg，使用默认配置
 	if cfg == nil {
 		cfg = &quic.Config{}
 	}
+	if _, ok := udpConn.(*masquePacketConn); ok {
+		// MASQUE 隧道的数据报还要加上外层的封装，使用 QUIC 允许的最小包长
+		cfg = cfg.Clone()
+		cfg.InitialPacketSize = 1200
+		cfg.DisablePathMTUDiscovery = true
+	}
 
-	// 建立 QUIC 连接（使用 DialEarly 支持 0-RTT）
-	quicConn, err := quic.DialEarly(ctx, udpConn, udpAddr, tlsCfg, cfg)
+	// 建立 QUIC 连接（使用 DialEarly 支持 0-RTT），连接池关闭 0-RTT 时握手不提供 early data
+	dial := quic.DialEarly
+	if t.pool != nil && t.pool.Disable0RTT {
+		dial = quic.Dial
+	}
+	quicConn, err := dial(ctx, udpConn, udpAddr, tlsCfg, cfg)
 	if err != nil {
 		udpConn.Close()
 		return nil, fmt.Errorf("建立 QUIC 连接失败: %w", err)
 	}
+	// quic-go 不关闭传入的 PacketConn，连接结束时关闭 UDP 连接或代理隧道
+	context.AfterFunc(quicConn.Context(), func() { udpConn.Close() })
 
 	return quicConn, nil
 }
 
-// newHTTP3Transport 创建 HTTP/3 传输层
-func newHTTP3Transport(fingerprint Fingerprint, userAgent string, cookies []Cookie, dialer proxy.ContextDialer) *http3Transport {
+// newHTTP3Transport 创建 HTTP/3 传输层，UDP 数据报不经过 TCP 的 dialer，使用代理时由 packetDialer 转发
+func newHTTP3Transport(fingerprint Fingerprint, userAgent string, cookies []Cookie) *http3Transport {
 	return &http3Transport{
-		Fingerprint:           fingerprint,
-		UserAgent:             userAgent,
-		Cookies:               cookies,
-		dialer:                dialer,
-		cachedQuicConnections: make(map[string]*quic.Conn),
+		Fingerprint: fingerprint,
+		UserAgent:   userAgent,
+		Cookies:     cookies,
+		logger:      discardLogger,
 	}
 }
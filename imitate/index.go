@@ -1,5 +1,7 @@
 package imitate
 
+//go:generate go run ./internal/profilegen -dir .
+
 import (
 	"math/rand"
 	"strings"
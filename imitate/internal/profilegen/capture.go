@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/textproto"
+	"os"
+	"strings"
+
+	fastls "github.com/FastTLS/fastls"
+)
+
+// peetCapture 是 https://tls.peet.ws/api/all 返回结果中生成画像所需的部分
+// 使用真实浏览器访问该地址并保存返回的 JSON 即为一次抓取
+type peetCapture struct {
+	UserAgent string `json:"user_agent"`
+	TLS       struct {
+		JA3  string `json:"ja3"`
+		JA4R string `json:"ja4_r"`
+	} `json:"tls"`
+	HTTP2 *struct {
+		AkamaiFingerprint string `json:"akamai_fingerprint"`
+		SentFrames        []struct {
+			FrameType string   `json:"frame_type"`
+			Headers   []string `json:"headers"`
+		} `json:"sent_frames"`
+	} `json:"http2"`
+	HTTP1 *struct {
+		Headers []string `json:"headers"`
+	} `json:"http1"`
+}
+
+// skipCaptureHeaders 抓取中与具体请求相关、不应写入画像的请求头
+var skipCaptureHeaders = map[string]bool{
+	"host":           true,
+	"user-agent":     true,
+	"cookie":         true,
+	"referer":        true,
+	"content-length": true,
+	"content-type":   true,
+}
+
+// defaultCaptureHeaders 允许调用方覆盖的请求头，生成时只在未设置时写入
+var defaultCaptureHeaders = map[string]bool{
+	"accept":          true,
+	"accept-encoding": true,
+	"accept-language": true,
+}
+
+// profileFromCapture 将 tls.peet.ws 的抓取结果转换为画像
+func profileFromCapture(path, name, description string, shuffle bool) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c peetCapture
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("解析抓取文件 %s 失败: %w", path, err)
+	}
+	if c.HTTP2 == nil || c.HTTP2.AkamaiFingerprint == "" {
+		return nil, fmt.Errorf("抓取文件 %s 不包含 HTTP/2 指纹，请使用 HTTP/2 访问 tls.peet.ws", path)
+	}
+
+	var rawHeaders []string
+	for _, frame := range c.HTTP2.SentFrames {
+		if frame.FrameType == "HEADERS" {
+			rawHeaders = frame.Headers
+			break
+		}
+	}
+	if rawHeaders == nil && c.HTTP1 != nil {
+		rawHeaders = c.HTTP1.Headers
+	}
+
+	if description == "" {
+		description = name
+	}
+	p := &Profile{
+		Name:                name,
+		Description:         description,
+		JA3:                 c.TLS.JA3,
+		JA3Shuffle:          shuffle,
+		JA4R:                c.TLS.JA4R,
+		HTTP2SettingsString: c.HTTP2.AkamaiFingerprint,
+		UserAgent:           c.UserAgent,
+	}
+	order := []string{"host"}
+	for _, line := range rawHeaders {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok || strings.HasPrefix(key, ":") {
+			continue
+		}
+		lower := strings.ToLower(key)
+		order = append(order, lower)
+		if skipCaptureHeaders[lower] {
+			continue
+		}
+		// 低熵 Client Hints 由 User-Agent 生成，这里只记录品牌
+		if lowEntropyHints[lower] && fastls.NewClientHints(c.UserAgent) != nil {
+			if lower == "sec-ch-ua" {
+				p.ClientHints = &ClientHints{Brand: captureBrand(value)}
+			}
+			continue
+		}
+		p.Headers = append(p.Headers, Header{
+			Name:    textproto.CanonicalMIMEHeaderKey(key),
+			Value:   value,
+			Default: defaultCaptureHeaders[lower],
+		})
+	}
+	// 抓取时未发送的 cookie 和 referer 追加到末尾，保证后续请求中它们有确定的位置
+	for _, key := range []string{"cookie", "referer"} {
+		if !containsString(order, key) {
+			order = append(order, key)
+		}
+	}
+	p.HeaderOrder = order
+	return p, p.validate()
+}
+
+// lowEntropyHints Chromium 默认发送的 Client Hints
+var lowEntropyHints = map[string]bool{
+	"sec-ch-ua":          true,
+	"sec-ch-ua-mobile":   true,
+	"sec-ch-ua-platform": true,
+}
+
+// captureBrand 从抓取的 Sec-Ch-Ua 中找出品牌，只有 Chromium 时返回 "Chromium"，
+// 是 Chrome、Edge 或 Opera 时返回空字符串，由 User-Agent 推导
+func captureBrand(secChUa string) string {
+	for _, item := range strings.Split(secChUa, ",") {
+		brand, _, _ := strings.Cut(strings.TrimSpace(item), ";")
+		brand = strings.Trim(brand, `"`)
+		switch {
+		case brand == "Chromium", strings.HasPrefix(brand, "Not"):
+			continue
+		case brand == "Google Chrome", brand == "Microsoft Edge", brand == "Opera":
+			return ""
+		default:
+			return brand
+		}
+	}
+	return "Chromium"
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+// profilegen 根据 imitate/profiles 下的浏览器画像生成 imitate 和 imitate/ja4r 中的函数，
+// 同时生成 _tests 下的 golden 测试数据。
+//
+// 重新生成所有画像：
+//
+//	go generate ./imitate
+//
+// 新增浏览器画像（先用真实浏览器访问 https://tls.peet.ws/api/all 并保存返回的 JSON）：
+//
+//	go run ./imitate/internal/profilegen -dir imitate -capture chrome143.json -name Chrome143 -description "Chrome 143 (Windows)" -shuffle -latest
+//
+// -latest 使新画像成为该浏览器的 latest 画像，imitate.Chrome 等别名随之指向它
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+func main() {
+	var (
+		dir         = flag.String("dir", ".", "imitate 包所在目录")
+		capture     = flag.String("capture", "", "tls.peet.ws 抓取结果文件，设置后先生成对应画像")
+		name        = flag.String("name", "", "抓取生成的画像名（导出函数名），如 Chrome143")
+		description = flag.String("description", "", "抓取生成的画像描述")
+		shuffle     = flag.Bool("shuffle", false, "抓取生成的画像是否随机打乱 JA3 扩展顺序（Chrome 系）")
+		latest      = flag.Bool("latest", false, "抓取生成的画像是否作为该浏览器最新的画像，生成去掉版本号的别名")
+	)
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("profilegen: ")
+
+	profilesDir := filepath.Join(*dir, "profiles")
+	if *capture != "" {
+		if *name == "" {
+			log.Fatal("使用 -capture 时必须指定 -name")
+		}
+		p, err := profileFromCapture(*capture, *name, *description, *shuffle)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *latest {
+			p.Latest = true
+			if err := clearLatest(profilesDir, p.alias()); err != nil {
+				log.Fatal(err)
+			}
+		}
+		path, err := writeProfile(profilesDir, p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("已写入画像 %s", path)
+	}
+
+	if err := generate(*dir, profilesDir); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate 为所有画像生成 imitate 代码和 golden 测试数据
+func generate(dir, profilesDir string) error {
+	profiles, err := loadProfiles(profilesDir)
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		return fmt.Errorf("%s 下没有画像", profilesDir)
+	}
+
+	testsDir := filepath.Join(dir, "..", "_tests")
+	goldenDir := filepath.Join(testsDir, "testdata", "profiles")
+	if err := os.MkdirAll(goldenDir, 0o755); err != nil {
+		return err
+	}
+
+	var all []renderData
+	for _, p := range profiles {
+		data := newRenderData(p)
+		all = append(all, data)
+		code, err := renderGo(ja3Template, p.source, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+		if err := writeFile(filepath.Join(dir, p.fileBase()+".go"), code); err != nil {
+			return err
+		}
+		fixture, err := renderGolden(p, false)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(goldenDir, p.fileBase()+".golden.json"), fixture); err != nil {
+			return err
+		}
+
+		if p.JA4R == "" {
+			continue
+		}
+		code, err = renderGo(ja4Template, p.source, data)
+		if err != nil {
+			return fmt.Errorf("%sJA4: %w", p.Name, err)
+		}
+		if err := writeFile(filepath.Join(dir, "ja4r", p.ja4FileBase()+".go"), code); err != nil {
+			return err
+		}
+		fixture, err = renderGolden(p, true)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(goldenDir, p.ja4FileBase()+".golden.json"), fixture); err != nil {
+			return err
+		}
+	}
+
+	if err := generateLatest(dir, all); err != nil {
+		return err
+	}
+	code, err := renderGo(testTemplate, "*", all)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(testsDir, "imitate_profiles_gen_test.go"), code)
+}
+
+// generateLatest 为 latest 画像生成去掉版本号的别名，没有 latest 画像时删除旧的别名文件
+func generateLatest(dir string, all []renderData) error {
+	var latest, latestJA4 []renderData
+	for _, d := range all {
+		if !d.Latest {
+			continue
+		}
+		latest = append(latest, d)
+		if d.JA4R != "" {
+			latestJA4 = append(latestJA4, d)
+		}
+	}
+	for _, f := range []struct {
+		t    *template.Template
+		path string
+		data []renderData
+	}{
+		{latestTemplate, filepath.Join(dir, "latest.go"), latest},
+		{latestJA4Template, filepath.Join(dir, "ja4r", "latest.go"), latestJA4},
+	} {
+		if len(f.data) == 0 {
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		code, err := renderGo(f.t, "*", f.data)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(f.path, code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	log.Printf("已生成 %s", path)
+	return nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	fastls "github.com/FastTLS/fastls"
+)
+
+// Profile 描述一个浏览器画像，由 profiles/*.json 加载
+type Profile struct {
+	// Name 生成的导出函数名，如 Chrome142；JA4R 版本为 Name + "JA4"
+	Name string `json:"name"`
+	// File JA3 版本的文件名（不含 .go），为空时使用小写的 Name
+	File string `json:"file,omitempty"`
+	// Description 浏览器描述，写入生成函数的文档注释
+	Description string `json:"description"`
+	// JA3 完整的 JA3 指纹字符串
+	JA3 string `json:"ja3"`
+	// JA3Shuffle 是否像 Chrome 一样随机打乱扩展顺序（扩展 21 随机出现，末尾的 41 固定）
+	JA3Shuffle bool `json:"ja3Shuffle,omitempty"`
+	// JA4R JA4R 指纹字符串，为空时不生成 JA4R 版本
+	JA4R string `json:"ja4r,omitempty"`
+	// QUICJA4R 通过 HTTP/3 抓取的 QUIC 握手 JA4R 指纹，设置后写入 options.QUICFingerprint
+	QUICJA4R string `json:"quicJa4r,omitempty"`
+	// HTTP2SettingsString HTTP/2 设置字符串（Akamai 格式）
+	HTTP2SettingsString string `json:"http2SettingsString"`
+	// UserAgent User-Agent
+	UserAgent string `json:"userAgent"`
+	// Latest 为 true 时生成去掉版本号的别名（如 Chrome142 的 Chrome），指向该浏览器最新的画像，
+	// 同一浏览器只能有一个画像设置
+	Latest bool `json:"latest,omitempty"`
+	// ClientHints 设置后由 User-Agent 生成 Sec-Ch-Ua、Sec-Ch-Ua-Mobile 和 Sec-Ch-Ua-Platform，
+	// 写在 Headers 之前，保证 Client Hints 与 User-Agent 一致
+	ClientHints *ClientHints `json:"clientHints,omitempty"`
+	// Headers 按顺序写入 options.Headers 的请求头
+	Headers []Header `json:"headers"`
+	// HeaderOrder 请求头顺序，为空时不设置 HeaderOrderKeys
+	HeaderOrder []string `json:"headerOrder,omitempty"`
+
+	// source 画像文件名（不含扩展名）
+	source string
+}
+
+// Header 画像中的单个请求头
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Default 为 true 时仅在调用方未设置该请求头时写入
+	Default bool `json:"default,omitempty"`
+}
+
+// ClientHints 画像的 Client Hints 设置
+type ClientHints struct {
+	// Brand 品牌，为空时由 User-Agent 推导（Chrome、Edge、Opera）；"Chromium" 表示只有 Chromium 品牌
+	Brand string `json:"brand,omitempty"`
+}
+
+// expandClientHints 将由 User-Agent 生成的低熵 Client Hints 加到 Headers 前面
+func (p *Profile) expandClientHints() error {
+	if p.ClientHints == nil {
+		return nil
+	}
+	hints := fastls.NewClientHints(p.UserAgent)
+	if hints == nil {
+		return fmt.Errorf("%s: User-Agent 不是 Chromium 内核，不能生成 Client Hints", p.Name)
+	}
+	if p.ClientHints.Brand != "" {
+		hints.Brand = p.ClientHints.Brand
+	}
+
+	headers := []Header{
+		{Name: "Sec-Ch-Ua", Value: hints.SecChUa()},
+		{Name: "Sec-Ch-Ua-Mobile", Value: "?0"},
+		{Name: "Sec-Ch-Ua-Platform", Value: strconv.Quote(hints.Platform)},
+	}
+	if hints.Mobile {
+		headers[1].Value = "?1"
+	}
+	for _, h := range p.Headers {
+		if strings.HasPrefix(strings.ToLower(h.Name), "sec-ch-ua") {
+			return fmt.Errorf("%s: 设置了 clientHints 时 headers 中不能再包含 %s", p.Name, h.Name)
+		}
+	}
+	p.Headers = append(headers, p.Headers...)
+	return nil
+}
+
+// fileBase 返回 JA3 版本的文件名（不含扩展名）
+func (p *Profile) fileBase() string {
+	if p.File != "" {
+		return p.File
+	}
+	return strings.ToLower(p.Name)
+}
+
+// alias 返回 Latest 画像的别名，即去掉 Name 末尾的版本号
+func (p *Profile) alias() string {
+	return strings.TrimRightFunc(p.Name, unicode.IsDigit)
+}
+
+// ja4FileBase 返回 JA4R 版本的文件名（不含扩展名）
+func (p *Profile) ja4FileBase() string {
+	return strings.ToLower(p.Name) + "_ja4"
+}
+
+// validate 检查画像字段是否完整
+func (p *Profile) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("缺少 name")
+	}
+	if parts := strings.Split(p.JA3, ","); len(parts) != 5 {
+		return fmt.Errorf("%s: JA3 需要 5 个部分，得到 %d 个", p.Name, len(parts))
+	}
+	if p.JA4R != "" && strings.Count(p.JA4R, "_") < 3 {
+		return fmt.Errorf("%s: JA4R 格式错误: %s", p.Name, p.JA4R)
+	}
+	if p.QUICJA4R != "" {
+		parts := strings.Split(p.QUICJA4R, "_")
+		// QUIC 握手一定带有 quic_transport_parameters (0039)
+		if !strings.HasPrefix(p.QUICJA4R, "q") || len(parts) < 4 || !strings.Contains(","+parts[2]+",", ",0039,") {
+			return fmt.Errorf("%s: QUIC JA4R 格式错误: %s", p.Name, p.QUICJA4R)
+		}
+	}
+	if p.Latest && p.alias() == p.Name {
+		return fmt.Errorf("%s: latest 画像的 name 需要以版本号结尾", p.Name)
+	}
+	if p.HTTP2SettingsString == "" {
+		return fmt.Errorf("%s: 缺少 http2SettingsString", p.Name)
+	}
+	if p.UserAgent == "" {
+		return fmt.Errorf("%s: 缺少 userAgent", p.Name)
+	}
+	return nil
+}
+
+// loadProfiles 加载目录下的所有画像，按文件名排序
+func loadProfiles(dir string) ([]*Profile, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var profiles []*Profile
+	seen := make(map[string]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var p Profile
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, fmt.Errorf("解析 %s 失败: %w", file, err)
+		}
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if prev, ok := seen[p.Name]; ok {
+			return nil, fmt.Errorf("%s 与 %s 使用了相同的 name %q", file, prev, p.Name)
+		}
+		seen[p.Name] = file
+		if p.Latest {
+			// 别名与画像的 name 共用命名空间，如 Chrome 不能同时是画像和别名
+			if prev, ok := seen[p.alias()]; ok {
+				return nil, fmt.Errorf("%s 的别名 %q 与 %s 冲突", file, p.alias(), prev)
+			}
+			seen[p.alias()] = file
+		}
+		if err := p.expandClientHints(); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		p.source = strings.TrimSuffix(filepath.Base(file), ".json")
+		profiles = append(profiles, &p)
+	}
+	return profiles, nil
+}
+
+// clearLatest 取消目录下别名为 alias 的画像的 latest 标记，由新抓取的画像接替
+func clearLatest(dir, alias string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var p Profile
+		if err := json.Unmarshal(data, &p); err != nil {
+			return fmt.Errorf("解析 %s 失败: %w", file, err)
+		}
+		if !p.Latest || p.alias() != alias {
+			continue
+		}
+		p.Latest = false
+		if err := encodeProfile(file, &p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeProfile 将画像写入 profiles 目录
+func writeProfile(dir string, p *Profile) (string, error) {
+	path := filepath.Join(dir, strings.ToLower(p.Name)+".json")
+	return path, encodeProfile(path, p)
+}
+
+// encodeProfile 以缩进的 JSON 写入画像，字段顺序与结构体一致
+func encodeProfile(path string, p *Profile) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(p); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
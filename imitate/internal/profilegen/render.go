@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// generatedHeader 生成文件的首行，go 工具据此识别生成代码
+const generatedHeader = "// Code generated by profilegen from profiles/%s.json; DO NOT EDIT.\n\n"
+
+var funcs = template.FuncMap{
+	"quote": goString,
+}
+
+var ja3Template = template.Must(template.New("ja3").Funcs(funcs).Parse(`package imitate
+
+import (
+	fastls "github.com/FastTLS/fastls"
+)
+{{if .Shuffle}}
+// {{.ExtensionConst}} 扩展列表，shuffleExtension 每次打乱顺序，扩展 21 (padding) 时有时无
+const {{.ExtensionConst}} = {{quote .Extensions}}
+{{end}}
+// {{.Name}}HTTP2SettingsString HTTP/2 设置字符串格式
+// 格式: {{quote .HTTP2SettingsString}}{{with .PseudoHeaderNote}}
+// 注意: {{.}}{{end}}{{range .SettingsNotes}}
+// {{.}}{{end}}
+var {{.Name}}HTTP2SettingsString = {{quote .HTTP2SettingsString}}
+
+// {{.Name}} 使用 JA3 指纹模拟 {{.Description}}
+func {{.Name}}(options *fastls.Options) {
+	options.Fingerprint = fastls.Ja3Fingerprint{
+		FingerprintValue: {{.JA3Expr}},
+	}
+	options.HTTP2SettingsString = {{.Name}}HTTP2SettingsString
+{{template "body" .}}}
+`))
+
+var ja4Template = template.Must(template.New("ja4").Funcs(funcs).Parse(`package ja4r
+
+import (
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+)
+
+// {{.Name}}JA4 使用 JA4R 指纹模拟 {{.Description}}
+//
+// 注意：此功能是实验性的，API 可能会在未来的版本中发生变化。
+// EXPERIMENTAL: This feature is experimental and the API may change in future versions.
+func {{.Name}}JA4(options *fastls.Options) {
+	// JA4R 格式：t13d<num>_<cipher_suites>_<extensions>_<signature_algorithms>
+	options.Fingerprint = fastls.Ja4Fingerprint{
+		FingerprintValue: {{quote .JA4R}},
+	}
+	options.HTTP2SettingsString = imitate.{{.Name}}HTTP2SettingsString
+{{template "body" .}}}
+`))
+
+const bodyTemplate = `{{define "body"}}{{if .QUICJA4R}}	options.QUICFingerprint = fastls.Ja4Fingerprint{
+		FingerprintValue: {{quote .QUICJA4R}},
+	}
+{{end}}	if options.Headers == nil {
+		options.Headers = make(map[string]string)
+	}
+
+{{range .Headers}}{{if .Default}}	if options.Headers[{{quote .Name}}] == "" {
+		options.Headers[{{quote .Name}}] = {{quote .Value}}
+	}
+{{else}}	options.Headers[{{quote .Name}}] = {{quote .Value}}
+{{end}}{{end}}{{if .HeaderOrder}}
+	options.HeaderOrderKeys = []string{
+{{range .HeaderOrder}}		{{quote .}},
+{{end}}	}
+{{end}}	options.UserAgent = {{quote .UserAgent}}
+{{end}}`
+
+var latestTemplate = template.Must(template.New("latest").Funcs(funcs).Parse(`package imitate
+
+import (
+	fastls "github.com/FastTLS/fastls"
+)
+{{range .}}
+// {{.Alias}}HTTP2SettingsString 最新的 {{.Alias}} 画像的 HTTP/2 设置字符串，目前与 {{.Name}}HTTP2SettingsString 相同
+var {{.Alias}}HTTP2SettingsString = {{.Name}}HTTP2SettingsString
+
+// {{.Alias}} 模拟最新的 {{.Alias}}，目前与 {{.Name}} 相同
+//
+// 需要固定版本时直接使用带版本号的函数
+func {{.Alias}}(options *fastls.Options) {
+	{{.Name}}(options)
+}
+{{end}}`))
+
+var latestJA4Template = template.Must(template.New("latestJA4").Funcs(funcs).Parse(`package ja4r
+
+import (
+	fastls "github.com/FastTLS/fastls"
+)
+{{range .}}
+// {{.Alias}}JA4 使用 JA4R 指纹模拟最新的 {{.Alias}}，目前与 {{.Name}}JA4 相同
+//
+// 注意：此功能是实验性的，API 可能会在未来的版本中发生变化。
+// EXPERIMENTAL: This feature is experimental and the API may change in future versions.
+func {{.Alias}}JA4(options *fastls.Options) {
+	{{.Name}}JA4(options)
+}
+{{end}}`))
+
+var testTemplate = template.Must(template.New("test").Funcs(funcs).Parse(`package tests
+
+import (
+	fastls "github.com/FastTLS/fastls"
+	"github.com/FastTLS/fastls/imitate"
+	"github.com/FastTLS/fastls/imitate/ja4r"
+)
+
+// generatedProfiles 由 profilegen 生成的 imitate 函数，键为 testdata/profiles 下的 golden 文件名
+var generatedProfiles = map[string]func(*fastls.Options){
+{{range .}}	{{quote .FileBase}}: imitate.{{.Name}},
+{{if .JA4R}}	{{quote .JA4FileBase}}: ja4r.{{.Name}}JA4,
+{{end}}{{end}}}
+
+// latestProfiles 由 latest 画像生成的别名，键为所指画像的 golden 文件名
+var latestProfiles = map[string]func(*fastls.Options){
+{{range .}}{{if .Latest}}	{{quote .FileBase}}: imitate.{{.Alias}},
+{{if .JA4R}}	{{quote .JA4FileBase}}: ja4r.{{.Alias}}JA4,
+{{end}}{{end}}{{end}}}
+`))
+
+func init() {
+	for _, t := range []*template.Template{ja3Template, ja4Template} {
+		template.Must(t.Parse(bodyTemplate))
+	}
+}
+
+// renderData 模板使用的画像数据
+type renderData struct {
+	*Profile
+	Shuffle        bool
+	ExtensionConst string
+	Extensions     string
+	JA3Expr        string
+	FileBase       string
+	JA4FileBase    string
+	Alias          string
+}
+
+// pseudoHeaderNames 伪头部顺序字母与伪头部的对应关系
+var pseudoHeaderNames = map[string]string{
+	"m": ":method",
+	"a": ":authority",
+	"s": ":scheme",
+	"p": ":path",
+}
+
+// PseudoHeaderNote 说明 HTTP/2 设置字符串末尾的伪头部顺序会推导成什么
+func (d renderData) PseudoHeaderNote() string {
+	parts := strings.Split(d.HTTP2SettingsString, "|")
+	letters := strings.Split(parts[len(parts)-1], ",")
+	names := make([]string, 0, len(letters))
+	for _, l := range letters {
+		name, ok := pseudoHeaderNames[l]
+		if !ok {
+			return ""
+		}
+		names = append(names, name)
+	}
+	return fmt.Sprintf("%s 会自动推导为 %s", parts[len(parts)-1], strings.Join(names, ","))
+}
+
+// settingNames 需要在生成代码中说明的 HTTP/2 设置 ID
+var settingNames = map[string]string{
+	"8": "ENABLE_CONNECT_PROTOCOL (RFC 8441)",
+	"9": "NO_RFC7540_PRIORITIES (RFC 9218)",
+}
+
+// SettingsNotes 说明 HTTP/2 设置字符串中不常见或容易误解的设置
+func (d renderData) SettingsNotes() []string {
+	parts := strings.Split(d.HTTP2SettingsString, "|")
+	order := parts[len(parts)-1]
+	var notes []string
+	for _, setting := range strings.Split(parts[0], ";") {
+		id, value, _ := strings.Cut(setting, ":")
+		switch {
+		case id == "3":
+			notes = append(notes, fmt.Sprintf("虽然 %s 设置了 MAX_CONCURRENT_STREAMS (3:%s)，但在顺序字符串中只使用 %s", d.Name, value, order))
+		case settingNames[id] != "":
+			notes = append(notes, fmt.Sprintf("设置 ID %s 是 %s", id, settingNames[id]))
+		}
+	}
+	return notes
+}
+
+func newRenderData(p *Profile) renderData {
+	d := renderData{
+		Profile:     p,
+		Shuffle:     p.JA3Shuffle,
+		FileBase:    p.fileBase(),
+		JA4FileBase: p.ja4FileBase(),
+		Alias:       p.alias(),
+		JA3Expr:     goString(p.JA3),
+	}
+	if !p.JA3Shuffle {
+		return d
+	}
+
+	// 与 shuffleExtension 的约定一致：扩展 21 随机出现，末尾的 PSK 扩展 41 固定在最后
+	parts := strings.Split(p.JA3, ",")
+	exts := strings.Split(parts[2], "-")
+	suffix := ""
+	if exts[len(exts)-1] == "41" {
+		exts = exts[:len(exts)-1]
+		suffix = "-41"
+	}
+	l21 := -1
+	for i, e := range exts {
+		if e == "21" {
+			l21 = i
+			break
+		}
+	}
+	d.ExtensionConst = lowerFirst(p.Name) + "Extension"
+	d.Extensions = strings.Join(exts, "-")
+	d.JA3Expr = fmt.Sprintf("%s + \",\" + shuffleExtension(%s, %d) + %s",
+		goString(parts[0]+","+parts[1]), d.ExtensionConst, l21,
+		goString(suffix+","+parts[3]+","+parts[4]))
+	return d
+}
+
+// renderGo 执行模板并格式化生成的 Go 代码
+func renderGo(t *template.Template, source string, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, generatedHeader, source)
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("格式化生成代码失败: %w\n%s", err, buf.String())
+	}
+	return out, nil
+}
+
+// golden 是 golden 测试数据，记录 imitate 函数应用后 Options 的期望状态
+type golden struct {
+	Function            string            `json:"function"`
+	FingerprintType     string            `json:"fingerprintType"`
+	Fingerprint         string            `json:"fingerprint"`
+	Shuffled            bool              `json:"shuffled,omitempty"`
+	QUICFingerprint     string            `json:"quicFingerprint,omitempty"`
+	HTTP2SettingsString string            `json:"http2SettingsString"`
+	UserAgent           string            `json:"userAgent"`
+	Headers             map[string]string `json:"headers"`
+	HeaderOrderKeys     []string          `json:"headerOrderKeys"`
+}
+
+// renderGolden 生成画像的 golden 数据，ja4 为 true 时生成 JA4R 版本
+func renderGolden(p *Profile, ja4 bool) ([]byte, error) {
+	g := golden{
+		Function:            "imitate." + p.Name,
+		FingerprintType:     "ja3",
+		Fingerprint:         p.JA3,
+		Shuffled:            p.JA3Shuffle,
+		QUICFingerprint:     p.QUICJA4R,
+		HTTP2SettingsString: p.HTTP2SettingsString,
+		UserAgent:           p.UserAgent,
+		Headers:             make(map[string]string),
+		HeaderOrderKeys:     p.HeaderOrder,
+	}
+	if ja4 {
+		g.Function = "ja4r." + p.Name + "JA4"
+		g.FingerprintType = "ja4r"
+		g.Fingerprint = p.JA4R
+		g.Shuffled = false
+	}
+	for _, h := range p.Headers {
+		g.Headers[h.Name] = h.Value
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(g); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// goString 返回字符串的 Go 字面量，包含双引号时使用反引号以保持可读
+func goString(s string) string {
+	if strings.Contains(s, `"`) && !strings.ContainsAny(s, "`\n") {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+func lowerFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
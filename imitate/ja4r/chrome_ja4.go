@@ -1,64 +0,0 @@
-package ja4r
-
-import (
-	fastls "github.com/FastTLS/fastls"
-	"github.com/FastTLS/fastls/imitate"
-)
-
-// ChromeJA4 使用 JA4R 指纹的 Chrome 配置
-//
-// 注意：此功能是实验性的，API 可能会在未来的版本中发生变化。
-// EXPERIMENTAL: This feature is experimental and the API may change in future versions.
-func ChromeJA4(options *fastls.Options) {
-	// 使用 JA4R 指纹（从 https://tls.peet.ws/api/all 获取）
-	// JA4R 格式：t13d<num>_<cipher_suites>_<extensions>_<signature_algorithms>
-	options.Fingerprint = fastls.Ja4Fingerprint{
-		FingerprintValue: "t13d1515h2_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_0005,000a,000b,000d,0012,0017,001b,0023,002b,002d,0033,4469,ff01_0403,0804,0401,0503,0805,0501,0806,0601",
-	}
-	options.HTTP2SettingsString = imitate.ChromeHTTP2SettingsString
-	if options.Headers == nil {
-		options.Headers = make(map[string]string)
-	}
-
-	options.Headers["Sec-Ch-Ua"] = `"Chromium";v="116", "Not)A;Brand";v="24", "Google Chrome";v="116"`
-	options.Headers["Sec-Ch-Ua-Mobile"] = "?0"
-	options.Headers["Sec-Ch-Ua-Platform"] = `"Windows"`
-	options.Headers["Sec-Fetch-Dest"] = "document"
-	options.Headers["Sec-Fetch-Mode"] = "navigate"
-	options.Headers["Sec-Fetch-Site"] = "none"
-	options.Headers["Sec-Fetch-User"] = "?1"
-	options.Headers["Upgrade-Insecure-Requests"] = "1"
-	if options.Headers["Accept"] == "" {
-		options.Headers["Accept"] = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"
-	}
-
-	options.HeaderOrderKeys = []string{
-		"host",
-		"connection",
-		"cache-control",
-		"device-memory",
-		"viewport-width",
-		"rtt",
-		"downlink",
-		"ect",
-		"sec-ch-ua",
-		"sec-ch-ua-mobile",
-		"sec-ch-ua-full-version",
-		"sec-ch-ua-arch",
-		"sec-ch-ua-platform",
-		"sec-ch-ua-platform-version",
-		"sec-ch-ua-model",
-		"upgrade-insecure-requests",
-		"user-agent",
-		"accept",
-		"sec-fetch-site",
-		"sec-fetch-mode",
-		"sec-fetch-user",
-		"sec-fetch-dest",
-		"accept-encoding",
-		"accept-language",
-		"cookie",
-		"referer",
-	}
-	options.UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36"
-}
@@ -4,13 +4,10 @@ import (
 	fastls "github.com/FastTLS/fastls"
 )
 
-// OperaJA4 使用 JA4R 指纹的 Opera 配置
+// OperaJA4 使用 JA4R 指纹模拟 Opera，使用最新的 Chrome 画像
 //
-// 注意：此功能是实验性的，API 可能会在未来的版本中发生变化。
-// EXPERIMENTAL: This feature is experimental and the API may change in future versions.
+// Deprecated: 没有 Opera 的真实抓取，User-Agent 和 Sec-Ch-Ua 是 Chrome 的，请使用 ChromeJA4。
+// 新增 Opera 抓取后 profilegen 生成的 OperaJA4 会替换此文件。
 func OperaJA4(options *fastls.Options) {
 	ChromeJA4(options)
-
-	options.Headers["Sec-Ch-Ua"] = `"Not/A)Brand";v="99", "Opera";v="101", "Chromium";v="115"`
-	options.UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36 OPR/101.0.0.0"
 }
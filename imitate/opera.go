@@ -4,9 +4,15 @@ import (
 	fastls "github.com/FastTLS/fastls"
 )
 
+// OperaHTTP2SettingsString Opera 的 HTTP/2 设置字符串，与 ChromeHTTP2SettingsString 相同
+//
+// Deprecated: 没有 Opera 的真实抓取，使用 ChromeHTTP2SettingsString。
+var OperaHTTP2SettingsString = ChromeHTTP2SettingsString
+
+// Opera 模拟 Opera，使用最新的 Chrome 画像（Opera 与 Chrome 使用相同的 Chromium 网络栈）
+//
+// Deprecated: 没有 Opera 的真实抓取，User-Agent 和 Sec-Ch-Ua 是 Chrome 的，请使用 Chrome。
+// 新增 Opera 抓取后 profilegen 生成的 Opera 会替换此文件。
 func Opera(options *fastls.Options) {
 	Chrome(options)
-
-	options.Headers["Sec-Ch-Ua"] = `"Not/A)Brand";v="99", "Opera";v="101", "Chromium";v="115"`
-	options.UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36 OPR/101.0.0.0"
 }
@@ -2,12 +2,15 @@ package fastls
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/url"
 	"strings"
+	"time"
 
 	http "github.com/FastTLS/fhttp"
 	"github.com/FastTLS/fhttp/http2"
@@ -29,36 +32,89 @@ type Options struct {
 	Proxy               string               `json:"proxy"`
 	Cookies             []Cookie             `json:"cookies"`
 	Timeout             int                  `json:"timeout"`
-	DisableRedirect     bool                 `json:"disableRedirect"`
-	HeaderOrder         []string             `json:"headerOrder"`
+	DisableRedirect     bool                 `json:"disableRedirect"`     // 不跟随重定向，等同于 Redirect.Mode 为 manual
+	Redirect            RedirectPolicy       `json:"redirect"`            // 重定向策略
+	HeaderOrder         []string             `json:"headerOrder"`         // 请求头顺序，设置后覆盖 HeaderOrderKeys，供 JSON 调用方使用
+	HeaderList          HeaderList           `json:"headerList"`          // 有序、可重复的请求头，替换 Headers 中的同名请求头；未设置 HeaderOrder 时按列表顺序排列
+	Destination         RequestDestination   `json:"destination"`         // 请求目标（Sec-Fetch-Dest），为空时保持 imitate 设置的导航请求头
+	FetchSite           string               `json:"fetchSite"`           // Sec-Fetch-Site，为空时导航使用 none，其他目标使用 same-origin
+	ClientHints         *ClientHints         `json:"-"`                   // 生成 Sec-CH-UA 系列请求头并按 origin 记住 Accept-CH，需在请求间复用
+	RawBody             bool                 `json:"rawBody"`             // 不自动解压，按原样返回响应体和 Content-Encoding
+	MaxDecompressedSize int64                `json:"maxDecompressedSize"` // 解压后响应体的最大字节数，为 0 时为 256 MiB，小于 0 时不限制
+	RequestBody         RequestBody          `json:"-"`                   // 类型化的请求体（JSON、表单、multipart、文件、io.Reader），设置后代替 Body
+	Retry               RetryPolicy          `json:"retry"`               // 重试策略，默认不重试
+	Limiter             *Limiter             `json:"-"`                   // 并发、速率和连接数限制，需在请求间复用
+	Context             context.Context      `json:"-"`                   // 请求的 context，取消时中止排队、重试等待和请求
+	Trace               *ClientTrace         `json:"-"`                   // 连接和请求各阶段的回调
+	Logger              *slog.Logger         `json:"-"`                   // 结构化日志，为空时使用 slog.Default()；代理密码和 Cookie 不会写入日志
+	Resolver            Resolver             `json:"-"`                   // 域名解析器，为空时使用系统 DNS
+	LocalAddr           string               `json:"localAddr"`           // 出站连接绑定的本地 IP
+	Interface           string               `json:"interface"`           // 出站连接使用的网卡，绑定该网卡上与目标地址族相同的地址
+	SourcePool          *SourcePool          `json:"-"`                   // 轮换的本地源地址池，优先于 LocalAddr 和 Interface，需在请求间复用
+	SourceSession       string               `json:"sourceSession"`       // 同一会话的请求使用 SourcePool 中相同的源地址，为空时每个请求轮换
+	ProxyPool           *ProxyPool           `json:"-"`                   // 轮换的代理池，设置后忽略 Proxy 和 Retry.Proxies，需在请求间复用
+	ProxySession        string               `json:"proxySession"`        // 代理池的会话，用于粘性会话策略和代理 URL 中的 {session}
+	ProxyFunc           ProxyFunc            `json:"-"`                   // 按请求 URL 选择代理，如 ProxyFromEnvironment() 和 ProxyFromPAC，设置了 Proxy 或 ProxyPool 时不使用
+	ProxyFingerprint    Fingerprint          `json:"-"`                   // 与 HTTPS 代理握手的指纹，为空时使用 Fingerprint，设置为空指纹（如 Ja3Fingerprint{}）时使用标准库 TLS
+	ProxyHTTP2Settings  *http2.HTTP2Settings `json:"-"`                   // 代理协商 HTTP/2 时 CONNECT 使用的设置，为空时使用 HTTP2Settings
+	ProxyHeaders        map[string]string    `json:"proxyHeaders"`        // CONNECT 请求的请求头，覆盖 User-Agent 等默认请求头
+	ProxyChain          []string             `json:"proxyChain"`          // 依次经过的跳板代理，最后一跳再连接 Proxy、ProxyPool 或 ProxyFunc 选择的代理，未设置这些时连接目标
+	ProxyHopTimeout     int                  `json:"proxyHopTimeout"`     // 代理链每一跳建立隧道的超时（毫秒），为 0 时不单独限制
+	HTTP3Pool           *HTTP3Pool           `json:"-"`                   // 按 origin 复用 HTTP/3 连接并缓存会话票据用于 0-RTT，需在请求间复用；为空时每个请求新建连接
+	AltSvc              *AltSvcCache         `json:"-"`                   // 按 Alt-Svc 和 DNS HTTPS 记录将之后的请求升级到 HTTP/3，需在请求间复用；为空时只在指纹以 q 开头时使用 HTTP/3
+	QUICFingerprint     Fingerprint          `json:"-"`                   // 升级 HTTP/3 时记录的 QUIC 指纹，为空时使用 Chrome 的 QUIC 指纹；QUIC 的 ClientHello 由 crypto/tls 生成，不按指纹修改
+	// ProxyDialTLS 自定义与 HTTPS 代理的 TLS 连接，返回完成握手的连接和协商的 ALPN 协议，设置后忽略 ProxyFingerprint
+	ProxyDialTLS func(ctx context.Context, network, addr string) (net.Conn, string, error) `json:"-"`
 }
 
 // requestContext 包含请求、客户端和选项的完整上下文
 type requestContext struct {
-	req     *http.Request
-	client  http.Client
-	options Options
+	req         *http.Request
+	client      http.Client
+	options     Options
+	clientHints map[string]string // 本次请求发送的 Client Hints
+	timing      *timingRecorder
+	logger      *slog.Logger // 带有 host 和 profile 字段
 }
 
 // Response 包含 Fastls 响应数据
 type Response struct {
-	Status  int
-	Body    io.ReadCloser
-	Headers map[string]string
-	Client  http.Client
+	Status     int
+	Body       io.ReadCloser
+	Headers    map[string]string // 每个响应头的第一个值，Set-Cookie 用 "/,/" 连接
+	Header     http.Header       // 完整的多值响应头
+	Trailer    http.Header       // 响应 trailer，读完响应体后填充
+	Client     http.Client
+	URL        string        // 跟随重定向后的最终 URL
+	Redirects  []RedirectHop // 重定向历史，按发生顺序排列
+	Protocol   string        // 协议，如 HTTP/1.1、HTTP/2.0、HTTP/3.0
+	RemoteAddr string        // 连接的远端地址，使用代理时为代理地址
+	TLS        *TLSInfo      // TLS 连接信息，http 请求时为 nil
+	// Uncompressed 响应体已按 Content-Encoding 自动解压，Content-Encoding 和 Content-Length 已从响应头中删除
+	Uncompressed bool
+	Attempts     int     // 按 Options.Retry 尝试的次数，不重试时为 1
+	Timing       *Timing // 最后一次尝试各阶段的耗时
 }
 
 // JSONBody 将响应体转换为 JSON，如果转换失败则返回错误
 func (re Response) JSONBody() (map[string]interface{}, error) {
+	var data map[string]interface{}
+	if err := re.DecodeJSON(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// DecodeJSON 将响应体解析到调用方提供的 v 中
+func (re Response) DecodeJSON(v interface{}) error {
 	body, err := io.ReadAll(re.Body)
 	if err != nil {
-		return nil, fmt.Errorf("读取响应体失败: %w", err)
+		return fmt.Errorf("读取响应体失败: %w", err)
 	}
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, fmt.Errorf("JSON解析失败: %w", err)
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("JSON解析失败: %w", err)
 	}
-	return data, nil
+	return nil
 }
 
 // Fastls 创建完整的请求和响应
@@ -86,17 +142,60 @@ func processRequest(options *Options) (*requestContext, error) {
 		}
 	}
 
+	// 根据请求目标调整 Accept、Sec-Fetch-* 和 Priority 等请求头
+	applyDestination(options)
+	// 调用方显式设置的顺序优先于 imitate 和请求目标的默认顺序
+	if len(options.HeaderOrder) > 0 {
+		options.HeaderOrderKeys = lowerStrings(options.HeaderOrder)
+	} else if len(options.HeaderList) > 0 {
+		options.HeaderOrderKeys = mergeHeaderOrder(options.HeaderOrderKeys, options.HeaderList)
+	}
+	// 生成与 User-Agent 一致的 Client Hints
+	clientHints := applyClientHints(options)
+
 	var browser = browser{
-		Fingerprint:   options.Fingerprint,
-		UserAgent:     options.UserAgent,
-		Cookies:       options.Cookies,
-		HTTP2Settings: options.HTTP2Settings,
+		Fingerprint:     options.Fingerprint,
+		UserAgent:       options.UserAgent,
+		Cookies:         options.Cookies,
+		HTTP2Settings:   options.HTTP2Settings,
+		Limiter:         options.Limiter,
+		Resolver:        options.Resolver,
+		HTTP3Pool:       options.HTTP3Pool,
+		AltSvc:          options.AltSvc,
+		QUICFingerprint: options.QUICFingerprint,
+
+		ProxyFingerprint:   options.ProxyFingerprint,
+		ProxyHTTP2Settings: options.ProxyHTTP2Settings,
+		ProxyDialTLS:       options.ProxyDialTLS,
+		ProxyHeaders:       options.ProxyHeaders,
+		ProxyFunc:          options.ProxyFunc,
+		ProxyChain:         options.ProxyChain,
+		ProxyHopTimeout:    time.Duration(options.ProxyHopTimeout) * time.Millisecond,
+	}
+	// 空指纹表示使用标准库 TLS，与 masque 代理的 QUIC 握手一致
+	browser.proxyFingerprintSet = options.ProxyFingerprint != nil && !options.ProxyFingerprint.IsEmpty()
+	browser.proxyHTTP2SettingsSet = options.ProxyHTTP2Settings != nil
+	if browser.ProxyFingerprint == nil {
+		browser.ProxyFingerprint = options.Fingerprint
+	}
+	if browser.ProxyHTTP2Settings == nil {
+		browser.ProxyHTTP2Settings = options.HTTP2Settings
+	}
+	source, err := newSourceAddr(options)
+	if err != nil {
+		return nil, err
 	}
+	browser.Source = source
+	timing := newTimingRecorder()
+	browser.Trace = ComposeTrace(timing.trace(), options.Trace)
+	logger := requestLogger(options)
+	browser.Logger = logger
 
+	// 重定向由 doWithRedirects 按浏览器规则处理，客户端本身不跟随
 	client, err := newClient(
 		browser,
 		options.Timeout,
-		options.DisableRedirect,
+		true,
 		options.UserAgent,
 		options.Proxy,
 	)
@@ -104,10 +203,26 @@ func processRequest(options *Options) (*requestContext, error) {
 		return nil, fmt.Errorf("创建客户端失败: %w", err)
 	}
 
-	req, err := http.NewRequest(strings.ToUpper(options.Method), options.URL, strings.NewReader(options.Body))
+	ctx := options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(options.Method), options.URL, strings.NewReader(options.Body))
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
+	body := options.RequestBody
+	if b, ok := body.(browserBody); ok {
+		body = b.forUserAgent(options.UserAgent)
+	}
+	if body != nil {
+		if err := setRequestBody(req, body); err != nil {
+			return nil, fmt.Errorf("创建请求体失败: %w", err)
+		}
+		if body.ContentType() != "" {
+			options.HeaderOrderKeys = addBodyHeaderOrder(options.HeaderOrderKeys, options.UserAgent)
+		}
+	}
 
 	// 排序伪头部和普通头部
 	if options.PHeaderOrderKeys == nil {
@@ -124,32 +239,56 @@ func processRequest(options *Options) (*requestContext, error) {
 		return nil, fmt.Errorf("无效的URL: %w", err)
 	}
 
-	// 追加普通头部
+	// 追加普通头部，保留调用方的大小写，HTTP/1.1 会按原样写出
 	for k, v := range options.Headers {
-		if k != "Content-Length" {
-			req.Header.Set(k, v)
+		if !strings.EqualFold(k, "Content-Length") {
+			setRawHeader(req.Header, k, v)
 		}
 	}
-	if req.Header.Get("Host") == "" {
+	applyHeaderList(req.Header, options.HeaderList)
+	if getHeader(options.Headers, "Host") == "" && options.HeaderList.Get("Host") == "" {
 		req.Header.Set("Host", u.Host)
 	}
-	req.Header.Set("user-agent", options.UserAgent)
-	return &requestContext{req: req, client: client, options: *options}, nil
+	setHeaderKeepCase(req.Header, "User-Agent", options.UserAgent)
+	// 与浏览器一样由请求体决定 Content-Type，调用方显式设置时保持不变
+	if body != nil && body.ContentType() != "" && headerValue(req.Header, "Content-Type") == "" {
+		req.Header.Set("Content-Type", body.ContentType())
+	}
+	if logEnabled(logger, slog.LevelDebug) {
+		logger.Debug("sending request", slog.String("phase", phaseRequest), slog.String("method", req.Method),
+			slog.String("proxy", redactURL(options.Proxy)), slog.Any("headers", redactedHeader(req.Header)))
+	}
+	return &requestContext{req: req, client: client, options: *options, clientHints: clientHints, timing: timing, logger: logger}, nil
 }
 
 func dispatcher(res *requestContext) (response Response, err error) {
 	//defer res.client.CloseIdleConnections()
 
-	resp, err := res.client.Do(res.req)
-	if err != nil {
+	resp, redirects, err := res.doWithRedirects()
+	if resp == nil {
 		parsedError := parseError(err)
+		res.logger.Warn("request failed", slog.String("phase", phaseRequest), slog.Any("error", err))
+		if parsedError.debugger != "" {
+			res.logger.Debug("request error detail", slog.String("phase", phaseRequest), slog.String("detail", parsedError.debugger))
+		}
 
 		headers := make(map[string]string)
 		// parsedError.ErrorMsg + "-> \n" + string(err.Error())
 		return Response{
-			parsedError.StatusCode, io.NopCloser(bytes.NewBufferString(parsedError.ErrorMsg)), headers, res.client,
+			Status:    parsedError.StatusCode,
+			Body:      io.NopCloser(bytes.NewBufferString(parsedError.ErrorMsg)),
+			Headers:   headers,
+			Client:    res.client,
+			URL:       res.req.URL.String(),
+			Redirects: redirects,
+			Timing:    res.timing.result(),
 		}, err
+	}
 
+	// 请求声明过的编码会被透明解压，RawBody 时保留原始响应体
+	uncompressed := false
+	if !res.options.RawBody {
+		uncompressed = decodeResponse(resp, res.options.MaxDecompressedSize)
 	}
 
 	headers := make(map[string]string)
@@ -161,27 +300,129 @@ func dispatcher(res *requestContext) (response Response, err error) {
 			headers[name] = values[0]
 		}
 	}
-	return Response{resp.StatusCode, resp.Body, headers, res.client}, nil
+	// 返回的客户端按调用方的设置处理重定向
+	client := res.client
+	if !res.options.DisableRedirect {
+		client.CheckRedirect = nil
+	}
+	finalURL := res.req.URL.String()
+	if resp.Request != nil {
+		finalURL = resp.Request.URL.String()
+	}
+	trailer := make(http.Header)
+	response = Response{
+		Status:       resp.StatusCode,
+		Body:         &trailerBody{ReadCloser: resp.Body, resp: resp, trailer: trailer},
+		Headers:      headers,
+		Header:       resp.Header,
+		Trailer:      trailer,
+		Client:       client,
+		URL:          finalURL,
+		Redirects:    redirects,
+		Protocol:     resp.Proto,
+		Uncompressed: uncompressed,
+		Timing:       res.timing.result(),
+	}
+	res.logger.Debug("request completed", slog.String("phase", phaseRequest), slog.Int("status", response.Status),
+		slog.String("protocol", response.Protocol), slog.Int("redirects", len(redirects)), slog.Duration("duration", response.Timing.Total))
+	if rt, ok := res.client.Transport.(*roundTripper); ok && resp.Request != nil {
+		info := rt.lastConn(connKey(resp.Request.URL))
+		response.RemoteAddr = info.remoteAddr
+		if resp.Request.URL.Scheme == "https" {
+			response.TLS = info.tls
+		}
+	}
+	return response, err
 
 }
 
-// Do 创建单个请求
+// trailerBody 读到响应体末尾时将 trailer 复制到 Response.Trailer
+type trailerBody struct {
+	io.ReadCloser
+	resp    *http.Response
+	trailer http.Header
+}
+
+func (b *trailerBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		for k, v := range b.resp.Trailer {
+			b.trailer[k] = v
+		}
+	}
+	return n, err
+}
+
+// Do 创建单个请求，按 Options.Retry 重试
 func (client Fastls) Do(URL string, options Options, Method string) (response Response, err error) {
 	options.URL = URL
 	options.Method = Method
 
-	reqCtx, err := processRequest(&options)
+	policy := options.Retry
+	proxy := options.Proxy
+	for attempt := 1; ; attempt++ {
+		// 每次尝试都重新创建客户端，使用新的指纹连接，并按策略轮换代理
+		options.Proxy = policy.proxyFor(attempt, proxy)
+		var pooled *proxyEntry
+		if options.ProxyPool != nil {
+			pooled, options.Proxy, err = options.ProxyPool.pick(options.Context, options.ProxySession, hostOf(URL))
+			if err != nil {
+				return response, err
+			}
+		}
+		var retryable bool
+		response, retryable, err = client.do(&options)
+		response.Attempts = attempt
+		if pooled != nil && (err == nil || retryable) {
+			options.ProxyPool.report(pooled, err)
+		}
+
+		delay, retry := policy.shouldRetry(attempt, Method, response, err, retryable)
+		if !retry || (options.Context != nil && options.Context.Err() != nil) {
+			return response, err
+		}
+		nextProxy := policy.proxyFor(attempt+1, proxy)
+		if options.ProxyPool != nil {
+			nextProxy = ""
+		}
+		requestLogger(&options).Info("retrying request", slog.String("phase", phaseRetry), slog.Int("attempt", attempt),
+			slog.Int("status", response.Status), slog.Duration("delay", delay), slog.String("proxy", redactURL(nextProxy)), slog.Any("error", err))
+		if response.Body != nil {
+			response.Body.Close()
+		}
+		if err := sleepContext(options.Context, delay); err != nil {
+			return response, err
+		}
+	}
+}
+
+// do 发送一次请求，retryable 表示错误来自网络而不是请求本身
+func (client Fastls) do(options *Options) (response Response, retryable bool, err error) {
+	reqCtx, err := processRequest(options)
 	if err != nil {
-		return response, fmt.Errorf("处理请求失败: %w", err)
+		return response, false, fmt.Errorf("处理请求失败: %w", err)
 	}
 
 	response, err = dispatcher(reqCtx)
 	if err != nil {
-		log.Print("Request Failed: " + err.Error())
-		return response, err
+		return response, true, err
+	}
+
+	// 与 Chrome 一样，Critical-CH 要求的 hints 未发送时带上它们重试一次
+	if reqCtx.needsClientHintsRetry(response) {
+		reqCtx.logger.Info("retrying with critical client hints", slog.String("phase", phaseRetry))
+		response.Body.Close()
+		reqCtx, err = processRequest(options)
+		if err != nil {
+			return response, false, fmt.Errorf("处理请求失败: %w", err)
+		}
+		response, err = dispatcher(reqCtx)
+		if err != nil {
+			return response, true, err
+		}
 	}
 
-	return response, nil
+	return response, false, nil
 }
 
 // NewClient 创建新的 Fastls 客户端实例
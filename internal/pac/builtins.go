@@ -0,0 +1,338 @@
+package pac
+
+import (
+	"context"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ---- PAC 辅助函数 ----
+
+// builtins 返回 PAC 规定的辅助函数
+func (in *interp) builtins() map[string]builtin {
+	str := func(args []value, i int) string { return toString(arg(args, i)) }
+	return map[string]builtin{
+		"isPlainHostName": func(args []value) (value, error) {
+			return !strings.Contains(str(args, 0), "."), nil
+		},
+		"dnsDomainIs": func(args []value) (value, error) {
+			return strings.HasSuffix(strings.ToLower(str(args, 0)), strings.ToLower(str(args, 1))), nil
+		},
+		"localHostOrDomainIs": func(args []value) (value, error) {
+			host, hostdom := strings.ToLower(str(args, 0)), strings.ToLower(str(args, 1))
+			if host == hostdom {
+				return true, nil
+			}
+			return !strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+"."), nil
+		},
+		"dnsDomainLevels": func(args []value) (value, error) {
+			return float64(strings.Count(str(args, 0), ".")), nil
+		},
+		"shExpMatch": func(args []value) (value, error) {
+			return shExpMatch(str(args, 0), str(args, 1)), nil
+		},
+		"isResolvable": func(args []value) (value, error) {
+			return in.resolve(str(args, 0), false) != "", nil
+		},
+		"isResolvableEx": func(args []value) (value, error) {
+			return in.resolve(str(args, 0), true) != "", nil
+		},
+		"dnsResolve": func(args []value) (value, error) {
+			if ip := in.resolve(str(args, 0), false); ip != "" {
+				return ip, nil
+			}
+			return null{}, nil
+		},
+		"dnsResolveEx": func(args []value) (value, error) {
+			return in.resolveAll(str(args, 0)), nil
+		},
+		"myIpAddress": func([]value) (value, error) {
+			return myIPAddress(false), nil
+		},
+		"myIpAddressEx": func([]value) (value, error) {
+			return myIPAddress(true), nil
+		},
+		"isInNet": func(args []value) (value, error) {
+			ip := net.ParseIP(str(args, 0))
+			if ip == nil {
+				ip = net.ParseIP(in.resolve(str(args, 0), false))
+			}
+			pattern, mask := net.ParseIP(str(args, 1)).To4(), net.ParseIP(str(args, 2)).To4()
+			if ip == nil || ip.To4() == nil || pattern == nil || mask == nil {
+				return false, nil
+			}
+			return ip.To4().Mask(net.IPMask(mask)).Equal(pattern.Mask(net.IPMask(mask))), nil
+		},
+		"isInNetEx": func(args []value) (value, error) {
+			ip := net.ParseIP(str(args, 0))
+			if ip == nil {
+				ip = net.ParseIP(in.resolve(str(args, 0), true))
+			}
+			_, prefix, err := net.ParseCIDR(str(args, 1))
+			if ip == nil || err != nil {
+				return false, nil
+			}
+			return prefix.Contains(ip), nil
+		},
+		"convert_addr": func(args []value) (value, error) {
+			ip := net.ParseIP(str(args, 0)).To4()
+			if ip == nil {
+				return 0.0, nil
+			}
+			return float64(uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])), nil
+		},
+		"weekdayRange": func(args []value) (value, error) {
+			return weekdayRange(time.Now(), args), nil
+		},
+		"dateRange": func(args []value) (value, error) {
+			return dateRange(time.Now(), args), nil
+		},
+		"timeRange": func(args []value) (value, error) {
+			return timeRange(time.Now(), args), nil
+		},
+		"alert": func([]value) (value, error) {
+			return nil, nil
+		},
+		"parseInt": func(args []value) (value, error) {
+			s := strings.TrimSpace(str(args, 0))
+			base := 10
+			if b := arg(args, 1); b != nil {
+				base = int(toNumber(b))
+			}
+			if base < 2 || base > 36 {
+				return math.NaN(), nil
+			}
+			if (base == 16 || arg(args, 1) == nil) && (strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X")) {
+				s, base = s[2:], 16
+			}
+			end := 0
+			for end < len(s) && (end == 0 && (s[0] == '-' || s[0] == '+') || strings.ContainsRune("0123456789abcdefghijklmnopqrstuvwxyz"[:base], unicode.ToLower(rune(s[end])))) {
+				end++
+			}
+			n, err := strconv.ParseInt(s[:end], base, 64)
+			if err != nil {
+				return math.NaN(), nil
+			}
+			return float64(n), nil
+		},
+	}
+}
+
+// resolve 解析 host 的地址，ex 为 false 时只返回 IPv4 地址，失败时返回空字符串
+func (in *interp) resolve(host string, ex bool) string {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	for _, ip := range in.lookup(host) {
+		if ex || ip.To4() != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// resolveAll 返回 host 的所有地址，以分号分隔
+func (in *interp) resolveAll(host string) string {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	var ips []string
+	for _, ip := range in.lookup(host) {
+		ips = append(ips, ip.String())
+	}
+	return strings.Join(ips, ";")
+}
+
+func (in *interp) lookup(host string) []net.IP {
+	ctx := in.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, dnsTimeout)
+	defer cancel()
+	resolver := in.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	return ips
+}
+
+// myIPAddress 返回本机的出口地址，ex 为 true 时返回所有地址，以分号分隔
+func myIPAddress(ex bool) string {
+	var ips []string
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				if ex || ipNet.IP.To4() != nil {
+					ips = append(ips, ipNet.IP.String())
+				}
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return "127.0.0.1"
+	}
+	if ex {
+		return strings.Join(ips, ";")
+	}
+	return ips[0]
+}
+
+// shExpMatch shell 通配符匹配，* 匹配任意字符串，? 匹配单个字符
+func shExpMatch(s, pattern string) bool {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	return err == nil && re.MatchString(s)
+}
+
+// gmt 参数列表最后一项为 "GMT" 时使用 UTC 时间，返回去掉它的参数
+func gmt(now time.Time, args []value) (time.Time, []value) {
+	if n := len(args); n > 0 && toString(args[n-1]) == "GMT" {
+		return now.UTC(), args[:n-1]
+	}
+	return now, args
+}
+
+var weekdays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+var months = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == strings.ToUpper(s) {
+			return i
+		}
+	}
+	return -1
+}
+
+// inRange 判断 v 是否在 [lo, hi] 内，lo 大于 hi 时表示跨越边界的范围
+func inRange(v, lo, hi int) bool {
+	if lo <= hi {
+		return v >= lo && v <= hi
+	}
+	return v >= lo || v <= hi
+}
+
+func weekdayRange(now time.Time, args []value) bool {
+	now, args = gmt(now, args)
+	if len(args) == 0 {
+		return false
+	}
+	lo := indexOf(weekdays, toString(args[0]))
+	hi := lo
+	if len(args) > 1 {
+		hi = indexOf(weekdays, toString(args[1]))
+	}
+	if lo < 0 || hi < 0 {
+		return false
+	}
+	return inRange(int(now.Weekday()), lo, hi)
+}
+
+func timeRange(now time.Time, args []value) bool {
+	now, args = gmt(now, args)
+	n := make([]int, len(args))
+	for i, arg := range args {
+		n[i] = int(toNumber(arg))
+	}
+	secs := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	switch len(n) {
+	case 1:
+		return now.Hour() == n[0]
+	case 2:
+		return inRange(now.Hour(), n[0], n[1]-1)
+	case 4:
+		return inRange(secs/60, n[0]*60+n[1], n[2]*60+n[3]-1)
+	case 6:
+		return inRange(secs, n[0]*3600+n[1]*60+n[2], n[3]*3600+n[4]*60+n[5])
+	}
+	return false
+}
+
+// dateRange 支持日、月、年以及它们的组合，参数个数与 PAC 规范一致
+func dateRange(now time.Time, args []value) bool {
+	now, args = gmt(now, args)
+	type part struct {
+		kind  byte // d 日，m 月，y 年
+		value int
+	}
+	var parts []part
+	for _, arg := range args {
+		if s, ok := arg.(string); ok {
+			if m := indexOf(months, s); m >= 0 {
+				parts = append(parts, part{'m', m})
+				continue
+			}
+		}
+		v := int(toNumber(arg))
+		if v > 31 {
+			parts = append(parts, part{'y', v})
+		} else {
+			parts = append(parts, part{'d', v})
+		}
+	}
+	value := func(p part) int {
+		switch p.kind {
+		case 'd':
+			return now.Day()
+		case 'm':
+			return int(now.Month()) - 1
+		}
+		return now.Year()
+	}
+	// key 按年、月、日组合成可比较的数字，只使用参数中出现的部分
+	key := func(ps []part, current bool) int {
+		k := 0
+		for _, kind := range []byte{'y', 'm', 'd'} {
+			for _, p := range ps {
+				if p.kind == kind {
+					v := p.value
+					if current {
+						v = value(p)
+					}
+					k = k*10000 + v
+				}
+			}
+		}
+		return k
+	}
+	switch len(parts) {
+	case 1:
+		return value(parts[0]) == parts[0].value
+	case 2, 4, 6:
+		lo, hi := parts[:len(parts)/2], parts[len(parts)/2:]
+		for i := range lo {
+			if lo[i].kind != hi[i].kind {
+				return false
+			}
+		}
+		return inRange(key(lo, true), key(lo, false), key(hi, false))
+	}
+	return false
+}
@@ -0,0 +1,439 @@
+package pac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// dnsTimeout PAC 辅助函数解析域名的超时时间
+const dnsTimeout = 2 * time.Second
+
+// errReturn return 语句，携带返回值沿调用栈向上传递
+type errReturn struct{ value value }
+
+func (errReturn) Error() string { return "return" }
+
+// errBreak break 语句
+var errBreak = errors.New("break")
+
+// errContinue continue 语句
+var errContinue = errors.New("continue")
+
+// value PAC 脚本中的值：nil（undefined）、null、bool、float64、string、*array、*funcValue、builtin 或 *regexp.Regexp
+type value any
+
+// null JavaScript 的 null
+type null struct{}
+
+// array JavaScript 数组
+type array struct{ items []value }
+
+// funcValue 脚本中定义的函数
+type funcValue struct {
+	name   string
+	params []string
+	body   []node
+	scope  *varScope
+}
+
+// builtin 内置函数
+type builtin func(args []value) (value, error)
+
+// varScope 变量作用域
+type varScope struct {
+	vars   map[string]value
+	parent *varScope
+}
+
+func newVarScope(parent *varScope) *varScope {
+	return &varScope{vars: make(map[string]value), parent: parent}
+}
+
+func (s *varScope) lookup(name string) (*varScope, bool) {
+	for scope := s; scope != nil; scope = scope.parent {
+		if _, ok := scope.vars[name]; ok {
+			return scope, true
+		}
+	}
+	return nil, false
+}
+
+func (s *varScope) get(name string) (value, error) {
+	if scope, ok := s.lookup(name); ok {
+		return scope.vars[name], nil
+	}
+	return nil, fmt.Errorf("%s 未定义", name)
+}
+
+func (s *varScope) set(name string, v value) {
+	if scope, ok := s.lookup(name); ok {
+		scope.vars[name] = v
+		return
+	}
+	// 未声明的变量与非严格模式一样成为全局变量
+	root := s
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.vars[name] = v
+}
+
+// ---- 求值 ----
+
+// interp 一个 PAC 脚本的执行环境
+type interp struct {
+	global   *varScope
+	resolver Resolver
+	ctx      context.Context
+	steps    int
+	depth    int
+}
+
+// maxSteps 单次调用最多执行的语句数，防止脚本死循环
+const maxSteps = 1 << 20
+
+// maxDepth 函数调用的最大嵌套深度，防止脚本无限递归耗尽 goroutine 栈
+const maxDepth = 256
+
+// lineError 带有出错行号的执行错误
+type lineError struct {
+	line int
+	err  error
+}
+
+func (e *lineError) Error() string { return fmt.Sprintf("第 %d 行: %v", e.line, e.err) }
+
+func (e *lineError) Unwrap() error { return e.err }
+
+// atLine 为执行错误加上行号，已经带有行号的错误（来自更深的调用）原样返回
+func atLine(line int, err error) error {
+	var le *lineError
+	if errors.As(err, &le) {
+		return err
+	}
+	return &lineError{line: line, err: err}
+}
+
+func (in *interp) exec(nodes []node, scope *varScope) error {
+	// 函数声明提升
+	for _, node := range nodes {
+		if decl, ok := node.(*funcDecl); ok {
+			scope.vars[decl.name] = &funcValue{name: decl.name, params: decl.params, body: decl.body, scope: scope}
+		}
+	}
+	for _, node := range nodes {
+		if err := in.stmt(node, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *interp) stmt(nd node, scope *varScope) error {
+	in.steps++
+	if in.steps > maxSteps {
+		return errors.New("PAC 脚本执行的语句过多")
+	}
+	switch n := nd.(type) {
+	case *funcDecl:
+		return nil
+	case *varDecl:
+		for i, name := range n.names {
+			var v value
+			if n.inits[i] != nil {
+				var err error
+				if v, err = in.eval(n.inits[i], scope); err != nil {
+					return err
+				}
+			} else if existing, ok := scope.vars[name]; ok {
+				v = existing
+			}
+			scope.vars[name] = v
+		}
+		return nil
+	case *ifStmt:
+		cond, err := in.eval(n.cond, scope)
+		if err != nil {
+			return err
+		}
+		if truthy(cond) {
+			return in.stmt(n.then, scope)
+		}
+		if n.els != nil {
+			return in.stmt(n.els, scope)
+		}
+		return nil
+	case *forStmt:
+		if n.init != nil {
+			if decl, ok := n.init.(*varDecl); ok {
+				if err := in.stmt(decl, scope); err != nil {
+					return err
+				}
+			} else if _, err := in.eval(n.init, scope); err != nil {
+				return err
+			}
+		}
+		for {
+			if n.cond != nil {
+				cond, err := in.eval(n.cond, scope)
+				if err != nil {
+					return err
+				}
+				if !truthy(cond) {
+					return nil
+				}
+			}
+			if err := in.stmt(n.body, scope); err == errBreak {
+				return nil
+			} else if err != nil && err != errContinue {
+				return err
+			}
+			if n.update != nil {
+				if _, err := in.eval(n.update, scope); err != nil {
+					return err
+				}
+			}
+		}
+	case *whileStmt:
+		for {
+			cond, err := in.eval(n.cond, scope)
+			if err != nil {
+				return err
+			}
+			if !truthy(cond) {
+				return nil
+			}
+			if err := in.stmt(n.body, scope); err == errBreak {
+				return nil
+			} else if err != nil && err != errContinue {
+				return err
+			}
+		}
+	case *returnStmt:
+		var v value
+		if n.value != nil {
+			var err error
+			if v, err = in.eval(n.value, scope); err != nil {
+				return err
+			}
+		}
+		return errReturn{value: v}
+	case *jump:
+		return n.err
+	case *block:
+		for _, stmt := range n.body {
+			if err := in.stmt(stmt, scope); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *exprStmt:
+		_, err := in.eval(n.expr, scope)
+		return err
+	}
+	return fmt.Errorf("不支持的语句 %T", nd)
+}
+
+func (in *interp) eval(nd node, scope *varScope) (value, error) {
+	switch n := nd.(type) {
+	case *literal:
+		return n.value, nil
+	case *identRef:
+		v, err := scope.get(n.name)
+		if err != nil {
+			return nil, atLine(n.line, err)
+		}
+		return v, nil
+	case *arrayLit:
+		arr := &array{}
+		for _, item := range n.items {
+			v, err := in.eval(item, scope)
+			if err != nil {
+				return nil, err
+			}
+			arr.items = append(arr.items, v)
+		}
+		return arr, nil
+	case *funcLit:
+		return &funcValue{name: n.decl.name, params: n.decl.params, body: n.decl.body, scope: scope}, nil
+	case *unary:
+		v, err := in.eval(n.operand, scope)
+		if err != nil {
+			if _, ok := n.operand.(*identRef); ok && n.op == "typeof" {
+				return "undefined", nil
+			}
+			return nil, err
+		}
+		switch n.op {
+		case "!":
+			return !truthy(v), nil
+		case "-":
+			return -toNumber(v), nil
+		case "+":
+			return toNumber(v), nil
+		}
+		return typeOf(v), nil
+	case *logical:
+		left, err := in.eval(n.left, scope)
+		if err != nil {
+			return nil, err
+		}
+		if (n.op == "||") == truthy(left) {
+			return left, nil
+		}
+		return in.eval(n.right, scope)
+	case *binary:
+		left, err := in.eval(n.left, scope)
+		if err != nil {
+			return nil, err
+		}
+		right, err := in.eval(n.right, scope)
+		if err != nil {
+			return nil, err
+		}
+		return binaryOp(n.op, left, right)
+	case *condExpr:
+		cond, err := in.eval(n.cond, scope)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return in.eval(n.then, scope)
+		}
+		return in.eval(n.els, scope)
+	case *assign:
+		v, err := in.eval(n.value, scope)
+		if err != nil {
+			return nil, err
+		}
+		if n.op != "=" {
+			old, err := in.eval(n.target, scope)
+			if err != nil {
+				return nil, err
+			}
+			if v, err = binaryOp(n.op[:1], old, v); err != nil {
+				return nil, err
+			}
+		}
+		return v, in.assign(n.target, v, scope)
+	case *update:
+		old, err := in.eval(n.target, scope)
+		if err != nil {
+			return nil, err
+		}
+		num := toNumber(old)
+		updated := num + 1
+		if n.op == "--" {
+			updated = num - 1
+		}
+		if err := in.assign(n.target, updated, scope); err != nil {
+			return nil, err
+		}
+		if n.prefix {
+			return updated, nil
+		}
+		return num, nil
+	case *member:
+		object, err := in.eval(n.object, scope)
+		if err != nil {
+			return nil, err
+		}
+		property, err := in.eval(n.property, scope)
+		if err != nil {
+			return nil, err
+		}
+		return getMember(object, property)
+	case *call:
+		var this value
+		var callee value
+		var err error
+		if member, ok := n.callee.(*member); ok {
+			if this, err = in.eval(member.object, scope); err != nil {
+				return nil, err
+			}
+			property, err := in.eval(member.property, scope)
+			if err != nil {
+				return nil, err
+			}
+			if callee, err = method(this, toString(property)); err != nil {
+				return nil, atLine(n.line, err)
+			}
+		} else if callee, err = in.eval(n.callee, scope); err != nil {
+			return nil, err
+		}
+		args := make([]value, 0, len(n.args))
+		for _, arg := range n.args {
+			v, err := in.eval(arg, scope)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+		}
+		v, err := in.call(callee, args)
+		if err != nil {
+			return nil, atLine(n.line, err)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("不支持的表达式 %T", nd)
+}
+
+func (in *interp) assign(target node, v value, scope *varScope) error {
+	switch t := target.(type) {
+	case *identRef:
+		scope.set(t.name, v)
+		return nil
+	case *member:
+		object, err := in.eval(t.object, scope)
+		if err != nil {
+			return err
+		}
+		property, err := in.eval(t.property, scope)
+		if err != nil {
+			return err
+		}
+		arr, ok := object.(*array)
+		if !ok {
+			return fmt.Errorf("不支持给 %s 的属性赋值", typeOf(object))
+		}
+		i := int(toNumber(property))
+		if i < 0 || i > 1<<16 {
+			return fmt.Errorf("数组下标 %d 超出范围", i)
+		}
+		for len(arr.items) <= i {
+			arr.items = append(arr.items, nil)
+		}
+		arr.items[i] = v
+		return nil
+	}
+	return fmt.Errorf("无效的赋值目标")
+}
+
+func (in *interp) call(callee value, args []value) (value, error) {
+	switch f := callee.(type) {
+	case builtin:
+		return f(args)
+	case *funcValue:
+		if in.depth >= maxDepth {
+			return nil, errors.New("PAC 脚本函数调用嵌套过深")
+		}
+		in.depth++
+		defer func() { in.depth-- }()
+		scope := newVarScope(f.scope)
+		for i, name := range f.params {
+			if i < len(args) {
+				scope.vars[name] = args[i]
+			} else {
+				scope.vars[name] = nil
+			}
+		}
+		err := in.exec(f.body, scope)
+		if ret, ok := err.(errReturn); ok {
+			return ret.value, nil
+		}
+		return nil, err
+	}
+	return nil, fmt.Errorf("%s 不是函数", typeOf(callee))
+}
@@ -0,0 +1,213 @@
+package pac
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ---- 词法分析 ----
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokRegexp
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	line int
+}
+
+// puncts 按长度从长到短匹配的运算符
+var puncts = []string{
+	"===", "!==", "==", "!=", "<=", ">=", "&&", "||", "++", "--", "+=", "-=", "*=", "/=",
+	"{", "}", "(", ")", "[", "]", ";", ",", ".", "?", ":", "=", "<", ">", "+", "-", "*", "/", "%", "!",
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+	prev *token
+}
+
+// regexpAllowed 判断 / 是否开始正则表达式字面量，即前一个 token 不能作为表达式的结尾
+func (l *lexer) regexpAllowed() bool {
+	if l.prev == nil {
+		return true
+	}
+	switch l.prev.kind {
+	case tokNumber, tokString, tokRegexp:
+		return false
+	case tokIdent:
+		return l.prev.text == "return" || l.prev.text == "typeof"
+	}
+	return l.prev.text != ")" && l.prev.text != "]" && l.prev.text != "}"
+}
+
+func (l *lexer) next() (token, error) {
+	tok, err := l.scan()
+	if err == nil {
+		l.prev = &tok
+	}
+	return tok, err
+}
+
+func (l *lexer) scan() (token, error) {
+	// 跳过空白和注释
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return token{}, fmt.Errorf("第 %d 行: 注释没有结束", l.line)
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+2+end], "\n")
+			l.pos += end + 4
+		default:
+			goto token
+		}
+	}
+	return token{kind: tokEOF, line: l.line}, nil
+
+token:
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case c == '_' || c == '$' || unicode.IsLetter(rune(c)):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || l.src[l.pos] == '$' || unicode.IsLetter(rune(l.src[l.pos])) || unicode.IsDigit(rune(l.src[l.pos]))) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], line: l.line}, nil
+	case c >= '0' && c <= '9' || c == '.' && l.pos+1 < len(l.src) && l.src[l.pos+1] >= '0' && l.src[l.pos+1] <= '9':
+		if strings.HasPrefix(l.src[l.pos:], "0x") || strings.HasPrefix(l.src[l.pos:], "0X") {
+			l.pos += 2
+			for l.pos < len(l.src) && strings.ContainsRune("0123456789abcdefABCDEF", rune(l.src[l.pos])) {
+				l.pos++
+			}
+			n, err := strconv.ParseInt(l.src[start+2:l.pos], 16, 64)
+			if err != nil {
+				return token{}, fmt.Errorf("第 %d 行: 无效的数字 %s", l.line, l.src[start:l.pos])
+			}
+			return token{kind: tokNumber, num: float64(n), line: l.line}, nil
+		}
+		for l.pos < len(l.src) && (l.src[l.pos] >= '0' && l.src[l.pos] <= '9' || l.src[l.pos] == '.' ||
+			l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+			l.pos++
+		}
+		n, err := strconv.ParseFloat(l.src[start:l.pos], 64)
+		if err != nil {
+			return token{}, fmt.Errorf("第 %d 行: 无效的数字 %s", l.line, l.src[start:l.pos])
+		}
+		return token{kind: tokNumber, num: n, line: l.line}, nil
+	case c == '"' || c == '\'':
+		return l.scanString(c)
+	case c == '/' && l.regexpAllowed():
+		return l.scanRegexp()
+	}
+	for _, p := range puncts {
+		if strings.HasPrefix(l.src[l.pos:], p) {
+			l.pos += len(p)
+			return token{kind: tokPunct, text: p, line: l.line}, nil
+		}
+	}
+	return token{}, fmt.Errorf("第 %d 行: 无法识别的字符 %q", l.line, c)
+}
+
+func (l *lexer) scanString(quote byte) (token, error) {
+	var b strings.Builder
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			return token{kind: tokString, text: b.String(), line: l.line}, nil
+		case c == '\n':
+			return token{}, fmt.Errorf("第 %d 行: 字符串没有结束", l.line)
+		case c == '\\' && l.pos+1 < len(l.src):
+			l.pos++
+			switch e := l.src[l.pos]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'x', 'u':
+				n := 2
+				if e == 'u' {
+					n = 4
+				}
+				if l.pos+n >= len(l.src) {
+					return token{}, fmt.Errorf("第 %d 行: 无效的转义", l.line)
+				}
+				r, err := strconv.ParseUint(l.src[l.pos+1:l.pos+1+n], 16, 32)
+				if err != nil {
+					return token{}, fmt.Errorf("第 %d 行: 无效的转义", l.line)
+				}
+				b.WriteRune(rune(r))
+				l.pos += n
+			default:
+				b.WriteByte(e)
+			}
+			l.pos++
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, fmt.Errorf("第 %d 行: 字符串没有结束", l.line)
+}
+
+func (l *lexer) scanRegexp() (token, error) {
+	start := l.pos
+	l.pos++
+	inClass := false
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			return token{}, fmt.Errorf("第 %d 行: 正则表达式没有结束", l.line)
+		case c == '\\':
+			l.pos++
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '/' && !inClass:
+			pattern := l.src[start+1 : l.pos]
+			l.pos++
+			flagStart := l.pos
+			for l.pos < len(l.src) && unicode.IsLetter(rune(l.src[l.pos])) {
+				l.pos++
+			}
+			flags := l.src[flagStart:l.pos]
+			if strings.Contains(flags, "i") {
+				pattern = "(?i)" + pattern
+			}
+			return token{kind: tokRegexp, text: pattern, line: l.line}, nil
+		}
+		l.pos++
+	}
+	return token{}, fmt.Errorf("第 %d 行: 正则表达式没有结束", l.line)
+}
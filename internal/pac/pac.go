@@ -0,0 +1,109 @@
+// Package pac 实现 PAC 文件解释器
+//
+// 没有引入完整的 JavaScript 引擎，只实现 PAC 文件常用的子集：函数、var/let/const、if/else、for、while、return，
+// 字符串、数字、布尔、数组和正则表达式字面量，常用运算符，字符串和数组的常用方法，以及 PAC 规定的辅助函数。
+package pac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Resolver 辅助函数解析域名使用的解析器，与 fastls.Resolver 相同
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Script 解析后的 PAC 脚本，脚本的全局变量在调用间共享，调用按顺序执行
+type Script struct {
+	mu     sync.Mutex
+	interp *interp
+	find   value
+}
+
+// Compile 解析并执行 PAC 脚本，resolver 为空时使用系统 DNS
+func Compile(src string, resolver Resolver) (*Script, error) {
+	program, err := parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("解析 PAC 脚本失败: %w", err)
+	}
+	in := &interp{global: newVarScope(nil), resolver: resolver}
+	for name, fn := range in.builtins() {
+		in.global.vars[name] = fn
+	}
+	if err := in.exec(program, in.global); err != nil {
+		return nil, fmt.Errorf("执行 PAC 脚本失败: %w", err)
+	}
+	find := in.global.vars["FindProxyForURL"]
+	if _, ok := find.(*funcValue); !ok {
+		return nil, errors.New("PAC 脚本没有定义 FindProxyForURL")
+	}
+	return &Script{interp: in, find: find}, nil
+}
+
+// FindProxy 调用 FindProxyForURL，返回脚本的结果字符串
+func (s *Script) FindProxy(ctx context.Context, u *url.URL) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interp.ctx = ctx
+	s.interp.steps, s.interp.depth = 0, 0
+	// 与 Chrome 一样，https 请求只传入 scheme、host 和端口，不暴露路径
+	target := *u
+	target.User = nil
+	target.Fragment = ""
+	if target.Scheme == "https" || target.Scheme == "wss" {
+		target.Path, target.RawPath, target.RawQuery = "/", "", ""
+	}
+	result, err := s.interp.call(s.find, []value{target.String(), u.Hostname()})
+	if err != nil {
+		return "", fmt.Errorf("执行 FindProxyForURL 失败: %w", err)
+	}
+	proxies, ok := result.(string)
+	if !ok {
+		return "", fmt.Errorf("FindProxyForURL 返回了 %s", typeOf(result))
+	}
+	return proxies, nil
+}
+
+// ParseResult 将 "PROXY host:port; SOCKS5 host:port; DIRECT" 转换为代理 URL 列表，DIRECT 为空字符串
+func ParseResult(result string) ([]string, error) {
+	var proxies []string
+	for _, item := range strings.Split(result, ";") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		kind := strings.ToUpper(fields[0])
+		if kind == "DIRECT" {
+			proxies = append(proxies, "")
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("无效的 PAC 结果 %q", strings.TrimSpace(item))
+		}
+		scheme, ok := schemes[kind]
+		if !ok {
+			return nil, fmt.Errorf("不支持的 PAC 代理类型 %s", fields[0])
+		}
+		proxies = append(proxies, scheme+"://"+fields[1])
+	}
+	if len(proxies) == 0 {
+		return nil, fmt.Errorf("无效的 PAC 结果 %q", result)
+	}
+	return proxies, nil
+}
+
+// schemes PAC 代理类型对应的代理 URL 协议，与 Chrome 一样 SOCKS 为 SOCKS4，SOCKS5 由代理解析域名
+var schemes = map[string]string{
+	"PROXY":  "http",
+	"HTTP":   "http",
+	"HTTPS":  "https",
+	"SOCKS":  "socks4",
+	"SOCKS4": "socks4",
+	"SOCKS5": "socks5h",
+}
@@ -0,0 +1,641 @@
+package pac
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// ---- 语法分析 ----
+
+// node 语法树节点
+type node interface{}
+
+type (
+	funcDecl struct {
+		name   string
+		params []string
+		body   []node
+	}
+	varDecl struct {
+		names []string
+		inits []node
+	}
+	ifStmt struct {
+		cond      node
+		then, els node
+	}
+	forStmt struct {
+		init, cond, update node
+		body               node
+	}
+	whileStmt struct {
+		cond node
+		body node
+	}
+	returnStmt struct{ value node }
+	block      struct{ body []node }
+	jump       struct{ err error }
+	exprStmt   struct{ expr node }
+
+	literal  struct{ value value }
+	identRef struct {
+		name string
+		line int
+	}
+	arrayLit struct{ items []node }
+	funcLit  struct{ decl *funcDecl }
+	unary    struct {
+		op      string
+		operand node
+	}
+	binary struct {
+		op          string
+		left, right node
+	}
+	logical struct {
+		op          string
+		left, right node
+	}
+	condExpr struct{ cond, then, els node }
+	assign   struct {
+		op     string
+		target node
+		value  node
+	}
+	update struct {
+		op     string
+		prefix bool
+		target node
+	}
+	member struct {
+		object   node
+		property node // 点号访问时为 literal 字符串
+	}
+	call struct {
+		callee node
+		args   []node
+		line   int
+	}
+)
+
+type parser struct {
+	lexer *lexer
+	tok   token
+}
+
+func parse(src string) ([]node, error) {
+	p := &parser{lexer: &lexer{src: src, line: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var program []node
+	for p.tok.kind != tokEOF {
+		stmt, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		program = append(program, stmt)
+	}
+	return program, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) is(text string) bool {
+	return (p.tok.kind == tokPunct || p.tok.kind == tokIdent) && p.tok.text == text
+}
+
+func (p *parser) accept(text string) (bool, error) {
+	if !p.is(text) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		return p.errorf("应该是 %q", text)
+	}
+	return p.advance()
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	got := p.tok.text
+	if p.tok.kind == tokEOF {
+		got = "文件结尾"
+	}
+	return fmt.Errorf("第 %d 行: %s，实际是 %q", p.tok.line, fmt.Sprintf(format, args...), got)
+}
+
+func (p *parser) ident() (string, error) {
+	if p.tok.kind != tokIdent {
+		return "", p.errorf("应该是标识符")
+	}
+	name := p.tok.text
+	return name, p.advance()
+}
+
+// semicolon 语句结尾的分号，与自动插入分号一样可以省略
+func (p *parser) semicolon() error {
+	_, err := p.accept(";")
+	return err
+}
+
+func (p *parser) statement() (node, error) {
+	switch {
+	case p.is("function"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return p.function(true)
+	case p.is("var") || p.is("let") || p.is("const"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		decl, err := p.varDecl()
+		if err != nil {
+			return nil, err
+		}
+		return decl, p.semicolon()
+	case p.is("if"):
+		return p.ifStatement()
+	case p.is("for"):
+		return p.forStatement()
+	case p.is("while"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		cond, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		body, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		return &whileStmt{cond: cond, body: body}, nil
+	case p.is("return"):
+		line := p.tok.line
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		ret := &returnStmt{}
+		if !p.is(";") && !p.is("}") && p.tok.kind != tokEOF && p.tok.line == line {
+			value, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			ret.value = value
+		}
+		return ret, p.semicolon()
+	case p.is("break"), p.is("continue"):
+		jump := &jump{err: errBreak}
+		if p.is("continue") {
+			jump.err = errContinue
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return jump, p.semicolon()
+	case p.is("{"):
+		return p.block()
+	case p.is(";"):
+		return &block{}, p.advance()
+	}
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return &exprStmt{expr: expr}, p.semicolon()
+}
+
+func (p *parser) block() (*block, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	block := &block{}
+	for !p.is("}") {
+		if p.tok.kind == tokEOF {
+			return nil, p.errorf("应该是 \"}\"")
+		}
+		stmt, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		block.body = append(block.body, stmt)
+	}
+	return block, p.advance()
+}
+
+// function 解析 function 关键字之后的部分，named 为 true 时需要函数名
+func (p *parser) function(named bool) (*funcDecl, error) {
+	decl := &funcDecl{}
+	if named || p.tok.kind == tokIdent {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		decl.name = name
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.is(")") {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		decl.params = append(decl.params, name)
+		if !p.is(")") {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	decl.body = body.body
+	return decl, nil
+}
+
+func (p *parser) varDecl() (*varDecl, error) {
+	decl := &varDecl{}
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		var init node
+		if ok, err := p.accept("="); err != nil {
+			return nil, err
+		} else if ok {
+			if init, err = p.assignment(); err != nil {
+				return nil, err
+			}
+		}
+		decl.names = append(decl.names, name)
+		decl.inits = append(decl.inits, init)
+		if ok, err := p.accept(","); err != nil || !ok {
+			return decl, err
+		}
+	}
+}
+
+func (p *parser) ifStatement() (node, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	cond, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	then, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &ifStmt{cond: cond, then: then}
+	if ok, err := p.accept("else"); err != nil {
+		return nil, err
+	} else if ok {
+		if stmt.els, err = p.statement(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) forStatement() (node, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	stmt := &forStmt{}
+	var err error
+	if p.is("var") || p.is("let") || p.is("const") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if stmt.init, err = p.varDecl(); err != nil {
+			return nil, err
+		}
+	} else if !p.is(";") {
+		if stmt.init, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+	if !p.is(";") {
+		if stmt.cond, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+	if !p.is(")") {
+		if stmt.update, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if stmt.body, err = p.statement(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *parser) expression() (node, error) {
+	expr, err := p.assignment()
+	if err != nil {
+		return nil, err
+	}
+	// 逗号表达式返回最后一个值
+	for p.is(",") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.assignment()
+		if err != nil {
+			return nil, err
+		}
+		expr = &binary{op: ",", left: expr, right: right}
+	}
+	return expr, nil
+}
+
+func (p *parser) assignment() (node, error) {
+	left, err := p.conditional()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"=", "+=", "-=", "*=", "/="} {
+		if p.is(op) {
+			switch left.(type) {
+			case *identRef, *member:
+			default:
+				return nil, p.errorf("无效的赋值目标")
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			value, err := p.assignment()
+			if err != nil {
+				return nil, err
+			}
+			return &assign{op: op, target: left, value: value}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) conditional() (node, error) {
+	cond, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := p.accept("?"); err != nil || !ok {
+		return cond, err
+	}
+	then, err := p.assignment()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	els, err := p.assignment()
+	if err != nil {
+		return nil, err
+	}
+	return &condExpr{cond: cond, then: then, els: els}, nil
+}
+
+// precedence 二元运算符的优先级，数字越大越先结合
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "===", "!=="},
+	{"<", ">", "<=", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binary(level int) (node, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		if p.tok.kind == tokPunct {
+			for _, candidate := range precedence[level] {
+				if p.tok.text == candidate {
+					op = candidate
+				}
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		if op == "||" || op == "&&" {
+			left = &logical{op: op, left: left, right: right}
+		} else {
+			left = &binary{op: op, left: left, right: right}
+		}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	for _, op := range []string{"!", "-", "+", "typeof"} {
+		if p.is(op) {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			operand, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return &unary{op: op, operand: operand}, nil
+		}
+	}
+	if p.is("++") || p.is("--") {
+		op := p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		target, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &update{op: op, prefix: true, target: target}, nil
+	}
+	expr, err := p.postfix()
+	if err != nil {
+		return nil, err
+	}
+	if p.is("++") || p.is("--") {
+		op := p.tok.text
+		return &update{op: op, target: expr}, p.advance()
+	}
+	return expr, nil
+}
+
+func (p *parser) postfix() (node, error) {
+	expr, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.is("."):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			expr = &member{object: expr, property: &literal{value: name}}
+		case p.is("["):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			index, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			expr = &member{object: expr, property: index}
+		case p.is("("):
+			call := &call{callee: expr, line: p.tok.line}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			for !p.is(")") {
+				arg, err := p.assignment()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+				if !p.is(")") {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			expr = call
+		default:
+			return expr, nil
+		}
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		return &literal{value: tok.num}, p.advance()
+	case tokString:
+		return &literal{value: tok.text}, p.advance()
+	case tokRegexp:
+		re, err := regexp.Compile(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: 不支持的正则表达式 /%s/: %w", tok.line, tok.text, err)
+		}
+		return &literal{value: re}, p.advance()
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return &literal{value: tok.text == "true"}, p.advance()
+		case "null":
+			return &literal{value: null{}}, p.advance()
+		case "undefined":
+			return &literal{value: nil}, p.advance()
+		case "function":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			decl, err := p.function(false)
+			if err != nil {
+				return nil, err
+			}
+			return &funcLit{decl: decl}, nil
+		}
+		return &identRef{name: tok.text, line: tok.line}, p.advance()
+	}
+	switch {
+	case p.is("("):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	case p.is("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		lit := &arrayLit{}
+		for !p.is("]") {
+			item, err := p.assignment()
+			if err != nil {
+				return nil, err
+			}
+			lit.items = append(lit.items, item)
+			if !p.is("]") {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return lit, p.advance()
+	}
+	return nil, p.errorf("应该是表达式")
+}
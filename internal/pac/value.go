@@ -0,0 +1,419 @@
+package pac
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ---- 类型转换和运算 ----
+
+func truthy(v value) bool {
+	switch v := v.(type) {
+	case nil, null:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+func toNumber(v value) float64 {
+	switch v := v.(type) {
+	case nil:
+		return math.NaN()
+	case null:
+		return 0
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return v
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 0
+		}
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+		if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+			if n, err := strconv.ParseInt(s[2:], 16, 64); err == nil {
+				return float64(n)
+			}
+		}
+	}
+	return math.NaN()
+}
+
+func toString(v value) string {
+	switch v := v.(type) {
+	case nil:
+		return "undefined"
+	case null:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e21 {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return v
+	case *array:
+		parts := make([]string, len(v.items))
+		for i, item := range v.items {
+			if item != nil && item != (null{}) {
+				parts[i] = toString(item)
+			}
+		}
+		return strings.Join(parts, ",")
+	case *regexp.Regexp:
+		return "/" + v.String() + "/"
+	}
+	return "function"
+}
+
+func typeOf(v value) string {
+	switch v.(type) {
+	case nil:
+		return "undefined"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *funcValue, builtin:
+		return "function"
+	}
+	return "object"
+}
+
+// looseEqual JavaScript 的 == 比较
+func looseEqual(a, b value) bool {
+	_, aNullish := a.(null)
+	_, bNullish := b.(null)
+	aNullish = aNullish || a == nil
+	bNullish = bNullish || b == nil
+	if aNullish || bNullish {
+		return aNullish && bNullish
+	}
+	if typeOf(a) == typeOf(b) {
+		return strictEqual(a, b)
+	}
+	_, aObj := a.(*array)
+	_, bObj := b.(*array)
+	if aObj || bObj {
+		return toString(a) == toString(b)
+	}
+	return toNumber(a) == toNumber(b)
+}
+
+// strictEqual JavaScript 的 === 比较
+func strictEqual(a, b value) bool {
+	switch a := a.(type) {
+	case float64, string, bool, nil, null:
+		return a == b
+	case *array:
+		other, ok := b.(*array)
+		return ok && a == other
+	case *funcValue:
+		other, ok := b.(*funcValue)
+		return ok && a == other
+	case *regexp.Regexp:
+		other, ok := b.(*regexp.Regexp)
+		return ok && a == other
+	}
+	return false
+}
+
+func binaryOp(op string, left, right value) (value, error) {
+	switch op {
+	case ",":
+		return right, nil
+	case "==":
+		return looseEqual(left, right), nil
+	case "!=":
+		return !looseEqual(left, right), nil
+	case "===":
+		return strictEqual(left, right), nil
+	case "!==":
+		return !strictEqual(left, right), nil
+	case "+":
+		_, ls := left.(string)
+		_, rs := right.(string)
+		_, la := left.(*array)
+		_, ra := right.(*array)
+		if ls || rs || la || ra {
+			return toString(left) + toString(right), nil
+		}
+		return toNumber(left) + toNumber(right), nil
+	case "-":
+		return toNumber(left) - toNumber(right), nil
+	case "*":
+		return toNumber(left) * toNumber(right), nil
+	case "/":
+		return toNumber(left) / toNumber(right), nil
+	case "%":
+		return math.Mod(toNumber(left), toNumber(right)), nil
+	case "<", ">", "<=", ">=":
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		if lok && rok {
+			c := strings.Compare(ls, rs)
+			return map[string]bool{"<": c < 0, ">": c > 0, "<=": c <= 0, ">=": c >= 0}[op], nil
+		}
+		l, r := toNumber(left), toNumber(right)
+		switch op {
+		case "<":
+			return l < r, nil
+		case ">":
+			return l > r, nil
+		case "<=":
+			return l <= r, nil
+		}
+		return l >= r, nil
+	}
+	return nil, fmt.Errorf("不支持的运算符 %s", op)
+}
+
+// getMember 读取属性，只支持 length 和数组、字符串的下标
+func getMember(object, property value) (value, error) {
+	switch o := object.(type) {
+	case string:
+		if s, ok := property.(string); ok && s == "length" {
+			return float64(len(o)), nil
+		}
+		i := toNumber(property)
+		if i >= 0 && int(i) < len(o) && i == math.Trunc(i) {
+			return o[int(i) : int(i)+1], nil
+		}
+		return nil, nil
+	case *array:
+		if s, ok := property.(string); ok && s == "length" {
+			return float64(len(o.items)), nil
+		}
+		i := toNumber(property)
+		if i >= 0 && int(i) < len(o.items) && i == math.Trunc(i) {
+			return o.items[int(i)], nil
+		}
+		return nil, nil
+	case nil, null:
+		return nil, fmt.Errorf("不能读取 %s 的属性 %s", toString(object), toString(property))
+	}
+	return nil, nil
+}
+
+// arg 返回第 i 个参数，不存在时为 undefined
+func arg(args []value, i int) value {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// toIndex 将参数转换为下标，与 JavaScript 一样截断为整数并限制在 [0, n] 内
+func toIndex(v value, def, n int) int {
+	if v == nil {
+		return def
+	}
+	f := toNumber(v)
+	if math.IsNaN(f) {
+		return 0
+	}
+	i := int(math.Trunc(f))
+	if i < 0 {
+		i = 0
+	}
+	if i > n {
+		i = n
+	}
+	return i
+}
+
+// method 返回字符串、数组和正则表达式的方法
+func method(this value, name string) (value, error) {
+	switch o := this.(type) {
+	case string:
+		switch name {
+		case "toLowerCase":
+			return builtin(func([]value) (value, error) { return strings.ToLower(o), nil }), nil
+		case "toUpperCase":
+			return builtin(func([]value) (value, error) { return strings.ToUpper(o), nil }), nil
+		case "trim":
+			return builtin(func([]value) (value, error) { return strings.TrimSpace(o), nil }), nil
+		case "indexOf":
+			return builtin(func(args []value) (value, error) {
+				from := toIndex(arg(args, 1), 0, len(o))
+				i := strings.Index(o[from:], toString(arg(args, 0)))
+				if i < 0 {
+					return -1.0, nil
+				}
+				return float64(i + from), nil
+			}), nil
+		case "lastIndexOf":
+			return builtin(func(args []value) (value, error) {
+				return float64(strings.LastIndex(o, toString(arg(args, 0)))), nil
+			}), nil
+		case "charAt":
+			return builtin(func(args []value) (value, error) {
+				i := toIndex(arg(args, 0), 0, len(o))
+				if i >= len(o) {
+					return "", nil
+				}
+				return o[i : i+1], nil
+			}), nil
+		case "substring":
+			return builtin(func(args []value) (value, error) {
+				start := toIndex(arg(args, 0), 0, len(o))
+				end := toIndex(arg(args, 1), len(o), len(o))
+				if start > end {
+					start, end = end, start
+				}
+				return o[start:end], nil
+			}), nil
+		case "substr":
+			return builtin(func(args []value) (value, error) {
+				start := int(toNumber(arg(args, 0)))
+				if start < 0 {
+					start = max(len(o)+start, 0)
+				}
+				start = min(start, len(o))
+				end := len(o)
+				if n := arg(args, 1); n != nil {
+					end = min(start+max(int(toNumber(n)), 0), len(o))
+				}
+				return o[start:end], nil
+			}), nil
+		case "slice":
+			return builtin(func(args []value) (value, error) {
+				bound := func(v value, def int) int {
+					if v == nil {
+						return def
+					}
+					i := int(toNumber(v))
+					if i < 0 {
+						i = max(len(o)+i, 0)
+					}
+					return min(i, len(o))
+				}
+				start, end := bound(arg(args, 0), 0), bound(arg(args, 1), len(o))
+				if start > end {
+					return "", nil
+				}
+				return o[start:end], nil
+			}), nil
+		case "split":
+			return builtin(func(args []value) (value, error) {
+				arr := &array{}
+				if arg(args, 0) == nil {
+					arr.items = []value{o}
+					return arr, nil
+				}
+				for _, part := range strings.Split(o, toString(args[0])) {
+					arr.items = append(arr.items, part)
+				}
+				return arr, nil
+			}), nil
+		case "startsWith":
+			return builtin(func(args []value) (value, error) {
+				return strings.HasPrefix(o, toString(arg(args, 0))), nil
+			}), nil
+		case "endsWith":
+			return builtin(func(args []value) (value, error) {
+				return strings.HasSuffix(o, toString(arg(args, 0))), nil
+			}), nil
+		case "includes":
+			return builtin(func(args []value) (value, error) {
+				return strings.Contains(o, toString(arg(args, 0))), nil
+			}), nil
+		case "match":
+			return builtin(func(args []value) (value, error) {
+				re, ok := arg(args, 0).(*regexp.Regexp)
+				if !ok {
+					var err error
+					if re, err = regexp.Compile(regexp.QuoteMeta(toString(arg(args, 0)))); err != nil {
+						return nil, err
+					}
+				}
+				m := re.FindStringSubmatch(o)
+				if m == nil {
+					return null{}, nil
+				}
+				arr := &array{}
+				for _, s := range m {
+					arr.items = append(arr.items, s)
+				}
+				return arr, nil
+			}), nil
+		case "replace":
+			return builtin(func(args []value) (value, error) {
+				replacement := toString(arg(args, 1))
+				if re, ok := arg(args, 0).(*regexp.Regexp); ok {
+					if loc := re.FindStringIndex(o); loc != nil {
+						return o[:loc[0]] + replacement + o[loc[1]:], nil
+					}
+					return o, nil
+				}
+				return strings.Replace(o, toString(arg(args, 0)), replacement, 1), nil
+			}), nil
+		case "toString":
+			return builtin(func([]value) (value, error) { return o, nil }), nil
+		}
+	case *array:
+		switch name {
+		case "indexOf":
+			return builtin(func(args []value) (value, error) {
+				for i, item := range o.items {
+					if strictEqual(item, arg(args, 0)) {
+						return float64(i), nil
+					}
+				}
+				return -1.0, nil
+			}), nil
+		case "includes":
+			return builtin(func(args []value) (value, error) {
+				for _, item := range o.items {
+					if strictEqual(item, arg(args, 0)) {
+						return true, nil
+					}
+				}
+				return false, nil
+			}), nil
+		case "push":
+			return builtin(func(args []value) (value, error) {
+				o.items = append(o.items, args...)
+				return float64(len(o.items)), nil
+			}), nil
+		case "join":
+			return builtin(func(args []value) (value, error) {
+				sep := ","
+				if arg(args, 0) != nil {
+					sep = toString(args[0])
+				}
+				parts := make([]string, len(o.items))
+				for i, item := range o.items {
+					parts[i] = toString(item)
+				}
+				return strings.Join(parts, sep), nil
+			}), nil
+		}
+	case *regexp.Regexp:
+		if name == "test" {
+			return builtin(func(args []value) (value, error) {
+				return o.MatchString(toString(arg(args, 0))), nil
+			}), nil
+		}
+	}
+	return nil, fmt.Errorf("%s 没有方法 %s", typeOf(this), name)
+}
@@ -0,0 +1,235 @@
+package fastls
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	http "github.com/FastTLS/fhttp"
+	"golang.org/x/net/proxy"
+)
+
+// defaultMaxConnsPerHost Chrome 和 Firefox 每个 origin 最多同时打开的 HTTP/1.1 连接数
+const defaultMaxConnsPerHost = 6
+
+// Limiter 限制并发请求数、每个 host 的请求速率和 HTTP/1.1 连接数，需在请求间复用同一个实例
+//
+// 请求从发出到响应体读完或关闭前都算作进行中，排队的请求在 Options.Context 取消时返回错误。
+// 零值只按浏览器的规则限制每个 origin 6 个 HTTP/1.1 连接，字段在第一次使用后不能再修改
+type Limiter struct {
+	MaxInFlight        int     // 全局同时进行的请求数，为 0 时不限制
+	MaxInFlightPerHost int     // 每个 host 同时进行的请求数，为 0 时不限制
+	RequestsPerSecond  float64 // 每个 host 每秒的请求数（令牌桶），为 0 时不限制
+	Burst              int     // 令牌桶容量，为 0 时为 1
+	MaxConnsPerHost    int     // 每个 origin 同时打开的 HTTP/1.1 连接数，为 0 时为 6，小于 0 时不限制
+
+	mu     sync.Mutex
+	global chan struct{}
+	hosts  map[string]*hostLimit
+}
+
+// hostLimit 单个 host 的限制状态
+type hostLimit struct {
+	inFlight chan struct{}
+	conns    chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// host 返回 key 对应的限制状态，第一次使用时创建
+func (l *Limiter) host(key string) *hostLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.hosts == nil {
+		l.hosts = make(map[string]*hostLimit)
+		if l.MaxInFlight > 0 {
+			l.global = make(chan struct{}, l.MaxInFlight)
+		}
+	}
+	h := l.hosts[key]
+	if h == nil {
+		h = &hostLimit{tokens: float64(l.burst()), last: time.Now()}
+		if l.MaxInFlightPerHost > 0 {
+			h.inFlight = make(chan struct{}, l.MaxInFlightPerHost)
+		}
+		maxConns := l.MaxConnsPerHost
+		if maxConns == 0 {
+			maxConns = defaultMaxConnsPerHost
+		}
+		if maxConns > 0 {
+			h.conns = make(chan struct{}, maxConns)
+		}
+		l.hosts[key] = h
+	}
+	return h
+}
+
+func (l *Limiter) burst() int {
+	if l.Burst <= 0 {
+		return 1
+	}
+	return l.Burst
+}
+
+// acquire 等待全局和 host 的并发名额以及速率令牌，返回释放名额的函数
+func (l *Limiter) acquire(ctx context.Context, key string) (func(), error) {
+	h := l.host(key)
+	if err := acquireSlot(ctx, l.global); err != nil {
+		return nil, err
+	}
+	if err := acquireSlot(ctx, h.inFlight); err != nil {
+		releaseSlot(l.global)
+		return nil, err
+	}
+	if err := l.wait(ctx, h); err != nil {
+		releaseSlot(h.inFlight)
+		releaseSlot(l.global)
+		return nil, err
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			releaseSlot(h.inFlight)
+			releaseSlot(l.global)
+		})
+	}, nil
+}
+
+// wait 从令牌桶中取一个令牌，不足时等待补充
+func (l *Limiter) wait(ctx context.Context, h *hostLimit) error {
+	if l.RequestsPerSecond <= 0 {
+		return nil
+	}
+	h.mu.Lock()
+	now := time.Now()
+	h.tokens += now.Sub(h.last).Seconds() * l.RequestsPerSecond
+	if burst := float64(l.burst()); h.tokens > burst {
+		h.tokens = burst
+	}
+	h.last = now
+	h.tokens--
+	delay := time.Duration(-h.tokens / l.RequestsPerSecond * float64(time.Second))
+	h.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// 归还未使用的令牌
+		h.mu.Lock()
+		h.tokens++
+		h.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func acquireSlot(ctx context.Context, slots chan struct{}) error {
+	if slots == nil {
+		return nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func releaseSlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+// limitDialer limiter 不为空时为 dialer 加上连接数限制
+func limitDialer(limiter *Limiter, dialer proxy.ContextDialer) proxy.ContextDialer {
+	if limiter == nil {
+		return dialer
+	}
+	return &limiterDialer{limiter: limiter, dialer: dialer}
+}
+
+// limiterDialer 按 origin 限制同时打开的连接数，连接关闭或协商为 HTTP/2 后释放名额
+type limiterDialer struct {
+	limiter *Limiter
+	dialer  proxy.ContextDialer
+}
+
+func (d *limiterDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *limiterDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	h := d.limiter.host(addr)
+	if err := acquireSlot(ctx, h.conns); err != nil {
+		return nil, err
+	}
+	conn, err := d.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		releaseSlot(h.conns)
+		return nil, err
+	}
+	return &limitedConn{Conn: conn, slots: h.conns}, nil
+}
+
+// limitedConn 占用一个连接名额的连接
+type limitedConn struct {
+	net.Conn
+	slots chan struct{}
+	once  sync.Once
+}
+
+// release 释放连接名额，HTTP/2 连接可以多路复用，不占用 HTTP/1.1 的名额
+func (c *limitedConn) release() {
+	c.once.Do(func() {
+		releaseSlot(c.slots)
+	})
+}
+
+func (c *limitedConn) Close() error {
+	c.release()
+	return c.Conn.Close()
+}
+
+// releaseBody 响应体读完或关闭时释放进行中请求的名额
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releaseBody) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
+
+// roundTripLimited 在 Limiter 的限制下发送请求
+func (rt *roundTripper) roundTripLimited(req *http.Request) (*http.Response, error) {
+	release, err := rt.limiter.acquire(req.Context(), hostWithPort(req.URL))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := rt.roundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
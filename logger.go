@@ -0,0 +1,104 @@
+package fastls
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	http "github.com/FastTLS/fhttp"
+)
+
+// 日志中使用的阶段名
+const (
+	phaseRequest  = "request"
+	phaseRetry    = "retry"
+	phaseProxy    = "proxy"
+	phaseTLS      = "tls"
+	phaseQUIC     = "quic"
+	phaseProtocol = "protocol"
+	phaseWS       = "websocket"
+)
+
+// discardLogger 不输出任何日志，用于未经 Options 创建的内部对象
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// logger 返回 Options.Logger，未设置时为 slog.Default()
+func (o *Options) logger() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return slog.Default()
+}
+
+// loggerOrDiscard logger 为空时返回不输出的 logger
+func loggerOrDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return discardLogger
+	}
+	return logger
+}
+
+// profileName 返回日志中的 profile 字段：User-Agent 对应的浏览器和指纹类型，如 chrome/ja3
+func profileName(userAgent string, fingerprint Fingerprint) string {
+	profile := parseUserAgent(userAgent)
+	if fingerprint != nil && !fingerprint.IsEmpty() {
+		profile += "/" + fingerprint.Type()
+	}
+	return profile
+}
+
+// withRequest 返回带有 host 和 profile 字段的 logger
+func withRequest(logger *slog.Logger, host, userAgent string, fingerprint Fingerprint) *slog.Logger {
+	return logger.With(slog.String("host", host), slog.String("profile", profileName(userAgent, fingerprint)))
+}
+
+// requestLogger 返回带有请求 host 和 profile 字段的 logger
+func requestLogger(options *Options) *slog.Logger {
+	host := options.URL
+	if u, err := url.Parse(options.URL); err == nil {
+		host = u.Host
+	}
+	return withRequest(options.logger(), host, options.UserAgent, options.Fingerprint)
+}
+
+// redactURL 隐藏 URL 中的密码，解析失败时整体隐藏
+func redactURL(rawURL string) string {
+	if rawURL == "" {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "REDACTED"
+	}
+	return u.Redacted()
+}
+
+// sensitiveHeaders 记录日志时隐藏值的请求头和响应头
+var sensitiveHeaders = []string{"cookie", "set-cookie", "authorization", "proxy-authorization"}
+
+// redactedHeader 记录日志时隐藏 Cookie 和认证信息的请求头
+type redactedHeader http.Header
+
+func (h redactedHeader) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(h))
+	for key, values := range h {
+		if key == http.HeaderOrderKey || key == http.PHeaderOrderKey {
+			continue
+		}
+		value := strings.Join(values, ", ")
+		for _, name := range sensitiveHeaders {
+			if strings.EqualFold(key, name) {
+				value = "REDACTED"
+				break
+			}
+		}
+		attrs = append(attrs, slog.String(key, value))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// logEnabled 判断 logger 是否会输出 level 级别的日志，避免构造不会输出的字段
+func logEnabled(logger *slog.Logger, level slog.Level) bool {
+	return logger.Enabled(context.Background(), level)
+}
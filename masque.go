@@ -0,0 +1,461 @@
+package fastls
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	stdhttp "net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/quicvarint"
+	xhttp2 "golang.org/x/net/http2"
+)
+
+// masqueUDPTemplate RFC 9298 默认的 CONNECT-UDP URI 模板
+const masqueUDPTemplate = "/.well-known/masque/udp/{target_host}/{target_port}/"
+
+// masqueDatagramCapsule DATAGRAM capsule 的类型（RFC 9297）
+const masqueDatagramCapsule = 0x00
+
+// masqueOuterPacketSize 与 masque 代理的 QUIC 连接的初始包长
+//
+// 外层的包要装下对端以默认 1280 字节发来的内层包，取 Chrome QUIC 的 1350，以太网 MTU 下不会分片
+const masqueOuterPacketSize = 1350
+
+// masqueDialer 通过 MASQUE CONNECT-UDP（RFC 9298）为 HTTP/3 建立经过 HTTP 代理的 UDP 通道
+//
+// masque 代理通过 HTTP/3 连接代理，数据报使用 HTTP/3 datagram；http 和 https 代理使用与代理协商的 HTTP/2
+// （扩展 CONNECT）或 HTTP/1.1（Upgrade），数据报封装为 DATAGRAM capsule。
+//
+// 与代理的 QUIC 握手使用标准库 TLS，HTTP/2 使用 x/net 的默认设置，都不使用 ProxyFingerprint 和 ProxyHTTP2Settings，
+// 与 https 代理的 TLS 握手仍使用 ProxyFingerprint。调用方显式设置了它们时拒绝建立通道，不会暴露 Go 的指纹
+type masqueDialer struct {
+	connect  *connectDialer
+	resolver Resolver
+	source   *sourceAddr
+	// strictTLS 调用方设置了非空的 ProxyFingerprint；strictHTTP2 调用方设置了 ProxyHTTP2Settings
+	strictTLS   bool
+	strictHTTP2 bool
+}
+
+// dialPacket 请求代理转发发往 addr 的 UDP 数据报，目标域名由代理解析
+func (d *masqueDialer) dialPacket(ctx context.Context, addr string) (net.PacketConn, net.Addr, error) {
+	target, err := d.targetURL(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	var conn net.PacketConn
+	if d.connect.ProxyURL.Scheme == "masque" {
+		conn, err = d.dialHTTP3(ctx, target, masqueAddr(addr))
+	} else {
+		conn, err = d.dialStream(ctx, target, masqueAddr(addr))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("MASQUE 代理 %s 建立 UDP 通道失败: %w", d.connect.ProxyURL.Redacted(), err)
+	}
+	return conn, masqueAddr(addr), nil
+}
+
+// targetURL 按代理 URL 中的 URI 模板生成 CONNECT-UDP 请求的 URL，没有模板时使用 RFC 9298 的默认模板
+func (d *masqueDialer) targetURL(addr string) (*url.URL, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	template := masqueUDPTemplate
+	if proxyURL := d.connect.ProxyURL; strings.Contains(proxyURL.Path+proxyURL.RawQuery, "{target_host}") {
+		template = proxyURL.Path
+		if proxyURL.RawQuery != "" {
+			template += "?" + proxyURL.RawQuery
+		}
+	}
+	// IPv6 地址中的冒号需要编码
+	host = strings.ReplaceAll(url.PathEscape(host), ":", "%3A")
+	path := strings.NewReplacer("{target_host}", host, "{target_port}", port).Replace(template)
+	return url.Parse("https://" + d.connect.ProxyURL.Host + path)
+}
+
+// header 返回 CONNECT-UDP 请求的请求头，包括代理认证和 ProxyHeaders
+func (d *masqueDialer) header() stdhttp.Header {
+	header := stdhttp.Header{"Capsule-Protocol": {"?1"}}
+	for k, v := range d.connect.DefaultHeader {
+		header[k] = v
+	}
+	return header
+}
+
+// dialHTTP3 通过 QUIC 连接代理，在扩展 CONNECT 请求流上收发 HTTP/3 datagram
+func (d *masqueDialer) dialHTTP3(ctx context.Context, target *url.URL, addr net.Addr) (net.PacketConn, error) {
+	if _, chained := d.connect.Dialer.(*chainDialer); chained {
+		return nil, errors.New("QUIC 不能经过代理链")
+	}
+	if d.strictTLS {
+		return nil, errors.New("与 masque 代理的 QUIC 握手使用标准库 TLS，不能使用设置的 ProxyFingerprint")
+	}
+	host, port, err := net.SplitHostPort(d.connect.ProxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	udpConn, udpAddr, err := dialDirectUDP(ctx, d.resolver, d.source, host, port)
+	if err != nil {
+		return nil, err
+	}
+	tlsConf := &tls.Config{
+		ServerName:         d.connect.ProxyURL.Hostname(),
+		InsecureSkipVerify: true,
+		NextProtos:         []string{http3.NextProtoH3},
+	}
+	qconf := &quic.Config{EnableDatagrams: true, KeepAlivePeriod: 15 * time.Second, InitialPacketSize: masqueOuterPacketSize}
+	qconn, err := quic.Dial(ctx, udpConn, udpAddr, tlsConf, qconf)
+	if err != nil {
+		udpConn.Close()
+		return nil, err
+	}
+	context.AfterFunc(qconn.Context(), func() { udpConn.Close() })
+	fail := func(err error) (net.PacketConn, error) {
+		_ = qconn.CloseWithError(0, "")
+		return nil, err
+	}
+
+	cc := (&http3.Transport{EnableDatagrams: true}).NewClientConn(qconn)
+	select {
+	case <-cc.ReceivedSettings():
+	case <-ctx.Done():
+		return fail(ctx.Err())
+	case <-qconn.Context().Done():
+		return fail(context.Cause(qconn.Context()))
+	}
+	if settings := cc.Settings(); !settings.EnableDatagrams || !settings.EnableExtendedConnect {
+		return fail(errors.New("代理不支持 HTTP/3 datagram 或扩展 CONNECT"))
+	}
+	str, err := cc.OpenRequestStream(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	req := &stdhttp.Request{
+		Method: stdhttp.MethodConnect,
+		Proto:  "connect-udp",
+		Host:   target.Host,
+		URL:    target,
+		Header: d.header(),
+	}
+	if err := str.SendRequestHeader(req); err != nil {
+		return fail(err)
+	}
+	resp, err := str.ReadResponse()
+	if err != nil {
+		return fail(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fail(fmt.Errorf("代理拒绝 CONNECT-UDP: %s", resp.Status))
+	}
+
+	receive := func(ctx context.Context) ([]byte, error) {
+		for {
+			data, err := str.ReceiveDatagram(ctx)
+			if err != nil {
+				return nil, err
+			}
+			// 只处理上下文 ID 为 0 的 UDP 负载
+			if id, n, err := quicvarint.Parse(data); err == nil && id == 0 {
+				return data[n:], nil
+			}
+		}
+	}
+	send := func(p []byte) error {
+		return str.SendDatagram(append([]byte{0}, p...))
+	}
+	closeTunnel := func() error {
+		str.CancelRead(0)
+		_ = str.Close()
+		return qconn.CloseWithError(0, "")
+	}
+	return newMasquePacketConn(qconn.LocalAddr(), addr, receive, send, closeTunnel), nil
+}
+
+// dialStream 通过 TCP 连接代理，在 HTTP/2 或 HTTP/1.1 的请求流上收发 DATAGRAM capsule
+func (d *masqueDialer) dialStream(ctx context.Context, target *url.URL, addr net.Addr) (net.PacketConn, error) {
+	rawConn, protocol, err := d.connect.dialProxy(ctx, "tcp")
+	if err != nil {
+		return nil, err
+	}
+	if protocol == "h2" && d.strictHTTP2 {
+		rawConn.Close()
+		return nil, errors.New("HTTP/2 扩展 CONNECT 使用 x/net 的默认设置，不能使用设置的 ProxyHTTP2Settings")
+	}
+	// 建立隧道前 ctx 结束时关闭连接，中断握手
+	stop := context.AfterFunc(ctx, func() { rawConn.Close() })
+	var r io.Reader
+	var w io.Writer
+	var closeTunnel func() error
+	if protocol == "h2" {
+		r, w, closeTunnel, err = d.connectHTTP2(rawConn, target)
+	} else {
+		r, w, closeTunnel, err = d.upgradeHTTP1(rawConn, target)
+	}
+	if !stop() {
+		if err == nil {
+			closeTunnel()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(r)
+	receive := func(context.Context) ([]byte, error) {
+		return readDatagramCapsule(reader)
+	}
+	var mu sync.Mutex
+	send := func(p []byte) error {
+		capsule := quicvarint.Append(nil, masqueDatagramCapsule)
+		capsule = quicvarint.Append(capsule, uint64(len(p)+1))
+		capsule = append(append(capsule, 0), p...)
+		mu.Lock()
+		defer mu.Unlock()
+		_, err := w.Write(capsule)
+		return err
+	}
+	return newMasquePacketConn(rawConn.LocalAddr(), addr, receive, send, closeTunnel), nil
+}
+
+// connectHTTP2 发送扩展 CONNECT 请求（RFC 8441），请求体和响应体是 capsule 流
+//
+// fhttp 的 HTTP/2 不支持 :protocol 伪头部，这里使用 x/net 的 HTTP/2 实现，SETTINGS 和窗口大小是 x/net 的默认值
+func (d *masqueDialer) connectHTTP2(rawConn net.Conn, target *url.URL) (io.Reader, io.Writer, func() error, error) {
+	cc, err := (&xhttp2.Transport{}).NewClientConn(rawConn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pr, pw := io.Pipe()
+	req := &stdhttp.Request{
+		Method: stdhttp.MethodConnect,
+		URL:    target,
+		Host:   target.Host,
+		Header: d.header(),
+		Body:   pr,
+	}
+	req.Header[":protocol"] = []string{"connect-udp"}
+	resp, err := cc.RoundTrip(req)
+	if err != nil {
+		pw.Close()
+		return nil, nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		pw.Close()
+		return nil, nil, nil, fmt.Errorf("代理拒绝 CONNECT-UDP: %s", resp.Status)
+	}
+	closeTunnel := func() error {
+		pw.Close()
+		resp.Body.Close()
+		return rawConn.Close()
+	}
+	return resp.Body, pw, closeTunnel, nil
+}
+
+// upgradeHTTP1 发送 Upgrade: connect-udp 请求，101 响应后连接上是 capsule 流
+func (d *masqueDialer) upgradeHTTP1(rawConn net.Conn, target *url.URL) (io.Reader, io.Writer, func() error, error) {
+	req := &stdhttp.Request{
+		Method: stdhttp.MethodGet,
+		URL:    target,
+		Host:   target.Host,
+		Header: d.header(),
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "connect-udp")
+	if err := req.Write(rawConn); err != nil {
+		return nil, nil, nil, err
+	}
+	br := bufio.NewReader(rawConn)
+	resp, err := stdhttp.ReadResponse(br, req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if resp.StatusCode != stdhttp.StatusSwitchingProtocols {
+		return nil, nil, nil, fmt.Errorf("代理拒绝 CONNECT-UDP: %s", resp.Status)
+	}
+	return br, rawConn, rawConn.Close, nil
+}
+
+// readDatagramCapsule 读取下一个上下文 ID 为 0 的 DATAGRAM capsule 的 UDP 负载，跳过其他 capsule
+func readDatagramCapsule(r *bufio.Reader) ([]byte, error) {
+	for {
+		capsuleType, err := quicvarint.Read(r)
+		if err != nil {
+			return nil, err
+		}
+		length, err := quicvarint.Read(r)
+		if err != nil {
+			return nil, err
+		}
+		if length > 1<<16 {
+			return nil, fmt.Errorf("capsule 长度 %d 超过限制", length)
+		}
+		value := make([]byte, length)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		if capsuleType != masqueDatagramCapsule {
+			continue
+		}
+		if id, n, err := quicvarint.Parse(value); err == nil && id == 0 {
+			return value[n:], nil
+		}
+	}
+}
+
+// masqueAddr CONNECT-UDP 的目标地址，域名由代理解析
+type masqueAddr string
+
+func (a masqueAddr) Network() string { return "udp" }
+func (a masqueAddr) String() string  { return string(a) }
+
+// masquePacketConn 通过 MASQUE 隧道收发单个目标的数据报
+//
+// 后台读取隧道中的数据报，ReadFrom 支持读超时，quic-go 通过设置过去的读超时结束读取
+type masquePacketConn struct {
+	local       net.Addr
+	target      net.Addr
+	send        func([]byte) error
+	closeTunnel func() error
+
+	incoming chan []byte
+	readDone chan struct{} // 隧道读取结束后关闭，readErr 为结束的原因
+	readErr  error
+	cancel   context.CancelFunc
+
+	deadlineMu    sync.Mutex
+	deadlineTimer *time.Timer
+	deadline      chan struct{} // 读超时到达后关闭
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newMasquePacketConn(local, target net.Addr, receive func(context.Context) ([]byte, error), send func([]byte) error, closeTunnel func() error) *masquePacketConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &masquePacketConn{
+		local:       local,
+		target:      target,
+		send:        send,
+		closeTunnel: closeTunnel,
+		incoming:    make(chan []byte, 64),
+		readDone:    make(chan struct{}),
+		cancel:      cancel,
+		deadline:    make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+	go c.readLoop(ctx, receive)
+	return c
+}
+
+func (c *masquePacketConn) readLoop(ctx context.Context, receive func(context.Context) ([]byte, error)) {
+	defer close(c.readDone)
+	for {
+		data, err := receive(ctx)
+		if err != nil {
+			c.readErr = err
+			return
+		}
+		select {
+		case c.incoming <- data:
+		case <-c.closed:
+			c.readErr = net.ErrClosed
+			return
+		}
+	}
+}
+
+func (c *masquePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.deadlineMu.Lock()
+	deadline := c.deadline
+	c.deadlineMu.Unlock()
+	select {
+	case data := <-c.incoming:
+		return copy(p, data), c.target, nil
+	default:
+	}
+	select {
+	case data := <-c.incoming:
+		return copy(p, data), c.target, nil
+	case <-deadline:
+		return 0, nil, os.ErrDeadlineExceeded
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	case <-c.readDone:
+		return 0, nil, c.readErr
+	}
+}
+
+func (c *masquePacketConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	if err := c.send(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *masquePacketConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *masquePacketConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline 设置读超时，t 为零值时取消
+func (c *masquePacketConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	if c.deadlineTimer != nil && !c.deadlineTimer.Stop() {
+		// 等待定时器关闭 deadline
+		<-c.deadline
+	}
+	c.deadlineTimer = nil
+	select {
+	case <-c.deadline:
+		c.deadline = make(chan struct{})
+	default:
+	}
+	if t.IsZero() {
+		return nil
+	}
+	deadline := c.deadline
+	if d := time.Until(t); d > 0 {
+		c.deadlineTimer = time.AfterFunc(d, func() { close(deadline) })
+	} else {
+		close(deadline)
+	}
+	return nil
+}
+
+func (c *masquePacketConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (c *masquePacketConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.cancel()
+		err = c.closeTunnel()
+	})
+	return err
+}
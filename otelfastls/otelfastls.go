@@ -0,0 +1,360 @@
+// Package otelfastls 为 fastls 请求提供 OpenTelemetry 追踪和指标
+//
+// 作为独立模块发布，使用 fastls 本身不需要引入 OpenTelemetry 依赖
+package otelfastls
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	fastls "github.com/FastTLS/fastls"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName 追踪和指标使用的 instrumentation scope
+const ScopeName = "github.com/FastTLS/fastls/otelfastls"
+
+// 请求 span 和指标使用的 fastls 专有属性
+const (
+	ProfileKey         = attribute.Key("fastls.profile")           // 模拟的浏览器配置，由 WithProfile 设置
+	FingerprintTypeKey = attribute.Key("fastls.fingerprint.type")  // 指纹类型，如 ja3、ja4r
+	ProxyHostKey       = attribute.Key("fastls.proxy.host")        // 代理的 host:port，不包含用户名和密码
+	JA3HashKey         = attribute.Key("fastls.tls.ja3_hash")      // 实际发送的 ClientHello 的 JA3 MD5
+	JA4Key             = attribute.Key("fastls.tls.ja4")           // 实际发送的 ClientHello 的 JA4
+	AttemptsKey        = attribute.Key("fastls.attempts")          // 按重试策略尝试的次数
+	ConnReusedKey      = attribute.Key("fastls.connection.reused") // 连接是否是复用的
+)
+
+// Option 配置 Client
+type Option func(*config)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	profile        string
+}
+
+// WithTracerProvider 设置 TracerProvider，默认使用 otel.GetTracerProvider()
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = provider
+	}
+}
+
+// WithMeterProvider 设置 MeterProvider，默认使用 otel.GetMeterProvider()
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = provider
+	}
+}
+
+// WithProfile 设置 fastls.profile 属性，如 "chrome142"，与 imitate 中使用的配置对应
+func WithProfile(name string) Option {
+	return func(c *config) {
+		c.profile = name
+	}
+}
+
+// Client 为每个请求创建 span 并记录指标的 fastls 客户端
+//
+// 请求 span 下为 DNS 解析、TCP 连接、代理隧道和 TLS 握手创建子 span。记录的指标：
+//   - http.client.request.duration：请求耗时直方图（秒）
+//   - fastls.client.tls.handshake.failures：按 error.type 分类的握手失败次数
+//   - fastls.client.connections：按 fastls.connection.reused 分类的连接使用次数，两者之比即连接复用率
+type Client struct {
+	client  fastls.Fastls
+	tracer  trace.Tracer
+	profile string
+
+	duration          metric.Float64Histogram
+	handshakeFailures metric.Int64Counter
+	connections       metric.Int64Counter
+}
+
+// NewClient 创建 Client
+func NewClient(opts ...Option) (*Client, error) {
+	cfg := config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.tracerProvider == nil {
+		cfg.tracerProvider = otel.GetTracerProvider()
+	}
+	if cfg.meterProvider == nil {
+		cfg.meterProvider = otel.GetMeterProvider()
+	}
+
+	meter := cfg.meterProvider.Meter(ScopeName)
+	c := &Client{
+		client:  fastls.NewClient(),
+		tracer:  cfg.tracerProvider.Tracer(ScopeName),
+		profile: cfg.profile,
+	}
+	var err error
+	if c.duration, err = meter.Float64Histogram("http.client.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("请求耗时，包括重定向和重试"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10),
+	); err != nil {
+		return nil, err
+	}
+	if c.handshakeFailures, err = meter.Int64Counter("fastls.client.tls.handshake.failures",
+		metric.WithUnit("{failure}"),
+		metric.WithDescription("TLS 握手失败次数，按原因分类"),
+	); err != nil {
+		return nil, err
+	}
+	if c.connections, err = meter.Int64Counter("fastls.client.connections",
+		metric.WithUnit("{connection}"),
+		metric.WithDescription("发送请求使用的连接数，按是否复用分类"),
+	); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Do 与 fastls.Fastls.Do 相同，并为请求创建 span 和记录指标
+//
+// options.Context 中的 span 作为父 span；options.Trace 中已有的回调仍然会被调用
+func (c *Client) Do(URL string, options fastls.Options, Method string) (fastls.Response, error) {
+	ctx := options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	method := strings.ToUpper(Method)
+	// metricAttrs 只包含低基数的属性
+	metricAttrs := []attribute.KeyValue{attribute.String("http.request.method", method)}
+	if c.profile != "" {
+		metricAttrs = append(metricAttrs, ProfileKey.String(c.profile))
+	}
+	attrs := slices.Clone(metricAttrs)
+	if u, err := url.Parse(URL); err == nil {
+		u.User = nil
+		metricAttrs = append(metricAttrs, attribute.String("server.address", u.Hostname()))
+		attrs = append(attrs, attribute.String("url.full", u.String()), attribute.String("server.address", u.Hostname()))
+	}
+	if typ := options.GetFingerprintType(); typ != "" {
+		attrs = append(attrs, FingerprintTypeKey.String(typ))
+	}
+	if host := proxyHost(options.Proxy); host != "" {
+		attrs = append(attrs, ProxyHostKey.String(host))
+	}
+
+	start := time.Now()
+	ctx, span := c.tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	defer span.End()
+
+	hooks := &spanHooks{client: c, ctx: ctx, spans: make(map[string][]trace.Span)}
+	options.Context = ctx
+	options.Trace = fastls.ComposeTrace(hooks.trace(), options.Trace)
+	resp, err := c.client.Do(URL, options, Method)
+	hooks.endAll()
+
+	var respAttrs []attribute.KeyValue
+	if resp.Status > 0 && err == nil {
+		respAttrs = append(respAttrs, attribute.Int("http.response.status_code", resp.Status))
+	}
+	if version := protocolVersion(resp.Protocol); version != "" {
+		respAttrs = append(respAttrs, attribute.String("network.protocol.version", version))
+	}
+	switch {
+	case err != nil:
+		respAttrs = append(respAttrs, attribute.String("error.type", errorType(err)))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case resp.Status >= 400:
+		respAttrs = append(respAttrs, attribute.String("error.type", strconv.Itoa(resp.Status)))
+		span.SetStatus(codes.Error, "")
+	}
+	span.SetAttributes(respAttrs...)
+	span.SetAttributes(AttemptsKey.Int(resp.Attempts))
+	if resp.TLS != nil {
+		span.SetAttributes(tlsAttributes(resp.TLS)...)
+	}
+	if resp.Timing != nil {
+		span.SetAttributes(ConnReusedKey.Bool(resp.Timing.ConnReused))
+	}
+
+	metricAttrs = append(metricAttrs, respAttrs...)
+	c.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(metricAttrs...))
+	return resp, err
+}
+
+// spanHooks 将 fastls.ClientTrace 的回调转换为子 span
+type spanHooks struct {
+	client *Client
+	ctx    context.Context
+
+	mu    sync.Mutex
+	spans map[string][]trace.Span // 阶段和 key -> 尚未结束的 span，按开始顺序
+}
+
+func (h *spanHooks) start(key, name string, attrs ...attribute.KeyValue) {
+	_, span := h.client.tracer.Start(h.ctx, name, trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(attrs...))
+	h.mu.Lock()
+	h.spans[key] = append(h.spans[key], span)
+	h.mu.Unlock()
+}
+
+// end 结束 key 下最早开始的 span，err 不为空时记录错误
+func (h *spanHooks) end(key string, err error, attrs ...attribute.KeyValue) {
+	h.mu.Lock()
+	spans := h.spans[key]
+	if len(spans) == 0 {
+		h.mu.Unlock()
+		return
+	}
+	span := spans[0]
+	h.spans[key] = spans[1:]
+	h.mu.Unlock()
+
+	span.SetAttributes(attrs...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// endAll 结束请求完成时仍未结束的 span
+func (h *spanHooks) endAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, spans := range h.spans {
+		for _, span := range spans {
+			span.End()
+		}
+		delete(h.spans, key)
+	}
+}
+
+func (h *spanHooks) trace() *fastls.ClientTrace {
+	return &fastls.ClientTrace{
+		// DNSDone 和 TLSHandshakeDone 不带 key，按开始顺序结束
+		DNSStart: func(host string) {
+			h.start("dns", "dns.lookup", attribute.String("dns.question.name", host))
+		},
+		DNSDone: func(addrs []net.IPAddr, err error) {
+			answers := make([]string, len(addrs))
+			for i, addr := range addrs {
+				answers[i] = addr.String()
+			}
+			h.end("dns", err, attribute.StringSlice("dns.answers", answers))
+		},
+		ConnectStart: func(network, addr string) {
+			h.start("connect "+addr, "connect", attribute.String("network.transport", network), attribute.String("network.peer.address", addr))
+		},
+		ConnectDone: func(network, addr string, err error) {
+			h.end("connect "+addr, err)
+		},
+		ProxyConnectStart: func(proxyURL, target string) {
+			h.start("proxy "+target, "proxy.connect", ProxyHostKey.String(proxyHost(proxyURL)), attribute.String("server.address", target))
+		},
+		ProxyConnectDone: func(proxyURL, target string, err error) {
+			h.end("proxy "+target, err)
+		},
+		TLSHandshakeStart: func(serverName string) {
+			h.start("tls", "tls.handshake", attribute.String("tls.client.server_name", serverName))
+		},
+		TLSHandshakeDone: func(info *fastls.TLSInfo, err error) {
+			if err != nil {
+				h.client.handshakeFailures.Add(h.ctx, 1, metric.WithAttributes(attribute.String("error.type", handshakeCause(err))))
+				h.end("tls", err)
+				return
+			}
+			var attrs []attribute.KeyValue
+			if info != nil {
+				attrs = tlsAttributes(info)
+			}
+			h.end("tls", nil, attrs...)
+		},
+		GotConn: func(remoteAddr string, reused bool) {
+			h.client.connections.Add(h.ctx, 1, metric.WithAttributes(ConnReusedKey.Bool(reused)))
+		},
+	}
+}
+
+// tlsAttributes 返回 TLS 连接的属性
+func tlsAttributes(info *fastls.TLSInfo) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("tls.protocol.version", strings.TrimPrefix(info.VersionName, "TLS ")),
+		attribute.String("tls.cipher", info.CipherSuiteName),
+		attribute.String("tls.next_protocol", info.ALPN),
+		attribute.Bool("tls.resumed", info.DidResume),
+	}
+	if info.JA3 != "" {
+		sum := md5.Sum([]byte(info.JA3))
+		attrs = append(attrs, JA3HashKey.String(hex.EncodeToString(sum[:])))
+	}
+	if info.JA4 != "" {
+		attrs = append(attrs, JA4Key.String(info.JA4))
+	}
+	return attrs
+}
+
+// proxyHost 返回代理 URL 的 host:port，不包含用户名和密码
+func proxyHost(proxyURL string) string {
+	if proxyURL == "" {
+		return ""
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// protocolVersion 将 HTTP/1.1、HTTP/2.0、HTTP/3.0 转换为 semconv 的 1.1、2、3
+func protocolVersion(proto string) string {
+	version := strings.TrimPrefix(proto, "HTTP/")
+	if version == proto {
+		return ""
+	}
+	return strings.TrimSuffix(version, ".0")
+}
+
+// errorType 返回请求错误的分类
+func errorType(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	}
+	return "error"
+}
+
+// handshakeCause 返回 TLS 握手失败的原因：timeout、certificate、alert、connection_closed 或 other
+func handshakeCause(err error) string {
+	var certErr *x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	switch {
+	case errorType(err) == "timeout":
+		return "timeout"
+	case errors.As(err, &certErr), errors.As(err, &hostErr), errors.As(err, &invalidErr), strings.Contains(err.Error(), "x509:"):
+		return "certificate"
+	case strings.Contains(err.Error(), "alert"):
+		return "alert"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET), errors.Is(err, net.ErrClosed):
+		return "connection_closed"
+	}
+	return "other"
+}
@@ -0,0 +1,206 @@
+package otelfastls_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/FastTLS/fastls/imitate"
+	"github.com/FastTLS/fastls/otelfastls"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	fastls "github.com/FastTLS/fastls"
+)
+
+// newInstrumentedClient 创建使用内存 exporter 和 ManualReader 的 Client
+func newInstrumentedClient(t *testing.T) (*otelfastls.Client, *tracetest.InMemoryExporter, *sdkmetric.ManualReader) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() {
+		_ = tracerProvider.Shutdown(context.Background())
+		_ = meterProvider.Shutdown(context.Background())
+	})
+
+	client, err := otelfastls.NewClient(
+		otelfastls.WithTracerProvider(tracerProvider),
+		otelfastls.WithMeterProvider(meterProvider),
+		otelfastls.WithProfile("chrome"),
+	)
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	return client, exporter, reader
+}
+
+func attr(attrs []attribute.KeyValue, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// findMetric 返回名为 name 的指标
+func findMetric(t *testing.T, reader *sdkmetric.ManualReader, name string) metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("收集指标失败: %v", err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m
+			}
+		}
+	}
+	t.Fatalf("缺少指标 %s", name)
+	return metricdata.Metrics{}
+}
+
+// TestRequestSpans 测试请求 span、子 span 和属性
+func TestRequestSpans(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	client, exporter, reader := newInstrumentedClient(t)
+
+	options := fastls.Options{}
+	imitate.Chrome(&options)
+	// 使用域名访问以触发 DNS 解析
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	resp, err := client.Do(url, options, "GET")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+
+	spans := exporter.GetSpans()
+	var request tracetest.SpanStub
+	children := map[string]int{}
+	for _, span := range spans {
+		if span.Name == "GET" {
+			request = span
+		} else {
+			children[span.Name]++
+		}
+	}
+	if request.Name == "" {
+		t.Fatalf("缺少请求 span: %v", spans)
+	}
+	for _, name := range []string{"dns.lookup", "connect", "tls.handshake"} {
+		if children[name] == 0 {
+			t.Errorf("缺少子 span %s: %v", name, children)
+		}
+	}
+	for _, span := range spans {
+		if span.Name != "GET" && span.Parent.SpanID() != request.SpanContext.SpanID() {
+			t.Errorf("子 span %s 的父 span 应该是请求 span", span.Name)
+		}
+	}
+
+	if v, _ := attr(request.Attributes, otelfastls.ProfileKey); v.AsString() != "chrome" {
+		t.Errorf("fastls.profile 应该是 chrome，实际是 %q", v.AsString())
+	}
+	if v, _ := attr(request.Attributes, "http.response.status_code"); v.AsInt64() != 200 {
+		t.Errorf("状态码应该是 200，实际是 %d", v.AsInt64())
+	}
+	if v, _ := attr(request.Attributes, "network.protocol.version"); v.AsString() != "1.1" {
+		t.Errorf("协议版本应该是 1.1，实际是 %q", v.AsString())
+	}
+	if v, _ := attr(request.Attributes, otelfastls.JA3HashKey); len(v.AsString()) != 32 {
+		t.Errorf("JA3 hash 应该是 32 位的 MD5，实际是 %q", v.AsString())
+	}
+	if v, _ := attr(request.Attributes, otelfastls.JA4Key); v.AsString() != resp.TLS.JA4 || v.AsString() == "" {
+		t.Errorf("JA4 应该是 %q，实际是 %q", resp.TLS.JA4, v.AsString())
+	}
+
+	duration, ok := findMetric(t, reader, "http.client.request.duration").Data.(metricdata.Histogram[float64])
+	if !ok || len(duration.DataPoints) != 1 || duration.DataPoints[0].Count != 1 {
+		t.Errorf("应该记录 1 次请求耗时: %+v", duration)
+	}
+	connections, ok := findMetric(t, reader, "fastls.client.connections").Data.(metricdata.Sum[int64])
+	if !ok || len(connections.DataPoints) == 0 {
+		t.Fatalf("应该记录连接数: %+v", connections)
+	}
+	if v, _ := connections.DataPoints[0].Attributes.Value(otelfastls.ConnReusedKey); v.AsBool() {
+		t.Error("新连接不应该记录为复用")
+	}
+}
+
+// TestProxySpan 测试代理子 span 和代理属性不包含密码
+func TestProxySpan(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(target.Close)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	t.Cleanup(proxy.Close)
+	client, exporter, _ := newInstrumentedClient(t)
+
+	options := fastls.Options{Proxy: strings.Replace(proxy.URL, "http://", "http://user:secret@", 1)}
+	imitate.Chrome(&options)
+	if _, err := client.Do(target.URL, options, "GET"); err == nil {
+		t.Fatal("代理拒绝 CONNECT 时请求应该失败")
+	}
+
+	var proxySpan, request tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		switch span.Name {
+		case "proxy.connect":
+			proxySpan = span
+		case "GET":
+			request = span
+		}
+	}
+	if proxySpan.Name == "" {
+		t.Fatal("缺少 proxy.connect 子 span")
+	}
+	if proxySpan.Status.Code != codes.Error || request.Status.Code != codes.Error {
+		t.Error("代理失败时 span 状态应该是 Error")
+	}
+	for _, span := range []tracetest.SpanStub{proxySpan, request} {
+		if v, _ := attr(span.Attributes, otelfastls.ProxyHostKey); v.AsString() != strings.TrimPrefix(proxy.URL, "http://") {
+			t.Errorf("%s 的代理地址错误: %q", span.Name, v.AsString())
+		}
+		for _, kv := range span.Attributes {
+			if strings.Contains(kv.Value.Emit(), "secret") {
+				t.Errorf("%s 的属性 %s 不应该包含密码", span.Name, kv.Key)
+			}
+		}
+	}
+}
+
+// TestHandshakeFailureMetric 测试握手失败按原因计数
+func TestHandshakeFailureMetric(t *testing.T) {
+	// 普通 HTTP 服务无法完成 TLS 握手
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+	client, _, reader := newInstrumentedClient(t)
+
+	options := fastls.Options{}
+	imitate.Chrome(&options)
+	if _, err := client.Do(strings.Replace(server.URL, "http://", "https://", 1), options, "GET"); err == nil {
+		t.Fatal("握手应该失败")
+	}
+
+	failures, ok := findMetric(t, reader, "fastls.client.tls.handshake.failures").Data.(metricdata.Sum[int64])
+	if !ok || len(failures.DataPoints) != 1 || failures.DataPoints[0].Value != 1 {
+		t.Fatalf("应该记录 1 次握手失败: %+v", failures)
+	}
+	if v, _ := failures.DataPoints[0].Attributes.Value("error.type"); v.AsString() == "" {
+		t.Error("握手失败应该带有原因")
+	}
+}
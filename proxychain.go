@@ -0,0 +1,174 @@
+package fastls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// ProxyHopError 代理链中某一跳失败，Hop 从 1 开始
+type ProxyHopError struct {
+	Hop    int
+	Proxy  string // 已隐藏密码
+	Target string // 这一跳要连接的地址，即下一跳代理或请求目标，配置错误时为空
+	Err    error
+}
+
+func (e *ProxyHopError) Error() string {
+	if e.Target == "" {
+		return fmt.Sprintf("代理链第 %d 跳 %s: %v", e.Hop, e.Proxy, e.Err)
+	}
+	return fmt.Sprintf("代理链第 %d 跳 %s 连接 %s 失败: %v", e.Hop, e.Proxy, e.Target, e.Err)
+}
+
+func (e *ProxyHopError) Unwrap() error {
+	return e.Err
+}
+
+// chainDialer 依次经过多个代理，每一跳通过上一跳建立的隧道连接下一跳
+type chainDialer struct {
+	hops      []string
+	addrs     []string // 每一跳代理的 host:port
+	userAgent string
+	browser   browser
+	forward   proxy.ContextDialer // 连接第一跳使用的 dialer
+	timeout   time.Duration       // 每一跳的超时，为 0 时不单独限制
+}
+
+// newChainDialer 创建经过 hops 的代理链，hops 支持 http、https、socks4(a) 和 socks5(h)，认证信息写在各自的 URL 中
+func newChainDialer(hops []string, userAgent string, browser browser, forward proxy.ContextDialer) (*chainDialer, error) {
+	d := &chainDialer{
+		hops:      hops,
+		userAgent: userAgent,
+		browser:   browser,
+		forward:   forward,
+		timeout:   browser.ProxyHopTimeout,
+	}
+	for i, hop := range hops {
+		dialer, err := newConnectDialer(hop, userAgent, browser, forward)
+		if err != nil {
+			return nil, &ProxyHopError{Hop: i + 1, Proxy: redactURL(hop), Err: err}
+		}
+		d.addrs = append(d.addrs, dialer.(*connectDialer).proxyAddr())
+	}
+	return d, nil
+}
+
+func (d *chainDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *chainDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var conn net.Conn
+	for i, hop := range d.hops {
+		target := addr
+		if i+1 < len(d.hops) {
+			target = d.addrs[i+1]
+		}
+		forward := &hopForward{dialer: d.forward, tunnel: conn}
+		hopBrowser := d.browser
+		if i > 0 {
+			// 之后的跳只能通过上一跳的隧道连接
+			hopBrowser.ProxyDialTLS = nil
+		}
+		dialer, err := newConnectDialer(hop, d.userAgent, hopBrowser, forward)
+		if err == nil {
+			// 每个隧道只使用一次，不复用与代理的 HTTP/2 连接
+			dialer.(*connectDialer).EnableH2ConnReuse = false
+			conn, err = d.dialHop(ctx, withTrace(d.browser.Trace, dialer, hop), forward, network, target)
+		}
+		if err != nil {
+			forward.abort()
+			return nil, &ProxyHopError{Hop: i + 1, Proxy: redactURL(hop), Target: target, Err: err}
+		}
+	}
+	return conn, nil
+}
+
+// dialHop 通过一跳代理连接 target，超时或 ctx 取消时关闭与这一跳的连接以中断握手
+//
+// 建立好的隧道不能绑定 ctx：经 HTTP/2 代理时 CONNECT 是一个随请求 context 取消而重置的流，
+// 所以 ctx 只用于中断建立过程，传给 dialer 的 context 不会被取消
+func (d *chainDialer) dialHop(ctx context.Context, dialer proxy.ContextDialer, forward *hopForward, network, target string) (net.Conn, error) {
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	forward.setup = ctx
+	stop := context.AfterFunc(ctx, forward.abort)
+	conn, err := dialer.DialContext(context.WithoutCancel(ctx), network, target)
+	if !stop() {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, ctx.Err()
+	}
+	return conn, err
+}
+
+// dialPacket 代理链只能转发 TCP，HTTP/3 不能经过代理链，也不能绕过它直连
+func (d *chainDialer) dialPacket(context.Context, string) (net.PacketConn, net.Addr, error) {
+	return nil, nil, errors.New("代理链不支持转发 UDP")
+}
+
+// hopForward 是代理链中一跳连接代理使用的 dialer，第一跳通过 dialer 连接，之后的跳返回上一跳的隧道
+type hopForward struct {
+	dialer proxy.ContextDialer
+	tunnel net.Conn
+	setup  context.Context // 建立这一跳的 context，第一跳用它连接代理，超时或取消时中断 TCP 连接
+
+	mu      sync.Mutex
+	conn    net.Conn
+	aborted bool
+}
+
+func (f *hopForward) Dial(network, addr string) (net.Conn, error) {
+	return f.DialContext(context.Background(), network, addr)
+}
+
+func (f *hopForward) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn := f.tunnel
+	if conn == nil {
+		if f.setup != nil {
+			ctx = f.setup
+		}
+		var err error
+		if conn, err = f.dialer.DialContext(ctx, network, addr); err != nil {
+			return nil, err
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.aborted || f.conn != nil {
+		conn.Close()
+		return nil, errors.New("代理链的隧道已关闭")
+	}
+	f.conn = conn
+	return conn, nil
+}
+
+// abort 关闭这一跳使用的连接
+func (f *hopForward) abort() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aborted = true
+	if f.conn != nil {
+		f.conn.Close()
+	} else if f.tunnel != nil {
+		f.tunnel.Close()
+	}
+}
+
+// proxyForward 返回连接代理或目标使用的 dialer，设置了 ProxyChain 时经过代理链
+func proxyForward(browser browser, userAgent string, forward proxy.ContextDialer) (proxy.ContextDialer, error) {
+	if len(browser.ProxyChain) == 0 {
+		return forward, nil
+	}
+	return newChainDialer(browser.ProxyChain, userAgent, browser, forward)
+}
@@ -0,0 +1,499 @@
+package fastls
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mrand "math/rand/v2"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 代理池的默认值
+const (
+	defaultProxyMaxFailures  = 3
+	defaultProxyCooldown     = time.Minute
+	defaultProxyCheckTimeout = 5 * time.Second
+	defaultProxyStickyTTL    = 10 * time.Minute
+)
+
+// proxySessionPlaceholder 代理 URL 中替换为会话 ID 的占位符
+const proxySessionPlaceholder = "{session}"
+
+// ErrNoProxyAvailable 代理池中的代理都在冷却中
+var ErrNoProxyAvailable = errors.New("代理池中没有可用的代理")
+
+// ProxyStrategy 代理池选择代理的策略
+type ProxyStrategy string
+
+const (
+	ProxyRoundRobin    ProxyStrategy = "roundRobin"    // 依次轮换，默认策略
+	ProxyRandom        ProxyStrategy = "random"        // 随机选择
+	ProxyLeastFailures ProxyStrategy = "leastFailures" // 选择失败次数最少的代理
+	ProxyStickySession ProxyStrategy = "stickySession" // 同一 Options.ProxySession 使用相同的代理，未设置会话时依次轮换
+	ProxyStickyHost    ProxyStrategy = "stickyHost"    // 同一目标 host 使用相同的代理
+)
+
+// ProxyPool 按策略轮换的代理池，需在请求间复用
+//
+// 每次尝试（包括重试）从池中选择一个代理，请求出现网络错误时记为失败，连续失败 MaxFailures 次的代理
+// 在 Cooldown 内不再使用；冷却结束后在后台做一次健康检查，通过后重新使用，只有没有其他可用代理时请求才等待检查结果。
+// HealthCheckInterval 大于 0 时还会在后台定期检查所有代理。粘性策略的绑定空闲 StickyTTL 后失效。
+// 代理 URL 中的 {session} 替换为 Options.ProxySession，未设置时每次选择生成随机 ID，用于住宅代理网关的会话用户名。
+// 字段在第一次使用后不能再修改
+type ProxyPool struct {
+	Proxies             []string      // 代理 URL，没有协议时为 http://，也支持 host:port:user:pass
+	Strategy            ProxyStrategy // 选择策略，为空时为 roundRobin
+	MaxFailures         int           // 连续失败多少次后进入冷却，为 0 时为 3
+	Cooldown            time.Duration // 冷却时间，为 0 时为 1 分钟
+	HealthCheckURL      string        // 健康检查通过代理请求的 URL，为空时只检查能否连接代理
+	HealthCheckInterval time.Duration // 后台健康检查的间隔，为 0 时只在冷却结束后检查
+	HealthCheckTimeout  time.Duration // 健康检查的超时时间，为 0 时为 5 秒
+	StickyTTL           time.Duration // 粘性绑定空闲多久后失效，为 0 时为 10 分钟
+
+	once    sync.Once
+	err     error
+	stop    chan struct{}
+	mu      sync.Mutex
+	entries []*proxyEntry
+	next    int
+	sticky  map[string]*proxyBinding
+	swept   time.Time     // 上次清理过期粘性绑定的时间
+	probing chan struct{} // 最近一批冷却结束检查完成时关闭
+}
+
+// ProxyStats 代理池中一个代理的统计
+type ProxyStats struct {
+	Proxy               string    // 隐藏密码后的代理 URL
+	Requests            int64     // 使用次数
+	Successes           int64     // 收到响应的次数
+	Failures            int64     // 网络错误次数
+	ConsecutiveFailures int       // 连续失败次数
+	Ejected             bool      // 是否在冷却中
+	EjectedUntil        time.Time // 冷却结束时间
+	LastError           string    // 最近一次请求或健康检查的错误
+	LastUsed            time.Time // 最近一次使用时间
+}
+
+// proxyEntry 代理池中的一个代理，字段由 ProxyPool.mu 保护
+type proxyEntry struct {
+	raw          string // 规范化后的 URL，可能包含 {session}
+	requests     int64
+	successes    int64
+	failures     int64
+	consecutive  int
+	ejectedUntil time.Time
+	checking     bool
+	lastError    string
+	lastUsed     time.Time
+}
+
+// proxyBinding 粘性策略下会话或 host 绑定的代理
+type proxyBinding struct {
+	entry    *proxyEntry
+	session  string
+	lastUsed time.Time
+}
+
+// LoadProxies 从文件读取代理列表，每行一个，忽略空行和 # 开头的注释
+func LoadProxies(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开代理列表失败: %w", err)
+	}
+	defer f.Close()
+	var proxies []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxies = append(proxies, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取代理列表失败: %w", err)
+	}
+	return proxies, nil
+}
+
+// normalizeProxy 补全协议，并将 host:port:user:pass 转换为 URL
+func normalizeProxy(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "://") {
+		if parts := strings.Split(s, ":"); len(parts) == 4 {
+			user := url.UserPassword(parts[2], parts[3]).String()
+			user = strings.ReplaceAll(user, url.PathEscape(proxySessionPlaceholder), proxySessionPlaceholder)
+			s = user + "@" + net.JoinHostPort(parts[0], parts[1])
+		}
+		s = "http://" + s
+	}
+	if _, err := url.Parse(strings.ReplaceAll(s, proxySessionPlaceholder, "session")); err != nil {
+		return "", fmt.Errorf("无效的代理 %q: %w", redactProxy(s), err)
+	}
+	return s, nil
+}
+
+// redactProxy 隐藏代理 URL 中的密码，保留 {session} 占位符
+func redactProxy(raw string) string {
+	const marker = "SESSIONPLACEHOLDER"
+	redacted := redactURL(strings.ReplaceAll(raw, proxySessionPlaceholder, marker))
+	return strings.ReplaceAll(redacted, marker, proxySessionPlaceholder)
+}
+
+// proxyURL 返回替换了会话 ID 的代理 URL
+func (e *proxyEntry) proxyURL(session string) string {
+	return strings.ReplaceAll(e.raw, proxySessionPlaceholder, url.QueryEscape(session))
+}
+
+// init 解析代理列表并启动后台健康检查，只在第一次使用时执行
+func (p *ProxyPool) init() error {
+	p.once.Do(func() {
+		for _, s := range p.Proxies {
+			raw, err := normalizeProxy(s)
+			if err != nil {
+				p.err = err
+				return
+			}
+			p.entries = append(p.entries, &proxyEntry{raw: raw})
+		}
+		if len(p.entries) == 0 {
+			p.err = errors.New("代理池为空")
+			return
+		}
+		p.sticky = make(map[string]*proxyBinding)
+		p.stop = make(chan struct{})
+		if p.HealthCheckInterval > 0 {
+			go p.checkLoop()
+		}
+	})
+	return p.err
+}
+
+// Close 停止后台健康检查
+func (p *ProxyPool) Close() {
+	p.init()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
+
+// Stats 返回每个代理的统计，顺序与 Proxies 相同
+func (p *ProxyPool) Stats() []ProxyStats {
+	p.init()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]ProxyStats, 0, len(p.entries))
+	for _, e := range p.entries {
+		stats = append(stats, ProxyStats{
+			Proxy:               redactProxy(e.raw),
+			Requests:            e.requests,
+			Successes:           e.successes,
+			Failures:            e.failures,
+			ConsecutiveFailures: e.consecutive,
+			Ejected:             !e.ejectedUntil.IsZero(),
+			EjectedUntil:        e.ejectedUntil,
+			LastError:           e.lastError,
+			LastUsed:            e.lastUsed,
+		})
+	}
+	return stats
+}
+
+// pick 为会话 session 和目标 host 选择代理，返回代理和替换了会话 ID 的 URL
+//
+// 冷却结束的代理在后台检查，只有没有其他可用代理时才等待检查完成
+func (p *ProxyPool) pick(ctx context.Context, session, host string) (*proxyEntry, string, error) {
+	if err := p.init(); err != nil {
+		return nil, "", err
+	}
+	p.probeExpired()
+
+	p.mu.Lock()
+	e, proxyURL, err := p.pickLocked(session, host)
+	probing := p.probing
+	p.mu.Unlock()
+	if err == nil || probing == nil {
+		return e, proxyURL, err
+	}
+	select {
+	case <-probing:
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pickLocked(session, host)
+}
+
+// pickLocked 按策略选择代理，调用时需持有 p.mu
+func (p *ProxyPool) pickLocked(session, host string) (*proxyEntry, string, error) {
+	now := time.Now()
+	p.sweepSticky(now)
+	key := ""
+	switch p.Strategy {
+	case ProxyStickySession:
+		key = session
+	case ProxyStickyHost:
+		key = strings.ToLower(host)
+	}
+	if binding := p.sticky[key]; key != "" && binding != nil && binding.entry.ejectedUntil.IsZero() {
+		binding.entry.use()
+		binding.lastUsed = now
+		return binding.entry, binding.entry.proxyURL(binding.session), nil
+	}
+
+	e := p.choose()
+	if e == nil {
+		return nil, "", ErrNoProxyAvailable
+	}
+	e.use()
+	if session == "" || p.Strategy == ProxyStickyHost {
+		session = randomSessionID()
+	}
+	if key != "" {
+		p.sticky[key] = &proxyBinding{entry: e, session: session, lastUsed: now}
+	}
+	return e, e.proxyURL(session), nil
+}
+
+// sweepSticky 删除空闲超过 StickyTTL 的粘性绑定，每个 StickyTTL 最多清理一次，调用时需持有 p.mu
+func (p *ProxyPool) sweepSticky(now time.Time) {
+	ttl := p.StickyTTL
+	if ttl <= 0 {
+		ttl = defaultProxyStickyTTL
+	}
+	if now.Sub(p.swept) < ttl {
+		return
+	}
+	p.swept = now
+	for key, binding := range p.sticky {
+		if now.Sub(binding.lastUsed) >= ttl {
+			delete(p.sticky, key)
+		}
+	}
+}
+
+// choose 按策略从不在冷却中的代理里选择一个，调用时需持有 p.mu
+func (p *ProxyPool) choose() *proxyEntry {
+	var available []*proxyEntry
+	for _, e := range p.entries {
+		if e.ejectedUntil.IsZero() {
+			available = append(available, e)
+		}
+	}
+	if len(available) == 0 {
+		return nil
+	}
+	switch p.Strategy {
+	case ProxyRandom:
+		return available[mrand.IntN(len(available))]
+	case ProxyLeastFailures:
+		best := available[0]
+		for _, e := range available[1:] {
+			if e.failures < best.failures || e.failures == best.failures && e.requests < best.requests {
+				best = e
+			}
+		}
+		return best
+	}
+	for i := range p.entries {
+		e := p.entries[(p.next+i)%len(p.entries)]
+		if e.ejectedUntil.IsZero() {
+			p.next = (p.next + i + 1) % len(p.entries)
+			return e
+		}
+	}
+	return nil
+}
+
+func (e *proxyEntry) use() {
+	e.requests++
+	e.lastUsed = time.Now()
+}
+
+// report 记录使用 e 的请求结果，err 为网络错误，连续失败 MaxFailures 次后进入冷却。取消的请求不计入
+func (p *ProxyPool) report(e *proxyEntry, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		e.successes++
+		e.consecutive = 0
+		return
+	}
+	e.failures++
+	e.consecutive++
+	e.lastError = err.Error()
+	maxFailures := p.MaxFailures
+	if maxFailures <= 0 {
+		maxFailures = defaultProxyMaxFailures
+	}
+	if e.consecutive >= maxFailures {
+		p.eject(e)
+	}
+}
+
+// eject 使 e 进入冷却，调用时需持有 p.mu
+func (p *ProxyPool) eject(e *proxyEntry) {
+	cooldown := p.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultProxyCooldown
+	}
+	e.ejectedUntil = time.Now().Add(cooldown)
+}
+
+// probeExpired 在后台检查冷却结束的代理，通过检查的代理重新使用，否则继续冷却
+func (p *ProxyPool) probeExpired() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var expired []*proxyEntry
+	now := time.Now()
+	for _, e := range p.entries {
+		if !e.ejectedUntil.IsZero() && !e.ejectedUntil.After(now) && !e.checking {
+			e.checking = true
+			expired = append(expired, e)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	// 检查由所有请求共享，不随发起检查的请求取消
+	done := make(chan struct{})
+	p.probing = done
+	go func() {
+		p.checkAll(context.Background(), expired)
+		p.mu.Lock()
+		if p.probing == done {
+			p.probing = nil
+		}
+		p.mu.Unlock()
+		close(done)
+	}()
+}
+
+// checkLoop 每隔 HealthCheckInterval 检查所有代理，直到 Close
+func (p *ProxyPool) checkLoop() {
+	ticker := time.NewTicker(p.HealthCheckInterval)
+	defer ticker.Stop()
+	p.mu.Lock()
+	stop := p.stop
+	p.mu.Unlock()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		var entries []*proxyEntry
+		for _, e := range p.entries {
+			if !e.checking {
+				e.checking = true
+				entries = append(entries, e)
+			}
+		}
+		p.mu.Unlock()
+		p.checkAll(context.Background(), entries)
+	}
+}
+
+// checkAll 同时检查 entries，通过检查的代理结束冷却，失败的代理进入冷却
+func (p *ProxyPool) checkAll(ctx context.Context, entries []*proxyEntry) {
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.check(ctx, e.proxyURL(randomSessionID()))
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			e.checking = false
+			if err != nil {
+				e.lastError = err.Error()
+				p.eject(e)
+				return
+			}
+			e.consecutive = 0
+			e.ejectedUntil = time.Time{}
+		}()
+	}
+	wg.Wait()
+}
+
+// defaultProxyPorts 代理 URL 没有端口时使用的端口
+var defaultProxyPorts = map[string]string{
+	"http":    "80",
+	"https":   "443",
+	"socks4":  "1080",
+	"socks4a": "1080",
+	"socks5":  "1080",
+	"socks5h": "1080",
+}
+
+// check 检查代理是否可用，设置了 HealthCheckURL 时通过代理请求它，否则只连接代理
+func (p *ProxyPool) check(ctx context.Context, proxyURL string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := p.HealthCheckTimeout
+	if timeout <= 0 {
+		timeout = defaultProxyCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if p.HealthCheckURL == "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return err
+		}
+		addr := u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), defaultProxyPorts[u.Scheme])
+		}
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return fmt.Errorf("健康检查连接代理失败: %w", err)
+		}
+		return conn.Close()
+	}
+
+	resp, err := NewClient().Do(p.HealthCheckURL, Options{Proxy: proxyURL, Context: ctx}, "GET")
+	if err != nil {
+		return fmt.Errorf("健康检查请求失败: %w", err)
+	}
+	resp.Body.Close()
+	if resp.Status >= 400 {
+		return fmt.Errorf("健康检查返回状态码 %d", resp.Status)
+	}
+	return nil
+}
+
+// hostOf 返回 URL 的 host，解析失败时返回空字符串
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// randomSessionID 生成代理网关的随机会话 ID
+func randomSessionID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,262 @@
+package fastls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/FastTLS/fastls/internal/pac"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// ProxyFunc 按请求 URL 返回依次尝试的代理，空字符串或 "direct" 表示直连，返回空列表时直连
+//
+// 连接代理失败时尝试下一个，WebSocket 的 ws 和 wss 按 http 和 https 传入
+type ProxyFunc func(u *url.URL) ([]string, error)
+
+// ProxyFromEnvironment 返回按 HTTP_PROXY、HTTPS_PROXY、ALL_PROXY 和 NO_PROXY（及小写形式）选择代理的 ProxyFunc
+//
+// 环境变量在调用时读取。NO_PROXY 支持域名后缀（example.com 和 .example.com）、带端口的 host、CIDR 和 *；
+// 与 Go 标准库一样，localhost 和回环地址总是直连
+func ProxyFromEnvironment() ProxyFunc {
+	cfg := httpproxy.FromEnvironment()
+	all := getEnvAny("ALL_PROXY", "all_proxy")
+	if cfg.HTTPProxy == "" {
+		cfg.HTTPProxy = all
+	}
+	if cfg.HTTPSProxy == "" {
+		cfg.HTTPSProxy = all
+	}
+	find := cfg.ProxyFunc()
+	return func(u *url.URL) ([]string, error) {
+		proxyURL, err := find(u)
+		if err != nil || proxyURL == nil {
+			return nil, err
+		}
+		return []string{proxyURL.String()}, nil
+	}
+}
+
+func getEnvAny(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ProxyFromPAC 返回执行 PAC 脚本的 FindProxyForURL 选择代理的 ProxyFunc，resolver 为空时使用系统 DNS
+//
+// 内置解释器支持 PAC 文件常用的 JavaScript 子集和全部 PAC 辅助函数。PROXY 和 HTTPS 对应 http 和 https 代理，
+// SOCKS 和 SOCKS4 对应 socks4，SOCKS5 对应由代理解析域名的 socks5h，DIRECT 表示直连
+func ProxyFromPAC(script string, resolver Resolver) (ProxyFunc, error) {
+	compiled, err := pac.Compile(script, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return func(u *url.URL) ([]string, error) {
+		result, err := compiled.FindProxy(context.Background(), u)
+		if err != nil {
+			return nil, err
+		}
+		return pac.ParseResult(result)
+	}, nil
+}
+
+// LoadPAC 从文件路径或 http(s) URL 读取 PAC 脚本，返回与 ProxyFromPAC 相同的 ProxyFunc
+func LoadPAC(location string, resolver Resolver) (ProxyFunc, error) {
+	var script []byte
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		resp, err := NewClient().Do(location, Options{Resolver: resolver}, "GET")
+		if err != nil {
+			return nil, fmt.Errorf("下载 PAC 文件失败: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.Status != 200 {
+			return nil, fmt.Errorf("下载 PAC 文件失败: 状态码 %d", resp.Status)
+		}
+		if script, err = io.ReadAll(resp.Body); err != nil {
+			return nil, fmt.Errorf("下载 PAC 文件失败: %w", err)
+		}
+	} else {
+		var err error
+		if script, err = os.ReadFile(location); err != nil {
+			return nil, fmt.Errorf("读取 PAC 文件失败: %w", err)
+		}
+	}
+	return ProxyFromPAC(string(script), resolver)
+}
+
+// requestURLKey 在 context 中保存请求 URL，按 URL 选择代理的 dialer 使用它
+type requestURLKey struct{}
+
+// withRequestURL 返回保存了请求 URL 的 context
+func withRequestURL(ctx context.Context, u *url.URL) context.Context {
+	return context.WithValue(ctx, requestURLKey{}, u)
+}
+
+// requestURL 返回 context 中的请求 URL，没有时按端口推断 addr 的协议
+func requestURL(ctx context.Context, addr string) *url.URL {
+	if u, ok := ctx.Value(requestURLKey{}).(*url.URL); ok && u != nil {
+		selected := *u
+		switch selected.Scheme {
+		case "ws":
+			selected.Scheme = "http"
+		case "wss":
+			selected.Scheme = "https"
+		}
+		return &selected
+	}
+	scheme := "https"
+	if _, port, _ := net.SplitHostPort(addr); port == "80" {
+		scheme = "http"
+	}
+	return &url.URL{Scheme: scheme, Host: addr, Path: "/"}
+}
+
+// selectDialer 按请求 URL 调用 ProxyFunc 选择代理，依次尝试返回的代理直到连接成功
+type selectDialer struct {
+	proxyFunc ProxyFunc
+	userAgent string
+	browser   browser
+	forward   proxy.ContextDialer // 直连和连接代理使用的 dialer
+
+	mu      sync.Mutex
+	dialers map[string]proxy.ContextDialer
+}
+
+// newSelectDialer 创建按 proxyFunc 选择代理的 dialer，forward 用于直连和连接代理
+func newSelectDialer(proxyFunc ProxyFunc, userAgent string, browser browser, forward proxy.ContextDialer) *selectDialer {
+	return &selectDialer{
+		proxyFunc: proxyFunc,
+		userAgent: userAgent,
+		browser:   browser,
+		forward:   forward,
+		dialers:   make(map[string]proxy.ContextDialer),
+	}
+}
+
+// proxies 返回连接 addr 时依次尝试的代理，空字符串表示直连
+func (d *selectDialer) proxies(ctx context.Context, addr string) ([]string, error) {
+	proxies, err := d.proxyFunc(requestURL(ctx, addr))
+	if err != nil {
+		return nil, fmt.Errorf("选择代理失败: %w", err)
+	}
+	if len(proxies) == 0 {
+		return []string{""}, nil
+	}
+	for i, p := range proxies {
+		if strings.EqualFold(p, "direct") {
+			proxies[i] = ""
+		}
+	}
+	return proxies, nil
+}
+
+// dialer 返回连接 proxyURL 的 dialer，每个代理只创建一次
+func (d *selectDialer) dialer(proxyURL string) (proxy.ContextDialer, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dialer, ok := d.dialers[proxyURL]; ok {
+		return dialer, nil
+	}
+	dialer := d.forward
+	if proxyURL != "" {
+		var err error
+		if dialer, err = newConnectDialer(proxyURL, d.userAgent, d.browser, d.forward); err != nil {
+			return nil, err
+		}
+	}
+	dialer = withTrace(d.browser.Trace, dialer, proxyURL)
+	d.dialers[proxyURL] = dialer
+	return dialer, nil
+}
+
+func (d *selectDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *selectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	proxies, err := d.proxies(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, proxyURL := range proxies {
+		dialer, err := d.dialer(proxyURL)
+		if err == nil {
+			var conn net.Conn
+			if conn, err = dialer.DialContext(ctx, network, addr); err == nil {
+				return conn, nil
+			}
+		}
+		if len(proxies) == 1 {
+			return nil, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", proxyLabel(proxyURL), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("所有代理都连接失败: %w", errors.Join(errs...))
+}
+
+// dialPacket 为 HTTP/3 选择代理，直连时直接建立 UDP 连接，socks5 代理使用 UDP ASSOCIATE，其他代理使用 MASQUE CONNECT-UDP
+func (d *selectDialer) dialPacket(ctx context.Context, addr string) (net.PacketConn, net.Addr, error) {
+	proxies, err := d.proxies(ctx, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	var errs []error
+	for _, proxyURL := range proxies {
+		conn, udpAddr, err := d.dialPacketVia(ctx, proxyURL, addr)
+		if err == nil {
+			return conn, udpAddr, nil
+		}
+		if len(proxies) == 1 {
+			return nil, nil, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", proxyLabel(proxyURL), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, nil, fmt.Errorf("所有代理都连接失败: %w", errors.Join(errs...))
+}
+
+func (d *selectDialer) dialPacketVia(ctx context.Context, proxyURL, addr string) (net.PacketConn, net.Addr, error) {
+	if proxyURL == "" {
+		if chain, ok := d.forward.(*chainDialer); ok {
+			return chain.dialPacket(ctx, addr)
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		return dialDirectUDP(ctx, d.browser.Resolver, d.browser.Source, host, port)
+	}
+	dialer, err := d.dialer(proxyURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if traced, ok := dialer.(*traceDialer); ok {
+		dialer = traced.dialer
+	}
+	return dialer.(*connectDialer).packetDialer().dialPacket(ctx, addr)
+}
+
+// proxyLabel 返回错误信息中的代理名称，隐藏密码
+func proxyLabel(proxyURL string) string {
+	if proxyURL == "" {
+		return "DIRECT"
+	}
+	return redactURL(proxyURL)
+}
@@ -0,0 +1,451 @@
+package fastls
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	stdhttp "net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	http "github.com/FastTLS/fhttp"
+	"golang.org/x/net/publicsuffix"
+)
+
+// 重定向模式，与 fetch 的 redirect 选项一致
+const (
+	RedirectFollow = "follow" // 按浏览器规则跟随重定向（默认）
+	RedirectManual = "manual" // 不跟随，直接返回 3xx 响应
+	RedirectError  = "error"  // 收到重定向时返回错误
+)
+
+// defaultMaxRedirects Chrome 和 Firefox 的最大重定向次数
+const defaultMaxRedirects = 20
+
+// ErrTooManyRedirects 重定向次数超过 RedirectPolicy.MaxRedirects
+var ErrTooManyRedirects = errors.New("重定向次数过多")
+
+// ErrRedirectNotAllowed RedirectPolicy.Mode 为 error 时收到重定向
+var ErrRedirectNotAllowed = errors.New("重定向模式为 error，不允许重定向")
+
+// RedirectPolicy 重定向策略，零值按浏览器规则最多跟随 20 次
+type RedirectPolicy struct {
+	Mode           string `json:"mode"`           // follow、manual 或 error，为空时为 follow
+	MaxRedirects   int    `json:"maxRedirects"`   // 最大重定向次数，为 0 时为 20
+	ReferrerPolicy string `json:"referrerPolicy"` // 初始 Referrer-Policy，为空时为 strict-origin-when-cross-origin
+}
+
+// RedirectHop 重定向链中的一跳
+type RedirectHop struct {
+	Status         int         // 重定向响应的状态码
+	Method         string      // 本跳请求的方法
+	URL            string      // 本跳请求的 URL
+	Location       string      // 解析后的重定向目标
+	RequestHeaders http.Header // 本跳发送的请求头
+	Headers        http.Header // 重定向响应的响应头
+}
+
+// redirectBodyHeaders 方法改为 GET 丢弃请求体时一并删除的请求头（fetch 规范的 request-body-header name）
+var redirectBodyHeaders = []string{"Content-Encoding", "Content-Language", "Content-Location", "Content-Type", "Content-Length"}
+
+// redirectSensitiveHeaders 跨 origin 重定向时删除的请求头
+var redirectSensitiveHeaders = []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2"}
+
+// isRedirect 判断状态码是否为重定向
+func isRedirect(status int) bool {
+	switch status {
+	case 301, 302, 303, 307, 308:
+		return true
+	}
+	return false
+}
+
+// redirectChain 跟随重定向时需要在各跳之间保持的状态
+type redirectChain struct {
+	policy         RedirectPolicy
+	referrerPolicy string
+	referrer       *url.URL // 发起请求的页面，来自最初的 Referer
+	initiator      *url.URL // 计算 Sec-Fetch-Site 的发起方 origin
+	originTainted  bool
+	jar            *cookiejar.Jar
+	cookieKey      string     // 调用方使用的 Cookie 请求头大小写
+	callerCookies  [][]string // 调用方在请求头中设置的 Cookie，每个请求头值一组，跨 origin 后不再发送
+	hops           []RedirectHop
+}
+
+func newRedirectChain(policy RedirectPolicy, req *http.Request) *redirectChain {
+	c := &redirectChain{policy: policy, referrerPolicy: policy.ReferrerPolicy}
+	if c.policy.MaxRedirects == 0 {
+		c.policy.MaxRedirects = defaultMaxRedirects
+	}
+	if c.referrerPolicy == "" {
+		c.referrerPolicy = "strict-origin-when-cross-origin"
+	}
+	if ref, err := url.Parse(headerValue(req.Header, "Referer")); err == nil && ref.Host != "" {
+		c.referrer = ref
+	}
+	if origin, err := url.Parse(headerValue(req.Header, "Origin")); err == nil && origin.Host != "" {
+		c.initiator = origin
+	} else if c.referrer != nil {
+		c.initiator = c.referrer
+	} else {
+		c.initiator = req.URL
+	}
+	c.jar, _ = cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	c.cookieKey = "Cookie"
+	for k, values := range req.Header {
+		if !strings.EqualFold(k, "Cookie") {
+			continue
+		}
+		c.cookieKey = k
+		for _, v := range values {
+			var pairs []string
+			for _, pair := range strings.Split(v, ";") {
+				if pair = strings.TrimSpace(pair); pair != "" {
+					pairs = append(pairs, pair)
+				}
+			}
+			c.callerCookies = append(c.callerCookies, pairs)
+		}
+	}
+	return c
+}
+
+// doWithRedirects 发送请求并按 RedirectPolicy 跟随重定向，返回最终响应和重定向历史
+func (res *requestContext) doWithRedirects() (*http.Response, []RedirectHop, error) {
+	policy := res.options.Redirect
+	if res.options.DisableRedirect {
+		policy.Mode = RedirectManual
+	}
+	chain := newRedirectChain(policy, res.req)
+
+	req := res.req
+	for {
+		resp, err := res.client.Do(req)
+		if err != nil {
+			return nil, chain.hops, err
+		}
+		res.rememberClientHints(resp)
+
+		if !isRedirect(resp.StatusCode) || chain.policy.Mode == RedirectManual {
+			return resp, chain.hops, nil
+		}
+		location := headerValue(resp.Header, "Location")
+		if location == "" {
+			return resp, chain.hops, nil
+		}
+		if chain.policy.Mode == RedirectError {
+			return resp, chain.hops, fmt.Errorf("%w: %d %s", ErrRedirectNotAllowed, resp.StatusCode, location)
+		}
+		target, err := req.URL.Parse(location)
+		if err != nil {
+			return resp, chain.hops, fmt.Errorf("无效的重定向地址 %q: %w", location, err)
+		}
+		if target.Scheme != "http" && target.Scheme != "https" {
+			return resp, chain.hops, fmt.Errorf("不支持重定向到 %s", target.Redacted())
+		}
+
+		chain.hops = append(chain.hops, RedirectHop{
+			Status:         resp.StatusCode,
+			Method:         req.Method,
+			URL:            req.URL.String(),
+			Location:       target.String(),
+			RequestHeaders: redirectRequestHeaders(req.Header),
+			Headers:        resp.Header,
+		})
+		if len(chain.hops) > chain.policy.MaxRedirects {
+			return resp, chain.hops, fmt.Errorf("%w: 超过 %d 次", ErrTooManyRedirects, chain.policy.MaxRedirects)
+		}
+
+		// 读完并关闭重定向响应的响应体，以便复用连接
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 2<<10))
+		resp.Body.Close()
+
+		req, err = chain.next(req, resp, target, res.options.ClientHints)
+		if err != nil {
+			return nil, chain.hops, err
+		}
+	}
+}
+
+// next 按 fetch 规范构造重定向后的请求
+func (c *redirectChain) next(prev *http.Request, resp *http.Response, target *url.URL, hints *ClientHints) (*http.Request, error) {
+	method := prev.Method
+	keepBody := true
+	// 301/302 上的 POST 和 303 上的非 GET/HEAD 请求改为不带请求体的 GET
+	if ((resp.StatusCode == 301 || resp.StatusCode == 302) && method == "POST") ||
+		(resp.StatusCode == 303 && method != "GET" && method != "HEAD") {
+		method = "GET"
+		keepBody = false
+	}
+
+	// 307/308 必须原样重发请求体，不能重建时返回错误而不是发送空的请求体
+	if keepBody && prev.GetBody == nil && prev.Body != nil && prev.Body != http.NoBody {
+		return nil, fmt.Errorf("%d 重定向需要重新发送请求体: %w", resp.StatusCode, ErrBodyNotReplayable)
+	}
+	var body io.ReadCloser
+	if keepBody && prev.GetBody != nil {
+		var err error
+		if body, err = prev.GetBody(); err != nil {
+			return nil, fmt.Errorf("重定向时重建请求体失败: %w", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(prev.Context(), method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if keepBody {
+		req.GetBody = prev.GetBody
+		req.ContentLength = prev.ContentLength
+	}
+
+	req.Header = prev.Header.Clone()
+	h := req.Header
+	if !keepBody {
+		for _, key := range redirectBodyHeaders {
+			deleteHeaderKey(h, key)
+		}
+	}
+	crossOrigin := !sameOrigin(prev.URL, target)
+	if crossOrigin {
+		for _, key := range redirectSensitiveHeaders {
+			deleteHeaderKey(h, key)
+		}
+	}
+	setHeaderKeepCase(h, "Host", target.Host)
+
+	// 重定向响应可以更新 Referrer-Policy
+	if policy := lastReferrerPolicy(headerValue(resp.Header, "Referrer-Policy")); policy != "" {
+		c.referrerPolicy = policy
+	}
+	if c.referrer != nil {
+		if referer := referrerFor(c.referrerPolicy, c.referrer, target); referer != "" {
+			setHeaderKeepCase(h, "Referer", referer)
+		} else {
+			deleteHeaderKey(h, "Referer")
+		}
+	}
+
+	// Origin：改为 GET 的非 CORS 请求不再发送；跨 origin 跳转后发起方 origin 被污染，发送 null
+	if headerValue(h, "Origin") != "" {
+		if c.initiator != nil && !sameOrigin(c.initiator, prev.URL) && crossOrigin {
+			c.originTainted = true
+		}
+		if (method == "GET" || method == "HEAD") && !strings.EqualFold(headerValue(h, "Sec-Fetch-Mode"), "cors") {
+			deleteHeaderKey(h, "Origin")
+		} else if c.originTainted {
+			setHeaderKeepCase(h, "Origin", "null")
+		}
+	}
+
+	// Sec-Fetch-Site 取发起方与重定向链中所有 URL 关系中最远的一个
+	if site := headerValue(h, "Sec-Fetch-Site"); site != "" && site != FetchSiteNone {
+		setHeaderKeepCase(h, "Sec-Fetch-Site", widerFetchSite(site, fetchSiteOf(c.initiator, target)))
+	}
+
+	if hints != nil {
+		for k := range h {
+			if strings.HasPrefix(strings.ToLower(k), "sec-ch-ua") {
+				delete(h, k)
+			}
+		}
+		for hint, value := range hints.Headers(urlOrigin(target)) {
+			h[hint] = []string{value}
+		}
+	}
+
+	// 与浏览器一样，重定向链中设置的 Cookie 用于后续各跳。上一跳的 Cookie 请求头已经包含传输层添加的
+	// Options.Cookies，每跳都重新生成，避免重复发送。与第一个请求相同，调用方的每个 Cookie 值单独保留，
+	// HTTP/2 和 HTTP/3 下分别发送，HTTP/1.1 下由传输层合并为一行
+	c.jar.SetCookies(prev.URL, (&stdhttp.Response{Header: stdhttp.Header(resp.Header)}).Cookies())
+	if crossOrigin {
+		c.callerCookies = nil
+	}
+	deleteHeaderKey(h, "Cookie")
+	if cookies := c.cookieValues(target); len(cookies) > 0 {
+		h[c.cookieKey] = cookies
+	}
+	return req, nil
+}
+
+// cookieValues 返回发送到 target 的 Cookie 请求头值：调用方设置的每个 Cookie 值，之后是重定向链中设置的 Cookie，
+// 同名时使用后者
+func (c *redirectChain) cookieValues(target *url.URL) []string {
+	jarCookies := c.jar.Cookies(target)
+	set := make(map[string]bool, len(jarCookies))
+	for _, cookie := range jarCookies {
+		set[cookie.Name] = true
+	}
+	values := make([]string, 0, len(c.callerCookies)+1)
+	for _, group := range c.callerCookies {
+		pairs := make([]string, 0, len(group))
+		for _, pair := range group {
+			name, _, _ := strings.Cut(pair, "=")
+			if !set[strings.TrimSpace(name)] {
+				pairs = append(pairs, pair)
+			}
+		}
+		if len(pairs) > 0 {
+			values = append(values, strings.Join(pairs, "; "))
+		}
+	}
+	if len(jarCookies) > 0 {
+		pairs := make([]string, 0, len(jarCookies))
+		for _, cookie := range jarCookies {
+			pairs = append(pairs, cookie.Name+"="+cookie.Value)
+		}
+		values = append(values, strings.Join(pairs, "; "))
+	}
+	return values
+}
+
+// redirectRequestHeaders 返回记录在重定向历史中的请求头，去掉 fhttp 的顺序键
+func redirectRequestHeaders(h http.Header) http.Header {
+	clone := h.Clone()
+	delete(clone, http.HeaderOrderKey)
+	delete(clone, http.PHeaderOrderKey)
+	return clone
+}
+
+// headerValue 不区分大小写地读取第一个请求头值
+func headerValue(h map[string][]string, key string) string {
+	for k, v := range h {
+		if strings.EqualFold(k, key) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// deleteHeaderKey 不区分大小写地删除请求头
+func deleteHeaderKey(h map[string][]string, key string) {
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			delete(h, k)
+		}
+	}
+}
+
+// sameOrigin 判断两个 URL 是否同源
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(hostWithPort(a), hostWithPort(b))
+}
+
+// hostWithPort 返回带默认端口的 host
+func hostWithPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if strings.EqualFold(u.Scheme, "https") {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// sameSite 判断两个 URL 是否同站（schemeful same-site）
+func sameSite(a, b *url.URL) bool {
+	if !strings.EqualFold(a.Scheme, b.Scheme) {
+		return false
+	}
+	return registrableDomain(a.Hostname()) == registrableDomain(b.Hostname())
+}
+
+// registrableDomain 返回 host 的可注册域名，IP 和无法解析的 host 原样返回
+func registrableDomain(host string) string {
+	host = strings.ToLower(host)
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// fetchSiteOf 返回从 initiator 发起到 target 的 Sec-Fetch-Site
+func fetchSiteOf(initiator, target *url.URL) string {
+	switch {
+	case initiator == nil:
+		return FetchSiteCrossSite
+	case sameOrigin(initiator, target):
+		return FetchSiteSameOrigin
+	case sameSite(initiator, target):
+		return FetchSiteSameSite
+	default:
+		return FetchSiteCrossSite
+	}
+}
+
+// widerFetchSite 返回两个 Sec-Fetch-Site 中范围更大的一个
+func widerFetchSite(a, b string) string {
+	rank := map[string]int{FetchSiteSameOrigin: 0, FetchSiteSameSite: 1, FetchSiteCrossSite: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// lastReferrerPolicy 返回 Referrer-Policy 中最后一个有效的策略
+func lastReferrerPolicy(value string) string {
+	policy := ""
+	for _, token := range strings.Split(value, ",") {
+		token = strings.ToLower(strings.TrimSpace(token))
+		switch token {
+		case "no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin",
+			"same-origin", "strict-origin", "strict-origin-when-cross-origin", "unsafe-url":
+			policy = token
+		}
+	}
+	return policy
+}
+
+// referrerFor 按 Referrer-Policy 计算发往 target 的 Referer，返回空字符串表示不发送
+func referrerFor(policy string, referrer, target *url.URL) string {
+	full := *referrer
+	full.Fragment = ""
+	full.RawFragment = ""
+	full.User = nil
+	origin := referrer.Scheme + "://" + referrer.Host + "/"
+	downgrade := strings.EqualFold(referrer.Scheme, "https") && !strings.EqualFold(target.Scheme, "https")
+	same := sameOrigin(referrer, target)
+
+	switch policy {
+	case "no-referrer":
+		return ""
+	case "no-referrer-when-downgrade":
+		if downgrade {
+			return ""
+		}
+		return full.String()
+	case "origin":
+		return origin
+	case "origin-when-cross-origin":
+		if same {
+			return full.String()
+		}
+		return origin
+	case "same-origin":
+		if same {
+			return full.String()
+		}
+		return ""
+	case "strict-origin":
+		if downgrade {
+			return ""
+		}
+		return origin
+	case "unsafe-url":
+		return full.String()
+	default: // strict-origin-when-cross-origin
+		if same {
+			return full.String()
+		}
+		if downgrade {
+			return ""
+		}
+		return origin
+	}
+}
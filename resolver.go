@@ -0,0 +1,315 @@
+package fastls
+
+import (
+	"context"
+	"net"
+	stdhttptrace "net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Resolver 将域名解析为 IP 地址，net.DefaultResolver 也实现了该接口
+//
+// 设置 Options.Resolver 后，直连、连接代理服务器、HTTP/3 和 WebSocket 都使用它解析域名；
+// 通过 HTTP 代理或 SOCKS5 代理访问的目标由代理解析，不会在本地查询
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// ttlResolver 可以返回记录 TTL 的 Resolver，CachingResolver 按记录的 TTL 缓存
+type ttlResolver interface {
+	lookupIPAddrTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error)
+}
+
+// StaticResolver 按固定的映射解析域名，与 curl 的 --resolve 类似
+//
+// Hosts 的 key 为域名（不区分大小写），value 为 IP 地址列表。
+// 不在 Hosts 中的域名交给 Fallback 解析，Fallback 为空时返回错误，不会发出系统 DNS 查询
+type StaticResolver struct {
+	Hosts    map[string][]string
+	Fallback Resolver
+}
+
+func (r *StaticResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	for name, ips := range r.Hosts {
+		if !strings.EqualFold(name, host) {
+			continue
+		}
+		addrs := make([]net.IPAddr, 0, len(ips))
+		for _, s := range ips {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, &net.DNSError{Err: "invalid static address " + s, Name: host}
+			}
+			addrs = append(addrs, net.IPAddr{IP: ip})
+		}
+		return addrs, nil
+	}
+	if r.Fallback != nil {
+		return r.Fallback.LookupIPAddr(ctx, host)
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// defaultCacheTTL 未设置 CachingResolver.TTL 且解析器不返回 TTL 时的缓存时间
+const defaultCacheTTL = time.Minute
+
+// CachingResolver 在进程内缓存 Resolver 的解析结果，需在请求间复用同一个实例
+//
+// DoHResolver 和 DoTResolver 按记录的 TTL 缓存，其他解析器按 TTL 缓存；同一域名同时只发出一个查询
+type CachingResolver struct {
+	Resolver Resolver      // 实际执行解析的 Resolver，为空时使用 net.DefaultResolver
+	TTL      time.Duration // 解析器不返回 TTL 时的缓存时间，为 0 时为 1 分钟
+	MaxTTL   time.Duration // 缓存时间上限，为 0 时不限制
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// cacheEntry 一个域名的缓存，done 关闭后 addrs 和 err 有效
+type cacheEntry struct {
+	done    chan struct{}
+	addrs   []net.IPAddr
+	err     error
+	expires time.Time
+}
+
+func (r *CachingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	key := strings.ToLower(host)
+	r.mu.Lock()
+	if r.entries == nil {
+		r.entries = make(map[string]*cacheEntry)
+	}
+	entry := r.entries[key]
+	if entry != nil {
+		select {
+		case <-entry.done:
+			if entry.err != nil || time.Now().After(entry.expires) {
+				entry = nil
+			}
+		default:
+		}
+	}
+	if entry == nil {
+		entry = &cacheEntry{done: make(chan struct{})}
+		r.entries[key] = entry
+		r.mu.Unlock()
+		r.resolve(host, entry)
+	} else {
+		r.mu.Unlock()
+	}
+
+	select {
+	case <-entry.done:
+		return append([]net.IPAddr(nil), entry.addrs...), entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// resolve 在后台解析 host，调用方的 context 取消不会中断其他等待同一查询的请求
+func (r *CachingResolver) resolve(host string, entry *cacheEntry) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	go func() {
+		defer close(entry.done)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		ttl := r.TTL
+		if ttl <= 0 {
+			ttl = defaultCacheTTL
+		}
+		if tr, ok := resolver.(ttlResolver); ok {
+			entry.addrs, ttl, entry.err = tr.lookupIPAddrTTL(ctx, host)
+		} else {
+			entry.addrs, entry.err = resolver.LookupIPAddr(ctx, host)
+		}
+		if r.MaxTTL > 0 && ttl > r.MaxTTL {
+			ttl = r.MaxTTL
+		}
+		entry.expires = time.Now().Add(ttl)
+	}()
+}
+
+// connectionAttemptDelay RFC 8305 建议的连接尝试间隔
+const connectionAttemptDelay = 250 * time.Millisecond
+
+// directDialer 返回不经过代理的 dialer，resolver 不为空时使用它解析域名，source 不为空时绑定源地址
+func directDialer(resolver Resolver, source *sourceAddr) proxy.ContextDialer {
+	if resolver == nil && source == nil {
+		return proxy.Direct
+	}
+	if resolver == nil {
+		// 需要先解析才能按目标地址族选择源地址
+		resolver = net.DefaultResolver
+	}
+	return &resolvingDialer{resolver: resolver, source: source}
+}
+
+// resolvingDialer 使用 Resolver 解析域名，并按 Happy Eyeballs v2（RFC 8305）在 IPv6 和 IPv4 地址间建立连接
+type resolvingDialer struct {
+	resolver Resolver
+	source   *sourceAddr
+	dialer   net.Dialer
+}
+
+func (d *resolvingDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *resolvingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return d.dialIP(ctx, network, net.IPAddr{IP: ip}, port)
+	}
+	addrs, err := lookupTraced(ctx, d.resolver, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs = sortAddrs(network, addrs)
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no suitable address found", Name: host, IsNotFound: true}
+	}
+	return dialHappyEyeballs(ctx, addrs, func(ctx context.Context, addr net.IPAddr) (net.Conn, error) {
+		return d.dialIP(ctx, network, addr, port)
+	})
+}
+
+// dialIP 连接 addr，设置了源地址时绑定与 addr 地址族相同的源地址
+func (d *resolvingDialer) dialIP(ctx context.Context, network string, addr net.IPAddr, port string) (net.Conn, error) {
+	dialer := d.dialer
+	if d.source != nil {
+		local, err := d.source.pick(addr.IP)
+		if err != nil {
+			return nil, err
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: local}
+	}
+	return dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+}
+
+// lookupTraced 解析 host，并触发 context 中 ClientTrace 的 DNS 回调
+func lookupTraced(ctx context.Context, resolver Resolver, host string) ([]net.IPAddr, error) {
+	trace := stdhttptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(stdhttptrace.DNSStartInfo{Host: host})
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if trace != nil && trace.DNSDone != nil {
+		trace.DNSDone(stdhttptrace.DNSDoneInfo{Addrs: addrs, Err: err})
+	}
+	return addrs, err
+}
+
+// sortAddrs 按 network 过滤地址，并以 IPv6 优先交替排列 IPv6 和 IPv4 地址
+func sortAddrs(network string, addrs []net.IPAddr) []net.IPAddr {
+	var v6, v4 []net.IPAddr
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			if !strings.HasSuffix(network, "6") {
+				v4 = append(v4, addr)
+			}
+		} else if !strings.HasSuffix(network, "4") {
+			v6 = append(v6, addr)
+		}
+	}
+	sorted := make([]net.IPAddr, 0, len(v6)+len(v4))
+	for i := 0; i < len(v6) || i < len(v4); i++ {
+		if i < len(v6) {
+			sorted = append(sorted, v6[i])
+		}
+		if i < len(v4) {
+			sorted = append(sorted, v4[i])
+		}
+	}
+	return sorted
+}
+
+// dialHappyEyeballs 按顺序发起连接，前一个连接 250ms 内未成功或失败时发起下一个，返回第一个成功的连接
+func dialHappyEyeballs(ctx context.Context, addrs []net.IPAddr, dial func(ctx context.Context, addr net.IPAddr) (net.Conn, error)) (net.Conn, error) {
+	if len(addrs) == 1 {
+		return dial(ctx, addrs[0])
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(addrs))
+	next, pending := 0, 0
+	start := func() {
+		addr := addrs[next]
+		next++
+		pending++
+		go func() {
+			conn, err := dial(ctx, addr)
+			results <- result{conn, err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(connectionAttemptDelay)
+	defer timer.Stop()
+	var firstErr error
+	for {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// 关闭其他随后成功的连接
+				go func(n int) {
+					for ; n > 0; n-- {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if next < len(addrs) {
+				start()
+				timer.Reset(connectionAttemptDelay)
+			} else if pending == 0 {
+				return nil, firstErr
+			}
+		case <-timer.C:
+			if next < len(addrs) {
+				start()
+				timer.Reset(connectionAttemptDelay)
+			}
+		}
+	}
+}
+
+// resolveUDPAddr 解析 QUIC 使用的 UDP 地址，resolver 为空时使用系统 DNS，设置了源地址时只选择有对应源地址的地址族
+func resolveUDPAddr(ctx context.Context, resolver Resolver, source *sourceAddr, host, port string) (*net.UDPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil || resolver == nil && source == nil {
+		return net.ResolveUDPAddr("udp", net.JoinHostPort(host, port))
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := lookupTraced(ctx, resolver, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range sortAddrs("udp", addrs) {
+		if source == nil || source.has(ipFamily(addr.IP)) {
+			return net.ResolveUDPAddr("udp", net.JoinHostPort(addr.String(), port))
+		}
+	}
+	return nil, &net.DNSError{Err: "no suitable address found", Name: host, IsNotFound: true}
+}
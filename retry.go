@@ -0,0 +1,165 @@
+package fastls
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	http "github.com/FastTLS/fhttp"
+)
+
+// 重试策略的默认值
+const (
+	defaultMinBackoff    = 200 * time.Millisecond
+	defaultMaxBackoff    = 10 * time.Second
+	defaultMaxRetryAfter = 60 * time.Second
+)
+
+// defaultRetryOn 未设置 RetryPolicy.RetryOn 时重试的状态码
+var defaultRetryOn = []int{429, 502, 503, 504}
+
+// RetryPolicy 重试策略，零值不重试
+//
+// 每次重试都会重新创建客户端，用新的指纹连接重新握手；请求体通过 RequestBody 重新打开
+type RetryPolicy struct {
+	MaxAttempts        int      `json:"maxAttempts"`        // 最多尝试次数（包括第一次），小于等于 1 时不重试
+	MinBackoff         int      `json:"minBackoff"`         // 第一次重试前的等待时间（毫秒），为 0 时为 200，之后每次翻倍
+	MaxBackoff         int      `json:"maxBackoff"`         // 最长等待时间（毫秒），为 0 时为 10000
+	MaxRetryAfter      int      `json:"maxRetryAfter"`      // 接受的最长 Retry-After（毫秒），超过时不再重试，为 0 时为 60000
+	RetryOn            []int    `json:"retryOn"`            // 需要重试的状态码，为空时为 429、502、503、504
+	RetryNonIdempotent bool     `json:"retryNonIdempotent"` // 是否重试 POST、PATCH 等非幂等请求
+	Proxies            []string `json:"proxies"`            // 重试时依次轮换的代理，为空时使用 Options.Proxy
+}
+
+// idempotentMethods RFC 9110 定义的幂等方法
+var idempotentMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"TRACE":   true,
+	"PUT":     true,
+	"DELETE":  true,
+}
+
+// permanentErrors 重试也不会成功的错误
+var permanentErrors = []error{
+	ErrTooManyRedirects,
+	ErrRedirectNotAllowed,
+	ErrBodyNotReplayable,
+	context.Canceled,
+}
+
+// proxyFor 返回第 attempt 次尝试使用的代理，第一次使用 Options.Proxy
+func (p RetryPolicy) proxyFor(attempt int, proxy string) string {
+	if attempt <= 1 || len(p.Proxies) == 0 {
+		return proxy
+	}
+	return p.Proxies[(attempt-2)%len(p.Proxies)]
+}
+
+// shouldRetry 判断第 attempt 次尝试后是否重试，并返回等待时间
+func (p RetryPolicy) shouldRetry(attempt int, method string, response Response, err error, retryable bool) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	if !p.RetryNonIdempotent && !idempotentMethods[strings.ToUpper(method)] {
+		return 0, false
+	}
+	if err != nil {
+		if !retryable {
+			return 0, false
+		}
+		for _, permanent := range permanentErrors {
+			if errors.Is(err, permanent) {
+				return 0, false
+			}
+		}
+		return p.backoff(attempt), true
+	}
+
+	retryOn := p.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = defaultRetryOn
+	}
+	found := false
+	for _, status := range retryOn {
+		if status == response.Status {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	if delay, ok := parseRetryAfter(response.Header.Get("Retry-After"), time.Now()); ok {
+		maxRetryAfter := millis(p.MaxRetryAfter, defaultMaxRetryAfter)
+		if delay > maxRetryAfter {
+			return 0, false
+		}
+		return delay, true
+	}
+	return p.backoff(attempt), true
+}
+
+// backoff 指数退避，在 [d/2, d] 之间随机抖动
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	minBackoff := millis(p.MinBackoff, defaultMinBackoff)
+	maxBackoff := millis(p.MaxBackoff, defaultMaxBackoff)
+	delay := minBackoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter 解析 Retry-After 的秒数或 HTTP 日期
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if delay := t.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleepContext 等待 d，ctx 取消时提前返回错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if ctx == nil {
+		time.Sleep(d)
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// millis 将毫秒数转换为 time.Duration，为 0 时使用默认值
+func millis(ms int, def time.Duration) time.Duration {
+	if ms <= 0 {
+		return def
+	}
+	return time.Duration(ms) * time.Millisecond
+}
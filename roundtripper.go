@@ -1,21 +1,23 @@
 package fastls
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"net"
+	"net/url"
 
 	"strings"
 	"sync"
 
 	stdhttp "net/http"
+	stdhttptrace "net/http/httptrace"
 
 	http "github.com/FastTLS/fhttp"
 	http2 "github.com/FastTLS/fhttp/http2"
+	"github.com/FastTLS/fhttp/httptrace"
 	utls "github.com/refraction-networking/utls"
 	"golang.org/x/net/proxy"
 )
@@ -33,16 +35,51 @@ type roundTripper struct {
 	cachedTransports  map[string]http.RoundTripper
 	http2Settings     *http2.HTTP2Settings
 
-	dialer proxy.ContextDialer
+	dialer   proxy.ContextDialer
+	resolver Resolver
+	source   *sourceAddr
+	limiter  *Limiter
+	// packetDialer 为 HTTP/3 建立 UDP 通道的代理
+	packetDialer packetDialer
+	// http3Pool 跨请求复用 HTTP/3 连接，http3Route 返回请求在连接池中的路由键
+	http3Pool  *HTTP3Pool
+	http3Route func(u *url.URL) (string, bool)
+	// altSvc 记录 origin 的 HTTP/3 端点，quicFingerprint 为升级 HTTP/3 记录的指纹
+	altSvc          *AltSvcCache
+	quicFingerprint Fingerprint
+	trace           *ClientTrace
+	logger          *slog.Logger
+
+	infoMu    sync.Mutex
+	connInfos map[string]connInfo // 地址 -> 最近一次连接的远端地址和 TLS 信息
 }
 
 func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// 按请求 URL 选择代理的 dialer 从 context 中读取 URL
+	req = req.WithContext(withRequestURL(req.Context(), req.URL))
+	if rt.limiter != nil {
+		return rt.roundTripLimited(req)
+	}
+	return rt.roundTrip(req)
+}
+
+func (rt *roundTripper) roundTrip(req *http.Request) (*http.Response, error) {
 	// 如果 Fingerprint 为空，使用 Go 标准库的 http.Client
 	if rt.Fingerprint == nil || rt.Fingerprint.IsEmpty() {
 		return rt.roundTripWithStdlib(req)
 	}
+	if rt.trace != nil {
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), rt.trace.requestTrace()))
+	}
 
 	// Fix this later for proper cookie parsing
+	// AddCookie 只保留第一个 Cookie 值，Options.Cookies 追加为单独的值，HTTP/1.1 下由 roundTripTCP 合并
+	var cookies []string
+	if len(rt.Cookies) > 0 {
+		canonicalizeHeader(req.Header, "Cookie")
+		cookies = req.Header["Cookie"]
+		delete(req.Header, "Cookie")
+	}
 	for _, properties := range rt.Cookies {
 		req.AddCookie(&http.Cookie{
 			Name:       properties.Name,
@@ -58,20 +95,56 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 			Unparsed:   properties.Unparsed,
 		})
 	}
-	req.Header.Set("User-Agent", rt.UserAgent)
+	if len(cookies) > 0 {
+		req.Header["Cookie"] = append(cookies, req.Header["Cookie"]...)
+	}
+	setHeaderKeepCase(req.Header, "User-Agent", rt.UserAgent)
 	addr := rt.getDialTLSAddr(req)
-	if _, ok := rt.cachedTransports[addr]; !ok {
+	if alt, ok := rt.altSvcEndpoint(req, addr); ok {
+		return rt.roundTripAltSvc(req, addr, alt)
+	}
+	return rt.roundTripTCP(req, addr)
+}
+
+// roundTripTCP 按 getTransport 选择的传输层发送请求，并记录 HTTPS 响应的 Alt-Svc
+func (rt *roundTripper) roundTripTCP(req *http.Request, addr string) (*http.Response, error) {
+	transport := rt.cachedTransport(addr)
+	if transport == nil {
 		if err := rt.getTransport(req, addr); err != nil {
 			return nil, err
 		}
+		transport = rt.cachedTransport(addr)
+	}
+	// HTTP/1.1 只允许一行 Cookie，HTTP/2 和 HTTP/3 下多个 Cookie 值分别发送
+	if _, ok := transport.(*http.Transport); ok {
+		joinCookieHeader(req.Header)
 	}
-	return rt.cachedTransports[addr].RoundTrip(req)
+	resp, err := transport.RoundTrip(req)
+	if err == nil && rt.altSvc != nil && strings.EqualFold(req.URL.Scheme, "https") {
+		rt.altSvc.record(addr, resp.Header)
+	}
+	return resp, err
+}
+
+// cachedTransport 返回 addr 已选择的传输层；Alt-Svc 竞速落败的 TCP 请求可能仍在选择传输层，读写都需要持有 rt 的锁
+func (rt *roundTripper) cachedTransport(addr string) http.RoundTripper {
+	rt.Lock()
+	defer rt.Unlock()
+	return rt.cachedTransports[addr]
+}
+
+// setCachedTransport 记录 addr 选择的传输层
+func (rt *roundTripper) setCachedTransport(addr string, transport http.RoundTripper) {
+	rt.Lock()
+	defer rt.Unlock()
+	rt.cachedTransports[addr] = transport
 }
 
 func (rt *roundTripper) getTransport(req *http.Request, addr string) error {
 	switch strings.ToLower(req.URL.Scheme) {
 	case "http":
-		rt.cachedTransports[addr] = &http.Transport{DialContext: rt.dialer.DialContext, DisableKeepAlives: true}
+		rt.logger.Debug("protocol selected", slog.String("phase", phaseProtocol), slog.String("protocol", "http/1.1"))
+		rt.setCachedTransport(addr, &http.Transport{DialContext: rt.dialRecording, DisableKeepAlives: true})
 		return nil
 	case "https":
 	default:
@@ -85,8 +158,10 @@ func (rt *roundTripper) getTransport(req *http.Request, addr string) error {
 		// 检查是否是 QUIC 协议（JA4R 格式以 'q' 开头）
 		if strings.HasPrefix(fpValue, "q") {
 			// 使用 HTTP/3 (QUIC)
-			h3Transport := newHTTP3Transport(rt.Fingerprint, rt.UserAgent, rt.Cookies, rt.dialer)
-			rt.cachedTransports[addr] = h3Transport
+			h3Transport := rt.newHTTP3Transport(rt.Fingerprint)
+			h3Transport.Cookies = rt.Cookies
+			rt.logger.Debug("protocol selected", slog.String("phase", phaseProtocol), slog.String("protocol", "h3"))
+			rt.setCachedTransport(addr, h3Transport)
 			return nil
 		}
 	}
@@ -95,10 +170,10 @@ func (rt *roundTripper) getTransport(req *http.Request, addr string) error {
 	if rt.Fingerprint == nil || rt.Fingerprint.IsEmpty() {
 		// 创建一个适配器，将标准库的 Transport 包装成 fhttp.RoundTripper
 		stdTransport := &stdhttp.Transport{
-			DialContext:       rt.dialer.DialContext,
+			DialContext:       rt.dialRecording,
 			DisableKeepAlives: true,
 		}
-		rt.cachedTransports[addr] = &stdlibTransportAdapter{transport: stdTransport}
+		rt.setCachedTransport(addr, &stdlibTransportAdapter{transport: stdTransport})
 		return nil
 	}
 
@@ -106,6 +181,10 @@ func (rt *roundTripper) getTransport(req *http.Request, addr string) error {
 	switch err {
 	case errProtocolNegotiated:
 	case nil:
+		// 并发的请求已经为 addr 选择了传输层
+		if rt.cachedTransport(addr) != nil {
+			return nil
+		}
 		// Should never happen.
 		panic("dialTLS returned no error when determining cachedTransports")
 	default:
@@ -115,6 +194,20 @@ func (rt *roundTripper) getTransport(req *http.Request, addr string) error {
 	return nil
 }
 
+// newHTTP3Transport 创建使用 fingerprint 的 HTTP/3 传输层，连接的解析器、源地址、代理和连接池与 TCP 相同
+func (rt *roundTripper) newHTTP3Transport(fingerprint Fingerprint) *http3Transport {
+	t := newHTTP3Transport(fingerprint, rt.UserAgent, nil)
+	t.recordConn = rt.recordConn
+	t.trace = rt.trace
+	t.logger = rt.logger
+	t.resolver = rt.resolver
+	t.source = rt.source
+	t.packetDialer = rt.packetDialer
+	t.pool = rt.http3Pool
+	t.route = rt.http3Route
+	return t
+}
+
 func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
 	rt.Lock()
 	defer rt.Unlock()
@@ -142,10 +235,19 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 			ServerName:         host,
 			InsecureSkipVerify: true,
 		})
+		rt.trace.tlsHandshakeStart(host)
 		if err = conn.Handshake(); err != nil {
+			rt.trace.tlsHandshakeDone(nil, err)
+			rt.logger.Warn("tls handshake failed", slog.String("phase", phaseTLS), slog.String("addr", addr), slog.Any("error", err))
 			_ = conn.Close()
 			return nil, fmt.Errorf("标准库 TLS Handshake() 错误: %+v", err)
 		}
+		state := conn.ConnectionState()
+		info := tlsInfoFromStd(&state)
+		rt.trace.tlsHandshakeDone(info, nil)
+		rt.logger.Debug("tls handshake completed", slog.String("phase", phaseTLS), slog.String("addr", addr),
+			slog.String("version", info.VersionName), slog.String("alpn", info.ALPN))
+		rt.recordConn(addr, connInfo{remoteAddr: rawConn.RemoteAddr().String(), tls: info})
 		rt.cachedConnections[addr] = conn
 		return conn, nil
 	}
@@ -164,7 +266,10 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 		return nil, err
 	}
 
+	rt.trace.tlsHandshakeStart(host)
 	if err = conn.Handshake(); err != nil {
+		rt.trace.tlsHandshakeDone(nil, err)
+		rt.logger.Warn("tls handshake failed", slog.String("phase", phaseTLS), slog.String("addr", addr), slog.Any("error", err))
 		_ = conn.Close()
 
 		if err.Error() == "tls: CurvePreferences includes unsupported curve" {
@@ -173,6 +278,15 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 		}
 		return nil, fmt.Errorf("uTlsConn.Handshake() error: %+v", err)
 	}
+	info := tlsInfoFromUTLS(conn)
+	rt.trace.tlsHandshakeDone(info, nil)
+	rt.logger.Debug("tls handshake completed", slog.String("phase", phaseTLS), slog.String("addr", addr),
+		slog.String("version", info.VersionName), slog.String("alpn", info.ALPN), slog.String("ja4", info.JA4))
+	rt.recordConn(addr, connInfo{remoteAddr: rawConn.RemoteAddr().String(), tls: info})
+	// HTTP/2 连接多路复用，不占用 HTTP/1.1 的连接名额
+	if lc, ok := rawConn.(*limitedConn); ok && conn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+		lc.release()
+	}
 
 	//////////
 	if rt.cachedTransports[addr] != nil {
@@ -181,6 +295,7 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 
 	// No http.Transport constructed yet, create one based on the results
 	// of ALPN.
+	rt.logger.Debug("protocol selected", slog.String("phase", phaseProtocol), slog.String("protocol", info.ALPN))
 	switch conn.ConnectionState().NegotiatedProtocol {
 	case http2.NextProtoTLS:
 		browserType := parseUserAgent(rt.UserAgent)
@@ -226,7 +341,7 @@ func (a *stdlibTransportAdapter) RoundTrip(req *http.Request) (*http.Response, e
 			if key == http.HeaderOrderKey || key == http.PHeaderOrderKey {
 				continue
 			}
-			stdReq.Header.Add(key, value)
+			stdReq.Header[key] = append(stdReq.Header[key], value)
 		}
 	}
 
@@ -236,24 +351,17 @@ func (a *stdlibTransportAdapter) RoundTrip(req *http.Request) (*http.Response, e
 		return nil, err
 	}
 
-	// 将标准库的 Response 转换为 fhttp.Response
-	// 读取响应体
-	bodyBytes, err := io.ReadAll(stdResp.Body)
-	stdResp.Body.Close()
-	if err != nil {
-		return nil, err
-	}
-
-	// 创建 fhttp.Response
+	// 将标准库的 Response 转换为 fhttp.Response，响应体直接流式传递
 	fhttpResp := &http.Response{
-		Status:     stdResp.Status,
-		StatusCode: stdResp.StatusCode,
-		Proto:      stdResp.Proto,
-		ProtoMajor: stdResp.ProtoMajor,
-		ProtoMinor: stdResp.ProtoMinor,
-		Header:     http.Header{},
-		Body:       io.NopCloser(bytes.NewReader(bodyBytes)),
-		Request:    req,
+		Status:        stdResp.Status,
+		StatusCode:    stdResp.StatusCode,
+		Proto:         stdResp.Proto,
+		ProtoMajor:    stdResp.ProtoMajor,
+		ProtoMinor:    stdResp.ProtoMinor,
+		Header:        http.Header{},
+		Body:          stdResp.Body,
+		ContentLength: stdResp.ContentLength,
+		Request:       req,
 	}
 
 	// 复制响应头
@@ -269,7 +377,11 @@ func (a *stdlibTransportAdapter) RoundTrip(req *http.Request) (*http.Response, e
 // roundTripWithStdlib 使用 Go 标准库的 http.Client 发送请求
 func (rt *roundTripper) roundTripWithStdlib(req *http.Request) (*http.Response, error) {
 	// 将 fhttp.Request 转换为标准库的 http.Request
-	stdReq, err := stdhttp.NewRequest(req.Method, req.URL.String(), req.Body)
+	ctx := req.Context()
+	if rt.trace != nil {
+		ctx = stdhttptrace.WithClientTrace(ctx, rt.trace.stdRequestTrace())
+	}
+	stdReq, err := stdhttp.NewRequestWithContext(ctx, req.Method, req.URL.String(), req.Body)
 	if err != nil {
 		return nil, err
 	}
@@ -281,16 +393,20 @@ func (rt *roundTripper) roundTripWithStdlib(req *http.Request) (*http.Response,
 			if key == http.HeaderOrderKey || key == http.PHeaderOrderKey {
 				continue
 			}
-			stdReq.Header.Add(key, value)
+			stdReq.Header[key] = append(stdReq.Header[key], value)
 		}
 	}
 
 	// 设置 User-Agent
 	if rt.UserAgent != "" {
-		stdReq.Header.Set("User-Agent", rt.UserAgent)
+		setHeaderKeepCase(stdReq.Header, "User-Agent", rt.UserAgent)
 	}
 
-	// 添加 Cookies
+	// 添加 Cookies，AddCookie 只保留第一个 Cookie 值，先合并多个值
+	if len(rt.Cookies) > 0 {
+		canonicalizeHeader(stdReq.Header, "Cookie")
+	}
+	joinCookieHeader(stdReq.Header)
 	for _, properties := range rt.Cookies {
 		stdReq.AddCookie(&stdhttp.Cookie{
 			Name:       properties.Name,
@@ -308,10 +424,13 @@ func (rt *roundTripper) roundTripWithStdlib(req *http.Request) (*http.Response,
 	}
 
 	// 创建标准库的 http.Client
+	// 每个请求新建 Transport，连接不放回空闲池，响应体读完或关闭后即关闭，释放 Limiter 的连接名额
+	transport := &stdhttp.Transport{
+		DialContext:         rt.dialRecording,
+		MaxIdleConnsPerHost: -1,
+	}
 	client := &stdhttp.Client{
-		Transport: &stdhttp.Transport{
-			DialContext: rt.dialer.DialContext,
-		},
+		Transport: transport,
 	}
 
 	// 发送请求
@@ -319,26 +438,22 @@ func (rt *roundTripper) roundTripWithStdlib(req *http.Request) (*http.Response,
 	if err != nil {
 		return nil, err
 	}
-
-	// 将标准库的 Response 转换为 fhttp.Response
-	// 由于类型不兼容，我们需要手动创建 fhttp.Response
-	// 读取响应体
-	bodyBytes, err := io.ReadAll(stdResp.Body)
-	stdResp.Body.Close()
-	if err != nil {
-		return nil, err
+	if stdResp.TLS != nil {
+		rt.recordConn(connKey(req.URL), connInfo{tls: tlsInfoFromStd(stdResp.TLS)})
 	}
 
-	// 创建 fhttp.Response
+	// 将标准库的 Response 转换为 fhttp.Response
+	// 由于类型不兼容，我们需要手动创建 fhttp.Response，响应体直接流式传递
 	fhttpResp := &http.Response{
-		Status:     stdResp.Status,
-		StatusCode: stdResp.StatusCode,
-		Proto:      stdResp.Proto,
-		ProtoMajor: stdResp.ProtoMajor,
-		ProtoMinor: stdResp.ProtoMinor,
-		Header:     http.Header{},
-		Body:       io.NopCloser(bytes.NewReader(bodyBytes)),
-		Request:    req,
+		Status:        stdResp.Status,
+		StatusCode:    stdResp.StatusCode,
+		Proto:         stdResp.Proto,
+		ProtoMajor:    stdResp.ProtoMajor,
+		ProtoMinor:    stdResp.ProtoMinor,
+		Header:        http.Header{},
+		Body:          stdResp.Body,
+		ContentLength: stdResp.ContentLength,
+		Request:       req,
 	}
 
 	// 复制响应头
@@ -360,6 +475,8 @@ func (rt *roundTripper) getDialTLSAddr(req *http.Request) string {
 }
 
 func (rt *roundTripper) CloseIdleConnections() {
+	rt.Lock()
+	defer rt.Unlock()
 	for addr, conn := range rt.cachedConnections {
 		_ = conn.Close()
 		delete(rt.cachedConnections, addr)
@@ -369,7 +486,17 @@ func (rt *roundTripper) CloseIdleConnections() {
 func newRoundTripper(browser browser, dialer ...proxy.ContextDialer) http.RoundTripper {
 	if len(dialer) > 0 {
 		return &roundTripper{
-			dialer: dialer[0],
+			dialer:          limitDialer(browser.Limiter, dialer[0]),
+			limiter:         browser.Limiter,
+			resolver:        browser.Resolver,
+			source:          browser.Source,
+			packetDialer:    browser.packetDialer,
+			http3Pool:       browser.HTTP3Pool,
+			http3Route:      browser.http3Route,
+			altSvc:          browser.AltSvc,
+			quicFingerprint: quicFingerprintFor(browser.QUICFingerprint, browser.Fingerprint),
+			trace:           browser.Trace,
+			logger:          loggerOrDiscard(browser.Logger),
 
 			Fingerprint:       browser.Fingerprint,
 			UserAgent:         browser.UserAgent,
@@ -381,7 +508,17 @@ func newRoundTripper(browser browser, dialer ...proxy.ContextDialer) http.RoundT
 	}
 
 	return &roundTripper{
-		dialer: proxy.Direct,
+		dialer:          limitDialer(browser.Limiter, directDialer(browser.Resolver, browser.Source)),
+		limiter:         browser.Limiter,
+		resolver:        browser.Resolver,
+		source:          browser.Source,
+		packetDialer:    browser.packetDialer,
+		http3Pool:       browser.HTTP3Pool,
+		http3Route:      browser.http3Route,
+		altSvc:          browser.AltSvc,
+		quicFingerprint: quicFingerprintFor(browser.QUICFingerprint, browser.Fingerprint),
+		trace:           browser.Trace,
+		logger:          loggerOrDiscard(browser.Logger),
 
 		Fingerprint:       browser.Fingerprint,
 		UserAgent:         browser.UserAgent,
@@ -0,0 +1,515 @@
+package fastls
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// SOCKS 协议常量
+const (
+	socks4Version = 0x04
+	socks5Version = 0x05
+
+	socksCmdConnect      = 0x01
+	socksCmdUDPAssociate = 0x03
+
+	socks5AuthNone     = 0x00
+	socks5AuthPassword = 0x02
+	socks5AuthNoAccept = 0xff
+
+	socks5AtypIPv4   = 0x01
+	socks5AtypDomain = 0x03
+	socks5AtypIPv6   = 0x04
+
+	socks4Granted = 0x5a
+)
+
+// socks5Replies SOCKS5 应答码的说明
+var socks5Replies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// SocksDialer 通过 SOCKS 代理建立连接，支持 socks4、socks4a、socks5 和 socks5h
+//
+// socks4 和 socks5 在本地解析目标域名，socks4a 和 socks5h 把域名交给代理解析
+type SocksDialer struct {
+	version   byte
+	remoteDNS bool
+	addr      string // 代理服务器地址
+	username  string
+	password  string
+	forward   proxy.ContextDialer // 连接代理服务器
+	resolver  Resolver            // 本地解析目标域名
+	source    *sourceAddr         // UDP 中继的源地址
+}
+
+// newSocksDialer 按代理 URL 创建 SocksDialer，forward 为空时直接连接代理，resolver 为空时使用系统 DNS，
+// source 为 UDP 中继绑定的源地址
+func newSocksDialer(proxyURL *url.URL, forward proxy.ContextDialer, resolver Resolver, source *sourceAddr) (*SocksDialer, error) {
+	d := &SocksDialer{addr: proxyURL.Host, forward: forward, resolver: resolver, source: source}
+	switch proxyURL.Scheme {
+	case "socks4":
+		d.version = socks4Version
+	case "socks4a":
+		d.version, d.remoteDNS = socks4Version, true
+	case "socks5":
+		d.version = socks5Version
+	case "socks5h":
+		d.version, d.remoteDNS = socks5Version, true
+	default:
+		return nil, errors.New("scheme " + proxyURL.Scheme + " is not supported")
+	}
+	if proxyURL.Port() == "" {
+		d.addr = net.JoinHostPort(proxyURL.Hostname(), "1080")
+	}
+	if proxyURL.User != nil {
+		d.username = proxyURL.User.Username()
+		d.password, _ = proxyURL.User.Password()
+	}
+	if d.version == socks5Version && (len(d.username) > 255 || len(d.password) > 255) {
+		return nil, errors.New("SOCKS5 username or password is too long")
+	}
+	if d.forward == nil {
+		d.forward = &net.Dialer{}
+	}
+	if d.resolver == nil {
+		d.resolver = net.DefaultResolver
+	}
+	return d, nil
+}
+
+func (d *SocksDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext 通过代理连接 addr，ctx 取消或超时时中止连接和握手
+func (d *SocksDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, errors.New("SOCKS proxy does not support network " + network)
+	}
+	conn, err := d.forward.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.handshake(ctx, conn, socksCmdConnect, addr); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// handshake 在 conn 上完成认证并发送命令，返回代理应答中的地址
+func (d *SocksDialer) handshake(ctx context.Context, conn net.Conn, cmd byte, addr string) (net.Addr, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	// ctx 取消时让阻塞的读写立即返回
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, errors.New("invalid port " + portStr)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil && !d.remoteDNS {
+		if ip, err = d.lookup(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+	if ip == nil && len(host) > 255 {
+		return nil, errors.New("host name is too long: " + host)
+	}
+
+	var bound net.Addr
+	if d.version == socks4Version {
+		err = d.socks4(conn, cmd, host, ip, uint16(port))
+	} else {
+		bound, err = d.socks5(conn, cmd, host, ip, uint16(port))
+	}
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("SOCKS%d proxy %s: %w", d.version, d.addr, err)
+	}
+	return bound, nil
+}
+
+// lookup 在本地解析目标域名，socks4 只能使用 IPv4 地址
+func (d *SocksDialer) lookup(ctx context.Context, host string) (net.IP, error) {
+	addrs, err := lookupTraced(ctx, d.resolver, host)
+	if err != nil {
+		return nil, err
+	}
+	network := "ip"
+	if d.version == socks4Version {
+		network = "ip4"
+	}
+	addrs = sortAddrs(network, addrs)
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no suitable address found", Name: host, IsNotFound: true}
+	}
+	return addrs[0].IP, nil
+}
+
+// socks4 发送 SOCKS4 或 SOCKS4a 请求，ip 为空时把 host 交给代理解析
+func (d *SocksDialer) socks4(conn net.Conn, cmd byte, host string, ip net.IP, port uint16) error {
+	if cmd != socksCmdConnect {
+		return errors.New("SOCKS4 only supports CONNECT")
+	}
+	req := []byte{socks4Version, cmd}
+	req = binary.BigEndian.AppendUint16(req, port)
+	if ip != nil {
+		ip4 := ip.To4()
+		if ip4 == nil {
+			return errors.New("SOCKS4 does not support IPv6 address " + ip.String())
+		}
+		req = append(req, ip4...)
+	} else {
+		// SOCKS4a：0.0.0.x 表示目标地址是 userid 后的域名
+		req = append(req, 0, 0, 0, 1)
+	}
+	req = append(req, d.username...)
+	req = append(req, 0)
+	if ip == nil {
+		req = append(req, host...)
+		req = append(req, 0)
+	}
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var resp [8]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		return err
+	}
+	if resp[1] != socks4Granted {
+		return fmt.Errorf("request rejected with code 0x%02x", resp[1])
+	}
+	return nil
+}
+
+// socks5 完成 SOCKS5 认证并发送请求，ip 为空时把 host 交给代理解析
+func (d *SocksDialer) socks5(conn net.Conn, cmd byte, host string, ip net.IP, port uint16) (net.Addr, error) {
+	methods := []byte{socks5AuthNone}
+	if d.username != "" {
+		methods = append(methods, socks5AuthPassword)
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return nil, err
+	}
+	var choice [2]byte
+	if _, err := io.ReadFull(conn, choice[:]); err != nil {
+		return nil, err
+	}
+	if choice[0] != socks5Version {
+		return nil, fmt.Errorf("unexpected protocol version %d", choice[0])
+	}
+	switch choice[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if d.username == "" {
+			return nil, errors.New("proxy requires username/password authentication")
+		}
+		// RFC 1929
+		auth := []byte{0x01, byte(len(d.username))}
+		auth = append(auth, d.username...)
+		auth = append(auth, byte(len(d.password)))
+		auth = append(auth, d.password...)
+		if _, err := conn.Write(auth); err != nil {
+			return nil, err
+		}
+		var status [2]byte
+		if _, err := io.ReadFull(conn, status[:]); err != nil {
+			return nil, err
+		}
+		if status[1] != 0x00 {
+			return nil, errors.New("username/password authentication failed")
+		}
+	case socks5AuthNoAccept:
+		return nil, errors.New("no acceptable authentication methods")
+	default:
+		return nil, fmt.Errorf("unsupported authentication method 0x%02x", choice[1])
+	}
+
+	req := appendSocks5Addr([]byte{socks5Version, cmd, 0x00}, host, ip, port)
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	var head [3]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return nil, err
+	}
+	if head[1] != 0x00 {
+		if msg, ok := socks5Replies[head[1]]; ok {
+			return nil, errors.New(msg)
+		}
+		return nil, fmt.Errorf("unknown reply code 0x%02x", head[1])
+	}
+	return readSocks5Addr(conn)
+}
+
+// appendSocks5Addr 按 SOCKS5 格式追加地址，ip 为空时使用域名
+func appendSocks5Addr(b []byte, host string, ip net.IP, port uint16) []byte {
+	switch {
+	case ip == nil:
+		b = append(b, socks5AtypDomain, byte(len(host)))
+		b = append(b, host...)
+	case ip.To4() != nil:
+		b = append(b, socks5AtypIPv4)
+		b = append(b, ip.To4()...)
+	default:
+		b = append(b, socks5AtypIPv6)
+		b = append(b, ip.To16()...)
+	}
+	return binary.BigEndian.AppendUint16(b, port)
+}
+
+// socksAddr 代理返回的地址，域名地址的 IP 为空
+type socksAddr struct {
+	host string
+	ip   net.IP
+	port int
+}
+
+func (a *socksAddr) Network() string { return "udp" }
+
+func (a *socksAddr) String() string {
+	if a.ip != nil {
+		return net.JoinHostPort(a.ip.String(), strconv.Itoa(a.port))
+	}
+	return net.JoinHostPort(a.host, strconv.Itoa(a.port))
+}
+
+// readSocks5Addr 读取 SOCKS5 格式的地址
+func readSocks5Addr(r io.Reader) (*socksAddr, error) {
+	var atyp [1]byte
+	if _, err := io.ReadFull(r, atyp[:]); err != nil {
+		return nil, err
+	}
+	addr := &socksAddr{}
+	switch atyp[0] {
+	case socks5AtypIPv4:
+		addr.ip = make(net.IP, net.IPv4len)
+	case socks5AtypIPv6:
+		addr.ip = make(net.IP, net.IPv6len)
+	case socks5AtypDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return nil, err
+		}
+		host := make([]byte, n[0])
+		if _, err := io.ReadFull(r, host); err != nil {
+			return nil, err
+		}
+		addr.host = string(host)
+	default:
+		return nil, fmt.Errorf("unknown address type 0x%02x", atyp[0])
+	}
+	if addr.ip != nil {
+		if _, err := io.ReadFull(r, addr.ip); err != nil {
+			return nil, err
+		}
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return nil, err
+	}
+	addr.port = int(binary.BigEndian.Uint16(port[:]))
+	return addr, nil
+}
+
+// packetDialer 可以为 HTTP/3 建立 UDP 通道的代理
+type packetDialer interface {
+	// dialPacket 返回发往 addr 的 PacketConn 和对应的目标地址
+	dialPacket(ctx context.Context, addr string) (net.PacketConn, net.Addr, error)
+}
+
+// dialPacket 通过 SOCKS5 UDP ASSOCIATE 建立发往 addr 的 UDP 通道，控制连接关闭时关联结束
+func (d *SocksDialer) dialPacket(ctx context.Context, addr string) (net.PacketConn, net.Addr, error) {
+	if d.version != socks5Version {
+		return nil, nil, fmt.Errorf("SOCKS%d proxy does not support UDP", d.version)
+	}
+	if _, chained := d.forward.(*chainDialer); chained {
+		// UDP 中继的数据报不能经过代理链
+		return nil, nil, errors.New("SOCKS5 UDP relay cannot be reached through a proxy chain")
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, nil, errors.New("invalid port " + portStr)
+	}
+	target := &socksAddr{host: host, ip: net.ParseIP(host), port: int(port)}
+	if target.ip == nil && !d.remoteDNS {
+		if target.ip, err = d.lookup(ctx, host); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ctrl, err := d.forward.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 客户端地址未知，按 RFC 1928 发送全 0 地址
+	bound, err := d.handshake(ctx, ctrl, socksCmdUDPAssociate, "0.0.0.0:0")
+	if err != nil {
+		ctrl.Close()
+		return nil, nil, err
+	}
+	relay, ok := bound.(*socksAddr)
+	if !ok {
+		ctrl.Close()
+		return nil, nil, fmt.Errorf("unexpected SOCKS5 UDP relay address %v", bound)
+	}
+	relayIP := relay.ip
+	if relayIP == nil || relayIP.IsUnspecified() {
+		// 代理返回全 0 地址时使用控制连接的地址
+		remote, ok := ctrl.RemoteAddr().(*net.TCPAddr)
+		if !ok {
+			ctrl.Close()
+			return nil, nil, fmt.Errorf("cannot determine SOCKS5 UDP relay address from %v", ctrl.RemoteAddr())
+		}
+		relayIP = remote.IP
+	}
+	localAddr, err := d.source.udpAddr(relayIP)
+	if err != nil {
+		ctrl.Close()
+		return nil, nil, err
+	}
+	udpConn, err := net.DialUDP("udp", localAddr, &net.UDPAddr{IP: relayIP, Port: relay.port})
+	if err != nil {
+		ctrl.Close()
+		return nil, nil, err
+	}
+
+	pc := &socksPacketConn{udp: udpConn, ctrl: ctrl, target: target}
+	go pc.watchControl()
+	return pc, target, nil
+}
+
+// socksPacketConn 通过 SOCKS5 UDP 中继收发单个目标的数据报
+//
+// 不嵌入 *net.UDPConn，避免 quic-go 通过 ReadMsgUDP 等方法绕过 SOCKS 封装
+type socksPacketConn struct {
+	udp    *net.UDPConn
+	ctrl   net.Conn
+	target *socksAddr
+
+	closeOnce sync.Once
+}
+
+// watchControl 控制连接断开时关闭 UDP 通道
+func (c *socksPacketConn) watchControl() {
+	_, _ = io.Copy(io.Discard, c.ctrl)
+	c.Close()
+}
+
+func (c *socksPacketConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	// RSV(2) FRAG(1) 后是目标地址
+	packet := appendSocks5Addr([]byte{0, 0, 0}, c.target.host, c.target.ip, uint16(c.target.port))
+	packet = append(packet, p...)
+	if _, err := c.udp.Write(packet); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *socksPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	buf := make([]byte, len(p)+262)
+	for {
+		n, err := c.udp.Read(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		// 跳过分片和格式错误的数据报
+		if n < 3 || buf[2] != 0 {
+			continue
+		}
+		r := &sliceReader{b: buf[3:n]}
+		if _, err := readSocks5Addr(r); err != nil {
+			continue
+		}
+		return copy(p, r.b), c.target, nil
+	}
+}
+
+func (c *socksPacketConn) LocalAddr() net.Addr {
+	return c.udp.LocalAddr()
+}
+
+func (c *socksPacketConn) SetDeadline(t time.Time) error {
+	return c.udp.SetDeadline(t)
+}
+
+func (c *socksPacketConn) SetReadDeadline(t time.Time) error {
+	return c.udp.SetReadDeadline(t)
+}
+
+func (c *socksPacketConn) SetWriteDeadline(t time.Time) error {
+	return c.udp.SetWriteDeadline(t)
+}
+
+func (c *socksPacketConn) SetReadBuffer(bytes int) error {
+	return c.udp.SetReadBuffer(bytes)
+}
+
+func (c *socksPacketConn) SetWriteBuffer(bytes int) error {
+	return c.udp.SetWriteBuffer(bytes)
+}
+
+func (c *socksPacketConn) SyscallConn() (syscall.RawConn, error) {
+	return c.udp.SyscallConn()
+}
+
+func (c *socksPacketConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.udp.Close()
+		c.ctrl.Close()
+	})
+	return err
+}
+
+// sliceReader 从字节切片读取，读取后 b 为剩余的数据
+type sliceReader struct {
+	b []byte
+}
+
+func (r *sliceReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.b)
+	r.b = r.b[n:]
+	return n, nil
+}
@@ -0,0 +1,286 @@
+package fastls
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultSourceSessionTTL = 10 * time.Minute
+
+// SourcePool 出站连接的本地源地址池，需在请求间复用
+//
+// Addrs 中的每一项是 IP 地址或 CIDR 前缀（如路由到本机的 IPv6 /64），前缀中的地址随机生成。
+// 每个请求按目标的地址族轮换到下一项；设置了 Options.SourceSession 的请求在同一会话内使用相同的源地址，
+// 会话空闲 SessionTTL 后失效。字段在第一次使用后不能再修改
+type SourcePool struct {
+	Addrs      []string
+	SessionTTL time.Duration // 会话空闲多久后失效，为 0 时为 10 分钟
+
+	once     sync.Once
+	err      error
+	v4, v6   []*net.IPNet // 单个地址的掩码为全 1
+	mu       sync.Mutex
+	next     [2]int
+	sessions map[string]*sourceSession
+	swept    time.Time // 上次清理过期会话的时间
+}
+
+// sourceSession 一个会话在两个地址族上的源地址
+type sourceSession struct {
+	ips      [2]net.IP
+	lastUsed time.Time
+}
+
+// parse 解析 Addrs，只在第一次使用时执行
+func (p *SourcePool) parse() error {
+	p.once.Do(func() {
+		for _, s := range p.Addrs {
+			s = strings.TrimSpace(s)
+			var network *net.IPNet
+			if strings.Contains(s, "/") {
+				_, ipNet, err := net.ParseCIDR(s)
+				if err != nil {
+					p.err = fmt.Errorf("无效的源地址前缀 %q: %w", s, err)
+					return
+				}
+				network = ipNet
+			} else if ip := net.ParseIP(s); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip4 := ip.To4(); ip4 != nil {
+					ip, bits = ip4, 8*net.IPv4len
+				}
+				network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+			} else {
+				p.err = fmt.Errorf("无效的源地址 %q", s)
+				return
+			}
+			if network.IP.To4() != nil {
+				p.v4 = append(p.v4, network)
+			} else {
+				p.v6 = append(p.v6, network)
+			}
+		}
+		if len(p.v4)+len(p.v6) == 0 {
+			p.err = fmt.Errorf("源地址池为空")
+		}
+	})
+	return p.err
+}
+
+// pick 为 family（0 为 IPv4，1 为 IPv6）选取源地址，session 不为空时同一会话返回相同的地址
+func (p *SourcePool) pick(family int, session string) (net.IP, error) {
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	networks := p.v4
+	if family == 1 {
+		networks = p.v6
+	}
+	if len(networks) == 0 {
+		return nil, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if session != "" {
+		now := time.Now()
+		p.sweep(now)
+		if p.sessions == nil {
+			p.sessions = make(map[string]*sourceSession)
+		}
+		chosen := p.sessions[session]
+		if chosen == nil {
+			chosen = &sourceSession{}
+			p.sessions[session] = chosen
+		}
+		chosen.lastUsed = now
+		if chosen.ips[family] == nil {
+			chosen.ips[family] = randomIP(networks[p.next[family]%len(networks)])
+			p.next[family]++
+		}
+		return chosen.ips[family], nil
+	}
+	ip := randomIP(networks[p.next[family]%len(networks)])
+	p.next[family]++
+	return ip, nil
+}
+
+// sweep 删除空闲超过 SessionTTL 的会话，每个 SessionTTL 最多清理一次，调用时需持有 p.mu
+func (p *SourcePool) sweep(now time.Time) {
+	ttl := p.SessionTTL
+	if ttl <= 0 {
+		ttl = defaultSourceSessionTTL
+	}
+	if now.Sub(p.swept) < ttl {
+		return
+	}
+	p.swept = now
+	for session, s := range p.sessions {
+		if now.Sub(s.lastUsed) >= ttl {
+			delete(p.sessions, session)
+		}
+	}
+}
+
+// randomIP 返回前缀中的随机地址，IPv4 前缀避开网络地址和广播地址
+func randomIP(network *net.IPNet) net.IP {
+	ones, bits := network.Mask.Size()
+	if ones == bits {
+		return network.IP
+	}
+	ip := make(net.IP, len(network.IP))
+	for {
+		_, _ = rand.Read(ip)
+		allZero, allOne := true, true
+		for i := range ip {
+			host := ip[i] &^ network.Mask[i]
+			ip[i] = network.IP[i] | host
+			if host != 0 {
+				allZero = false
+			}
+			if host != ^network.Mask[i] {
+				allOne = false
+			}
+		}
+		if bits == 8*net.IPv6len || bits-ones < 2 || (!allZero && !allOne) {
+			return ip
+		}
+	}
+}
+
+// sourceAddr 一个请求的源地址选择，按地址族记住选中的地址，使同一请求的连接使用相同的源地址
+type sourceAddr struct {
+	local   net.IP // Options.LocalAddr
+	iface   []net.IP
+	pool    *SourcePool
+	session string
+
+	mu     sync.Mutex
+	chosen [2]net.IP
+}
+
+// newSourceAddr 按 Options 创建源地址选择，未设置源地址时返回 nil
+func newSourceAddr(options *Options) (*sourceAddr, error) {
+	if options.LocalAddr == "" && options.Interface == "" && options.SourcePool == nil {
+		return nil, nil
+	}
+	s := &sourceAddr{pool: options.SourcePool, session: options.SourceSession}
+	if options.LocalAddr != "" {
+		s.local = net.ParseIP(options.LocalAddr)
+		if s.local == nil {
+			return nil, fmt.Errorf("无效的本地地址 %q", options.LocalAddr)
+		}
+	}
+	if options.Interface != "" {
+		iface, err := net.InterfaceByName(options.Interface)
+		if err != nil {
+			return nil, fmt.Errorf("获取网卡 %s 失败: %w", options.Interface, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("获取网卡 %s 的地址失败: %w", options.Interface, err)
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				s.iface = append(s.iface, ipNet.IP)
+			}
+		}
+		if len(s.iface) == 0 {
+			return nil, fmt.Errorf("网卡 %s 没有可用的地址", options.Interface)
+		}
+	}
+	if s.pool != nil {
+		if err := s.pool.parse(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// ipFamily 返回地址族，0 为 IPv4，1 为 IPv6
+func ipFamily(ip net.IP) int {
+	if ip.To4() != nil {
+		return 0
+	}
+	return 1
+}
+
+// pick 返回连接 dst 使用的源地址。优先级依次为 SourcePool、LocalAddr 和 Interface，
+// 没有与 dst 地址族相同的源地址时返回错误，Happy Eyeballs 会继续尝试其他地址
+func (s *sourceAddr) pick(dst net.IP) (net.IP, error) {
+	family := ipFamily(dst)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ip := s.chosen[family]; ip != nil {
+		return ip, nil
+	}
+
+	var ip net.IP
+	if s.pool != nil {
+		var err error
+		if ip, err = s.pool.pick(family, s.session); err != nil {
+			return nil, err
+		}
+	}
+	if ip == nil && s.local != nil && ipFamily(s.local) == family {
+		ip = s.local
+	}
+	if ip == nil {
+		for _, candidate := range s.iface {
+			if ipFamily(candidate) == family {
+				ip = candidate
+				break
+			}
+		}
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("没有可以连接 %s 的源地址", dst)
+	}
+	s.chosen[family] = ip
+	return ip, nil
+}
+
+// has 判断是否有 family 地址族的源地址
+func (s *sourceAddr) has(family int) bool {
+	if s.pool != nil {
+		if family == 0 && len(s.pool.v4) > 0 || family == 1 && len(s.pool.v6) > 0 {
+			return true
+		}
+	}
+	if s.local != nil && ipFamily(s.local) == family {
+		return true
+	}
+	for _, ip := range s.iface {
+		if ipFamily(ip) == family {
+			return true
+		}
+	}
+	return false
+}
+
+// reuseKey 返回区分源地址设置的键，s 为 nil 时为空。每个请求轮换源地址时连接不能跨请求复用，返回 false
+func (s *sourceAddr) reuseKey() (string, bool) {
+	if s == nil {
+		return "", true
+	}
+	if s.pool != nil && s.session == "" {
+		return "", false
+	}
+	return fmt.Sprintf("%v %v %p %s", s.local, s.iface, s.pool, s.session), true
+}
+
+// udpAddr 返回连接 dst 的 UDP 本地地址，s 为 nil 时返回 nil
+func (s *sourceAddr) udpAddr(dst net.IP) (*net.UDPAddr, error) {
+	if s == nil {
+		return nil, nil
+	}
+	ip, err := s.pick(dst)
+	if err != nil {
+		return nil, err
+	}
+	return &net.UDPAddr{IP: ip}, nil
+}
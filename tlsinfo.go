@@ -0,0 +1,321 @@
+package fastls
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// TLSInfo 响应所用 TLS 连接的信息
+type TLSInfo struct {
+	Version          uint16              // TLS 版本，如 tls.VersionTLS13
+	VersionName      string              // TLS 版本名称，如 "TLS 1.3"
+	CipherSuite      uint16              // 协商的密码套件
+	CipherSuiteName  string              // 密码套件名称
+	ALPN             string              // ALPN 协商结果，如 h2、http/1.1、h3
+	ServerName       string              // 发送的 SNI
+	DidResume        bool                // 是否复用了会话
+	PeerCertificates []*x509.Certificate // 服务器证书链，第一个为叶子证书
+	// OCSPResponse 服务器通过 status_request 扩展装订的 OCSP 响应
+	OCSPResponse []byte
+	// SignedCertificateTimestamps 服务器通过 SCT 扩展返回的证书透明度时间戳
+	SignedCertificateTimestamps [][]byte
+	// JA3 根据实际发送的 ClientHello 计算的 JA3，未使用指纹时为空
+	JA3 string
+	// JA4 根据实际发送的 ClientHello 计算的 JA4，未使用指纹时为空
+	JA4 string
+	// ClientHello 实际发送的 ClientHello 握手消息，未使用指纹时为空
+	ClientHello []byte
+}
+
+// connInfo roundTripper 为每个地址记录的最近一次连接信息
+type connInfo struct {
+	remoteAddr string
+	tls        *TLSInfo
+}
+
+// tlsInfoFromUTLS 从 uTLS 连接生成 TLSInfo，并根据实际发送的 ClientHello 计算 JA3
+func tlsInfoFromUTLS(conn *utls.UConn) *TLSInfo {
+	state := conn.ConnectionState()
+	info := &TLSInfo{
+		Version:                     state.Version,
+		VersionName:                 tls.VersionName(state.Version),
+		CipherSuite:                 state.CipherSuite,
+		CipherSuiteName:             tls.CipherSuiteName(state.CipherSuite),
+		ALPN:                        state.NegotiatedProtocol,
+		ServerName:                  state.ServerName,
+		DidResume:                   state.DidResume,
+		PeerCertificates:            state.PeerCertificates,
+		OCSPResponse:                state.OCSPResponse,
+		SignedCertificateTimestamps: state.SignedCertificateTimestamps,
+	}
+	if conn.HandshakeState.Hello != nil {
+		info.ClientHello = conn.HandshakeState.Hello.Raw
+		info.JA3 = ja3FromClientHello(info.ClientHello)
+		info.JA4 = ja4FromClientHello(info.ClientHello)
+	}
+	return info
+}
+
+// tlsInfoFromStd 从标准库 TLS 连接状态生成 TLSInfo
+func tlsInfoFromStd(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+	return &TLSInfo{
+		Version:                     state.Version,
+		VersionName:                 tls.VersionName(state.Version),
+		CipherSuite:                 state.CipherSuite,
+		CipherSuiteName:             tls.CipherSuiteName(state.CipherSuite),
+		ALPN:                        state.NegotiatedProtocol,
+		ServerName:                  state.ServerName,
+		DidResume:                   state.DidResume,
+		PeerCertificates:            state.PeerCertificates,
+		OCSPResponse:                state.OCSPResponse,
+		SignedCertificateTimestamps: state.SignedCertificateTimestamps,
+	}
+}
+
+// isGREASE 判断是否为 GREASE 值（RFC 8701），计算 JA3 和 JA4 时忽略
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// clientHello 计算 JA3 和 JA4 所需的 ClientHello 字段，均已去掉 GREASE 值
+type clientHello struct {
+	version           uint16
+	ciphers           []uint16
+	extensions        []uint16 // 按发送顺序
+	groups            []uint16
+	points            []uint8
+	signatureAlgs     []uint16
+	supportedVersions []uint16
+	alpn              string // 第一个 ALPN 值
+}
+
+// parseClientHello 解析 ClientHello 握手消息，解析失败时返回 nil
+func parseClientHello(raw []byte) *clientHello {
+	// 握手消息头：类型(1) + 长度(3)
+	if len(raw) < 4 || raw[0] != 1 {
+		return nil
+	}
+	p := raw[4:]
+	read := func(n int) []byte {
+		if n > len(p) {
+			p = nil
+			return nil
+		}
+		b := p[:n]
+		p = p[n:]
+		return b
+	}
+	readVector := func(lenBytes int) []byte {
+		l := read(lenBytes)
+		if l == nil {
+			return nil
+		}
+		n := 0
+		for _, b := range l {
+			n = n<<8 | int(b)
+		}
+		return read(n)
+	}
+	// uint16s 解析 2 字节值的列表，忽略 GREASE
+	uint16s := func(b []byte) []uint16 {
+		var list []uint16
+		for i := 0; i+1 < len(b); i += 2 {
+			if v := binary.BigEndian.Uint16(b[i:]); !isGREASE(v) {
+				list = append(list, v)
+			}
+		}
+		return list
+	}
+
+	version := read(2)
+	read(32) // random
+	readVector(1)
+	ciphers := readVector(2)
+	readVector(1) // compression methods
+	extensions := readVector(2)
+	if version == nil || ciphers == nil {
+		return nil
+	}
+
+	hello := &clientHello{version: binary.BigEndian.Uint16(version), ciphers: uint16s(ciphers)}
+	for len(extensions) >= 4 {
+		typ := binary.BigEndian.Uint16(extensions)
+		n := int(binary.BigEndian.Uint16(extensions[2:]))
+		if 4+n > len(extensions) {
+			break
+		}
+		data := extensions[4 : 4+n]
+		extensions = extensions[4+n:]
+		if isGREASE(typ) {
+			continue
+		}
+		hello.extensions = append(hello.extensions, typ)
+		switch typ {
+		case 10: // supported_groups
+			if len(data) >= 2 {
+				hello.groups = uint16s(data[2:])
+			}
+		case 11: // ec_point_formats
+			if len(data) >= 1 {
+				hello.points = data[1:]
+			}
+		case 13: // signature_algorithms
+			if len(data) >= 2 {
+				hello.signatureAlgs = uint16s(data[2:])
+			}
+		case 16: // application_layer_protocol_negotiation
+			if len(data) >= 3 && int(data[2]) <= len(data)-3 {
+				hello.alpn = string(data[3 : 3+int(data[2])])
+			}
+		case 43: // supported_versions
+			if len(data) >= 1 {
+				hello.supportedVersions = uint16s(data[1:])
+			}
+		}
+	}
+	return hello
+}
+
+// ja3FromClientHello 从 ClientHello 握手消息计算 JA3 字符串，解析失败时返回空字符串
+func ja3FromClientHello(raw []byte) string {
+	hello := parseClientHello(raw)
+	if hello == nil {
+		return ""
+	}
+	decimal := func(list []uint16) string {
+		s := make([]string, len(list))
+		for i, v := range list {
+			s[i] = strconv.Itoa(int(v))
+		}
+		return strings.Join(s, "-")
+	}
+	points := make([]string, len(hello.points))
+	for i, f := range hello.points {
+		points[i] = strconv.Itoa(int(f))
+	}
+	return strings.Join([]string{
+		strconv.Itoa(int(hello.version)),
+		decimal(hello.ciphers),
+		decimal(hello.extensions),
+		decimal(hello.groups),
+		strings.Join(points, "-"),
+	}, ",")
+}
+
+// ja4FromClientHello 从 ClientHello 握手消息计算 JA4 指纹（TCP），解析失败时返回空字符串
+func ja4FromClientHello(raw []byte) string {
+	hello := parseClientHello(raw)
+	if hello == nil {
+		return ""
+	}
+
+	version := hello.version
+	for _, v := range hello.supportedVersions {
+		if v > version {
+			version = v
+		}
+	}
+	versionName := map[uint16]string{0x0304: "13", 0x0303: "12", 0x0302: "11", 0x0301: "10", 0x0300: "s3"}[version]
+	if versionName == "" {
+		versionName = "00"
+	}
+	sni := "i"
+	if slices.Contains(hello.extensions, 0) {
+		sni = "d"
+	}
+	alpn := "00"
+	if n := len(hello.alpn); n > 0 {
+		first, last := hello.alpn[0], hello.alpn[n-1]
+		if isAlnum(first) && isAlnum(last) {
+			alpn = string([]byte{first, last})
+		} else {
+			alpn = hex.EncodeToString([]byte{first})[:1] + hex.EncodeToString([]byte{last})[1:]
+		}
+	}
+	a := fmt.Sprintf("t%s%s%02d%02d%s", versionName, sni, min(len(hello.ciphers), 99), min(len(hello.extensions), 99), alpn)
+
+	// 密码套件和扩展排序后计算 SHA256，扩展不包括 SNI 和 ALPN，签名算法保持原顺序
+	var extensions []uint16
+	for _, e := range hello.extensions {
+		if e != 0 && e != 16 {
+			extensions = append(extensions, e)
+		}
+	}
+	c := hexList(slices.Sorted(slices.Values(extensions)))
+	if len(hello.signatureAlgs) > 0 {
+		c += "_" + hexList(hello.signatureAlgs)
+	}
+	return a + "_" + ja4Hash(hexList(slices.Sorted(slices.Values(hello.ciphers))), len(hello.ciphers)) + "_" + ja4Hash(c, len(extensions))
+}
+
+func isAlnum(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// hexList 将值格式化为逗号分隔的 4 位十六进制
+func hexList(list []uint16) string {
+	s := make([]string, len(list))
+	for i, v := range list {
+		s[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(s, ",")
+}
+
+// ja4Hash 返回 SHA256 的前 12 个十六进制字符，列表为空时返回 12 个 0
+func ja4Hash(s string, n int) string {
+	if n == 0 {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// connKey 返回记录连接信息使用的地址（带默认端口）
+func connKey(u *url.URL) string {
+	return hostWithPort(u)
+}
+
+// recordConn 记录 addr 最近一次连接的信息
+func (rt *roundTripper) recordConn(addr string, info connInfo) {
+	rt.infoMu.Lock()
+	defer rt.infoMu.Unlock()
+	if rt.connInfos == nil {
+		rt.connInfos = make(map[string]connInfo)
+	}
+	if info.remoteAddr == "" {
+		info.remoteAddr = rt.connInfos[addr].remoteAddr
+	}
+	rt.connInfos[addr] = info
+}
+
+// lastConn 返回 addr 最近一次连接的信息
+func (rt *roundTripper) lastConn(addr string) connInfo {
+	rt.infoMu.Lock()
+	defer rt.infoMu.Unlock()
+	return rt.connInfos[addr]
+}
+
+// dialRecording 建立 TCP 连接并记录远端地址
+func (rt *roundTripper) dialRecording(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := rt.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	rt.recordConn(addr, connInfo{remoteAddr: conn.RemoteAddr().String()})
+	return conn, nil
+}
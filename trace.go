@@ -0,0 +1,327 @@
+package fastls
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	stdhttptrace "net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/FastTLS/fhttp/httptrace"
+	"golang.org/x/net/proxy"
+)
+
+// ClientTrace 请求各阶段的回调，与 net/http/httptrace 类似，所有字段都可以为空
+//
+// 回调可能在不同的 goroutine 中调用；跟随重定向时每一跳都会触发
+type ClientTrace struct {
+	DNSStart             func(host string)                        // 开始解析域名，使用代理时为代理的域名
+	DNSDone              func(addrs []net.IPAddr, err error)      // 域名解析完成
+	ConnectStart         func(network, addr string)               // 开始建立 TCP 连接，每个尝试的地址触发一次
+	ConnectDone          func(network, addr string, err error)    // TCP 连接建立完成
+	ProxyConnectStart    func(proxyURL, target string)            // 开始通过代理连接目标，proxyURL 已隐藏密码
+	ProxyConnectDone     func(proxyURL, target string, err error) // 代理隧道建立完成
+	TLSHandshakeStart    func(serverName string)                  // 开始 TLS 握手
+	TLSHandshakeDone     func(info *TLSInfo, err error)           // TLS 握手完成，info 包含实际发送的 ClientHello 和协商结果
+	GotConn              func(remoteAddr string, reused bool)     // 获得用于发送请求的连接
+	WroteRequest         func(err error)                          // 请求已写完
+	GotFirstResponseByte func()                                   // 收到第一个响应字节
+}
+
+// Timing 请求各阶段的耗时，跟随重定向时为各跳之和
+type Timing struct {
+	DNS           time.Duration // 域名解析
+	Connect       time.Duration // TCP 连接
+	ProxyConnect  time.Duration // 代理隧道建立（包括连接代理）
+	TLSHandshake  time.Duration // TLS 或 QUIC 握手
+	WaitFirstByte time.Duration // 请求写完到收到第一个响应字节
+	Total         time.Duration // 从开始发送到收到最终响应头
+	ConnReused    bool          // 最终响应使用的连接是否是复用的
+}
+
+// timingRecorder 通过 ClientTrace 记录 Timing
+type timingRecorder struct {
+	mu      sync.Mutex
+	start   time.Time
+	timing  Timing
+	dns     time.Time
+	connect time.Time
+	proxy   time.Time
+	tls     time.Time
+	wrote   time.Time
+}
+
+func newTimingRecorder() *timingRecorder {
+	return &timingRecorder{start: time.Now()}
+}
+
+// since 返回 t 到现在的时间，t 为零值（阶段未开始）时返回 0
+func since(t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+	return time.Since(t)
+}
+
+func (r *timingRecorder) trace() *ClientTrace {
+	mark := func(t *time.Time) {
+		r.mu.Lock()
+		*t = time.Now()
+		r.mu.Unlock()
+	}
+	add := func(d *time.Duration, t *time.Time) {
+		r.mu.Lock()
+		*d += since(*t)
+		*t = time.Time{}
+		r.mu.Unlock()
+	}
+	return &ClientTrace{
+		DNSStart:          func(string) { mark(&r.dns) },
+		DNSDone:           func([]net.IPAddr, error) { add(&r.timing.DNS, &r.dns) },
+		ConnectStart:      func(string, string) { mark(&r.connect) },
+		ConnectDone:       func(string, string, error) { add(&r.timing.Connect, &r.connect) },
+		ProxyConnectStart: func(string, string) { mark(&r.proxy) },
+		ProxyConnectDone:  func(string, string, error) { add(&r.timing.ProxyConnect, &r.proxy) },
+		TLSHandshakeStart: func(string) { mark(&r.tls) },
+		TLSHandshakeDone:  func(*TLSInfo, error) { add(&r.timing.TLSHandshake, &r.tls) },
+		GotConn: func(_ string, reused bool) {
+			r.mu.Lock()
+			r.timing.ConnReused = reused
+			r.mu.Unlock()
+		},
+		WroteRequest:         func(error) { mark(&r.wrote) },
+		GotFirstResponseByte: func() { add(&r.timing.WaitFirstByte, &r.wrote) },
+	}
+}
+
+// result 返回到目前为止的耗时
+func (r *timingRecorder) result() *Timing {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	timing := r.timing
+	timing.Total = time.Since(r.start)
+	return &timing
+}
+
+// ComposeTrace 返回依次调用 a 和 b 回调的 ClientTrace，a 或 b 为 nil 时返回另一个
+func ComposeTrace(a, b *ClientTrace) *ClientTrace {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return &ClientTrace{
+		DNSStart: func(host string) {
+			if a.DNSStart != nil {
+				a.DNSStart(host)
+			}
+			if b.DNSStart != nil {
+				b.DNSStart(host)
+			}
+		},
+		DNSDone: func(addrs []net.IPAddr, err error) {
+			if a.DNSDone != nil {
+				a.DNSDone(addrs, err)
+			}
+			if b.DNSDone != nil {
+				b.DNSDone(addrs, err)
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			if a.ConnectStart != nil {
+				a.ConnectStart(network, addr)
+			}
+			if b.ConnectStart != nil {
+				b.ConnectStart(network, addr)
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if a.ConnectDone != nil {
+				a.ConnectDone(network, addr, err)
+			}
+			if b.ConnectDone != nil {
+				b.ConnectDone(network, addr, err)
+			}
+		},
+		ProxyConnectStart: func(proxyURL, target string) {
+			if a.ProxyConnectStart != nil {
+				a.ProxyConnectStart(proxyURL, target)
+			}
+			if b.ProxyConnectStart != nil {
+				b.ProxyConnectStart(proxyURL, target)
+			}
+		},
+		ProxyConnectDone: func(proxyURL, target string, err error) {
+			if a.ProxyConnectDone != nil {
+				a.ProxyConnectDone(proxyURL, target, err)
+			}
+			if b.ProxyConnectDone != nil {
+				b.ProxyConnectDone(proxyURL, target, err)
+			}
+		},
+		TLSHandshakeStart: func(serverName string) {
+			if a.TLSHandshakeStart != nil {
+				a.TLSHandshakeStart(serverName)
+			}
+			if b.TLSHandshakeStart != nil {
+				b.TLSHandshakeStart(serverName)
+			}
+		},
+		TLSHandshakeDone: func(info *TLSInfo, err error) {
+			if a.TLSHandshakeDone != nil {
+				a.TLSHandshakeDone(info, err)
+			}
+			if b.TLSHandshakeDone != nil {
+				b.TLSHandshakeDone(info, err)
+			}
+		},
+		GotConn: func(remoteAddr string, reused bool) {
+			if a.GotConn != nil {
+				a.GotConn(remoteAddr, reused)
+			}
+			if b.GotConn != nil {
+				b.GotConn(remoteAddr, reused)
+			}
+		},
+		WroteRequest: func(err error) {
+			if a.WroteRequest != nil {
+				a.WroteRequest(err)
+			}
+			if b.WroteRequest != nil {
+				b.WroteRequest(err)
+			}
+		},
+		GotFirstResponseByte: func() {
+			if a.GotFirstResponseByte != nil {
+				a.GotFirstResponseByte()
+			}
+			if b.GotFirstResponseByte != nil {
+				b.GotFirstResponseByte()
+			}
+		},
+	}
+}
+
+// tlsHandshakeStart 和下面的方法在 trace 为 nil 或回调为空时什么都不做
+func (t *ClientTrace) tlsHandshakeStart(serverName string) {
+	if t != nil && t.TLSHandshakeStart != nil {
+		t.TLSHandshakeStart(serverName)
+	}
+}
+
+func (t *ClientTrace) tlsHandshakeDone(info *TLSInfo, err error) {
+	if t != nil && t.TLSHandshakeDone != nil {
+		t.TLSHandshakeDone(info, err)
+	}
+}
+
+func (t *ClientTrace) gotConn(remoteAddr string, reused bool) {
+	if t != nil && t.GotConn != nil {
+		t.GotConn(remoteAddr, reused)
+	}
+}
+
+func (t *ClientTrace) gotFirstResponseByte() {
+	if t != nil && t.GotFirstResponseByte != nil {
+		t.GotFirstResponseByte()
+	}
+}
+
+// netTrace 返回触发 DNS 和 TCP 连接回调的 net/http/httptrace.ClientTrace，net.Dialer 会调用它们
+func (t *ClientTrace) netTrace() *stdhttptrace.ClientTrace {
+	return &stdhttptrace.ClientTrace{
+		DNSStart: func(info stdhttptrace.DNSStartInfo) {
+			if t.DNSStart != nil {
+				t.DNSStart(info.Host)
+			}
+		},
+		DNSDone: func(info stdhttptrace.DNSDoneInfo) {
+			if t.DNSDone != nil {
+				t.DNSDone(info.Addrs, info.Err)
+			}
+		},
+		ConnectStart: t.ConnectStart,
+		ConnectDone:  t.ConnectDone,
+	}
+}
+
+// requestTrace 返回 fhttp 传输层使用的 httptrace.ClientTrace，触发连接获取、请求写完和首字节回调
+func (t *ClientTrace) requestTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Conn != nil {
+				t.gotConn(info.Conn.RemoteAddr().String(), info.Reused)
+			}
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if t.WroteRequest != nil {
+				t.WroteRequest(info.Err)
+			}
+		},
+		GotFirstResponseByte: t.gotFirstResponseByte,
+	}
+}
+
+// stdRequestTrace 返回标准库传输层使用的 ClientTrace，包括标准库 TLS 握手的回调
+func (t *ClientTrace) stdRequestTrace() *stdhttptrace.ClientTrace {
+	return &stdhttptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			t.tlsHandshakeStart("")
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			t.tlsHandshakeDone(tlsInfoFromStd(&state), err)
+		},
+		GotConn: func(info stdhttptrace.GotConnInfo) {
+			if info.Conn != nil {
+				t.gotConn(info.Conn.RemoteAddr().String(), info.Reused)
+			}
+		},
+		WroteRequest: func(info stdhttptrace.WroteRequestInfo) {
+			if t.WroteRequest != nil {
+				t.WroteRequest(info.Err)
+			}
+		},
+		GotFirstResponseByte: t.gotFirstResponseByte,
+	}
+}
+
+// traceDialer 触发 DNS、TCP 连接和代理隧道的回调
+type traceDialer struct {
+	trace    *ClientTrace
+	dialer   proxy.ContextDialer
+	proxyURL string
+}
+
+// withTrace trace 不为空时为 dialer 加上回调
+func withTrace(trace *ClientTrace, dialer proxy.ContextDialer, proxyURL string) proxy.ContextDialer {
+	if trace == nil {
+		return dialer
+	}
+	// 回调中不暴露代理的用户名和密码
+	if u, err := url.Parse(proxyURL); err == nil && proxyURL != "" {
+		proxyURL = u.Redacted()
+	}
+	return &traceDialer{trace: trace, dialer: dialer, proxyURL: proxyURL}
+}
+
+func (d *traceDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *traceDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	ctx = stdhttptrace.WithClientTrace(ctx, d.trace.netTrace())
+	if d.proxyURL == "" {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+	if d.trace.ProxyConnectStart != nil {
+		d.trace.ProxyConnectStart(d.proxyURL, addr)
+	}
+	conn, err := d.dialer.DialContext(ctx, network, addr)
+	if d.trace.ProxyConnectDone != nil {
+		d.trace.ProxyConnectDone(d.proxyURL, addr, err)
+	}
+	return conn, err
+}
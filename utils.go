@@ -2,8 +2,6 @@ package fastls
 
 import (
 	"bytes"
-	"compress/gzip"
-	"compress/zlib"
 	"crypto/sha256"
 	"crypto/tls"
 	"encoding/base64"
@@ -11,11 +9,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/textproto"
 	"strconv"
 	"strings"
 
-	"github.com/andybalholm/brotli"
-	"github.com/klauspost/compress/zstd"
+	http "github.com/FastTLS/fhttp"
 	utls "github.com/refraction-networking/utls"
 )
 
@@ -38,34 +36,18 @@ func parseUserAgent(userAgent string) string {
 	return other
 }
 
-// DecompressBody 解压缩响应体数据
+// DecompressBody 解压缩响应体数据，支持多层编码，解压失败时返回原始数据
+//
+// Do 已经按请求的 Accept-Encoding 自动解压响应体，只有设置了 Options.RawBody 时才需要调用
 func DecompressBody(Body []byte, encoding []string, content []string) (parsedBody string) {
-	if len(encoding) > 0 {
-		if encoding[0] == "gzip" {
-			unz, err := gUnzipData(Body)
-			if err != nil {
-				return string(Body)
-			}
-			return string(unz)
-		} else if encoding[0] == "deflate" {
-			unz, err := enflateData(Body)
-			if err != nil {
-				return string(Body)
-			}
-			return string(unz)
-		} else if encoding[0] == "br" {
-			unz, err := unBrotliData(Body)
-			if err != nil {
-				return string(Body)
-			}
-			return string(unz)
-		} else if encoding[0] == "zstd" {
-			unz, err := unZstdData(Body)
-			if err != nil {
-				return string(Body)
-			}
-			return string(unz)
+	header := http.Header{"Content-Encoding": encoding}
+	if encodings := contentEncodings(header); len(encodings) > 0 {
+		body := &decodedBody{raw: io.NopCloser(bytes.NewReader(Body)), encodings: encodings, remaining: -1}
+		unz, err := io.ReadAll(body)
+		if err != nil {
+			return string(Body)
 		}
+		return string(unz)
 	} else if len(content) > 0 {
 		decodingTypes := map[string]bool{
 			"image/svg+xml":   true,
@@ -84,39 +66,6 @@ func DecompressBody(Body []byte, encoding []string, content []string) (parsedBod
 	return parsedBody
 }
 
-func gUnzipData(data []byte) (resData []byte, err error) {
-	gz, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return []byte{}, err
-	}
-	defer gz.Close()
-	respBody, err := io.ReadAll(gz)
-	return respBody, err
-}
-func enflateData(data []byte) (resData []byte, err error) {
-	zr, err := zlib.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return []byte{}, err
-	}
-	defer zr.Close()
-	enflated, err := io.ReadAll(zr)
-	return enflated, err
-}
-func unBrotliData(data []byte) (resData []byte, err error) {
-	br := brotli.NewReader(bytes.NewReader(data))
-	respBody, err := io.ReadAll(br)
-	return respBody, err
-}
-
-func unZstdData(data []byte) ([]byte, error) {
-	dec, err := zstd.NewReader(nil)
-	if err != nil {
-		return nil, err
-	}
-	defer dec.Close()
-	return dec.DecodeAll(data, nil)
-}
-
 // StringToSpec 将指纹字符串转换为 uTLS ClientHelloSpec
 func StringToSpec(fingerprint string, userAgent string) (*utls.ClientHelloSpec, error) {
 	// 检查是否为 JA4R 格式: t13d<num>_<cipher_suites>_<extensions>_<signature_algorithms>
@@ -378,3 +327,45 @@ func ConvertUtlsConfig(utlsConfig *utls.Config) *tls.Config {
 		MaxVersion:         utlsConfig.MaxVersion,
 	}
 }
+
+// setRawHeader 按原样的大小写设置请求头，HTTP/1.1 会以该大小写写出；
+// 大小写不同的同名请求头会被替换
+func setRawHeader(h map[string][]string, key string, values ...string) {
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			delete(h, k)
+		}
+	}
+	h[key] = values
+}
+
+// setHeaderKeepCase 设置请求头的值，已存在时沿用调用方设置的大小写，否则使用规范形式
+func setHeaderKeepCase(h map[string][]string, key, value string) {
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			setRawHeader(h, k, value)
+			return
+		}
+	}
+	h[textproto.CanonicalMIMEHeaderKey(key)] = []string{value}
+}
+
+// canonicalizeHeader 将大小写不同的同名请求头合并为规范形式，供只识别规范形式的标准库方法（如 AddCookie）使用
+func canonicalizeHeader(h map[string][]string, key string) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	for k, v := range h {
+		if k != key && strings.EqualFold(k, key) {
+			delete(h, k)
+			h[key] = append(h[key], v...)
+		}
+	}
+}
+
+// lowerStrings 返回全部转为小写的副本，fhttp 按小写名称匹配请求头顺序
+func lowerStrings(list []string) []string {
+	lowered := make([]string, len(list))
+	for i, s := range list {
+		lowered[i] = strings.ToLower(s)
+	}
+	return lowered
+}
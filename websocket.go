@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/proxy"
 )
 
 // WebSocketClient represents a client for WebSocket connections
@@ -29,6 +31,9 @@ type WebSocketClient struct {
 
 	// UserAgent for TLS fingerprinting
 	UserAgent string
+
+	// Logger for connection events, slog.Default() if nil
+	Logger *slog.Logger
 }
 
 // NewWebSocketClientWithOptions creates a new WebSocket client from Options
@@ -41,23 +46,96 @@ func NewWebSocketClientWithOptions(options Options) *WebSocketClient {
 	if options.UserAgent != "" {
 		headers.Set("User-Agent", options.UserAgent)
 	}
-	return NewWebSocketClient(options.Fingerprint, options.UserAgent, headers)
+	wsc := newWebSocketClient(options.Fingerprint, options.UserAgent, headers, optionsDialContext(&options))
+	wsc.Logger = options.Logger
+	return wsc
 }
 
 // NewWebSocketClient creates a new WebSocket client with TLS fingerprinting support
 // If fingerprint is nil or empty, it will use standard TLS
+// Proxies are selected from the environment like ProxyFromEnvironment
 func NewWebSocketClient(fingerprint Fingerprint, userAgent string, headers http.Header) *WebSocketClient {
+	selector := newSelectDialer(ProxyFromEnvironment(), userAgent, browser{ProxyFingerprint: fingerprint}, wsNetDialer())
+	return newWebSocketClient(fingerprint, userAgent, headers, selector.DialContext)
+}
+
+// wsNetDialer returns the dialer used for WebSocket TCP connections
+func wsNetDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+}
+
+// optionsDialContext returns a dial function honoring the proxy, resolver and source address settings of options.
+// Invalid proxy or source address settings make every dial fail instead of silently connecting directly.
+func optionsDialContext(options *Options) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	failed := func(err error) func(context.Context, string, string) (net.Conn, error) {
+		return func(context.Context, string, string) (net.Conn, error) {
+			return nil, err
+		}
+	}
+	source, err := newSourceAddr(options)
+	if err != nil {
+		return failed(err)
+	}
+	var forward proxy.ContextDialer = wsNetDialer()
+	if options.Resolver != nil || source != nil {
+		resolver := options.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		forward = &resolvingDialer{resolver: resolver, source: source, dialer: *wsNetDialer()}
+	}
+
+	browser := browser{
+		Resolver:           options.Resolver,
+		Source:             source,
+		Logger:             options.Logger,
+		ProxyFingerprint:   options.ProxyFingerprint,
+		ProxyHTTP2Settings: options.ProxyHTTP2Settings,
+		ProxyDialTLS:       options.ProxyDialTLS,
+		ProxyHeaders:       options.ProxyHeaders,
+		ProxyChain:         options.ProxyChain,
+		ProxyHopTimeout:    time.Duration(options.ProxyHopTimeout) * time.Millisecond,
+	}
+	if browser.ProxyFingerprint == nil {
+		browser.ProxyFingerprint = options.Fingerprint
+	}
+	if browser.ProxyHTTP2Settings == nil {
+		browser.ProxyHTTP2Settings = options.HTTP2Settings
+	}
+	forward, err = proxyForward(browser, options.UserAgent, forward)
+	if err != nil {
+		return failed(err)
+	}
+	switch {
+	case options.Proxy != "":
+		dialer, err := newConnectDialer(options.Proxy, options.UserAgent, browser, forward)
+		if err != nil {
+			return failed(err)
+		}
+		return dialer.DialContext
+	case options.ProxyFunc != nil:
+		return newSelectDialer(options.ProxyFunc, options.UserAgent, browser, forward).DialContext
+	}
+	return forward.DialContext
+}
+
+// newWebSocketClient creates a WebSocket client whose TCP connections are made by dialContext
+func newWebSocketClient(fingerprint Fingerprint, userAgent string, headers http.Header, dialContext func(ctx context.Context, network, addr string) (net.Conn, error)) *WebSocketClient {
+
 	// Create custom dialer for TLS fingerprinting
-	var dialTLS func(network, addr string) (net.Conn, error)
+	var dialTLS func(ctx context.Context, network, addr string) (net.Conn, error)
 	if fingerprint != nil && !fingerprint.IsEmpty() {
 		// Use uTLS for fingerprinting
-		dialTLS = func(network, addr string) (net.Conn, error) {
+		dialTLS = func(ctx context.Context, network, addr string) (net.Conn, error) {
 			host, _, err := net.SplitHostPort(addr)
 			if err != nil {
 				host = addr
 			}
 
-			rawConn, err := net.DialTimeout(network, addr, 30*time.Second)
+			rawConn, err := dialContext(ctx, network, addr)
 			if err != nil {
 				return nil, err
 			}
@@ -114,13 +192,13 @@ func NewWebSocketClient(fingerprint Fingerprint, userAgent string, headers http.
 		}
 	} else {
 		// Use standard TLS
-		dialTLS = func(network, addr string) (net.Conn, error) {
+		dialTLS = func(ctx context.Context, network, addr string) (net.Conn, error) {
 			host, _, err := net.SplitHostPort(addr)
 			if err != nil {
 				host = addr
 			}
 
-			rawConn, err := net.DialTimeout(network, addr, 30*time.Second)
+			rawConn, err := dialContext(ctx, network, addr)
 			if err != nil {
 				return nil, err
 			}
@@ -147,30 +225,23 @@ func NewWebSocketClient(fingerprint Fingerprint, userAgent string, headers http.
 		}
 	}
 
+	// Proxies are handled by dialContext so that the TLS fingerprint is kept through the tunnel
 	dialer := &websocket.Dialer{
-		Proxy:            http.ProxyFromEnvironment,
-		HandshakeTimeout: 45 * time.Second,
-		NetDialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return dialTLS(network, addr)
-		},
+		HandshakeTimeout:  45 * time.Second,
+		NetDialContext:    dialContext,
+		NetDialTLSContext: dialTLS,
 	}
 
 	// Create HTTP client for WebSocket handshake
 	// 禁用 HTTP/2，WebSocket 只支持 HTTP/1.1
 	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		DialContext:           dialContext,
 		MaxIdleConns:          100,
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 		ForceAttemptHTTP2:     false, // 禁用 HTTP/2
-		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return dialTLS(network, addr)
-		},
+		DialTLSContext:        dialTLS,
 	}
 
 	client := &http.Client{
@@ -217,10 +288,17 @@ func (wsc *WebSocketClient) Connect(urlStr string) (*websocket.Conn, *http.Respo
 	}
 
 	// Connect to the WebSocket server
-	conn, resp, err := wsc.Dialer.Dial(wsURL.String(), wsc.Headers)
+	logger := wsc.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = withRequest(logger, u.Host, wsc.UserAgent, wsc.Fingerprint)
+	conn, resp, err := wsc.Dialer.DialContext(withRequestURL(context.Background(), &wsURL), wsURL.String(), wsc.Headers)
 	if err != nil {
+		logger.Warn("websocket connect failed", slog.String("phase", phaseWS), slog.String("scheme", scheme), slog.Any("error", err))
 		return nil, resp, err
 	}
+	logger.Debug("websocket connected", slog.String("phase", phaseWS), slog.String("scheme", scheme), slog.String("protocol", "http/1.1"))
 
 	return conn, resp, nil
 }